@@ -0,0 +1,198 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"web_app/dao/mysql"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Record 一条审计记录
+type Record struct {
+	Time       time.Time `json:"time" db:"created_at"`
+	UserID     string    `json:"user_id" db:"user_id"`
+	Method     string    `json:"method" db:"method"`
+	Route      string    `json:"route" db:"route"` // 注册路由时的路径，例如 /api/v1/post/:id
+	Path       string    `json:"path" db:"path"`
+	ResourceID string    `json:"resource_id" db:"resource_id"`
+	Status     int       `json:"status" db:"status"`
+	IP         string    `json:"ip" db:"ip"`
+	RequestID  string    `json:"request_id" db:"request_id"`
+}
+
+var (
+	enabled bool
+	methods map[string]bool
+	skip    map[string]bool
+	params  []string
+
+	// fileLogger 审计日志文件，每条记录一行 JSON
+	fileLogger *zap.Logger
+
+	// table 不为空时审计记录由后台 goroutine 写入 MySQL 的这张表，队列满时丢弃并记录错误日志
+	table   string
+	records chan Record
+	wg      sync.WaitGroup
+)
+
+// tablePattern 表名只能包含字母、数字和下划线，避免拼接 SQL 时被注入
+var tablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Init 根据配置初始化审计日志，audit.enable 为 false 时不启用；audit.mutations.enable 为 true 时同时记录数据变更
+// 写入 MySQL 时需要在 mysql.Init 之后调用，表结构见 dao/mysql/migrations/<driver>/00001_create_audit_log.sql、00002_create_audit_events.sql
+func Init(cfg *settings.AuditConfig) (err error) {
+	if cfg.Mutations.Enable {
+		if err = initMutations(&cfg.Mutations); err != nil {
+			return
+		}
+	}
+	if !cfg.Enable {
+		return
+	}
+	if cfg.Table != "" {
+		if !tablePattern.MatchString(cfg.Table) {
+			return fmt.Errorf("invalid audit table name %q", cfg.Table)
+		}
+		if mysql.Default() == nil {
+			return fmt.Errorf("audit table %s requires mysql to be initialized", cfg.Table)
+		}
+		table = cfg.Table
+		records = make(chan Record, 1000)
+		wg.Add(1)
+		go saveRecords()
+	}
+
+	methods = make(map[string]bool)
+	for _, m := range cfg.Methods {
+		methods[m] = true
+	}
+	if len(methods) == 0 {
+		for _, m := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			methods[m] = true
+		}
+	}
+	skip = make(map[string]bool, len(cfg.SkipPaths))
+	for _, p := range cfg.SkipPaths {
+		skip[p] = true
+	}
+	params = cfg.ResourceParams
+	if len(params) == 0 {
+		params = []string{"id"}
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	encoderConfig.LevelKey = ""
+	encoderConfig.CallerKey = ""
+	encoderConfig.MessageKey = ""
+	ws := logger.NewFileWriter(cfg.Filename, cfg.Rotation, cfg.MaxSize, cfg.MaxBackups, cfg.MaxAge)
+	logger.AddArchiveFile(cfg.Filename)
+	fileLogger = zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), ws, zapcore.InfoLevel))
+	enabled = true
+	return
+}
+
+// Close 写入队列中剩余的审计记录和数据变更记录
+func Close() {
+	closeMutations()
+	if !enabled {
+		return
+	}
+	if records != nil {
+		close(records)
+		wg.Wait()
+	}
+	_ = fileLogger.Sync()
+}
+
+// Middleware 请求处理完成后为 audit.methods 中的请求写入审计记录
+// 用户 ID 取自认证中间件保存的 logger.UserIDKey（logger.User），需要放在认证中间件之前注册（在 c.Next 之后读取）
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if !enabled || !methods[c.Request.Method] {
+			return
+		}
+		route := c.FullPath()
+		if route == "" || skip[route] {
+			// 没有匹配到路由的请求不审计
+			return
+		}
+		r := Record{
+			Time:      time.Now(),
+			Method:    c.Request.Method,
+			Route:     route,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			IP:        c.ClientIP(),
+			RequestID: c.GetString(logger.RequestIDKey),
+		}
+		if id, _ := logger.User(c); id != nil {
+			r.UserID = fmt.Sprint(id)
+		}
+		for _, p := range params {
+			if v := c.Param(p); v != "" {
+				r.ResourceID = v
+				break
+			}
+		}
+		Write(c.Request.Context(), r)
+	}
+}
+
+// Write 写入一条审计记录，业务代码中也可以直接调用，例如记录批量操作中的每一个资源
+func Write(ctx context.Context, r Record) {
+	if !enabled {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.RequestID == "" {
+		r.RequestID = logger.RequestID(ctx)
+	}
+	fileLogger.Info("",
+		zap.String("time", r.Time.Format(time.RFC3339Nano)),
+		zap.String("user_id", r.UserID),
+		zap.String("method", r.Method),
+		zap.String("route", r.Route),
+		zap.String("path", r.Path),
+		zap.String("resource_id", r.ResourceID),
+		zap.Int("status", r.Status),
+		zap.String("ip", r.IP),
+		zap.String("request_id", r.RequestID),
+	)
+	if records == nil {
+		return
+	}
+	select {
+	case records <- r:
+	default:
+		logger.Named("audit").Error("audit queue is full, record not saved to mysql",
+			zap.String("route", r.Route), zap.String("user_id", r.UserID), zap.String("request_id", r.RequestID))
+	}
+}
+
+// saveRecords 把队列中的审计记录写入 MySQL，写入失败的记录仍然保存在审计日志文件中
+func saveRecords() {
+	defer wg.Done()
+	query := "INSERT INTO " + table + " (created_at, user_id, method, route, path, resource_id, status, ip, request_id) " +
+		"VALUES (:created_at, :user_id, :method, :route, :path, :resource_id, :status, :ip, :request_id)"
+	for r := range records {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := mysql.Default().NamedExecContext(ctx, query, r); err != nil {
+			logger.Named("audit").Error("save audit record failed", zap.String("request_id", r.RequestID), zap.Error(err))
+		}
+		cancel()
+	}
+}
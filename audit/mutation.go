@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"web_app/dao/mysql"
+	"web_app/logger"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+)
+
+// Event 一条数据变更记录，Before、After 为写入前后的记录序列化后的 JSON，模型中 json:"-" 的字段（例如密码）不会记录
+type Event struct {
+	Time      time.Time      `db:"created_at"`
+	Table     string         `db:"table_name"`
+	RecordID  string         `db:"record_id"`
+	Action    string         `db:"action"`
+	UserID    string         `db:"user_id"`
+	RequestID string         `db:"request_id"`
+	Before    sql.NullString `db:"before_data"`
+	After     sql.NullString `db:"after_data"`
+}
+
+var (
+	// eventTable 数据变更记录的表，events 为写入队列，队列满时丢弃并记录错误日志
+	eventTable string
+	events     chan Event
+	eventsMu   sync.RWMutex
+	eventsWG   sync.WaitGroup
+)
+
+// initMutations 按 audit.mutations 注册 mysql.Repository 的写入回调，需要在 mysql.Init 之后调用
+func initMutations(cfg *settings.AuditMutationsConfig) (err error) {
+	if !tablePattern.MatchString(cfg.Table) {
+		return fmt.Errorf("invalid audit mutations table name %q", cfg.Table)
+	}
+	if mysql.Default() == nil {
+		return fmt.Errorf("audit mutations table %s requires mysql to be initialized", cfg.Table)
+	}
+	eventTable = cfg.Table
+	events = make(chan Event, 1000)
+	eventsWG.Add(1)
+	go saveEvents(events)
+	mysql.SetMutationHook(onMutation, cfg.Tables...)
+	return
+}
+
+// closeMutations 取消写入回调，并写入队列中剩余的记录
+func closeMutations() {
+	if events == nil {
+		return
+	}
+	mysql.SetMutationHook(nil)
+	eventsMu.Lock()
+	close(events)
+	events = nil
+	eventsMu.Unlock()
+	eventsWG.Wait()
+}
+
+// onMutation 在写入（或者事务提交）后调用，操作人取自 ctx 中的用户 ID（logger.WithUser 或者认证中间件保存的 logger.UserIDKey）
+func onMutation(ctx context.Context, m mysql.Mutation) {
+	e := Event{
+		Time:      time.Now(),
+		Table:     m.Table,
+		RecordID:  fmt.Sprint(m.ID),
+		Action:    m.Action,
+		RequestID: logger.RequestID(ctx),
+		Before:    snapshotJSON(m.Before),
+		After:     snapshotJSON(m.After),
+	}
+	if id, _ := logger.User(ctx); id != nil {
+		e.UserID = fmt.Sprint(id)
+	}
+	eventsMu.RLock()
+	defer eventsMu.RUnlock()
+	if events == nil {
+		return
+	}
+	select {
+	case events <- e:
+	default:
+		logger.Named("audit").Error("audit mutation queue is full, event dropped",
+			zap.String("table", e.Table), zap.String("record_id", e.RecordID), zap.String("action", e.Action),
+			zap.String("request_id", e.RequestID))
+	}
+}
+
+func snapshotJSON(v interface{}) sql.NullString {
+	if v == nil {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger.Named("audit").Error("marshal audit mutation snapshot failed", zap.Error(err))
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+// saveEvents 把队列中的数据变更记录写入 MySQL
+func saveEvents(events <-chan Event) {
+	defer eventsWG.Done()
+	query := "INSERT INTO " + eventTable + " (created_at, table_name, record_id, action, user_id, request_id, before_data, after_data) " +
+		"VALUES (:created_at, :table_name, :record_id, :action, :user_id, :request_id, :before_data, :after_data)"
+	for e := range events {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := mysql.Default().NamedExecContext(ctx, query, e); err != nil {
+			logger.Named("audit").Error("save audit mutation failed",
+				zap.String("table", e.Table), zap.String("record_id", e.RecordID), zap.String("request_id", e.RequestID), zap.Error(err))
+		}
+		cancel()
+	}
+}
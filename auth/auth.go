@@ -0,0 +1,155 @@
+// Package auth 基于 JWT 的登录认证：POST /api/v1/login 用用户名和密码换取访问令牌和刷新令牌，
+// POST /api/v1/refresh 用刷新令牌换取新的一对令牌（旧的刷新令牌随之失效），Middleware 校验访问令牌并保存用户 ID；
+// 每次登录的令牌属于一个 family，保存在 Redis 中，退出登录、修改密码（RevokeUser）或者发现刷新令牌被重复使用时撤销
+//
+//	func init() {
+//		auth.SetAuthenticator(func(ctx context.Context, username, password string) (string, error) {
+//			u, err := users.GetByName(ctx, username)
+//			if errors.Is(err, sql.ErrNoRows) || (err == nil && !auth.CheckPassword(u.PasswordHash, password)) {
+//				return "", auth.ErrInvalidCredentials
+//			}
+//			return strconv.FormatInt(u.ID, 10), err
+//		})
+//		routes.RegisterAPI("v1", "post", routes.RegistrarFunc(func(r gin.IRouter) error {
+//			g := r.Group("/posts", auth.Middleware())
+//			g.POST("", createPost) // auth.UserID(c) 为当前用户
+//			return nil
+//		}))
+//	}
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"web_app/logger"
+	"web_app/pkg/jwt"
+	"web_app/response"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Config 认证配置，对应配置文件中的 auth
+type Config struct {
+	// Enable 为 false 时登录、刷新接口返回 404，Middleware 拒绝所有请求
+	Enable bool       `mapstructure:"enable"`
+	JWT    jwt.Config `mapstructure:"jwt"`
+}
+
+// 配置文件中的 key
+const configKey = "auth"
+
+// 响应中的错误码
+var (
+	CodeUnauthorized       = response.NewCode("unauthorized", http.StatusUnauthorized, "unauthorized")
+	CodeTokenExpired       = response.NewCode("token_expired", http.StatusUnauthorized, "token expired")
+	CodeInvalidCredentials = response.NewCode("invalid_credentials", http.StatusUnauthorized, ErrInvalidCredentials.Error())
+	// CodeAuthUnavailable Redis 不可用，无法确认令牌是否已经撤销
+	CodeAuthUnavailable = response.NewCode("auth_unavailable", http.StatusServiceUnavailable, "authentication is unavailable")
+)
+
+// familyKeyCtx gin.Context 中保存访问令牌的 family 的 key
+const familyKeyCtx = "web_app/auth.family"
+
+// manager 启用时为当前配置的 jwt.Manager，没有启用时为 nil
+var manager atomic.Pointer[jwt.Manager]
+
+func init() {
+	settings.Register(configKey, Config{JWT: jwt.Config{
+		Algorithm:  jwt.AlgorithmHS256,
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 7 * 24 * time.Hour,
+	}})
+}
+
+// Init 读取认证配置，并在配置热加载时更新密钥和有效期
+func Init() (err error) {
+	if err = load(); err != nil {
+		return
+	}
+	settings.OnChange(func(settings.Config) {
+		if err := load(); err != nil {
+			logger.Named("auth").Error("reload auth config failed", zap.Error(err))
+		}
+	})
+	return
+}
+
+func load() error {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil {
+		return err
+	}
+	if !cfg.Enable {
+		manager.Store(nil)
+		return nil
+	}
+	m, err := jwt.New(cfg.JWT)
+	if err != nil {
+		return err
+	}
+	manager.Store(m)
+	return nil
+}
+
+// Middleware 校验 Authorization: Bearer <access token> 和令牌所属的登录没有被撤销，通过后把用户 ID 保存为 logger.UserIDKey，
+// 访问日志、审计记录等都会带上；没有令牌、令牌无效或者已撤销时返回 401，过期时错误码为 token_expired，客户端据此刷新令牌；
+// Redis 不可用时返回 503
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m := manager.Load()
+		if m == nil {
+			abortUnauthorized(c, errors.New("authentication is not enabled"))
+			return
+		}
+		token, ok := bearerToken(c)
+		if !ok {
+			abortUnauthorized(c, errors.New("missing bearer token"))
+			return
+		}
+		claims, err := m.Parse(token, jwt.TypeAccess)
+		if err != nil {
+			abortUnauthorized(c, err)
+			return
+		}
+		if err = checkFamily(c.Request.Context(), claims); errors.Is(err, ErrRevoked) {
+			abortUnauthorized(c, err)
+			return
+		} else if err != nil {
+			logger.FromContext(c).Error("check token revocation failed", zap.Error(err))
+			response.Error(c, CodeAuthUnavailable)
+			return
+		}
+		c.Set(logger.UserIDKey, claims.Subject)
+		c.Set(familyKeyCtx, claims.Family)
+		c.Request = c.Request.WithContext(logger.WithUser(c.Request.Context(), claims.Subject, nil))
+		c.Next()
+	}
+}
+
+// UserID 返回 Middleware 保存的当前用户 ID，没有经过 Middleware 时为空
+func UserID(c *gin.Context) string {
+	return c.GetString(logger.UserIDKey)
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	h := c.GetHeader("Authorization")
+	if len(h) < len("Bearer ") || !strings.EqualFold(h[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(h[len("Bearer "):])
+	return token, token != ""
+}
+
+func abortUnauthorized(c *gin.Context, err error) {
+	code := CodeUnauthorized
+	if errors.Is(err, jwt.ErrExpired) {
+		code = CodeTokenExpired
+	}
+	c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	response.ErrorWithMsg(c, code, err.Error())
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"web_app/dao/mysql"
+	"web_app/logger"
+	"web_app/middlewares"
+	"web_app/pkg/jwt"
+	"web_app/response"
+	"web_app/routes"
+	"web_app/validation"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidCredentials Authenticator 在用户不存在或者密码错误时返回，登录接口响应 401，不区分两种情况
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Authenticator 校验用户名和密码，成功时返回用户 ID；数据库熔断时返回的 mysql.ErrUnavailable 响应 503，其他错误响应 500
+type Authenticator func(ctx context.Context, username, password string) (userID string, err error)
+
+var (
+	authMu        sync.RWMutex
+	authenticator Authenticator
+)
+
+func init() {
+	routes.RegisterAPI("v1", "auth", routes.RegistrarFunc(func(r gin.IRouter) error {
+		r.POST("/login", middlewares.RateLimit("login"), loginHandler)
+		r.POST("/refresh", refreshHandler)
+		r.POST("/logout", Middleware(), logoutHandler)
+		r.POST("/logout/all", Middleware(), logoutAllHandler)
+		return nil
+	}))
+}
+
+// SetAuthenticator 设置登录时校验用户名和密码的函数，一般在用户模块的 init 中调用；没有设置时登录接口返回 404
+func SetAuthenticator(a Authenticator) {
+	authMu.Lock()
+	defer authMu.Unlock()
+	authenticator = a
+}
+
+// loginHandler POST /api/v1/login {"username": "...", "password": "..."}，返回 jwt.TokenPair
+func loginHandler(c *gin.Context) {
+	authMu.RLock()
+	a := authenticator
+	authMu.RUnlock()
+	m := manager.Load()
+	if m == nil || a == nil {
+		response.Error(c, response.CodeNotFound)
+		return
+	}
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	userID, err := a(c.Request.Context(), req.Username, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		logger.FromContext(c).Info("login failed", zap.String("username", req.Username), zap.String("ip", c.ClientIP()))
+		response.Error(c, CodeInvalidCredentials)
+		return
+	}
+	if errors.Is(err, mysql.ErrUnavailable) || errors.Is(err, mysql.ErrReadOnly) {
+		// 由 middlewares.DBUnavailable 响应 503
+		_ = c.Error(err)
+		return
+	}
+	if err != nil {
+		logger.FromContext(c).Error("authenticate failed", zap.Error(err))
+		response.ErrorWithMsg(c, response.CodeServerBusy, "login failed")
+		return
+	}
+	family := jwt.NewFamily()
+	pair, err := m.Issue(userID, family)
+	if err == nil {
+		err = startFamily(c.Request.Context(), m, userID, family, pair)
+	}
+	respondTokens(c, pair, err)
+}
+
+// refreshHandler POST /api/v1/refresh {"refresh_token": "..."}，返回同一个 family 中新的 jwt.TokenPair；
+// 每个刷新令牌只能使用一次，重复使用时撤销整个 family 并返回 401
+func refreshHandler(c *gin.Context) {
+	m := manager.Load()
+	if m == nil {
+		response.Error(c, response.CodeNotFound)
+		return
+	}
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	claims, err := m.Parse(req.RefreshToken, jwt.TypeRefresh)
+	if err != nil {
+		abortUnauthorized(c, err)
+		return
+	}
+	pair, err := m.Issue(claims.Subject, claims.Family)
+	if err == nil {
+		err = rotateFamily(c.Request.Context(), m, claims, pair)
+	}
+	switch {
+	case errors.Is(err, ErrReused):
+		logger.FromContext(c).Warn("refresh token reused, family revoked", zap.String("user_id", claims.Subject),
+			zap.String("family", claims.Family), zap.String("ip", c.ClientIP()))
+		abortUnauthorized(c, err)
+	case errors.Is(err, ErrRevoked):
+		abortUnauthorized(c, err)
+	default:
+		respondTokens(c, pair, err)
+	}
+}
+
+// logoutHandler POST /api/v1/logout，撤销当前登录的刷新令牌和访问令牌
+func logoutHandler(c *gin.Context) {
+	if err := revokeFamily(c.Request.Context(), UserID(c), c.GetString(familyKeyCtx)); err != nil {
+		logger.FromContext(c).Error("revoke token failed", zap.Error(err))
+		response.ErrorWithMsg(c, response.CodeServerBusy, "logout failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// logoutAllHandler POST /api/v1/logout/all，撤销当前用户所有登录的令牌
+func logoutAllHandler(c *gin.Context) {
+	if err := RevokeUser(c.Request.Context(), UserID(c)); err != nil {
+		logger.FromContext(c).Error("revoke user tokens failed", zap.Error(err))
+		response.ErrorWithMsg(c, response.CodeServerBusy, "logout failed")
+		return
+	}
+	logger.FromContext(c).Info("user logged out everywhere")
+	c.Status(http.StatusNoContent)
+}
+
+// respondTokens err 为签发或者保存令牌的错误
+func respondTokens(c *gin.Context, pair *jwt.TokenPair, err error) {
+	if err != nil {
+		logger.FromContext(c).Error("issue token failed", zap.Error(err))
+		response.ErrorWithMsg(c, response.CodeServerBusy, "issue token failed")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	response.Success(c, pair)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"web_app/dao/redis"
+	"web_app/pkg/jwt"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// 每次登录（family）在 Redis 中保存最新的刷新令牌的 jti，用户的所有 family 保存在一个集合中，用于退出所有设备
+const (
+	familyPrefix     = "auth:family:"
+	userFamilyPrefix = "auth:user:families:"
+)
+
+// rotate.lua 的返回值
+const (
+	rotateRevoked = 0
+	rotateOK      = 1
+	rotateReused  = -1
+)
+
+var (
+	// ErrRevoked 令牌所属的登录已经退出、撤销或者过期
+	ErrRevoked = errors.New("token has been revoked")
+	// ErrReused 已经使用过的刷新令牌再次被使用，可能已经泄露，这次登录的所有令牌都被撤销
+	ErrReused = errors.New("refresh token has already been used")
+)
+
+var (
+	//go:embed scripts/rotate.lua
+	rotateLua    string
+	rotateScript = redis.RegisterScript("auth_rotate", rotateLua)
+)
+
+func familyKey(family string) string {
+	return redis.Key(familyPrefix + family)
+}
+
+func userFamilyKey(userID string) string {
+	return redis.Key(userFamilyPrefix + userID)
+}
+
+// startFamily 登录时保存新的 family
+func startFamily(ctx context.Context, m *jwt.Manager, userID, family string, pair *jwt.TokenPair) error {
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	ttl := m.RefreshTTL()
+	// family 和用户的集合可能不在同一个 slot，不使用事务
+	_, err := client.Pipelined(ctx, func(p goredis.Pipeliner) error {
+		p.Set(ctx, familyKey(family), pair.RefreshID, ttl)
+		p.SAdd(ctx, userFamilyKey(userID), family)
+		p.Expire(ctx, userFamilyKey(userID), ttl)
+		return nil
+	})
+	return err
+}
+
+// rotateFamily 刷新时把 family 中的 jti 替换为新的刷新令牌的 jti，刷新令牌已经被使用过时撤销整个 family 并返回 ErrReused
+func rotateFamily(ctx context.Context, m *jwt.Manager, claims *jwt.Claims, pair *jwt.TokenPair) error {
+	if claims.Family == "" {
+		return ErrRevoked
+	}
+	ttl := m.RefreshTTL()
+	n, err := rotateScript.Run(ctx, nil, []string{familyKey(claims.Family)}, claims.ID, pair.RefreshID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	switch n {
+	case rotateOK:
+		// 活跃的用户的集合不随最早的一次登录过期
+		return redis.Client().Expire(ctx, userFamilyKey(claims.Subject), ttl).Err()
+	case rotateReused:
+		return ErrReused
+	default:
+		return ErrRevoked
+	}
+}
+
+// checkFamily 访问令牌所属的登录没有被撤销时返回 nil
+func checkFamily(ctx context.Context, claims *jwt.Claims) error {
+	if claims.Family == "" {
+		return ErrRevoked
+	}
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	n, err := client.Exists(ctx, familyKey(claims.Family)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRevoked
+	}
+	return nil
+}
+
+// revokeFamily 撤销一次登录的刷新令牌和访问令牌，退出登录时调用
+func revokeFamily(ctx context.Context, userID, family string) error {
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	_, err := client.Pipelined(ctx, func(p goredis.Pipeliner) error {
+		p.Del(ctx, familyKey(family))
+		p.SRem(ctx, userFamilyKey(userID), family)
+		return nil
+	})
+	return err
+}
+
+// RevokeUser 撤销用户所有登录的令牌（退出所有设备），修改密码、禁用用户之后调用；
+// 已经签发的访问令牌在下一次请求时失效
+func RevokeUser(ctx context.Context, userID string) error {
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	families, err := client.SMembers(ctx, userFamilyKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	_, err = client.Pipelined(ctx, func(p goredis.Pipeliner) error {
+		for _, family := range families {
+			p.Del(ctx, familyKey(family))
+		}
+		p.Del(ctx, userFamilyKey(userID))
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,12 @@
+-- 刷新令牌轮换：family 中保存的是最新的刷新令牌的 jti，与 ARGV[1] 相同时替换为新的 jti 并返回 1；
+-- family 不存在（已撤销或过期）时返回 0；不同说明旧的刷新令牌被重复使用，删除 family 撤销这次登录的所有令牌并返回 -1
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return 0
+end
+if current ~= ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	return -1
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
@@ -0,0 +1,184 @@
+// Package cache 基于 Redis 的旁路缓存（cache-aside）：先读缓存，没有时调用 loader 从数据库加载并写入缓存
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// Config 缓存配置，对应配置文件中的 cache
+type Config struct {
+	// Prefix 缓存 key 的前缀
+	Prefix string `mapstructure:"prefix"`
+	// Jitter 过期时间的随机浮动比例，避免同时写入的 key 同时过期，0.1 表示 ttl 的 ±10%
+	Jitter float64 `mapstructure:"jitter" validate:"min=0,max=1"`
+	// NegativeTTL 不存在的记录（loader 返回 ErrNotFound）的缓存时间，避免反复查询不存在的 key 穿透到数据库，0 表示不缓存
+	NegativeTTL time.Duration `mapstructure:"negative_ttl" validate:"min=0"`
+	// WarmTimeout 启动时执行所有预热函数的总超时，0 表示不限制；WarmConcurrency 同时执行的预热函数数量
+	WarmTimeout     time.Duration `mapstructure:"warm_timeout" validate:"min=0"`
+	WarmConcurrency int           `mapstructure:"warm_concurrency" validate:"min=1"`
+}
+
+// 配置文件中的 key
+const configKey = "cache"
+
+var defaults = Config{Prefix: "cache:", Jitter: 0.1, NegativeTTL: 30 * time.Second, WarmTimeout: 30 * time.Second, WarmConcurrency: 4}
+
+// ErrNotFound 记录不存在，与 mysql.ErrNotFound 相同：loader 返回该错误时缓存一段时间（见 negative_ttl），
+// 之后的 GetOrLoad 直接返回该错误，不再调用 loader
+var ErrNotFound = mysql.ErrNotFound
+
+// negative 缓存中表示记录不存在的值，JSON 序列化的结果不会为空
+const negative = ""
+
+// requests 缓存的查询次数，result 为 hit、miss、negative（命中不存在的记录）或 error（Redis 不可用或者值无法解析）
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_requests_total",
+	Help: "Number of cache lookups by result (hit, miss, negative or error).",
+}, []string{"result"})
+
+var (
+	current atomic.Pointer[Config]
+	group   singleflight.Group
+)
+
+func init() {
+	settings.Register(configKey, defaults)
+}
+
+// Init 读取缓存配置，并在配置热加载时更新；没有调用时使用默认值
+func Init() (err error) {
+	if err = load(); err != nil {
+		return
+	}
+	settings.OnChange(func(settings.Config) {
+		if err := load(); err != nil {
+			logger.Named("cache").Error("reload cache config failed", zap.Error(err))
+		}
+	})
+	return
+}
+
+func load() error {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil {
+		return err
+	}
+	current.Store(cfg)
+	return nil
+}
+
+func config() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	return &defaults
+}
+
+// GetOrLoad 读取缓存中的 key，没有时调用 load 加载，并把结果序列化为 JSON 写入缓存，过期时间为 ttl 加上随机的浮动
+// 同一个进程中同一个 key 同时只有一个 load 在执行，其他请求等待并共用它的结果，避免热点 key 过期时大量请求同时查询数据库；
+// Redis 不可用时直接调用 load。load 使用第一个请求的 ctx，该请求取消时等待的请求也会返回错误
+//
+//	post, err := cache.GetOrLoad(ctx, "post:"+id, 10*time.Minute, func(ctx context.Context) (*Post, error) {
+//		return posts.Get(ctx, id)
+//	})
+func GetOrLoad[T any](ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) (T, error)) (v T, err error) {
+	cfg := config()
+	key = redis.Key(cfg.Prefix + key)
+	log := logger.Named("cache")
+	client := redis.Client()
+	if client != nil {
+		b, err := client.Get(ctx, key).Bytes()
+		switch {
+		case err == nil && string(b) == negative:
+			requests.WithLabelValues("negative").Inc()
+			return v, ErrNotFound
+		case err == nil:
+			if err = json.Unmarshal(b, &v); err == nil {
+				requests.WithLabelValues("hit").Inc()
+				return v, nil
+			}
+			// 模型的字段类型修改后旧的缓存可能无法解析，重新加载并覆盖
+			requests.WithLabelValues("error").Inc()
+			log.Warn("decode cached value failed", zap.String("key", key), zap.Error(err))
+		case errors.Is(err, goredis.Nil):
+			requests.WithLabelValues("miss").Inc()
+		default:
+			requests.WithLabelValues("error").Inc()
+			log.Warn("read cache failed", zap.String("key", key), zap.Error(err))
+			client = nil
+		}
+	}
+	// 不同类型的调用共用同一个 key 时不共用结果
+	res, err, _ := group.Do(fmt.Sprintf("%s|%T", key, v), func() (interface{}, error) {
+		v, err := load(ctx)
+		if client == nil {
+			return v, err
+		}
+		if errors.Is(err, ErrNotFound) {
+			if cfg.NegativeTTL > 0 {
+				if serr := client.Set(ctx, key, negative, jitter(cfg.NegativeTTL, cfg.Jitter)).Err(); serr != nil {
+					log.Warn("write cache failed", zap.String("key", key), zap.Error(serr))
+				}
+			}
+			return v, err
+		}
+		if err != nil {
+			return v, err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			log.Error("encode value for cache failed", zap.String("key", key), zap.Error(err))
+			return v, nil
+		}
+		if err = client.Set(ctx, key, b, jitter(ttl, cfg.Jitter)).Err(); err != nil {
+			log.Warn("write cache failed", zap.String("key", key), zap.Error(err))
+		}
+		return v, nil
+	})
+	if err != nil {
+		return v, err
+	}
+	// T 为接口类型并且 load 返回 nil 时断言失败，返回零值即可
+	v, _ = res.(T)
+	return v, nil
+}
+
+// Delete 删除缓存，更新或删除数据库中的记录之后调用，key 不包括 redis.key_prefix 和 cache.prefix
+func Delete(ctx context.Context, keys ...string) error {
+	client := redis.Client()
+	if client == nil || len(keys) == 0 {
+		return nil
+	}
+	prefix := redis.Key(config().Prefix)
+	// 逐个删除，cluster 中的 key 可能不在同一个 slot
+	for _, k := range keys {
+		if err := client.Del(ctx, prefix+k).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jitter 在 ttl 的基础上随机浮动 ±ratio
+func jitter(ttl time.Duration, ratio float64) time.Duration {
+	if ratio <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration((rand.Float64()*2-1)*ratio*float64(ttl))
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+	"web_app/logger"
+
+	"go.uber.org/zap"
+)
+
+// Warmer 预热函数，通常读取热点的配置数据并通过 GetOrLoad 或 redis.Set 写入缓存
+type Warmer func(ctx context.Context) error
+
+var (
+	warmersMu sync.Mutex
+	warmers   = make(map[string]Warmer)
+)
+
+// RegisterWarmer 注册名为 name 的预热函数，在 init 中调用，同名的会被覆盖；
+// 启动时 main 在开始接收请求之前调用 Warm 执行，避免冷启动时大量请求同时穿透到数据库
+//
+//	func init() {
+//		cache.RegisterWarmer("categories", func(ctx context.Context) error {
+//			_, err := cache.GetOrLoad(ctx, "categories", time.Hour, categories.List)
+//			return err
+//		})
+//	}
+func RegisterWarmer(name string, fn Warmer) {
+	warmersMu.Lock()
+	defer warmersMu.Unlock()
+	warmers[name] = fn
+}
+
+// Warm 执行所有注册的预热函数，最多同时执行 cache.warm_concurrency 个，总的超时为 cache.warm_timeout；
+// 返回所有失败的预热函数的错误，预热失败只是缓存没有数据，是否继续启动由调用方决定
+func Warm(ctx context.Context) error {
+	cfg := config()
+	warmersMu.Lock()
+	names := make([]string, 0, len(warmers))
+	for name := range warmers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fns := make([]Warmer, len(names))
+	for i, name := range names {
+		fns[i] = warmers[name]
+	}
+	warmersMu.Unlock()
+	if len(fns) == 0 {
+		return nil
+	}
+
+	if cfg.WarmTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.WarmTimeout)
+		defer cancel()
+	}
+	log := logger.Named("cache")
+	errs := make([]error, len(fns))
+	sem := make(chan struct{}, cfg.WarmConcurrency)
+	var wg sync.WaitGroup
+	for i := range fns {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			// 超时之后不再执行剩下的预热函数
+			errs[i] = fmt.Errorf("warm %s: %w", names[i], ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				if p := recover(); p != nil {
+					log.Error("[Recovery from panic]", zap.String("warmer", names[i]), zap.Any("error", p), zap.String("stack", string(debug.Stack())))
+					errs[i] = fmt.Errorf("warm %s: panic: %v", names[i], p)
+				}
+				<-sem
+				wg.Done()
+			}()
+			start := time.Now()
+			if err := fns[i](ctx); err != nil {
+				errs[i] = fmt.Errorf("warm %s: %w", names[i], err)
+				return
+			}
+			log.Info("cache warmed", zap.String("warmer", names[i]), zap.Duration("duration", time.Since(start)))
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"web_app/settings"
+
+	// 匿名导入 注册各模块通过 settings.Register 注册的配置段，新增调用 Register 的包时需要加到这里
+	_ "web_app/auth"
+	_ "web_app/cache"
+	_ "web_app/featureflag"
+	_ "web_app/keyspace"
+	_ "web_app/middlewares"
+	_ "web_app/pubsub"
+	_ "web_app/rbac"
+	_ "web_app/sessions"
+	_ "web_app/streams"
+	_ "web_app/tasks"
+)
+
+// 生成配置文件的 JSON Schema，字段说明取自源码中字段的注释
+//
+//	go run ./cmd/config-schema -o config.schema.json
+func main() {
+	out := flag.String("o", "", "输出文件，为空时输出到标准输出")
+	src := flag.String("src", ".", "提取字段注释的源码根目录")
+	flag.Parse()
+
+	descriptions, err := fieldComments(*src)
+	if err != nil {
+		fmt.Printf("parse source failed, error: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := json.MarshalIndent(settings.Schema(descriptions), "", "  ")
+	if err != nil {
+		fmt.Printf("marshal schema failed, error: %v\n", err)
+		os.Exit(1)
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
+	if err = os.WriteFile(*out, data, 0o644); err != nil {
+		fmt.Printf("write %s failed, error: %v\n", *out, err)
+		os.Exit(1)
+	}
+}
+
+// fieldComments 提取所有结构体字段的注释，key 形如 settings.MySQLConfig.Host
+func fieldComments(root string) (map[string]string, error) {
+	comments := make(map[string]string)
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			for _, field := range st.Fields.List {
+				text := strings.TrimSpace(field.Doc.Text() + " " + field.Comment.Text())
+				if text == "" {
+					continue
+				}
+				text = strings.Join(strings.Fields(text), " ")
+				for _, name := range field.Names {
+					// 注释一般以字段名开头，去掉之后作为说明
+					comments[file.Name.Name+"."+spec.Name.Name+"."+name.Name] = strings.TrimSpace(strings.TrimPrefix(text, name.Name))
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	return comments, err
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"web_app/settings"
+)
+
+// 生成加密的配置值
+//
+//	go run ./cmd/encrypt-config -genkey
+//	WEBAPP_CONFIG_KEY=<key> go run ./cmd/encrypt-config 12345678
+func main() {
+	genKey := flag.Bool("genkey", false, "生成一个新的 base64 编码的 32 字节密钥")
+	keyEnv := flag.String("key-env", settings.DefaultKeyEnv, "保存密钥的环境变量")
+	flag.Parse()
+
+	if *genKey {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			fmt.Printf("generate key failed, error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+		return
+	}
+	if flag.NArg() != 1 {
+		fmt.Println("usage: encrypt-config [-key-env NAME] <plaintext>")
+		os.Exit(2)
+	}
+	value, err := settings.Encrypt(flag.Arg(0), os.Getenv(*keyEnv))
+	if err != nil {
+		fmt.Printf("encrypt failed, error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(value)
+}
@@ -0,0 +1,74 @@
+// Package controller 示例的用户模块的 HTTP 处理函数，演示 controller（解析参数、响应）→ logic（业务逻辑）→
+// dao/mysql（读写数据库）的分层：注册、登录（auth 的 POST /api/v1/login，通过 auth.SetAuthenticator 校验密码）和查询当前用户；
+// 在 main 中导入本包后生效，新的业务模块可以参照本包编写
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"web_app/auth"
+	"web_app/logger"
+	"web_app/logic"
+	"web_app/middlewares"
+	"web_app/models"
+	"web_app/response"
+	"web_app/routes"
+	"web_app/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+// 用户模块的错误码
+var (
+	CodeUserExist    = response.NewCode("user_exist", http.StatusConflict, "username already exists")
+	CodeUserNotExist = response.NewCode("user_not_exist", http.StatusNotFound, "user does not exist")
+)
+
+func init() {
+	// maxbytes 按 UTF-8 编码后的字节数限制长度，max 按字符数计算
+	validation.RegisterValidation("maxbytes", maxBytes, map[string]string{
+		"zh": "{0}长度不能超过{1}个字节",
+		"en": "{0} must be at most {1} bytes long",
+	})
+	response.RegisterError(logic.ErrUserExist, CodeUserExist)
+	response.RegisterError(logic.ErrUserNotExist, CodeUserNotExist)
+	auth.SetAuthenticator(logic.Login)
+	routes.RegisterAPI("v1", "user", routes.RegistrarFunc(func(r gin.IRouter) error {
+		r.POST("/signup", middlewares.RateLimit("signup"), SignUpHandler)
+		r.GET("/users/me", auth.Middleware(), ProfileHandler)
+		return nil
+	}))
+}
+
+func maxBytes(fl validator.FieldLevel) bool {
+	n, err := strconv.Atoi(fl.Param())
+	return err == nil && len([]byte(fl.Field().String())) <= n
+}
+
+// SignUpHandler POST /api/v1/signup {"username", "password", "re_password", "email"}，data 为新用户的资料
+func SignUpHandler(c *gin.Context) {
+	var p models.ParamSignUp
+	if !validation.Bind(c, &p) {
+		return
+	}
+	u, err := logic.SignUp(c.Request.Context(), &p)
+	if err != nil {
+		// 用户名已经存在等错误由 response.Middleware 按错误码响应
+		_ = c.Error(err)
+		return
+	}
+	logger.FromContext(c).Info("user signed up", zap.Int64("user_id", u.ID), zap.String("username", u.Username))
+	response.Success(c, u)
+}
+
+// ProfileHandler GET /api/v1/users/me，data 为当前登录用户的资料；令牌有效但用户已经被删除时响应 404
+func ProfileHandler(c *gin.Context) {
+	u, err := logic.GetProfile(c.Request.Context(), auth.UserID(c))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	response.Success(c, u)
+}
@@ -0,0 +1,257 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// defaultBatchSize、defaultMaxPacket mysql.batch_size、mysql.max_allowed_packet 为 0 时使用
+	defaultBatchSize = 1000
+	defaultMaxPacket = 4 << 20
+)
+
+// maxPlaceholders 一条语句中最多的占位符数量，超过时驱动或数据库会报错
+var maxPlaceholders = map[string]int{DriverMySQL: 65535, DriverPostgres: 65535, DriverSQLite: 32766}
+
+// SetBatchLimits 修改批量写入时每条语句最多的行数和字节数，maxPacket 应不大于 MySQL 的 max_allowed_packet，0 表示使用默认值
+func (d *DB) SetBatchLimits(size, maxPacket int) {
+	d.batchSize.Store(int64(size))
+	d.maxPacket.Store(int64(maxPacket))
+}
+
+// batchRows 批量写入时每条语句最多的行数，不超过 mysql.batch_size 以及驱动对占位符数量的限制，columns 为每行的列数
+func (d *DB) batchRows(columns int) int {
+	size := int(d.batchSize.Load())
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	if limit := maxPlaceholders[d.DriverName()]; limit > 0 && columns > 0 && size*columns > limit {
+		size = limit / columns
+	}
+	return size
+}
+
+// InsertBatch 使用多行 INSERT 批量插入，每条语句最多 mysql.batch_size 行，参数的大小不超过 mysql.max_allowed_packet，
+// 超过时拆分成多条语句并在同一个事务中执行，任何一条失败时全部回滚；返回插入的行数
+// 与 Insert 不同，自增主键不会回填到 items 中，需要时插入后重新查询；每个元素的 BeforeInsert、AfterInsert 仍然会调用
+func (r *Repository[T]) InsertBatch(ctx context.Context, items []T) (n int64, err error) {
+	return r.insertBatch(ctx, items, r.writableColumns(false), "")
+}
+
+// Upsert 批量插入或更新：主键冲突时更新 columns 中的列，columns 为空时更新除主键和 auto 之外的所有列，返回数据库报告的影响行数
+// Upsert 不检查乐观锁的版本号，也不会恢复已经软删除的记录（deleted_at 不在 columns 中时）
+// 与 InsertBatch 不同，主键列即使是 auto 也会写入；MySQL 使用 ON DUPLICATE KEY UPDATE（其他唯一索引冲突时同样更新，
+// 一行更新计为 2），PostgreSQL、SQLite 使用 ON CONFLICT (主键) DO UPDATE
+func (r *Repository[T]) Upsert(ctx context.Context, items []T, columns ...string) (n int64, err error) {
+	if len(columns) == 0 {
+		columns = r.writableColumns(false)
+	}
+	sets := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if _, ok := r.index[c]; !ok {
+			return 0, fmt.Errorf("invalid upsert column %q", c)
+		}
+		if c == r.pk {
+			continue
+		}
+		if r.db.DriverName() == DriverMySQL {
+			sets = append(sets, c+" = VALUES("+c+")")
+		} else {
+			sets = append(sets, c+" = EXCLUDED."+c)
+		}
+	}
+	var suffix string
+	switch {
+	case r.db.DriverName() == DriverMySQL && len(sets) == 0:
+		suffix = " ON DUPLICATE KEY UPDATE " + r.pk + " = " + r.pk
+	case r.db.DriverName() == DriverMySQL:
+		suffix = " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	case len(sets) == 0:
+		suffix = " ON CONFLICT (" + r.pk + ") DO NOTHING"
+	default:
+		suffix = " ON CONFLICT (" + r.pk + ") DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+	return r.insertBatch(ctx, items, r.writableColumns(true), suffix)
+}
+
+// UpdateBatch 在同一个事务中按主键更新多条记录（更新的列与 Update 相同），复用同一条预处理语句，返回更新的行数
+// 每个元素的 BeforeUpdate、AfterUpdate 仍然会调用，任何一条失败（包括乐观锁冲突）时全部回滚，此时 items 中已经加 1 的版本号不会恢复
+func (r *Repository[T]) UpdateBatch(ctx context.Context, items []T) (n int64, err error) {
+	if len(items) == 0 {
+		return
+	}
+	columns := append(r.updateColumns(), r.pk)
+	if r.version {
+		columns = append(columns, ColumnVersion)
+	}
+	query := r.updateSQL(func(string) string { return "?" })
+	hooked := r.hooked()
+	var befores []*T
+	err = r.db.WithTx(ctx, func(tx *sqlx.Tx) (err error) {
+		stmt, err := tx.PreparexContext(ctx, tx.Rebind(query))
+		if err != nil {
+			return
+		}
+		defer stmt.Close()
+		for i := range items {
+			v := &items[i]
+			if h, ok := interface{}(v).(BeforeUpdater); ok {
+				if err = h.BeforeUpdate(ctx); err != nil {
+					return
+				}
+			}
+			rv := reflect.ValueOf(v).Elem()
+			args := make([]interface{}, len(columns))
+			for j, c := range columns {
+				args[j] = rv.FieldByIndex(r.index[c]).Interface()
+			}
+			if hooked {
+				befores = append(befores, r.snapshot(ctx, tx, rv.FieldByIndex(r.index[r.pk]).Interface()))
+			}
+			var result sql.Result
+			execCtx, cancel := r.db.withTimeout(ctx)
+			result, err = stmt.ExecContext(execCtx, args...)
+			cancel()
+			if err != nil {
+				return
+			}
+			if err = r.afterUpdate(ctx, v, result); err != nil {
+				return
+			}
+			if c := rowsAffected(result); c > 0 {
+				n += c
+			}
+			if h, ok := interface{}(v).(AfterUpdater); ok {
+				if err = h.AfterUpdate(ctx); err != nil {
+					return
+				}
+			}
+		}
+		return
+	})
+	if err != nil {
+		n = 0
+		return
+	}
+	for i := range befores {
+		after := items[i]
+		r.emit(ctx, ActionUpdate, reflect.ValueOf(after).FieldByIndex(r.index[r.pk]).Interface(), befores[i], &after)
+	}
+	return
+}
+
+// writableColumns 插入时写入的列，withPK 为 true 时包括 auto 的主键
+func (r *Repository[T]) writableColumns(withPK bool) []string {
+	cols := make([]string, 0, len(r.columns))
+	for _, c := range r.columns {
+		if !r.auto[c] || (withPK && c == r.pk) {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// insertBatch 按行数、占位符数量和参数大小把 items 拆分成多条 INSERT，suffix 追加在每条语句的 VALUES 之后
+func (r *Repository[T]) insertBatch(ctx context.Context, items []T, columns []string, suffix string) (n int64, err error) {
+	if len(items) == 0 {
+		return
+	}
+	size := r.db.batchRows(len(columns))
+	maxPacket := int(r.db.maxPacket.Load())
+	if maxPacket <= 0 {
+		maxPacket = defaultMaxPacket
+	}
+	prefix := "INSERT INTO " + r.table + " (" + strings.Join(columns, ", ") + ") VALUES "
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	err = r.db.WithTx(ctx, func(tx *sqlx.Tx) (err error) {
+		var (
+			rows  int
+			bytes = len(prefix) + len(suffix)
+			args  []interface{}
+		)
+		flush := func() error {
+			if rows == 0 {
+				return nil
+			}
+			query := prefix + strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ") + suffix
+			result, err := txConn{Tx: tx, db: r.db}.ExecContext(ctx, tx.Rebind(query), args...)
+			if err != nil {
+				return err
+			}
+			if c := rowsAffected(result); c > 0 {
+				n += c
+			}
+			rows, bytes, args = 0, len(prefix)+len(suffix), args[:0]
+			return nil
+		}
+		for i := range items {
+			v := &items[i]
+			if err = r.beforeInsert(ctx, v); err != nil {
+				return
+			}
+			rv := reflect.ValueOf(v).Elem()
+			values := make([]interface{}, len(columns))
+			rowBytes := len(row) + 2
+			for j, c := range columns {
+				values[j] = rv.FieldByIndex(r.index[c]).Interface()
+				rowBytes += argSize(values[j])
+			}
+			// 单行超过 max_allowed_packet 时仍然单独发送，由数据库返回错误
+			if rows >= size || (rows > 0 && bytes+rowBytes > maxPacket) {
+				if err = flush(); err != nil {
+					return
+				}
+			}
+			args = append(args, values...)
+			rows++
+			bytes += rowBytes
+		}
+		if err = flush(); err != nil {
+			return
+		}
+		for i := range items {
+			if h, ok := interface{}(&items[i]).(AfterInserter); ok {
+				if err = h.AfterInsert(ctx); err != nil {
+					return
+				}
+			}
+		}
+		return
+	})
+	if err != nil {
+		n = 0
+		return
+	}
+	if r.hooked() {
+		action := ActionInsert
+		if suffix != "" {
+			action = ActionUpsert
+		}
+		for i := range items {
+			after := items[i]
+			r.emit(ctx, action, reflect.ValueOf(after).FieldByIndex(r.index[r.pk]).Interface(), nil, &after)
+		}
+	}
+	return
+}
+
+// argSize 估算参数在数据包中的大小，字符串和二进制按长度，其他类型按最长的文本表示估算
+func argSize(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		return len(v) + 9
+	case []byte:
+		return len(v) + 9
+	case *string:
+		if v != nil {
+			return len(*v) + 9
+		}
+	}
+	return 32
+}
@@ -0,0 +1,132 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"time"
+	"web_app/logger"
+	"web_app/settings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+)
+
+// ErrUnavailable 熔断器打开时语句不会发送到数据库，直接返回该错误，handler 应返回 503，见 middlewares.DBUnavailable
+var ErrUnavailable = errors.New("database unavailable")
+
+// breakerState mysql_breaker_state 熔断器的状态，0 关闭、1 半开、2 打开
+var breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "mysql_breaker_state",
+	Help: "State of the database circuit breaker: 0 closed, 1 half-open, 2 open.",
+}, []string{"database"})
+
+// SetBreaker 按配置重新创建熔断器，enable 为 false 时不熔断，name 为连接池的名称，用于日志和指标
+func (d *DB) SetBreaker(name string, cfg *settings.BreakerConfig) {
+	if !cfg.Enable {
+		d.breaker.Store(nil)
+		breakerState.WithLabelValues(name).Set(0)
+		return
+	}
+	ratio := cfg.FailureRatio
+	if ratio <= 0 {
+		ratio = 0.5
+	}
+	minRequests := cfg.MinRequests
+	if minRequests == 0 {
+		minRequests = 20
+	}
+	timeout := cfg.OpenTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	d.breakerTimeout.Store(int64(timeout))
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: cfg.HalfOpenRequests,
+		Interval:    cfg.Interval,
+		Timeout:     timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.Requests >= minRequests && float64(counts.TotalFailures)/float64(counts.Requests) >= ratio
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			breakerState.WithLabelValues(name).Set(float64(to))
+			log := logger.Named("dao.mysql").With(zap.String("database", name), zap.String("from", from.String()), zap.String("to", to.String()))
+			if to == gobreaker.StateOpen {
+				log.Error("mysql circuit breaker opened, failing fast", zap.Duration("open_timeout", timeout))
+			} else {
+				log.Warn("mysql circuit breaker state changed")
+			}
+		},
+		IsSuccessful: func(err error) bool {
+			return !isUnavailable(err)
+		},
+	})
+	d.breaker.Store(cb)
+	breakerState.WithLabelValues(name).Set(0)
+}
+
+// guard 在熔断器中执行 fn，熔断时不执行 fn 而是直接返回 ErrUnavailable；
+// ctx 为调用方传入的、加上 query_timeout 之前的 ctx，它已经结束时 fn 的错误（包括调用方自己的截止时间到期）不计入熔断
+func (d *DB) guard(ctx context.Context, fn func() error) error {
+	cb := d.breaker.Load()
+	if cb == nil {
+		return fn()
+	}
+	_, err := cb.Execute(func() (interface{}, error) {
+		err := fn()
+		if err != nil && ctx.Err() != nil {
+			return nil, callerDone{err}
+		}
+		return nil, err
+	})
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return ErrUnavailable
+	}
+	if e, ok := err.(callerDone); ok {
+		return e.err
+	}
+	return err
+}
+
+// callerDone 调用方的 ctx 结束之后语句返回的错误，只在熔断器中使用，isUnavailable 不计入熔断，guard 返回之前去掉
+type callerDone struct {
+	err error
+}
+
+func (e callerDone) Error() string {
+	return e.err.Error()
+}
+
+// RetryAfter 熔断器打开后多久会尝试恢复，用于 503 响应的 Retry-After
+func (d *DB) RetryAfter() time.Duration {
+	if d.breaker.Load() == nil {
+		return 0
+	}
+	return time.Duration(d.breakerTimeout.Load())
+}
+
+// isUnavailable 数据库不可用的错误：连接失败、连接断开、query_timeout 超时、连接数已满，
+// 记录不存在、唯一键冲突、SQL 错误等业务错误以及调用方取消或者超过调用方截止时间的请求不计入熔断
+func isUnavailable(err error) bool {
+	if _, ok := err.(callerDone); ok {
+		return false
+	}
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysqldriver.ErrInvalidConn) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var myErr *mysqldriver.MySQLError
+	// 1040 Too many connections，1053 Server shutdown in progress
+	return errors.As(err, &myErr) && (myErr.Number == 1040 || myErr.Number == 1053)
+}
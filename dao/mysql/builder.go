@@ -0,0 +1,162 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Builder 返回占位符与驱动匹配的 squirrel 构造器（PostgreSQL 为 $1、$2...），动态条件的查询应使用构造器而不是拼接 SQL
+//
+//	query, args, err := mysql.Default().Builder().Select("id", "title").From("posts").
+//		Where(sq.Eq{"status": status}).OrderBy("id DESC").Limit(20).ToSql()
+func (d *DB) Builder() sq.StatementBuilderType {
+	if d.DriverName() == DriverPostgres {
+		return sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	}
+	return sq.StatementBuilder.PlaceholderFormat(sq.Question)
+}
+
+// Select 查询 r 的所有列的 SelectBuilder，启用软删除时已经带有 deleted_at IS NULL 条件，使用 Query 执行
+func (r *Repository[T]) Select() sq.SelectBuilder {
+	b := r.db.Builder().Select(r.columns...).From(r.table)
+	if r.softDelete {
+		b = b.Where(ColumnDeletedAt + " IS NULL")
+	}
+	return b
+}
+
+// Query 执行 SelectBuilder，结果扫描到 []T 中，ctx 中有事务时使用事务
+func (r *Repository[T]) Query(ctx context.Context, b sq.SelectBuilder) ([]T, error) {
+	query, args, err := b.PlaceholderFormat(sq.Question).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	q := r.conn(ctx)
+	list := []T{}
+	if err = q.SelectContext(ctx, &list, q.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// SortBy 把请求中的排序参数转换为 ORDER BY，多个列用逗号分隔，- 前缀表示降序，也可以使用 ListOptions.OrderBy 的格式，
+// 只能使用模型中的列，结果可以用于 ListOptions.OrderBy 或者 SelectBuilder.OrderBy
+//
+//	orderBy, err := posts.SortBy(c.DefaultQuery("sort", "-created_at")) // created_at DESC
+func (r *Repository[T]) SortBy(sort string) (string, error) {
+	parts := strings.Split(sort, ",")
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "-") {
+			p = strings.TrimPrefix(p, "-") + " DESC"
+		}
+		parts[i] = p
+	}
+	return r.orderBy(strings.Join(parts, ","))
+}
+
+// Filters 按请求结构体字段的 filter 标签生成查询条件，零值（nil 指针、空字符串、空切片等）的字段不生成条件，
+// 需要按零值过滤时使用指针；条件的值都作为参数传入，列名只来自标签，不会被请求注入
+//
+//	标签的格式为 filter:"列名,操作"，操作默认为 eq：
+//	eq、ne、gt、gte、lt、lte  比较
+//	in                         字段为切片，IN (...)
+//	like、prefix               包含、前缀匹配，值中的 %、_ 会被转义
+//
+//	type PostQuery struct {
+//		Status  *int      `form:"status" filter:"status"`
+//		UserIDs []int64   `form:"user_id" filter:"user_id,in"`
+//		Title   string    `form:"title" filter:"title,like"`
+//		Since   time.Time `form:"since" filter:"created_at,gte"`
+//	}
+//
+//	where, err := mysql.Filters(&q)
+//	list, err := posts.Query(ctx, posts.Select().Where(where))
+//	// 或者
+//	query, args, err := where.ToSql()
+//	list, err := posts.List(ctx, mysql.ListOptions{Where: query, Args: args})
+func Filters(v interface{}) (sq.And, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("filters requires a struct, got %T", v)
+	}
+	and := sq.And{}
+	return and, collectFilters(rv, &and)
+}
+
+func collectFilters(rv reflect.Value, and *sq.And) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := f.Tag.Lookup("filter")
+		if !ok {
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				if err := collectFilters(rv.Field(i), and); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+		column, op, _ := strings.Cut(tag, ",")
+		if column == "" {
+			return fmt.Errorf("missing filter column on field %s", f.Name)
+		}
+		fv := rv.Field(i)
+		if fv.IsZero() || (fv.Kind() == reflect.Slice && fv.Len() == 0) {
+			continue
+		}
+		value := reflect.Indirect(fv).Interface()
+		var cond sq.Sqlizer
+		switch op {
+		case "", "eq":
+			cond = sq.Eq{column: value}
+		case "ne":
+			cond = sq.NotEq{column: value}
+		case "gt":
+			cond = sq.Gt{column: value}
+		case "gte":
+			cond = sq.GtOrEq{column: value}
+		case "lt":
+			cond = sq.Lt{column: value}
+		case "lte":
+			cond = sq.LtOrEq{column: value}
+		case "in":
+			if fv.Kind() != reflect.Slice {
+				return fmt.Errorf("filter %q on field %s requires a slice", tag, f.Name)
+			}
+			cond = sq.Eq{column: value}
+		case "like", "prefix":
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("filter %q on field %s requires a string", tag, f.Name)
+			}
+			pattern := escapeLike(s) + "%"
+			if op == "like" {
+				pattern = "%" + pattern
+			}
+			// sqlite 没有默认的转义字符，统一使用 ! 并显式指定
+			cond = sq.Expr(column+" LIKE ? ESCAPE '!'", pattern)
+		default:
+			return fmt.Errorf("invalid filter op %q on field %s", op, f.Name)
+		}
+		*and = append(*and, cond)
+	}
+	return nil
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"web_app/pagination"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNotInitialized 没有调用 Init 时使用默认连接池的包级函数（WithTx、Ping）返回的错误
+var ErrNotInitialized = errors.New("mysql not initialized")
+
+// Querier *DB 执行语句的方法，dao 层的函数和结构体依赖该接口而不是包级的默认连接池，
+// 单元测试中传入 NewFromDB 包装的 sqlmock 连接或者自己实现的 fake
+//
+//	type UserDAO struct{ db mysql.Querier }
+//
+//	func NewUserDAO(db mysql.Querier) *UserDAO { return &UserDAO{db: db} }
+//
+//	// 单元测试
+//	conn, mock, _ := sqlmock.New()
+//	users := NewUserDAO(mysql.NewFromDB(conn, mysql.DriverMySQL))
+type Querier interface {
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*Rows, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	WithTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error
+	DriverName() string
+}
+
+// Store Repository 的方法，handler、service 依赖 Store[T] 时单元测试中可以使用内存中的 fake
+// 实现为 Repository（sqlx）或 GormRepository（GORM），NewStore 按 mysql.backend 选择
+type Store[T any] interface {
+	Get(ctx context.Context, id interface{}) (*T, error)
+	List(ctx context.Context, opts ListOptions) ([]T, error)
+	Count(ctx context.Context, where string, args ...interface{}) (int64, error)
+	Page(ctx context.Context, p pagination.Params, opts ListOptions) (*pagination.Result[T], error)
+	Insert(ctx context.Context, v *T) error
+	Update(ctx context.Context, v *T) error
+	Delete(ctx context.Context, id interface{}) (int64, error)
+	InsertBatch(ctx context.Context, items []T) (int64, error)
+	Upsert(ctx context.Context, items []T, columns ...string) (int64, error)
+	UpdateBatch(ctx context.Context, items []T) (int64, error)
+}
+
+var (
+	_ Querier                 = (*DB)(nil)
+	_ Store[struct{ ID int }] = (*Repository[struct{ ID int }])(nil)
+	_ Store[struct{ ID int }] = (*GormRepository[struct{ ID int }])(nil)
+)
+
+// NewFromDB 使用已经打开的 *sql.DB 创建 DB，driver 为 mysql.driver 的取值（决定占位符的转换和 SQL 方言），
+// 例如 sqlmock.New() 返回的连接；连接池的大小、超时等使用 *sql.DB 本身的配置，语句没有 query_timeout 的限制
+func NewFromDB(conn *sql.DB, driver string) *DB {
+	return Wrap(sqlx.NewDb(conn, driverName(driver)))
+}
@@ -0,0 +1,174 @@
+package mysql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"web_app/settings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/lib/pq"  // 注册 postgres 驱动
+	"modernc.org/sqlite" // 注册 sqlite 驱动，纯 Go 实现，不需要 cgo
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// mysql.driver 支持的数据库驱动，dao 层的代码统一使用 ? 作为占位符，由 DB 的方法按驱动转换（sqlx.Rebind）
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+func init() {
+	// sqlx 不认识 modernc.org/sqlite 注册的驱动名，指定使用 ? 作为占位符
+	sqlx.BindDriver(DriverSQLite, sqlx.QUESTION)
+}
+
+// driverName mysql.driver 为空时使用 MySQL
+func driverName(driver string) string {
+	if driver == "" {
+		return DriverMySQL
+	}
+	return driver
+}
+
+// dsn DSN (Data Source Name) 按驱动的格式拼接连接信息，host、port、user、password 可能是副本的，其他参数取自 cfg
+// sqlite 的 dbname 为数据库文件的路径
+func dsn(cfg *settings.MySQLConfig, host string, port int, user, password string) (string, error) {
+	params, err := url.ParseQuery(cfg.Params)
+	if err != nil {
+		return "", fmt.Errorf("invalid mysql.params: %w", err)
+	}
+	switch driverName(cfg.Driver) {
+	case DriverPostgres:
+		q := url.Values{}
+		if cfg.TLS.Enable {
+			q.Set("sslmode", "verify-full")
+			if cfg.TLS.InsecureSkipVerify {
+				q.Set("sslmode", "require")
+			}
+			setIfNotEmpty(q, "sslrootcert", cfg.TLS.CAFile)
+			setIfNotEmpty(q, "sslcert", cfg.TLS.CertFile)
+			setIfNotEmpty(q, "sslkey", cfg.TLS.KeyFile)
+		}
+		if cfg.Timeout > 0 {
+			q.Set("connect_timeout", strconv.Itoa(int(math.Ceil(cfg.Timeout.Seconds()))))
+		}
+		for k, v := range params {
+			q[k] = v
+		}
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(user, password),
+			Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+			Path:     "/" + cfg.DBName,
+			RawQuery: q.Encode(),
+		}
+		return u.String(), nil
+	case DriverSQLite:
+		if len(params) == 0 {
+			return cfg.DBName, nil
+		}
+		return cfg.DBName + "?" + params.Encode(), nil
+	default:
+		c := mysqldriver.NewConfig()
+		c.User = user
+		c.Passwd = password
+		c.Net = "tcp"
+		c.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+		c.DBName = cfg.DBName
+		c.ParseTime = true
+		c.Params = map[string]string{"charset": "utf8mb4"}
+		if cfg.Loc != "" {
+			if c.Loc, err = time.LoadLocation(cfg.Loc); err != nil {
+				return "", fmt.Errorf("invalid mysql.loc: %w", err)
+			}
+		}
+		c.Timeout = cfg.Timeout
+		c.ReadTimeout = cfg.ReadTimeout
+		c.WriteTimeout = cfg.WriteTimeout
+		if cfg.TLS.Enable {
+			if c.TLSConfig, err = registerTLS(&cfg.TLS); err != nil {
+				return "", err
+			}
+		}
+		// 写在最后，与上面相同的参数以 params 为准
+		for k := range params {
+			c.Params[k] = params.Get(k)
+		}
+		return c.FormatDSN(), nil
+	}
+}
+
+func setIfNotEmpty(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+// registerTLS 按 mysql.tls 创建 tls.Config 并注册到 MySQL 驱动，返回 DSN 中 tls 参数使用的名称
+// 名称由配置计算，相同的配置（例如主库和副本）使用同一个名称；server_name 为空时驱动使用每个连接的 host 校验证书
+func registerTLS(cfg *settings.DBTLSConfig) (name string, err error) {
+	tc, err := cfg.Load("mysql.tls")
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s|%t", cfg.CAFile, cfg.CertFile, cfg.KeyFile, cfg.ServerName, cfg.InsecureSkipVerify)))
+	name = "web_app_" + hex.EncodeToString(sum[:8])
+	return name, mysqldriver.RegisterTLSConfig(name, tc)
+}
+
+// IsDuplicateKey err 是否为违反 names 中任意一个唯一索引的错误，用于区分主键冲突和其他唯一索引：
+// names 为 MySQL 的索引名、PostgreSQL 的约束名，SQLite 的错误中没有索引名，使用形如 users.username 的列名
+func IsDuplicateKey(err error, names ...string) bool {
+	if !IsDuplicate(err) {
+		return false
+	}
+	var myErr *mysqldriver.MySQLError
+	var pqErr *pq.Error
+	for _, name := range names {
+		switch {
+		case errors.As(err, &myErr):
+			// Duplicate entry 'x' for key 'uk_username'，MySQL 8.0 为 'users.uk_username'
+			if strings.HasSuffix(myErr.Message, "'"+name+"'") || strings.HasSuffix(myErr.Message, "."+name+"'") {
+				return true
+			}
+		case errors.As(err, &pqErr):
+			if pqErr.Constraint == name {
+				return true
+			}
+		default:
+			// constraint failed: UNIQUE constraint failed: users.username (2067)
+			if strings.Contains(err.Error(), "constraint failed: "+name+" ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsDuplicate err 是否为违反唯一索引（包括主键）的错误，例如注册时用户名已经被其他请求抢先使用
+func IsDuplicate(err error) bool {
+	var myErr *mysqldriver.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1062 // ER_DUP_ENTRY
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505" // unique_violation
+	}
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) {
+		return liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
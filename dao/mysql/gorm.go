@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	gormmysql "gorm.io/driver/mysql"
+	gormpostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// mysql.backend 的取值，决定 NewStore 返回的 Store 的实现
+const (
+	BackendSQLX = "sqlx"
+	BackendGorm = "gorm"
+)
+
+// gormPool 把 DB 包装为 GORM 的连接池，GORM 生成的语句经过 DB 的方法执行，
+// 与 sqlx 共用连接池、副本、超时、熔断、维护模式、预处理语句缓存、慢查询日志、指标和链路追踪
+type gormPool struct {
+	d *DB
+}
+
+func (p gormPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.d.DB.PrepareContext(ctx, query)
+}
+
+func (p gormPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.d.ExecContext(ctx, query, args...)
+}
+
+// QueryContext GORM 需要 *sql.Rows，无法在关闭时释放 query_timeout 的计时器，ctx 在超时到期时自己结束并释放；
+// GORM 的 Find、Scan 等在返回前就已经读取完并关闭
+func (p gormPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, cancel, err := p.d.queryx(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	_ = cancel
+	return rows.Rows, nil
+}
+
+// QueryRowContext GORM 的 Row() 使用，*sql.Row 无法携带错误，与 QueryRowx 相同不经过熔断器；超时的计时器与 QueryContext 相同在到期时释放
+func (p gormPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query = p.d.Rebind(query)
+	ctx, cancel := p.d.rowsContext(ctx)
+	start := time.Now()
+	ctx = p.d.startSpan(ctx, "query", query)
+	row := p.d.Reader(ctx).QueryRowContext(ctx, query, args...)
+	if row.Err() != nil {
+		cancel()
+	}
+	p.d.observe(ctx, "query", query, args, start, -1, row.Err())
+	return row
+}
+
+// BeginTx GORM 的 Transaction、Begin 使用，与 WithTx 相同熔断时返回 ErrUnavailable，维护模式下开启只读事务
+func (p gormPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (tx *sql.Tx, err error) {
+	if p.d.ReadOnly() {
+		o := sql.TxOptions{ReadOnly: true}
+		if opts != nil {
+			o.Isolation = opts.Isolation
+		}
+		opts = &o
+	}
+	err = p.d.guard(ctx, func() (err error) {
+		tx, err = p.d.DB.BeginTx(ctx, opts)
+		return
+	})
+	return
+}
+
+// GetDBConn gorm.DB.DB() 返回主库的 *sql.DB
+func (p gormPool) GetDBConn() (*sql.DB, error) {
+	return p.d.DB.DB, nil
+}
+
+// Gorm 返回共用该连接池的 *gorm.DB，第一次调用时创建，不会访问数据库；只支持 mysql 和 postgres 驱动
+// GORM 不再单独记录日志，也不为单条语句开启默认事务，需要事务时使用 WithTx（GORM 的 Transaction 也可以使用）
+//
+//	g, err := mysql.Default().Gorm()
+//	err = g.WithContext(ctx).Where("status = ?", 1).Find(&posts).Error
+func (d *DB) Gorm() (*gorm.DB, error) {
+	d.gormOnce.Do(func() {
+		var dialector gorm.Dialector
+		switch d.DriverName() {
+		case DriverMySQL:
+			dialector = gormmysql.New(gormmysql.Config{Conn: gormPool{d}, SkipInitializeWithVersion: true})
+		case DriverPostgres:
+			dialector = gormpostgres.New(gormpostgres.Config{Conn: gormPool{d}})
+		default:
+			d.gormErr = fmt.Errorf("gorm backend does not support driver %q", d.DriverName())
+			return
+		}
+		d.gormDB, d.gormErr = gorm.Open(dialector, &gorm.Config{
+			SkipDefaultTransaction: true,
+			Logger:                 gormlogger.Discard,
+		})
+	})
+	return d.gormDB, d.gormErr
+}
+
+// NewStore 按 mysql.backend 创建模型 T 的 Store：sqlx（默认）时为 NewRepository，gorm 时为 NewGormRepository，
+// 两者的模型标签不同（db 标签和 gorm 标签），切换实现时模型需要同时带有两种标签
+func NewStore[T any](db *DB, table string) Store[T] {
+	if db.backend == BackendGorm {
+		return NewGormRepository[T](db, table)
+	}
+	return NewRepository[T](db, table)
+}
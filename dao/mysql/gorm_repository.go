@@ -0,0 +1,326 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"web_app/pagination"
+
+	"github.com/jmoiron/sqlx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// GormRepository 基于 GORM 的 Store 实现，方法的语义与 Repository 相同，列、主键、软删除（gorm.DeletedAt）等由 gorm 标签决定
+//
+//	type Post struct {
+//		ID        int64 `gorm:"primaryKey"`
+//		Title     string
+//		CreatedAt time.Time
+//		DeletedAt gorm.DeletedAt
+//	}
+//	posts := mysql.NewGormRepository[Post](mysql.Default(), "post")
+//
+// 与 Repository 的区别：
+//   - 软删除使用 gorm.DeletedAt 类型的字段，不支持 version 乐观锁，不调用 SetMutationHook 设置的回调
+//   - 除了 BeforeInsert 等 Repository 的回调之外，GORM 自己的回调（BeforeCreate 等）同样会调用
+//   - InsertBatch 会回填自增主键
+//
+// ctx 中有事务时（见 ContextWithTx）在该事务中执行
+type GormRepository[T any] struct {
+	db     *DB
+	gorm   *gorm.DB
+	table  string
+	schema *schema.Schema
+	pk     *schema.Field
+}
+
+// NewGormRepository 创建模型 T 的 GormRepository，table 为表名，db 的驱动不支持 GORM 或者 T 没有主键时 panic
+func NewGormRepository[T any](db *DB, table string) *GormRepository[T] {
+	g, err := db.Gorm()
+	if err != nil {
+		panic(fmt.Sprintf("mysql: %v", err))
+	}
+	stmt := &gorm.Statement{DB: g}
+	if err = stmt.Parse(new(T)); err != nil {
+		panic(fmt.Sprintf("mysql: parse gorm model %T: %v", *new(T), err))
+	}
+	r := &GormRepository[T]{db: db, gorm: g, table: table, schema: stmt.Schema, pk: stmt.Schema.PrioritizedPrimaryField}
+	if r.pk == nil {
+		panic(fmt.Sprintf("mysql: gorm model %s has no primary key", stmt.Schema.Name))
+	}
+	return r
+}
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// conn 返回 r.table 上的 *gorm.DB，ctx 中有事务时使用事务
+func (r *GormRepository[T]) conn(ctx context.Context) *gorm.DB {
+	g := r.gorm.WithContext(ctx)
+	if tx, ok := TxFromContext(ctx); ok {
+		g.Statement.ConnPool = tx.Tx
+	}
+	return g.Table(r.table)
+}
+
+func (r *GormRepository[T]) byPK(id interface{}) clause.Eq {
+	return clause.Eq{Column: clause.Column{Name: r.pk.DBName}, Value: id}
+}
+
+// Get 按主键查询，没有记录时返回 ErrNotFound
+func (r *GormRepository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	var v T
+	err := r.conn(ctx).Where(r.byPK(id)).Take(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// List 按条件查询，见 Repository.List
+func (r *GormRepository[T]) List(ctx context.Context, opts ListOptions) ([]T, error) {
+	q := r.conn(ctx)
+	if opts.Where != "" {
+		q = q.Where(opts.Where, opts.Args...)
+	}
+	if opts.OrderBy != "" {
+		orderBy, err := r.orderBy(opts.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Order(orderBy)
+	}
+	if opts.Page > 0 {
+		size := opts.PageSize
+		if size <= 0 {
+			size = 20
+		}
+		q = q.Limit(size).Offset((opts.Page - 1) * size)
+	}
+	list := []T{}
+	if err := q.Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// orderBy 校验排序中的列和方向，只能使用模型中的列
+func (r *GormRepository[T]) orderBy(s string) (string, error) {
+	return validateOrderBy(s, func(column string) bool {
+		_, ok := r.schema.FieldsByDBName[column]
+		return ok
+	})
+}
+
+// Count 按条件统计数量，where 为空时统计全表
+func (r *GormRepository[T]) Count(ctx context.Context, where string, args ...interface{}) (n int64, err error) {
+	q := r.conn(ctx).Model(new(T))
+	if where != "" {
+		q = q.Where(where, args...)
+	}
+	err = q.Count(&n).Error
+	return
+}
+
+// Page 按 pagination.Parse 解析出的参数分页查询，见 Repository.Page
+func (r *GormRepository[T]) Page(ctx context.Context, p pagination.Params, opts ListOptions) (result *pagination.Result[T], err error) {
+	if !p.IsCursor() {
+		return offsetPage[T](ctx, r, p, opts)
+	}
+	orderBy := opts.OrderBy
+	if orderBy != "" {
+		if orderBy, err = r.orderBy(orderBy); err != nil {
+			return
+		}
+	}
+	columns, desc, err := keysetOrder(orderBy, r.pk.DBName)
+	if err != nil {
+		return
+	}
+	fields := make([]*schema.Field, len(columns))
+	for i, c := range columns {
+		fields[i] = r.schema.FieldsByDBName[c]
+	}
+	q := r.conn(ctx)
+	if opts.Where != "" {
+		q = q.Where(opts.Where, opts.Args...)
+	}
+	if p.Cursor != "" {
+		types := make([]reflect.Type, len(fields))
+		for i, f := range fields {
+			types[i] = f.FieldType
+		}
+		clause, args, err := keysetWhere(p.Cursor, columns, desc, types)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where(clause, args...)
+	}
+	items := []T{}
+	if err = q.Order(keysetOrderBy(columns, desc)).Limit(p.Size + 1).Find(&items).Error; err != nil {
+		return
+	}
+	items, more := pagination.Trim(p, items)
+	result = &pagination.Result[T]{Items: items, Meta: pagination.Meta{Size: p.Size, HasMore: more}}
+	if more {
+		last := reflect.ValueOf(&items[len(items)-1]).Elem()
+		values := make([]interface{}, len(fields))
+		for i, f := range fields {
+			values[i] = f.ReflectValueOf(ctx, last).Interface()
+		}
+		result.Meta.NextCursor, err = pagination.EncodeCursor(values...)
+	}
+	return
+}
+
+// Insert 插入一条记录，自增主键在插入后回填到 v 中
+func (r *GormRepository[T]) Insert(ctx context.Context, v *T) (err error) {
+	if err = r.db.writable(); err != nil {
+		return
+	}
+	if h, ok := interface{}(v).(BeforeInserter); ok {
+		if err = h.BeforeInsert(ctx); err != nil {
+			return
+		}
+	}
+	if err = r.conn(ctx).Create(v).Error; err != nil {
+		return
+	}
+	if h, ok := interface{}(v).(AfterInserter); ok {
+		err = h.AfterInsert(ctx)
+	}
+	return
+}
+
+// Update 按主键更新除主键、只读列、自动设置创建时间的列和 gorm.DeletedAt 之外的所有列（包括零值），已经软删除的记录不会更新
+func (r *GormRepository[T]) Update(ctx context.Context, v *T) (err error) {
+	_, err = r.update(ctx, v)
+	return
+}
+
+func (r *GormRepository[T]) update(ctx context.Context, v *T) (n int64, err error) {
+	if err = r.db.writable(); err != nil {
+		return
+	}
+	if h, ok := interface{}(v).(BeforeUpdater); ok {
+		if err = h.BeforeUpdate(ctx); err != nil {
+			return
+		}
+	}
+	result := r.conn(ctx).Model(v).Select(r.updateColumns()).Updates(v)
+	if err = result.Error; err != nil {
+		return
+	}
+	n = result.RowsAffected
+	if h, ok := interface{}(v).(AfterUpdater); ok {
+		err = h.AfterUpdate(ctx)
+	}
+	return
+}
+
+// updateColumns Update 时 SET 的列
+func (r *GormRepository[T]) updateColumns() []string {
+	cols := make([]string, 0, len(r.schema.DBNames))
+	for _, f := range r.schema.Fields {
+		if f.DBName != "" && f.Updatable && !f.PrimaryKey && f.AutoCreateTime == 0 && f.FieldType != deletedAtType {
+			cols = append(cols, f.DBName)
+		}
+	}
+	return cols
+}
+
+// Delete 按主键删除，返回删除的行数；模型中有 gorm.DeletedAt 字段时只设置删除时间
+func (r *GormRepository[T]) Delete(ctx context.Context, id interface{}) (n int64, err error) {
+	if err = r.db.writable(); err != nil {
+		return
+	}
+	result := r.conn(ctx).Where(r.byPK(id)).Delete(new(T))
+	return result.RowsAffected, result.Error
+}
+
+// InsertBatch 批量插入，见 Repository.InsertBatch，与 Repository 不同会回填自增主键
+func (r *GormRepository[T]) InsertBatch(ctx context.Context, items []T) (n int64, err error) {
+	return r.insertBatch(ctx, items, nil)
+}
+
+// Upsert 批量插入或更新：主键冲突时更新 columns 中的列，columns 为空时更新除主键之外的所有列，见 Repository.Upsert
+func (r *GormRepository[T]) Upsert(ctx context.Context, items []T, columns ...string) (n int64, err error) {
+	onConflict := clause.OnConflict{Columns: []clause.Column{{Name: r.pk.DBName}}, UpdateAll: len(columns) == 0}
+	for _, c := range columns {
+		if _, ok := r.schema.FieldsByDBName[c]; !ok {
+			return 0, fmt.Errorf("invalid upsert column %q", c)
+		}
+	}
+	if len(columns) > 0 {
+		onConflict.DoUpdates = clause.AssignmentColumns(columns)
+	}
+	return r.insertBatch(ctx, items, onConflict)
+}
+
+// insertBatch 在同一个事务中按 mysql.batch_size 分批插入，onConflict 不为 nil 时追加在每条语句之后
+func (r *GormRepository[T]) insertBatch(ctx context.Context, items []T, onConflict clause.Expression) (n int64, err error) {
+	if len(items) == 0 {
+		return
+	}
+	if err = r.db.writable(); err != nil {
+		return
+	}
+	err = r.db.WithTx(ctx, func(tx *sqlx.Tx) (err error) {
+		ctx := ContextWithTx(ctx, tx)
+		for i := range items {
+			if h, ok := interface{}(&items[i]).(BeforeInserter); ok {
+				if err = h.BeforeInsert(ctx); err != nil {
+					return
+				}
+			}
+		}
+		q := r.conn(ctx)
+		if onConflict != nil {
+			q = q.Clauses(onConflict)
+		}
+		result := q.CreateInBatches(items, r.db.batchRows(len(r.schema.DBNames)))
+		if err = result.Error; err != nil {
+			return
+		}
+		n = result.RowsAffected
+		for i := range items {
+			if h, ok := interface{}(&items[i]).(AfterInserter); ok {
+				if err = h.AfterInsert(ctx); err != nil {
+					return
+				}
+			}
+		}
+		return
+	})
+	if err != nil {
+		n = 0
+	}
+	return
+}
+
+// UpdateBatch 在同一个事务中按主键更新多条记录，返回更新的行数，任何一条失败时全部回滚
+func (r *GormRepository[T]) UpdateBatch(ctx context.Context, items []T) (n int64, err error) {
+	if len(items) == 0 {
+		return
+	}
+	err = r.db.WithTx(ctx, func(tx *sqlx.Tx) error {
+		ctx := ContextWithTx(ctx, tx)
+		for i := range items {
+			c, err := r.update(ctx, &items[i])
+			if err != nil {
+				return err
+			}
+			n += c
+		}
+		return nil
+	})
+	if err != nil {
+		n = 0
+	}
+	return
+}
@@ -0,0 +1,35 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// RegisterMetrics 把主库和每个副本的连接池状态（db.Stats()）注册为 Prometheus 指标，每次抓取时读取
+// 指标名为 go_sql_*，例如 go_sql_open_connections、go_sql_in_use_connections、go_sql_wait_count_total、
+// go_sql_wait_duration_seconds_total、go_sql_max_lifetime_closed_total，标签 role 为 primary 或 replica，addr 为连接的地址；
+// 相同 addr 和 dbName 的连接池已经注册过时（例如两个命名连接池指向同一个数据库，或者重复调用 Init）返回 prometheus.AlreadyRegisteredError
+func (d *DB) RegisterMetrics(reg prometheus.Registerer, dbName string) error {
+	if err := register(reg, prometheus.Labels{"role": "primary", "addr": d.addr}, collectors.NewDBStatsCollector(d.DB.DB, dbName)); err != nil {
+		return err
+	}
+	for _, r := range d.replicas {
+		if err := register(reg, prometheus.Labels{"role": "replica", "addr": r.addr}, collectors.NewDBStatsCollector(r.DB.DB, dbName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// register 重复注册时返回的错误中带上标签，便于确定是哪个连接池，之前注册的指标不受影响
+func register(reg prometheus.Registerer, labels prometheus.Labels, c prometheus.Collector) error {
+	err := prometheus.WrapRegistererWith(labels, reg).Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		return fmt.Errorf("pool metrics %s %s already registered, only the first pool is reported: %w", labels["role"], labels["addr"], err)
+	}
+	return err
+}
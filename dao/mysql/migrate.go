@@ -0,0 +1,54 @@
+package mysql
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"strings"
+	"web_app/logger"
+
+	"github.com/pressly/goose/v3"
+)
+
+// migrations 数据库迁移文件，编译进可执行文件中，按驱动放在 migrations/<driver> 目录下，
+// 文件名为 <版本号>_<说明>.sql，格式见 https://github.com/pressly/goose
+//
+//go:embed migrations/*/*.sql
+var migrations embed.FS
+
+// MigrateCommands Migrate 支持的命令，create、fix 等需要修改迁移文件的命令请使用 goose 命令行工具
+var MigrateCommands = []string{"up", "up-by-one", "up-to", "down", "down-to", "redo", "status", "version"}
+
+// Migrate 在主库上执行迁移命令，例如 up（执行所有未执行的迁移）、down（回滚最近的一次迁移）、status（打印每个迁移的状态）
+// up-to、down-to 的参数为目标版本号
+func Migrate(ctx context.Context, d *DB, command string, args ...string) (err error) {
+	supported := false
+	for _, c := range MigrateCommands {
+		supported = supported || c == command
+	}
+	if !supported {
+		return fmt.Errorf("unknown migrate command %q, supported: %s", command, strings.Join(MigrateCommands, ", "))
+	}
+	goose.SetBaseFS(migrations)
+	goose.SetLogger(gooseLogger{})
+	dialect := d.DriverName()
+	if dialect == DriverSQLite {
+		dialect = "sqlite3" // goose 中 sqlite 的方言名
+	}
+	if err = goose.SetDialect(dialect); err != nil {
+		return
+	}
+	return goose.RunContext(ctx, command, d.DB.DB, "migrations/"+d.DriverName(), args...)
+}
+
+// gooseLogger 把 goose 的输出写入 dao.mysql 日志
+type gooseLogger struct{}
+
+func (gooseLogger) Printf(format string, v ...interface{}) {
+	logger.Named("dao.mysql").Sugar().Infof(strings.TrimSpace(format), v...)
+}
+
+// Fatalf 只记录错误，不退出进程，迁移失败由 Migrate 返回的错误处理
+func (gooseLogger) Fatalf(format string, v ...interface{}) {
+	logger.Named("dao.mysql").Sugar().Errorf(strings.TrimSpace(format), v...)
+}
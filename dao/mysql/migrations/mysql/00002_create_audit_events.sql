@@ -0,0 +1,19 @@
+-- +goose Up
+-- audit.mutations.table 配置为 audit_events 时使用的表，见 audit.Init
+CREATE TABLE IF NOT EXISTS audit_events (
+	id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	created_at  DATETIME(3) NOT NULL,
+	table_name  VARCHAR(64) NOT NULL,
+	record_id   VARCHAR(64) NOT NULL DEFAULT '',
+	action      VARCHAR(16) NOT NULL,
+	user_id     VARCHAR(64) NOT NULL DEFAULT '',
+	request_id  VARCHAR(128) NOT NULL DEFAULT '',
+	before_data JSON NULL,
+	after_data  JSON NULL,
+	KEY idx_record (table_name, record_id, created_at),
+	KEY idx_user_id (user_id, created_at),
+	KEY idx_created_at (created_at)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- rbac 的策略，每行为一条规则：ptype 为 p（角色拥有的权限）或 g（用户属于的角色），见 rbac.Init
+CREATE TABLE IF NOT EXISTS casbin_rule (
+	id    BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	ptype VARCHAR(16) NOT NULL,
+	v0    VARCHAR(128) NOT NULL DEFAULT '',
+	v1    VARCHAR(128) NOT NULL DEFAULT '',
+	v2    VARCHAR(128) NOT NULL DEFAULT '',
+	v3    VARCHAR(128) NOT NULL DEFAULT '',
+	v4    VARCHAR(128) NOT NULL DEFAULT '',
+	v5    VARCHAR(128) NOT NULL DEFAULT '',
+	UNIQUE KEY uk_rule (ptype, v0, v1, v2, v3, v4, v5)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS casbin_rule;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- 示例用户模块（controller、logic、dao/mysql/user.go）使用的表，id 由 pkg/snowflake 生成
+CREATE TABLE IF NOT EXISTS users (
+	id         BIGINT NOT NULL PRIMARY KEY,
+	username   VARCHAR(64) NOT NULL,
+	password   VARCHAR(255) NOT NULL,
+	email      VARCHAR(255) NOT NULL DEFAULT '',
+	created_at DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	UNIQUE KEY uk_username (username)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS users;
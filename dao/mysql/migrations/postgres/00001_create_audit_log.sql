@@ -0,0 +1,19 @@
+-- +goose Up
+-- audit.table 配置为 audit_log 时使用的表，见 audit.Init
+CREATE TABLE IF NOT EXISTS audit_log (
+	id          BIGSERIAL PRIMARY KEY,
+	created_at  TIMESTAMP(3) NOT NULL,
+	user_id     VARCHAR(64) NOT NULL DEFAULT '',
+	method      VARCHAR(16) NOT NULL,
+	route       VARCHAR(255) NOT NULL,
+	path        VARCHAR(1024) NOT NULL,
+	resource_id VARCHAR(64) NOT NULL DEFAULT '',
+	status      INT NOT NULL,
+	ip          VARCHAR(64) NOT NULL,
+	request_id  VARCHAR(128) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- audit.mutations.table 配置为 audit_events 时使用的表，见 audit.Init
+CREATE TABLE IF NOT EXISTS audit_events (
+	id          BIGSERIAL PRIMARY KEY,
+	created_at  TIMESTAMP(3) NOT NULL,
+	table_name  VARCHAR(64) NOT NULL,
+	record_id   VARCHAR(64) NOT NULL DEFAULT '',
+	action      VARCHAR(16) NOT NULL,
+	user_id     VARCHAR(64) NOT NULL DEFAULT '',
+	request_id  VARCHAR(128) NOT NULL DEFAULT '',
+	before_data JSONB NULL,
+	after_data  JSONB NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_record ON audit_events (table_name, record_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- audit.table 配置为 audit_log 时使用的表，见 audit.Init
+CREATE TABLE IF NOT EXISTS audit_log (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at  DATETIME NOT NULL,
+	user_id     TEXT NOT NULL DEFAULT '',
+	method      TEXT NOT NULL,
+	route       TEXT NOT NULL,
+	path        TEXT NOT NULL,
+	resource_id TEXT NOT NULL DEFAULT '',
+	status      INTEGER NOT NULL,
+	ip          TEXT NOT NULL,
+	request_id  TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_log;
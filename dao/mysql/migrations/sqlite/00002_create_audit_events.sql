@@ -0,0 +1,19 @@
+-- +goose Up
+-- audit.mutations.table 配置为 audit_events 时使用的表，见 audit.Init
+CREATE TABLE IF NOT EXISTS audit_events (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at  DATETIME NOT NULL,
+	table_name  TEXT NOT NULL,
+	record_id   TEXT NOT NULL DEFAULT '',
+	action      TEXT NOT NULL,
+	user_id     TEXT NOT NULL DEFAULT '',
+	request_id  TEXT NOT NULL DEFAULT '',
+	before_data TEXT NULL,
+	after_data  TEXT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_record ON audit_events (table_name, record_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- rbac 的策略，每行为一条规则：ptype 为 p（角色拥有的权限）或 g（用户属于的角色），见 rbac.Init
+CREATE TABLE IF NOT EXISTS casbin_rule (
+	id    INTEGER PRIMARY KEY AUTOINCREMENT,
+	ptype TEXT NOT NULL,
+	v0    TEXT NOT NULL DEFAULT '',
+	v1    TEXT NOT NULL DEFAULT '',
+	v2    TEXT NOT NULL DEFAULT '',
+	v3    TEXT NOT NULL DEFAULT '',
+	v4    TEXT NOT NULL DEFAULT '',
+	v5    TEXT NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_casbin_rule ON casbin_rule (ptype, v0, v1, v2, v3, v4, v5);
+
+-- +goose Down
+DROP TABLE IF EXISTS casbin_rule;
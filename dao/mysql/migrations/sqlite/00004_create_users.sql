@@ -0,0 +1,13 @@
+-- +goose Up
+-- 示例用户模块（controller、logic、dao/mysql/user.go）使用的表，id 由 pkg/snowflake 生成
+CREATE TABLE IF NOT EXISTS users (
+	id         INTEGER NOT NULL PRIMARY KEY,
+	username   TEXT NOT NULL,
+	password   TEXT NOT NULL,
+	email      TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_users_username ON users (username);
+
+-- +goose Down
+DROP TABLE IF EXISTS users;
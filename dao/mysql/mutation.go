@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Repository 写入的类型
+const (
+	ActionInsert  = "insert"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionUpsert  = "upsert"
+	ActionRestore = "restore"
+)
+
+// Mutation Repository 的一次写入，Before、After 为写入前后的记录（*T），插入时 Before 为 nil，删除时 After 为 nil，
+// Upsert 时只有 After；InsertBatch 时自增主键没有回填，ID 为 0
+type Mutation struct {
+	Action string
+	Table  string
+	ID     interface{}
+	Before interface{}
+	After  interface{}
+}
+
+// MutationHook 写入成功后调用（在事务中时为事务提交后），不应阻塞，例如只把记录放入队列
+type MutationHook func(ctx context.Context, m Mutation)
+
+type mutationHook struct {
+	hook   MutationHook
+	tables map[string]bool
+}
+
+var currentHook atomic.Pointer[mutationHook]
+
+// SetMutationHook 设置 Repository 写入后的回调，tables 为空时所有表都调用，hook 为 nil 时取消
+// 设置后 Update、Delete 会在写入前多查询一次记录作为 Before；通过 Exec 等手写的 SQL 不会调用
+func SetMutationHook(hook MutationHook, tables ...string) {
+	if hook == nil {
+		currentHook.Store(nil)
+		return
+	}
+	h := &mutationHook{hook: hook}
+	if len(tables) > 0 {
+		h.tables = make(map[string]bool, len(tables))
+		for _, t := range tables {
+			h.tables[t] = true
+		}
+	}
+	currentHook.Store(h)
+}
+
+// hooked 写入 r.table 时是否需要调用 MutationHook
+func (r *Repository[T]) hooked() bool {
+	h := currentHook.Load()
+	return h != nil && (h.tables == nil || h.tables[r.table])
+}
+
+// snapshot 写入前的记录，包括软删除的记录，查询失败时返回 nil
+func (r *Repository[T]) snapshot(ctx context.Context, q conn, id interface{}) *T {
+	var v T
+	if err := q.GetContext(ctx, &v, q.Rebind(r.selectSQL()+" WHERE "+r.pk+" = ?"), id); err != nil {
+		return nil
+	}
+	return &v
+}
+
+// emit 调用 MutationHook，ctx 中有事务时在提交后调用
+func (r *Repository[T]) emit(ctx context.Context, action string, id interface{}, before, after *T) {
+	h := currentHook.Load()
+	if h == nil || (h.tables != nil && !h.tables[r.table]) {
+		return
+	}
+	m := Mutation{Action: action, Table: r.table, ID: id}
+	if before != nil {
+		m.Before = before
+	}
+	if after != nil {
+		m.After = after
+	}
+	AfterCommit(ctx, func() { h.hook(ctx, m) })
+}
@@ -1,39 +1,334 @@
 package mysql
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web_app/health"
+	"web_app/logger"
+	"web_app/settings"
 
 	"go.uber.org/zap"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/spf13/viper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+	"gorm.io/gorm"
 
 	_ "github.com/go-sql-driver/mysql" // 匿名导入 自动执行 init()
 )
 
-var db *sqlx.DB
-
-func Init() (err error) {
-	//DSN (Data Source Name) Sprintf根据格式说明符进行格式化，并返回结果字符串。
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=true",
-		viper.GetString("mysql.user"),
-		viper.GetString("mysql.password"),
-		viper.GetString("mysql.host"),
-		viper.GetInt("mysql.port"),
-		viper.GetString("mysql.dbname"),
-	)
-	// 连接到数据库并使用ping进行验证。
-	// 也可以使用 MustConnect MustConnect连接到数据库，并在出现错误时恐慌 panic。
-	db, err = sqlx.Connect("mysql", dsn)
+// DB MySQL 连接池，嵌入主库的 *sqlx.DB，可以直接调用 sqlx 的方法
+// 配置了只读副本时，Select、Get、Query 等查询方法发送到副本，其他方法使用主库
+// 启用 mysql.breaker 时数据库不可用的错误达到一定比例后熔断，之后的语句直接返回 ErrUnavailable，见 SetBreaker
+// 维护模式（mysql.read_only）下写入直接返回 ErrReadOnly，见 SetReadOnly
+// Select、Get、Query、Exec 等方法带有 mysql.query_timeout 的超时，见 query.go
+// 单元测试或者同一个进程中需要连接多个数据库时使用 New 创建，业务代码一般使用 Init 初始化的默认连接池
+type DB struct {
+	*sqlx.DB
+	// addr 主库的地址，dbName 数据库名，用于指标的标签和 span 的属性
+	addr     string
+	dbName   string
+	replicas []*replica
+	next     atomic.Uint64
+	// stop 停止副本的健康检查，closeOnce、closeErr 保证 Close 只执行一次，见 Close
+	stop      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	// queryTimeout 每条语句的超时时间，见 SetQueryTimeout
+	queryTimeout atomic.Int64
+	// slowThreshold、slowLogArgs 慢查询日志的配置，见 SetSlowQuery
+	slowThreshold atomic.Int64
+	slowLogArgs   atomic.Bool
+	// batchSize、maxPacket 批量写入时每条语句最多的行数和字节数，见 SetBatchLimits
+	batchSize atomic.Int64
+	maxPacket atomic.Int64
+	// breaker 熔断器，没有启用时为 nil，见 SetBreaker
+	breaker        atomic.Pointer[gobreaker.CircuitBreaker]
+	breakerTimeout atomic.Int64
+	// readOnly 维护模式，见 SetReadOnly
+	readOnly atomic.Bool
+	// stmts 预处理语句的缓存，见 SetStmtCacheSize
+	stmts stmtCache
+	// backend NewStore 使用的实现，gormDB 为共用该连接池的 *gorm.DB，见 Gorm
+	backend  string
+	gormOnce sync.Once
+	gormDB   *gorm.DB
+	gormErr  error
+}
+
+const (
+	// DefaultName 默认连接池在日志中的名称
+	DefaultName = "default"
+	// pingTimeout Ping 和副本健康检查的超时时间
+	pingTimeout = 2 * time.Second
+)
+
+var (
+	// db 默认的连接池，由 Init 初始化
+	db *DB
+	// dbs mysql.databases 中配置的命名连接池，键为小写的名称
+	dbs map[string]*DB
+)
+
+// New 根据 MySQL 配置创建连接池，并使用 ping 验证连接，mysql.driver 可以切换为 PostgreSQL 或 SQLite
+func New(cfg *settings.MySQLConfig) (*DB, error) {
+	driver := driverName(cfg.Driver)
+	source := cfg.DSN
+	if source == "" {
+		var err error
+		if source, err = dsn(cfg, cfg.Host, cfg.Port, cfg.User, cfg.Password); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := connect(driver, source, &cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	d := &DB{DB: conn, addr: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port), dbName: cfg.DBName, backend: cfg.Backend}
+	if err = d.openReplicas(cfg); err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	if d.backend == BackendGorm {
+		// 驱动不支持 GORM 时启动失败，而不是在第一次使用时 panic
+		if _, err = d.Gorm(); err != nil {
+			_ = d.Close()
+			return nil, err
+		}
+	}
+	d.SetPoolSize(cfg.MaxOpenConns, cfg.MaxIdleConns)
+	d.SetConnLifetime(cfg.ConnMaxLifetime, cfg.ConnMaxIdleTime)
+	d.SetQueryTimeout(cfg.QueryTimeout)
+	d.SetSlowQuery(cfg.SlowThreshold, cfg.SlowLogArgs)
+	d.SetBatchLimits(cfg.BatchSize, cfg.MaxAllowedPacket)
+	d.SetStmtCacheSize(cfg.StmtCacheSize)
+	return d, nil
+}
+
+// SetPoolSize 调整主库和所有副本的连接池大小
+func (d *DB) SetPoolSize(maxOpenConns, maxIdleConns int) {
+	d.DB.SetMaxOpenConns(maxOpenConns) // 设置数据库的最大打开连接数。
+	d.DB.SetMaxIdleConns(maxIdleConns) // 设置空闲连接池中的最大连接数。
+	for _, r := range d.replicas {
+		r.SetMaxOpenConns(maxOpenConns)
+		r.SetMaxIdleConns(maxIdleConns)
+	}
+}
+
+// SetConnLifetime 设置主库和所有副本中连接的最长存活时间和最长空闲时间，0 表示不限制
+// 应小于 MySQL 的 wait_timeout 以及中间的代理、负载均衡的空闲超时，避免使用已经被服务端关闭的连接（invalid connection）
+func (d *DB) SetConnLifetime(maxLifetime, maxIdleTime time.Duration) {
+	d.DB.SetConnMaxLifetime(maxLifetime)
+	d.DB.SetConnMaxIdleTime(maxIdleTime)
+	for _, r := range d.replicas {
+		r.SetConnMaxLifetime(maxLifetime)
+		r.SetConnMaxIdleTime(maxIdleTime)
+	}
+}
+
+// connect 连接数据库，失败时按 retry 的配置以指数退避重试
+func connect(driver, dsn string, retry *settings.RetryConfig) (conn *sqlx.DB, err error) {
+	backoff := retry.InitialBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	maxBackoff := retry.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		// 连接到数据库并使用ping进行验证。
+		// 也可以使用 MustConnect MustConnect连接到数据库，并在出现错误时恐慌 panic。
+		conn, err = sqlx.Connect(driver, dsn)
+		if err == nil || attempt >= retry.MaxAttempts {
+			return
+		}
+		// 在 [backoff/2, backoff] 之间随机等待，避免多个实例同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		logger.Named("dao.mysql").Warn("connect DB failed, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", retry.MaxAttempts),
+			zap.Duration("backoff", wait),
+			zap.Error(err),
+		)
+		time.Sleep(wait)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Wrap 使用已有的连接创建 DB，例如单元测试中使用 sqlmock 创建的连接，只有 *sql.DB 时使用 NewFromDB
+//
+//	conn, mock, _ := sqlmock.New()
+//	d := mysql.Wrap(sqlx.NewDb(conn, "mysql"))
+func Wrap(conn *sqlx.DB) *DB {
+	return &DB{DB: conn}
+}
+
+// Init 根据 MySQL 配置初始化默认的连接池、mysql.databases 中配置的命名连接池和 mysql.shards 中配置的分片路由
+func Init(cfg *settings.MySQLConfig) (err error) {
+	if db, err = open(DefaultName, cfg); err != nil {
+		return
+	}
+	if cfg.AutoMigrate {
+		// 迁移只在默认的连接池上执行
+		if err = Migrate(context.Background(), db, "up"); err != nil {
+			logger.Named("dao.mysql").Error("migrate DB failed", zap.Error(err))
+			return
+		}
+	}
+	dbs = make(map[string]*DB, len(cfg.Databases))
+	for name, c := range cfg.Databases {
+		c := c
+		var d *DB
+		if d, err = open(name, &c); err != nil {
+			return
+		}
+		dbs[name] = d
+	}
+	if err = initRouters(cfg); err != nil {
+		return
+	}
+	// 数据库不可用时 /readiness 返回 503
+	health.Register("mysql", Ping)
+	for name, d := range dbs {
+		health.Register("mysql."+name, d.Ping)
+	}
+	current := *cfg
+	// 连接池的大小、连接的存活时间和语句的超时时间可以在运行时调整，连接信息变化、增减命名连接池则需要重启服务
+	settings.OnChange(func(c settings.Config) {
+		next := c.MySQL
+		db.apply(DefaultName, &current, &next)
+		for name, d := range dbs {
+			cur, nxt := current.Databases[name], next.Databases[name]
+			if _, ok := next.Databases[name]; ok {
+				d.apply(name, &cur, &nxt)
+			}
+		}
+		if len(next.Databases) != len(dbs) || !sameNames(next.Databases, dbs) {
+			logger.Named("dao.mysql").Warn("mysql.databases changed, restart required to take effect")
+		}
+		if !reflect.DeepEqual(next.Shards, current.Shards) {
+			logger.Named("dao.mysql").Warn("mysql.shards changed, restart required to take effect")
+		}
+		current = next
+	})
+	return
+}
+
+// open 创建连接池、熔断器并注册指标，name 为连接池的名称，用于日志
+func open(name string, cfg *settings.MySQLConfig) (d *DB, err error) {
+	d, err = New(cfg)
 	if err != nil {
-		zap.L().Error("connect DB failed", zap.Error(err))
+		logger.Named("dao.mysql").Error("connect DB failed", zap.String("database", name), zap.Error(err))
 		return
 	}
-	db.SetMaxOpenConns(viper.GetInt("mysql.max_open_conns")) // 设置数据库的最大打开连接数。
-	db.SetMaxIdleConns(viper.GetInt("mysql.max_idle_conns")) // 设置空闲连接池中的最大连接数。
+	d.SetBreaker(name, &cfg.Breaker)
+	d.SetReadOnly(cfg.ReadOnly)
+	if err = d.RegisterMetrics(prometheus.DefaultRegisterer, cfg.DBName); err != nil {
+		logger.Named("dao.mysql").Error("register mysql metrics failed", zap.String("database", name), zap.Error(err))
+	}
 	return
 }
 
+// apply 配置热加载时调整连接池
+func (d *DB) apply(name string, current, next *settings.MySQLConfig) {
+	log := logger.Named("dao.mysql").With(zap.String("database", name))
+	if next.MaxOpenConns != current.MaxOpenConns || next.MaxIdleConns != current.MaxIdleConns {
+		d.SetPoolSize(next.MaxOpenConns, next.MaxIdleConns)
+		log.Info("mysql pool size changed",
+			zap.Int("max_open_conns", next.MaxOpenConns),
+			zap.Int("max_idle_conns", next.MaxIdleConns),
+		)
+	}
+	if next.ConnMaxLifetime != current.ConnMaxLifetime || next.ConnMaxIdleTime != current.ConnMaxIdleTime {
+		d.SetConnLifetime(next.ConnMaxLifetime, next.ConnMaxIdleTime)
+		log.Info("mysql connection lifetime changed",
+			zap.Duration("conn_max_lifetime", next.ConnMaxLifetime),
+			zap.Duration("conn_max_idle_time", next.ConnMaxIdleTime),
+		)
+	}
+	if next.QueryTimeout != current.QueryTimeout {
+		d.SetQueryTimeout(next.QueryTimeout)
+		log.Info("mysql query timeout changed", zap.Duration("query_timeout", next.QueryTimeout))
+	}
+	if next.SlowThreshold != current.SlowThreshold || next.SlowLogArgs != current.SlowLogArgs {
+		d.SetSlowQuery(next.SlowThreshold, next.SlowLogArgs)
+	}
+	if next.BatchSize != current.BatchSize || next.MaxAllowedPacket != current.MaxAllowedPacket {
+		d.SetBatchLimits(next.BatchSize, next.MaxAllowedPacket)
+	}
+	if next.StmtCacheSize != current.StmtCacheSize {
+		d.SetStmtCacheSize(next.StmtCacheSize)
+		log.Info("mysql statement cache size changed", zap.Int("stmt_cache_size", next.StmtCacheSize))
+	}
+	if next.Breaker != current.Breaker {
+		d.SetBreaker(name, &next.Breaker)
+		log.Info("mysql circuit breaker changed", zap.Bool("enable", next.Breaker.Enable))
+	}
+	if next.ReadOnly != current.ReadOnly {
+		d.SetReadOnly(next.ReadOnly)
+		log.Warn("mysql read-only mode changed", zap.Bool("read_only", next.ReadOnly))
+	}
+	if next.Host != current.Host || next.Port != current.Port || next.User != current.User ||
+		next.Password != current.Password || next.DBName != current.DBName ||
+		next.Driver != current.Driver || next.DSN != current.DSN || !reflect.DeepEqual(next.Replicas, current.Replicas) ||
+		next.TLS != current.TLS || next.Loc != current.Loc || next.Params != current.Params || next.Timeout != current.Timeout ||
+		next.ReadTimeout != current.ReadTimeout || next.WriteTimeout != current.WriteTimeout || next.Backend != current.Backend {
+		log.Warn("mysql connection settings changed, restart required to take effect")
+	}
+}
+
+func sameNames(cfgs map[string]settings.MySQLConfig, pools map[string]*DB) bool {
+	for name := range cfgs {
+		if pools[name] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Ping 检查默认连接池的主库是否可用，超时时间最长为 2s
+func Ping(ctx context.Context) error {
+	if db == nil {
+		return ErrNotInitialized
+	}
+	return db.Ping(ctx)
+}
+
+// Ping 检查主库是否可用，超时时间最长为 2s，副本不可用时查询会回退到主库，不影响 Ping 的结果
+func (d *DB) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return d.DB.PingContext(ctx)
+}
+
+// Default 返回 Init 创建的默认连接池，没有初始化时返回 nil
+// 新的 dao 代码应通过构造函数接收 Querier 或 *DB，而不是直接使用 Default，这样单元测试中可以传入 NewFromDB 包装的 sqlmock
+func Default() *DB {
+	return db
+}
+
+// Get 返回 mysql.databases 中名为 name 的连接池，没有配置时返回 nil，name 不区分大小写
+//
+//	err := mysql.Get("orders").GetContext(ctx, &order, "SELECT * FROM orders WHERE id = ?", id)
+func Get(name string) *DB {
+	return dbs[strings.ToLower(name)]
+}
+
+// Close 关闭所有的连接池
 func Close() {
-	_ = db.Close()
+	if db != nil {
+		_ = db.Close()
+	}
+	for _, d := range dbs {
+		_ = d.Close()
+	}
 }
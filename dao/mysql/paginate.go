@@ -0,0 +1,134 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"web_app/pagination"
+)
+
+// Page 按 pagination.Parse 解析出的参数分页查询，opts 中的 Page、PageSize 被忽略
+// 偏移分页时按 opts.OrderBy 排序并同时查询总数；游标分页时按 opts.OrderBy 的列（缺少主键时追加主键，默认为主键升序）
+// 生成 keyset 条件，所有列的方向必须相同，不查询总数
+//
+//	p, err := pagination.Parse(c)
+//	if err != nil {
+//		response.ErrorWithMsg(c, response.CodeInvalidParam, err.Error())
+//		return
+//	}
+//	result, err := orders.Page(c.Request.Context(), p, mysql.ListOptions{Where: "user_id = ?", Args: []interface{}{uid}, OrderBy: "created_at DESC"})
+func (r *Repository[T]) Page(ctx context.Context, p pagination.Params, opts ListOptions) (result *pagination.Result[T], err error) {
+	if !p.IsCursor() {
+		return offsetPage[T](ctx, r, p, opts)
+	}
+	columns, desc, err := r.keysetColumns(opts.OrderBy)
+	if err != nil {
+		return
+	}
+	where := []string{opts.Where}
+	args := append([]interface{}(nil), opts.Args...)
+	if p.Cursor != "" {
+		t := reflect.TypeOf((*T)(nil)).Elem()
+		types := make([]reflect.Type, len(columns))
+		for i, c := range columns {
+			types[i] = t.FieldByIndex(r.index[c]).Type
+		}
+		clause, keysetArgs, err := keysetWhere(p.Cursor, columns, desc, types)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, clause)
+		args = append(args, keysetArgs...)
+	}
+	query := r.selectSQL() + r.where(where...) + " ORDER BY " + keysetOrderBy(columns, desc)
+	limit, limitArgs := p.LimitOffset()
+	q := r.conn(ctx)
+	items := []T{}
+	if err = q.SelectContext(ctx, &items, q.Rebind(query+limit), append(args, limitArgs...)...); err != nil {
+		return
+	}
+	items, more := pagination.Trim(p, items)
+	result = &pagination.Result[T]{Items: items, Meta: pagination.Meta{Size: p.Size, HasMore: more}}
+	if more {
+		last := reflect.ValueOf(&items[len(items)-1]).Elem()
+		values := make([]interface{}, len(columns))
+		for i, c := range columns {
+			values[i] = last.FieldByIndex(r.index[c]).Interface()
+		}
+		result.Meta.NextCursor, err = pagination.EncodeCursor(values...)
+	}
+	return
+}
+
+// keysetColumns 游标分页的排序列和方向
+func (r *Repository[T]) keysetColumns(orderBy string) (columns []string, desc bool, err error) {
+	if orderBy != "" {
+		if orderBy, err = r.orderBy(orderBy); err != nil {
+			return
+		}
+	}
+	return keysetOrder(orderBy, r.pk)
+}
+
+// offsetPage 偏移分页：先查询总数，当前页在范围内时再查询列表
+func offsetPage[T any](ctx context.Context, s Store[T], p pagination.Params, opts ListOptions) (result *pagination.Result[T], err error) {
+	opts.Page, opts.PageSize = p.Page, p.Size
+	var total int64
+	if total, err = s.Count(ctx, opts.Where, opts.Args...); err != nil {
+		return
+	}
+	result = &pagination.Result[T]{Items: []T{}, Meta: pagination.OffsetMeta(p, total)}
+	if int64(p.Offset()) < total {
+		result.Items, err = s.List(ctx, opts)
+	}
+	return
+}
+
+// keysetOrder 把校验过的 orderBy 转换为游标分页的排序列和方向，orderBy 为空时按主键升序，缺少主键时追加主键
+func keysetOrder(orderBy, pk string) (columns []string, desc bool, err error) {
+	if orderBy == "" {
+		return []string{pk}, false, nil
+	}
+	hasPK := false
+	for i, part := range strings.Split(orderBy, ", ") {
+		fields := strings.Fields(part)
+		d := len(fields) == 2 && fields[1] == "DESC"
+		if i > 0 && d != desc {
+			return nil, false, errors.New("cursor pagination requires the same direction for all order by columns")
+		}
+		desc = d
+		columns = append(columns, fields[0])
+		hasPK = hasPK || fields[0] == pk
+	}
+	if !hasPK {
+		columns = append(columns, pk)
+	}
+	return
+}
+
+// keysetWhere 解码 cursor 并生成位于其后的查询条件，types 为 columns 对应字段的类型
+func keysetWhere(cursor string, columns []string, desc bool, types []reflect.Type) (string, []interface{}, error) {
+	dest := make([]interface{}, len(columns))
+	for i, t := range types {
+		dest[i] = reflect.New(t).Interface()
+	}
+	if err := pagination.DecodeCursor(cursor, dest...); err != nil {
+		return "", nil, err
+	}
+	values := make([]interface{}, len(columns))
+	for i := range dest {
+		values[i] = reflect.ValueOf(dest[i]).Elem().Interface()
+	}
+	clause, args := pagination.Keyset(columns, desc, values)
+	return clause, args, nil
+}
+
+// keysetOrderBy 游标分页的 ORDER BY，所有列的方向相同
+func keysetOrderBy(columns []string, desc bool) string {
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+	return strings.Join(columns, dir+", ") + dir
+}
@@ -0,0 +1,286 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 以下方法覆盖 sqlx.DB 中的同名方法：
+//   - 每条语句都带有 mysql.query_timeout 的超时，ctx 本身的截止时间更早时使用 ctx 的，请求结束或者超时后语句随之取消
+//   - 查询发送到 Reader 选择的连接，Exec 发送到主库
+//   - SQL 中的 ? 占位符按驱动转换（PostgreSQL 为 $1、$2...），事务中使用 tx.Rebind 转换
+//   - 启用 mysql.stmt_cache_size 时按 SQL 缓存预处理语句（PreparexContext），相同的 SQL 不再重复预处理，见 prepared；事务中的语句不缓存
+//   - 耗时超过 mysql.slow_threshold 的语句记录慢查询日志，见 observe
+//   - 维护模式下 Exec、NamedExec 直接返回 ErrReadOnly，数据库拒绝写入的错误（例如主从切换时服务端开启了 read_only）同样转换为 ErrReadOnly
+//   - 启用 mysql.breaker 时在熔断器中执行，熔断时直接返回 ErrUnavailable；QueryRowx 返回的 Row 无法携带该错误，不经过熔断器
+//   - 启用链路追踪时每条语句是请求 span 的子 span，见 startSpan；事务中通过 *sqlx.Tx 执行的语句不会单独生成 span
+//
+// 不带 Context 的版本使用 context.Background()，只有 query_timeout 的限制，处理请求时应使用带 Context 的版本并传入请求的 ctx
+
+// SetQueryTimeout 修改每条语句的超时时间，0 表示不限制
+func (d *DB) SetQueryTimeout(timeout time.Duration) {
+	d.queryTimeout.Store(int64(timeout))
+}
+
+// withTimeout 返回带有 query_timeout 超时的 ctx
+func (d *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(d.queryTimeout.Load())
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// rowsContext 返回 Rows 的查询使用的 ctx：Next、Scan 时仍然使用 ctx，不能在返回前取消。
+// 查询失败时立即调用返回的 cancel，成功时交给 Rows、Row，关闭或者读取完之后调用；不需要额外的超时时 ctx 原样返回
+func (d *DB) rowsContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(d.queryTimeout.Load())
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Rows QueryxContext、QueryContext 返回的结果，Close 或者 Next 返回 false（读取完或者出错）时释放 query_timeout 的计时器，
+// 读取完之前计时器不会被释放，超时到期时读取失败
+type Rows struct {
+	*sqlx.Rows
+	cancel context.CancelFunc
+}
+
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.cancel()
+	return false
+}
+
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
+
+// Row QueryRowxContext 返回的结果，Scan、StructScan、MapScan、SliceScan 之后释放 query_timeout 的计时器
+type Row struct {
+	*sqlx.Row
+	cancel context.CancelFunc
+}
+
+func (r *Row) Scan(dest ...interface{}) error {
+	defer r.cancel()
+	return r.Row.Scan(dest...)
+}
+
+func (r *Row) StructScan(dest interface{}) error {
+	defer r.cancel()
+	return r.Row.StructScan(dest)
+}
+
+func (r *Row) MapScan(dest map[string]interface{}) error {
+	defer r.cancel()
+	return r.Row.MapScan(dest)
+}
+
+func (r *Row) SliceScan() ([]interface{}, error) {
+	defer r.cancel()
+	return r.Row.SliceScan()
+}
+
+func (d *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	query = d.Rebind(query)
+	parent := ctx
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	ctx = d.startSpan(ctx, "select", query)
+	err := d.guard(parent, func() error {
+		q, release, err := d.prepared(ctx, d.Reader(ctx), query)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return sqlx.SelectContext(ctx, q, dest, query, args...)
+	})
+	d.observe(ctx, "select", query, args, start, selectedRows(dest), err)
+	return err
+}
+
+func (d *DB) Select(dest interface{}, query string, args ...interface{}) error {
+	return d.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (d *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	query = d.Rebind(query)
+	parent := ctx
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	ctx = d.startSpan(ctx, "get", query)
+	err := d.guard(parent, func() error {
+		q, release, err := d.prepared(ctx, d.Reader(ctx), query)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return sqlx.GetContext(ctx, q, dest, query, args...)
+	})
+	d.observe(ctx, "get", query, args, start, 1, err)
+	return err
+}
+
+func (d *DB) Get(dest interface{}, query string, args ...interface{}) error {
+	return d.GetContext(context.Background(), dest, query, args...)
+}
+
+func (d *DB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	rows, cancel, err := d.queryx(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{Rows: rows, cancel: cancel}, nil
+}
+
+func (d *DB) Queryx(query string, args ...interface{}) (*Rows, error) {
+	return d.QueryxContext(context.Background(), query, args...)
+}
+
+// QueryContext 与 QueryxContext 相同，覆盖 sql.DB 的 QueryContext
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	return d.QueryxContext(ctx, query, args...)
+}
+
+func (d *DB) Query(query string, args ...interface{}) (*Rows, error) {
+	return d.QueryxContext(context.Background(), query, args...)
+}
+
+// queryx 执行返回 Rows 的查询，读取完之后调用返回的 cancel 释放 query_timeout 的计时器，查询失败时已经释放
+func (d *DB) queryx(ctx context.Context, query string, args ...interface{}) (rows *sqlx.Rows, cancel context.CancelFunc, err error) {
+	parent := ctx
+	query = d.Rebind(query)
+	ctx, cancel = d.rowsContext(ctx)
+	start := time.Now()
+	ctx = d.startSpan(ctx, "query", query)
+	err = d.guard(parent, func() error {
+		q, release, err := d.prepared(ctx, d.Reader(ctx), query)
+		if err != nil {
+			return err
+		}
+		defer release()
+		rows, err = q.QueryxContext(ctx, query, args...)
+		return err
+	})
+	d.observe(ctx, "query", query, args, start, -1, err)
+	if err != nil {
+		cancel()
+	}
+	return
+}
+
+func (d *DB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *Row {
+	query = d.Rebind(query)
+	ctx, cancel := d.rowsContext(ctx)
+	start := time.Now()
+	ctx = d.startSpan(ctx, "query", query)
+	var row *sqlx.Row
+	conn := d.Reader(ctx)
+	// *sqlx.Row 无法携带预处理的错误，预处理失败时直接执行，由执行返回错误
+	if q, release, err := d.prepared(ctx, conn, query); err == nil {
+		row = q.QueryRowxContext(ctx, query, args...)
+		release()
+	} else {
+		row = conn.QueryRowxContext(ctx, query, args...)
+	}
+	if row.Err() != nil {
+		cancel()
+	}
+	d.observe(ctx, "query", query, args, start, -1, row.Err())
+	return &Row{Row: row, cancel: cancel}
+}
+
+func (d *DB) QueryRowx(query string, args ...interface{}) *Row {
+	return d.QueryRowxContext(context.Background(), query, args...)
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := d.writable(); err != nil {
+		return nil, err
+	}
+	query = d.Rebind(query)
+	parent := ctx
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	ctx = d.startSpan(ctx, "exec", query)
+	var result sql.Result
+	err := d.guard(parent, func() error {
+		q, release, err := d.prepared(ctx, d.DB, query)
+		if err != nil {
+			return err
+		}
+		defer release()
+		result, err = q.ExecContext(ctx, query, args...)
+		return err
+	})
+	d.observe(ctx, "exec", query, args, start, rowsAffected(result), err)
+	return result, readOnlyError(err)
+}
+
+func (d *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.ExecContext(context.Background(), query, args...)
+}
+
+func (d *DB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	if err := d.writable(); err != nil {
+		return nil, err
+	}
+	// 按驱动把 :name 转换为占位符，之后与 Exec 相同
+	bound, args, err := d.BindNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	parent := ctx
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	ctx = d.startSpan(ctx, "exec", query)
+	var result sql.Result
+	err = d.guard(parent, func() error {
+		q, release, err := d.prepared(ctx, d.DB, bound)
+		if err != nil {
+			return err
+		}
+		defer release()
+		result, err = q.ExecContext(ctx, bound, args...)
+		return err
+	})
+	// query 中 :name 的顺序与 args 相同，慢查询日志按名称脱敏
+	d.observe(ctx, "exec", query, args, start, rowsAffected(result), err)
+	return result, readOnlyError(err)
+}
+
+func (d *DB) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	return d.NamedExecContext(context.Background(), query, arg)
+}
+
+// rowsAffected Exec 影响的行数，未知时返回 -1
+func rowsAffected(result sql.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,69 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// ErrReadOnly 维护模式下写入时返回的错误，handler 应返回 503，见 middlewares.DBUnavailable
+var ErrReadOnly = errors.New("database is in read-only mode")
+
+// SetReadOnly 开启或关闭维护模式：Exec、NamedExec 和 Repository 的写入直接返回 ErrReadOnly，查询正常执行，
+// WithTx 开启只读事务，事务中的写入由数据库拒绝（SQLite 不支持只读事务，不会拒绝）；迁移、主从切换时使用
+func (d *DB) SetReadOnly(on bool) {
+	d.readOnly.Store(on)
+}
+
+// ReadOnly 是否处于维护模式
+func (d *DB) ReadOnly() bool {
+	return d.readOnly.Load()
+}
+
+// SetReadOnly 切换默认连接池和所有命名连接池的维护模式，见 (*DB).SetReadOnly
+func SetReadOnly(on bool) error {
+	if db == nil {
+		return ErrNotInitialized
+	}
+	db.SetReadOnly(on)
+	for _, d := range dbs {
+		d.SetReadOnly(on)
+	}
+	return nil
+}
+
+// ReadOnly 默认连接池是否处于维护模式
+func ReadOnly() bool {
+	return db != nil && db.ReadOnly()
+}
+
+// writable 维护模式下返回 ErrReadOnly
+func (d *DB) writable() error {
+	if d.readOnly.Load() {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// readOnlyError 把数据库拒绝写入的错误（只读事务、服务端开启了 read_only）转换为 ErrReadOnly，并保留原始的错误
+func readOnlyError(err error) error {
+	if err == nil || errors.Is(err, ErrReadOnly) {
+		return err
+	}
+	var myErr *mysqldriver.MySQLError
+	// 1792 Cannot execute statement in a READ ONLY transaction，1836 Running in read-only mode，
+	// 1290 The MySQL server is running with the --read-only option（其他选项也使用 1290，需要检查错误信息）
+	if errors.As(err, &myErr) && (myErr.Number == 1792 || myErr.Number == 1836 ||
+		(myErr.Number == 1290 && strings.Contains(myErr.Message, "read-only"))) {
+		return fmt.Errorf("%w: %w", ErrReadOnly, err)
+	}
+	var pqErr *pq.Error
+	// 25006 read_only_sql_transaction
+	if errors.As(err, &pqErr) && pqErr.Code == "25006" {
+		return fmt.Errorf("%w: %w", ErrReadOnly, err)
+	}
+	return err
+}
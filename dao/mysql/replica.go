@@ -0,0 +1,131 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// replica 一个只读副本，healthy 由后台的健康检查更新
+type replica struct {
+	*sqlx.DB
+	addr    string
+	healthy atomic.Bool
+}
+
+type usePrimaryCtxKey struct{}
+
+// UsePrimary 返回的 context 中的查询都发送到主库，用于写入之后马上读取、不能接受副本延迟的场景
+//
+//	ctx = mysql.UsePrimary(ctx)
+//	err := db.GetContext(ctx, &user, "SELECT * FROM user WHERE id = ?", id)
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usePrimaryCtxKey{}, true)
+}
+
+func usingPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(usePrimaryCtxKey{}).(bool)
+	return v
+}
+
+// openReplicas 打开 cfg.Replicas 中的副本，启动时副本不可用不影响启动，由健康检查在恢复后启用
+func (d *DB) openReplicas(cfg *settings.MySQLConfig) error {
+	if len(cfg.Replicas) == 0 {
+		return nil
+	}
+	for _, rc := range cfg.Replicas {
+		user, password := rc.User, rc.Password
+		if user == "" {
+			user, password = cfg.User, cfg.Password
+		}
+		source, err := dsn(cfg, rc.Host, rc.Port, user, password)
+		if err != nil {
+			return err
+		}
+		// Open 不会建立连接，连接在第一次使用时建立
+		conn, err := sqlx.Open(d.DriverName(), source)
+		if err != nil {
+			return err
+		}
+		d.replicas = append(d.replicas, &replica{DB: conn, addr: fmt.Sprintf("%s:%d", rc.Host, rc.Port)})
+	}
+	d.checkReplicas()
+	interval := cfg.HealthCheckInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	d.stop = make(chan struct{})
+	go d.healthCheck(interval)
+	return nil
+}
+
+func (d *DB) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.checkReplicas()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// checkReplicas ping 每个副本，状态变化时记录日志
+func (d *DB) checkReplicas() {
+	for _, r := range d.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		err := r.PingContext(ctx)
+		cancel()
+		if healthy := err == nil; r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				logger.Named("dao.mysql").Info("mysql replica is healthy", zap.String("addr", r.addr))
+			} else {
+				logger.Named("dao.mysql").Warn("mysql replica is unhealthy, queries fallback to other replicas or primary",
+					zap.String("addr", r.addr), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Reader 返回执行查询使用的连接：轮询选择一个健康的副本，ctx 经过 UsePrimary 或者没有可用的副本时返回主库
+func (d *DB) Reader(ctx context.Context) *sqlx.DB {
+	if len(d.replicas) == 0 || usingPrimary(ctx) {
+		return d.DB
+	}
+	n := uint64(len(d.replicas))
+	start := d.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := d.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.DB
+		}
+	}
+	return d.DB
+}
+
+// Writer 返回主库的连接
+func (d *DB) Writer() *sqlx.DB {
+	return d.DB
+}
+
+// Close 关闭主库和所有副本的连接，重复调用时返回第一次的结果
+func (d *DB) Close() error {
+	d.closeOnce.Do(func() {
+		if d.stop != nil {
+			close(d.stop)
+		}
+		d.closeStmts()
+		for _, r := range d.replicas {
+			_ = r.DB.Close()
+		}
+		d.closeErr = d.DB.Close()
+	})
+	return d.closeErr
+}
@@ -0,0 +1,474 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// ColumnDeletedAt 软删除的列，模型中有该列时 Delete 只设置删除时间，查询自动过滤已删除的记录，见 Unscoped
+	// 字段应为 *time.Time 或 sql.NullTime，未删除时为 NULL
+	ColumnDeletedAt = "deleted_at"
+	// ColumnVersion 乐观锁的版本号列，模型中有该列时 Update 只更新版本号与模型中相同的记录并把版本号加 1
+	ColumnVersion = "version"
+)
+
+var (
+	// ErrNotFound Get 没有查到记录
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict 乐观锁冲突，可以使用 errors.Is 判断，需要详细信息时使用 errors.As 获取 *ConflictError
+	ErrConflict = errors.New("version conflict")
+)
+
+// ConflictError Update 时记录已被其他请求修改（版本号不同）或者已经删除，一般应提示用户刷新后重试，handler 可以返回 409
+type ConflictError struct {
+	Table   string
+	ID      interface{}
+	Version int64 // 模型中的版本号
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s %v version %d", ErrConflict, e.Table, e.ID, e.Version)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// BeforeInserter 等接口由模型（指针接收者）实现，在 Repository 写入前后调用，Before* 返回错误时不写入
+type (
+	BeforeInserter interface {
+		BeforeInsert(ctx context.Context) error
+	}
+	AfterInserter interface {
+		AfterInsert(ctx context.Context) error
+	}
+	BeforeUpdater interface {
+		BeforeUpdate(ctx context.Context) error
+	}
+	AfterUpdater interface {
+		AfterUpdate(ctx context.Context) error
+	}
+)
+
+// Repository 基于 sqlx 的通用 CRUD，列由模型字段的 db 标签决定，标签中可以带有以下选项：
+// pk 表示主键，没有标记时使用名为 id 的列；auto 表示由数据库生成的列（自增主键、DEFAULT CURRENT_TIMESTAMP 等），
+// 插入和更新时跳过，自增主键在插入后回填
+//
+//	type User struct {
+//		ID        int64     `db:"id,pk,auto"`
+//		Name      string    `db:"name"`
+//		CreatedAt time.Time `db:"created_at,auto"`
+//	}
+//	users := mysql.NewRepository[User](mysql.Default(), "user")
+//	u, err := users.Get(ctx, 1)
+//
+// ctx 中有事务时（见 ContextWithTx）在该事务中执行，否则使用 db，查询发送到副本
+// 模型中有 deleted_at、version 列时分别启用软删除和乐观锁，见 ColumnDeletedAt、ColumnVersion
+type Repository[T any] struct {
+	db      *DB
+	table   string
+	columns []string
+	index   map[string][]int // 列对应的字段
+	pk      string
+	auto    map[string]bool
+	// softDelete 模型中有 deleted_at 列，并且不是 Unscoped 返回的
+	softDelete bool
+	version    bool
+}
+
+// NewRepository 创建模型 T 的 Repository，table 为表名，T 必须是结构体
+func NewRepository[T any](db *DB, table string) *Repository[T] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("mysql: Repository model %s must be a struct", t))
+	}
+	r := &Repository[T]{db: db, table: table, index: make(map[string][]int), auto: make(map[string]bool)}
+	r.collect(t, nil)
+	if r.pk == "" {
+		r.pk = "id"
+	}
+	if _, ok := r.index[r.pk]; !ok {
+		panic(fmt.Sprintf("mysql: Repository model %s has no primary key column %q", t, r.pk))
+	}
+	_, r.softDelete = r.index[ColumnDeletedAt]
+	if i, ok := r.index[ColumnVersion]; ok {
+		if f := t.FieldByIndex(i); !f.Type.ConvertibleTo(reflect.TypeOf(int64(0))) || f.Type.Kind() == reflect.Float32 || f.Type.Kind() == reflect.Float64 {
+			panic(fmt.Sprintf("mysql: Repository model %s column %q must be an integer", t, ColumnVersion))
+		}
+		r.version = true
+	}
+	return r
+}
+
+// Unscoped 返回不过滤软删除的 Repository：查询包括已删除的记录，Delete 物理删除
+func (r *Repository[T]) Unscoped() *Repository[T] {
+	u := *r
+	u.softDelete = false
+	return &u
+}
+
+// collect 收集结构体中带 db 标签的字段，匿名嵌入的结构体展开
+func (r *Repository[T]) collect(t reflect.Type, parent []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int(nil), parent...), i)
+		tag, ok := f.Tag.Lookup("db")
+		if f.Anonymous && !ok && f.Type.Kind() == reflect.Struct {
+			r.collect(f.Type, index)
+			continue
+		}
+		if !f.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		r.columns = append(r.columns, name)
+		r.index[name] = index
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "pk":
+				r.pk = name
+			case "auto":
+				r.auto[name] = true
+			}
+		}
+	}
+}
+
+// conn Repository 执行语句的连接：*DB 或者 ctx 中的事务，只使用读取完才返回的方法，
+// 每条语句的 query_timeout 在返回前释放
+type conn interface {
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	BindNamed(query string, arg interface{}) (string, []interface{}, error)
+	Rebind(query string) string
+	DriverName() string
+}
+
+// conn ctx 中有事务时使用事务，每条语句同样带有 query_timeout 的超时
+func (r *Repository[T]) conn(ctx context.Context) conn {
+	if tx, ok := TxFromContext(ctx); ok {
+		return txConn{Tx: tx, db: r.db}
+	}
+	return r.db
+}
+
+func (r *Repository[T]) selectSQL() string {
+	return "SELECT " + strings.Join(r.columns, ", ") + " FROM " + r.table
+}
+
+// where 返回 WHERE 子句，启用软删除时追加 deleted_at IS NULL，没有条件时返回空字符串
+func (r *Repository[T]) where(conds ...string) string {
+	if r.softDelete {
+		conds = append(conds, ColumnDeletedAt+" IS NULL")
+	}
+	var parts []string
+	for _, c := range conds {
+		if c != "" {
+			parts = append(parts, "("+c+")")
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(parts, " AND ")
+}
+
+// Get 按主键查询，没有记录时返回 ErrNotFound
+func (r *Repository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	q := r.conn(ctx)
+	var v T
+	err := q.GetContext(ctx, &v, q.Rebind(r.selectSQL()+r.where(r.pk+" = ?")), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListOptions List 的查询条件、排序和分页
+type ListOptions struct {
+	Where    string        // 查询条件，使用 ? 占位符，例如 "status = ? AND user_id = ?"
+	Args     []interface{} // 查询条件的参数
+	OrderBy  string        // 排序，例如 "created_at DESC, id DESC"，只能使用模型中的列
+	Page     int           // 页码，从 1 开始，0 表示不分页
+	PageSize int           // 每页的数量，默认 20
+}
+
+// List 按条件查询，分页时同时需要总数可以调用 Count
+func (r *Repository[T]) List(ctx context.Context, opts ListOptions) ([]T, error) {
+	query := r.selectSQL() + r.where(opts.Where)
+	if opts.OrderBy != "" {
+		orderBy, err := r.orderBy(opts.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		query += " ORDER BY " + orderBy
+	}
+	args := opts.Args
+	if opts.Page > 0 {
+		size := opts.PageSize
+		if size <= 0 {
+			size = 20
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(append([]interface{}(nil), args...), size, (opts.Page-1)*size)
+	}
+	q := r.conn(ctx)
+	list := []T{}
+	if err := q.SelectContext(ctx, &list, q.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// orderBy 校验排序中的列和方向，避免拼接 SQL 时被注入
+func (r *Repository[T]) orderBy(s string) (string, error) {
+	return validateOrderBy(s, func(column string) bool {
+		_, ok := r.index[column]
+		return ok
+	})
+}
+
+// validateOrderBy 校验排序中的列和方向，valid 判断是否为模型中的列，返回规范化后的 ORDER BY，例如 "created_at DESC, id"
+func validateOrderBy(s string, valid func(column string) bool) (string, error) {
+	parts := strings.Split(s, ",")
+	for i, p := range parts {
+		fields := strings.Fields(p)
+		if len(fields) == 0 || len(fields) > 2 {
+			return "", fmt.Errorf("invalid order by %q", s)
+		}
+		if !valid(fields[0]) {
+			return "", fmt.Errorf("invalid order by column %q", fields[0])
+		}
+		if len(fields) == 2 {
+			dir := strings.ToUpper(fields[1])
+			if dir != "ASC" && dir != "DESC" {
+				return "", fmt.Errorf("invalid order by direction %q", fields[1])
+			}
+			fields[1] = dir
+		}
+		parts[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// Count 按条件统计数量，where 为空时统计全表
+func (r *Repository[T]) Count(ctx context.Context, where string, args ...interface{}) (n int64, err error) {
+	query := "SELECT COUNT(*) FROM " + r.table + r.where(where)
+	q := r.conn(ctx)
+	err = q.GetContext(ctx, &n, q.Rebind(query), args...)
+	return
+}
+
+// Insert 插入一条记录，auto 的自增主键在插入后回填到 v 中，有 version 列并且为 0 时设为 1
+func (r *Repository[T]) Insert(ctx context.Context, v *T) (err error) {
+	// PostgreSQL 的 INSERT ... RETURNING 通过 QueryRowx 执行，需要在这里检查维护模式
+	if err = r.db.writable(); err != nil {
+		return
+	}
+	if err = r.beforeInsert(ctx, v); err != nil {
+		return
+	}
+	var cols, values []string
+	for _, c := range r.columns {
+		if !r.auto[c] {
+			cols = append(cols, c)
+			values = append(values, ":"+c)
+		}
+	}
+	query := "INSERT INTO " + r.table + " (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
+	q := r.conn(ctx)
+	query, args, err := q.BindNamed(query, v)
+	if err != nil {
+		return
+	}
+	pk := reflect.ValueOf(v).Elem().FieldByIndex(r.index[r.pk])
+	switch {
+	case !r.auto[r.pk]:
+		_, err = q.ExecContext(ctx, query, args...)
+	case q.DriverName() == DriverPostgres:
+		// PostgreSQL 不支持 LastInsertId，使用 RETURNING 获取生成的主键
+		err = q.GetContext(UsePrimary(ctx), pk.Addr().Interface(), query+" RETURNING "+r.pk, args...)
+	default:
+		var result sql.Result
+		if result, err = q.ExecContext(ctx, query, args...); err != nil {
+			return
+		}
+		if pk.CanInt() || pk.CanUint() {
+			var id int64
+			if id, err = result.LastInsertId(); err != nil {
+				return
+			}
+			if pk.CanInt() {
+				pk.SetInt(id)
+			} else {
+				pk.SetUint(uint64(id))
+			}
+		}
+	}
+	if err != nil {
+		return
+	}
+	if r.hooked() {
+		after := *v
+		r.emit(ctx, ActionInsert, pk.Interface(), nil, &after)
+	}
+	if h, ok := interface{}(v).(AfterInserter); ok {
+		err = h.AfterInsert(ctx)
+	}
+	return
+}
+
+// beforeInsert 调用 BeforeInsert，并设置 version 的初始值
+func (r *Repository[T]) beforeInsert(ctx context.Context, v *T) (err error) {
+	if h, ok := interface{}(v).(BeforeInserter); ok {
+		if err = h.BeforeInsert(ctx); err != nil {
+			return
+		}
+	}
+	if r.version {
+		if f := reflect.ValueOf(v).Elem().FieldByIndex(r.index[ColumnVersion]); f.IsZero() {
+			setInt(f, 1)
+		}
+	}
+	return
+}
+
+// Update 按主键更新除主键、auto、deleted_at 和 version 之外的所有列，已经软删除的记录不会更新
+// 有 version 列时只更新版本号与 v 中相同的记录并把版本号加 1，没有更新时返回 *ConflictError，成功后 v 中的版本号同样加 1
+func (r *Repository[T]) Update(ctx context.Context, v *T) (err error) {
+	if h, ok := interface{}(v).(BeforeUpdater); ok {
+		if err = h.BeforeUpdate(ctx); err != nil {
+			return
+		}
+	}
+	q := r.conn(ctx)
+	query, args, err := q.BindNamed(r.updateSQL(func(c string) string { return ":" + c }), v)
+	if err != nil {
+		return
+	}
+	id := reflect.ValueOf(v).Elem().FieldByIndex(r.index[r.pk]).Interface()
+	var before *T
+	if r.hooked() {
+		before = r.snapshot(ctx, q, id)
+	}
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	if err = r.afterUpdate(ctx, v, result); err != nil {
+		return
+	}
+	if r.hooked() && rowsAffected(result) != 0 {
+		after := *v
+		r.emit(ctx, ActionUpdate, id, before, &after)
+	}
+	if h, ok := interface{}(v).(AfterUpdater); ok {
+		err = h.AfterUpdate(ctx)
+	}
+	return
+}
+
+// updateColumns Update 时 SET 的列
+func (r *Repository[T]) updateColumns() []string {
+	cols := make([]string, 0, len(r.columns))
+	for _, c := range r.columns {
+		if c != r.pk && !r.auto[c] && c != ColumnDeletedAt && !(r.version && c == ColumnVersion) {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// updateSQL 按主键（以及版本号）更新的语句，占位符由 bind 生成，参数依次为 updateColumns、主键和版本号
+func (r *Repository[T]) updateSQL(bind func(column string) string) string {
+	var sets []string
+	for _, c := range r.updateColumns() {
+		sets = append(sets, c+" = "+bind(c))
+	}
+	cond := r.pk + " = " + bind(r.pk)
+	if r.version {
+		sets = append(sets, ColumnVersion+" = "+ColumnVersion+" + 1")
+		cond += " AND " + ColumnVersion + " = " + bind(ColumnVersion)
+	}
+	return "UPDATE " + r.table + " SET " + strings.Join(sets, ", ") + r.where(cond)
+}
+
+// afterUpdate 检查乐观锁是否冲突，没有冲突时把 v 中的版本号加 1
+func (r *Repository[T]) afterUpdate(ctx context.Context, v *T, result sql.Result) (err error) {
+	if !r.version {
+		return
+	}
+	rv := reflect.ValueOf(v).Elem()
+	f := rv.FieldByIndex(r.index[ColumnVersion])
+	version := f.Convert(reflect.TypeOf(int64(0))).Int()
+	n, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		return &ConflictError{Table: r.table, ID: rv.FieldByIndex(r.index[r.pk]).Interface(), Version: version}
+	}
+	setInt(f, version+1)
+	return
+}
+
+// setInt 设置整数类型的字段
+func setInt(f reflect.Value, n int64) {
+	if f.CanUint() {
+		f.SetUint(uint64(n))
+	} else {
+		f.SetInt(n)
+	}
+}
+
+// Delete 按主键删除，返回删除的行数；有 deleted_at 列时只设置删除时间（软删除），Unscoped 时物理删除
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}) (n int64, err error) {
+	q := r.conn(ctx)
+	var before *T
+	if r.hooked() {
+		before = r.snapshot(ctx, q, id)
+	}
+	var result sql.Result
+	if r.softDelete {
+		result, err = q.ExecContext(ctx, q.Rebind("UPDATE "+r.table+" SET "+ColumnDeletedAt+" = ?"+r.where(r.pk+" = ?")), time.Now(), id)
+	} else {
+		result, err = q.ExecContext(ctx, q.Rebind("DELETE FROM "+r.table+" WHERE "+r.pk+" = ?"), id)
+	}
+	if err != nil {
+		return
+	}
+	if n, err = result.RowsAffected(); err == nil && n > 0 {
+		r.emit(ctx, ActionDelete, id, before, nil)
+	}
+	return
+}
+
+// Restore 恢复软删除的记录，返回恢复的行数
+func (r *Repository[T]) Restore(ctx context.Context, id interface{}) (n int64, err error) {
+	if _, ok := r.index[ColumnDeletedAt]; !ok {
+		return 0, fmt.Errorf("%s has no %s column", r.table, ColumnDeletedAt)
+	}
+	q := r.conn(ctx)
+	var before *T
+	if r.hooked() {
+		before = r.snapshot(ctx, q, id)
+	}
+	result, err := q.ExecContext(ctx, q.Rebind("UPDATE "+r.table+" SET "+ColumnDeletedAt+" = NULL WHERE "+r.pk+" = ?"), id)
+	if err != nil {
+		return
+	}
+	if n, err = result.RowsAffected(); err == nil && n > 0 && r.hooked() {
+		r.emit(ctx, ActionRestore, id, before, r.snapshot(ctx, q, id))
+	}
+	return
+}
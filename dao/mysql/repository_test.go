@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+type testUser struct {
+	ID   int64  `db:"id,pk,auto"`
+	Name string `db:"name"`
+}
+
+func newMock(t *testing.T) (*DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewFromDB(conn, DriverMySQL), mock
+}
+
+func TestRepositoryInsertAndGet(t *testing.T) {
+	d, mock := newMock(t)
+	users := NewRepository[testUser](d, "users")
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (name) VALUES (?)")).
+		WithArgs("alice").
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	u := &testUser{Name: "alice"}
+	if err := users.Insert(ctx, u); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if u.ID != 42 {
+		t.Errorf("Insert did not fill the auto primary key, got %d", u.ID)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name FROM users WHERE (id = ?)")).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(42, "alice"))
+	got, err := users.Get(ctx, int64(42))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if *got != *u {
+		t.Errorf("Get = %+v, want %+v", *got, *u)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name FROM users WHERE (id = ?)")).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	if _, err := users.Get(ctx, int64(7)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing record: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestWithTxRollsBackNestedCalls(t *testing.T) {
+	d, mock := newMock(t)
+	users := NewRepository[testUser](d, "users")
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (name) VALUES (?)")).
+		WithArgs("bob").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := d.WithTx(ctx, func(tx *sqlx.Tx) error {
+		ctx := ContextWithTx(ctx, tx)
+		if err := users.Insert(ctx, &testUser{Name: "bob"}); err != nil {
+			return err
+		}
+		// ctx 中有事务时 WithTx 加入外层的事务，而不是开启新的事务
+		if err := d.WithTx(ctx, func(*sqlx.Tx) error { return boom }); !errors.Is(err, boom) {
+			t.Errorf("nested WithTx: got %v, want %v", err, boom)
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("WithTx: got %v, want %v", err, boom)
+	}
+}
+
+func TestReadOnlyRejectsWrites(t *testing.T) {
+	d, _ := newMock(t)
+	d.SetReadOnly(true)
+	if _, err := d.ExecContext(context.Background(), "DELETE FROM users"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Exec in read-only mode: got %v, want ErrReadOnly", err)
+	}
+	users := NewRepository[testUser](d, "users")
+	if err := users.Insert(context.Background(), &testUser{Name: "eve"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Insert in read-only mode: got %v, want ErrReadOnly", err)
+	}
+}
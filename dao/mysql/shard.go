@@ -0,0 +1,347 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"web_app/settings"
+)
+
+// fanOutLimit FanOut 同时执行的分片数
+const fanOutLimit = 16
+
+// routers mysql.shards 中配置的分片路由，键为小写的逻辑表名
+var routers map[string]*ShardRouter
+
+// Shard 分片键所在的连接池和表，可以作为 map 的键
+type Shard struct {
+	DB    *DB
+	Table string
+}
+
+func (s Shard) String() string {
+	if s.DB == nil || s.DB.dbName == "" {
+		return s.Table
+	}
+	return s.DB.dbName + "." + s.Table
+}
+
+// ShardRouter 按 mysql.shards 中的规则把分片键路由到库和表，见 settings.ShardConfig
+//
+//	s, err := mysql.Router("posts").Route(userID)
+//	err = s.DB.GetContext(ctx, &post, "SELECT * FROM "+s.Table+" WHERE id = ?", id)
+//
+// 分片键相同的记录在同一个库中，可以在 s.DB.WithTx 中一起写入，跨库的写入没有事务保证
+type ShardRouter struct {
+	table  string
+	cfg    settings.ShardConfig
+	pools  []*DB
+	since  []time.Time
+	loc    *time.Location
+	layout string
+}
+
+// NewShardRouter 创建逻辑表 table 的分片路由，pool 按 cfg.Databases 中的名称返回连接池，没有时返回 nil
+func NewShardRouter(table string, cfg *settings.ShardConfig, pool func(name string) *DB) (*ShardRouter, error) {
+	r := &ShardRouter{table: table, cfg: *cfg, loc: time.UTC}
+	for _, name := range cfg.Databases {
+		d := pool(name)
+		if d == nil {
+			return nil, fmt.Errorf("shard %s: unknown database %q", table, name)
+		}
+		r.pools = append(r.pools, d)
+	}
+	if cfg.Strategy != "date" {
+		return r, nil
+	}
+	switch cfg.Period {
+	case "day":
+		r.layout = "20060102"
+	case "year":
+		r.layout = "2006"
+	default:
+		r.layout = "200601"
+	}
+	if cfg.Loc != "" {
+		var err error
+		if r.loc, err = time.LoadLocation(cfg.Loc); err != nil {
+			return nil, fmt.Errorf("shard %s: %w", table, err)
+		}
+	}
+	if len(r.pools) > 1 && len(cfg.Since) != len(r.pools) {
+		return nil, fmt.Errorf("shard %s: since must have one date per database", table)
+	}
+	for i, s := range cfg.Since {
+		t, err := time.ParseInLocation("2006-01-02", s, r.loc)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %w", table, err)
+		}
+		if i > 0 && !t.After(r.since[i-1]) {
+			return nil, fmt.Errorf("shard %s: since must be in ascending order", table)
+		}
+		r.since = append(r.since, t)
+	}
+	return r, nil
+}
+
+// Router 返回 mysql.shards 中名为 name 的分片路由，没有配置时返回 nil，name 不区分大小写
+func Router(name string) *ShardRouter {
+	return routers[strings.ToLower(name)]
+}
+
+// initRouters 根据 mysql.shards 创建分片路由，Init 在创建连接池之后调用
+func initRouters(cfg *settings.MySQLConfig) error {
+	routers = make(map[string]*ShardRouter, len(cfg.Shards))
+	for name, c := range cfg.Shards {
+		c := c
+		r, err := NewShardRouter(name, &c, func(name string) *DB {
+			if strings.EqualFold(name, DefaultName) {
+				return db
+			}
+			return Get(name)
+		})
+		if err != nil {
+			return err
+		}
+		routers[name] = r
+	}
+	return nil
+}
+
+// Route 返回分片键所在的分片：hash 时 key 为整数（直接取模，便于按 ID 定位）或字符串（FNV-1a），date 时为 time.Time
+func (r *ShardRouter) Route(key interface{}) (s Shard, err error) {
+	if r.cfg.Strategy == "date" {
+		t, ok := key.(time.Time)
+		if !ok {
+			return s, fmt.Errorf("shard %s: date shard key must be time.Time, got %T", r.table, key)
+		}
+		return r.dateShard(t), nil
+	}
+	h, err := shardHash(key)
+	if err != nil {
+		return s, fmt.Errorf("shard %s: %w", r.table, err)
+	}
+	return r.hashShard(int(h % uint64(len(r.pools)*r.tables()))), nil
+}
+
+// All 返回 hash 分片的所有分片，用于不带分片键的查询；date 分片没有上限，使用 Between
+func (r *ShardRouter) All() ([]Shard, error) {
+	if r.cfg.Strategy == "date" {
+		return nil, fmt.Errorf("shard %s: date shards are unbounded, use Between", r.table)
+	}
+	shards := make([]Shard, len(r.pools)*r.tables())
+	for i := range shards {
+		shards[i] = r.hashShard(i)
+	}
+	return shards, nil
+}
+
+// Between 返回 date 分片中 [from, to] 时间范围内的分片，按时间递增
+func (r *ShardRouter) Between(from, to time.Time) (shards []Shard, err error) {
+	if r.cfg.Strategy != "date" {
+		return nil, fmt.Errorf("shard %s: Between requires a date shard", r.table)
+	}
+	if to.Before(from) {
+		return nil, errors.New("shard: to is before from")
+	}
+	to = to.In(r.loc)
+	for t := r.truncate(from.In(r.loc)); !t.After(to); t = r.nextPeriod(t) {
+		shards = append(shards, r.dateShard(t))
+	}
+	return
+}
+
+// tables hash 分片每个库的分表数，不分表时为 1
+func (r *ShardRouter) tables() int {
+	if r.cfg.Tables > 1 {
+		return r.cfg.Tables
+	}
+	return 1
+}
+
+func (r *ShardRouter) hashShard(i int) Shard {
+	n := r.tables()
+	s := Shard{DB: r.pools[i/n], Table: r.table}
+	if n > 1 {
+		s.Table = fmt.Sprintf("%s_%d", r.table, i)
+	}
+	return s
+}
+
+func (r *ShardRouter) dateShard(t time.Time) Shard {
+	t = t.In(r.loc)
+	d := r.pools[0]
+	for i, since := range r.since {
+		if !t.Before(since) {
+			d = r.pools[i]
+		}
+	}
+	return Shard{DB: d, Table: r.table + "_" + t.Format(r.layout)}
+}
+
+// truncate 返回 t 所在时间范围的开始
+func (r *ShardRouter) truncate(t time.Time) time.Time {
+	switch r.cfg.Period {
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, r.loc)
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, r.loc)
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, r.loc)
+	}
+}
+
+func (r *ShardRouter) nextPeriod(t time.Time) time.Time {
+	switch r.cfg.Period {
+	case "day":
+		return t.AddDate(0, 0, 1)
+	case "year":
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+// shardHash 整数（包括 type UserID int64 这样的类型）直接使用其值，字符串使用 FNV-1a
+func shardHash(key interface{}) (uint64, error) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.String:
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(v.String()))
+		return h.Sum64(), nil
+	default:
+		return 0, fmt.Errorf("unsupported shard key type %T", key)
+	}
+}
+
+// FanOut 并发地（最多 16 个）在每个分片上执行 fn，按 shards 的顺序返回结果；任何一个失败时取消其他分片并返回第一个错误。
+// 各分片的结果需要调用方自己合并、排序和截断，ctx 中不应有事务（事务只属于一个库）
+//
+//	shards, _ := mysql.Router("posts").All()
+//	counts, err := mysql.FanOut(ctx, shards, func(ctx context.Context, s mysql.Shard) (n int64, err error) {
+//		err = s.DB.GetContext(ctx, &n, "SELECT COUNT(*) FROM "+s.Table+" WHERE status = ?", 1)
+//		return
+//	})
+func FanOut[R any](ctx context.Context, shards []Shard, fn func(ctx context.Context, s Shard) (R, error)) ([]R, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]R, len(shards))
+	errs := make([]error, len(shards))
+	sem := make(chan struct{}, fanOutLimit)
+	var wg sync.WaitGroup
+	for i, s := range shards {
+		i, s := i, s
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if ctx.Err() != nil {
+				errs[i] = ctx.Err()
+				return
+			}
+			if results[i], errs[i] = fn(ctx, s); errs[i] != nil {
+				errs[i] = fmt.Errorf("shard %s: %w", s, errs[i])
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	// 优先返回 fn 的错误，而不是其他分片因为取消得到的 context.Canceled
+	var first error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if first != nil {
+		return nil, first
+	}
+	return results, nil
+}
+
+// ShardedStore 分片表的 Store，每个分片的 Store 按 mysql.backend 创建（见 NewStore）并缓存
+//
+//	posts := mysql.NewShardedStore[Post](mysql.Router("posts"))
+//	store, err := posts.For(post.UserID)
+//	err = store.Insert(ctx, &post)
+type ShardedStore[T any] struct {
+	router *ShardRouter
+	stores sync.Map // Shard -> Store[T]
+}
+
+// NewShardedStore 创建模型 T 在 router 上的 ShardedStore，router 为 nil（没有配置分片）时 panic
+func NewShardedStore[T any](router *ShardRouter) *ShardedStore[T] {
+	if router == nil {
+		panic("mysql: NewShardedStore with nil router")
+	}
+	return &ShardedStore[T]{router: router}
+}
+
+// Router 返回使用的分片路由
+func (s *ShardedStore[T]) Router() *ShardRouter {
+	return s.router
+}
+
+// For 返回分片键所在分片的 Store
+func (s *ShardedStore[T]) For(key interface{}) (Store[T], error) {
+	sh, err := s.router.Route(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Shard(sh), nil
+}
+
+// Shard 返回分片 sh 的 Store
+func (s *ShardedStore[T]) Shard(sh Shard) Store[T] {
+	if v, ok := s.stores.Load(sh); ok {
+		return v.(Store[T])
+	}
+	v, _ := s.stores.LoadOrStore(sh, NewStore[T](sh.DB, sh.Table))
+	return v.(Store[T])
+}
+
+// List 在 shards 上执行 List 并按分片的顺序拼接结果，opts 应用于每个分片：
+// 分页时每个分片各返回一页，需要全局排序、分页时由调用方合并后截断
+func (s *ShardedStore[T]) List(ctx context.Context, shards []Shard, opts ListOptions) ([]T, error) {
+	lists, err := FanOut(ctx, shards, func(ctx context.Context, sh Shard) ([]T, error) {
+		return s.Shard(sh).List(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var all []T
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	if all == nil {
+		all = []T{}
+	}
+	return all, nil
+}
+
+// Count 在 shards 上执行 Count 并返回总数
+func (s *ShardedStore[T]) Count(ctx context.Context, shards []Shard, where string, args ...interface{}) (n int64, err error) {
+	counts, err := FanOut(ctx, shards, func(ctx context.Context, sh Shard) (int64, error) {
+		return s.Shard(sh).Count(ctx, where, args...)
+	})
+	for _, c := range counts {
+		n += c
+	}
+	return
+}
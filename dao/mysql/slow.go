@@ -0,0 +1,205 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+	"web_app/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// maxSlowSQL 慢查询日志中 SQL 的最大长度
+	maxSlowSQL = 2048
+	// maxSlowArg 慢查询日志中每个字符串参数的最大长度
+	maxSlowArg = 64
+)
+
+// slowQueries 慢查询的次数，按语句的类型统计
+var slowQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "mysql_slow_queries_total",
+	Help: "Number of MySQL statements slower than mysql.slow_threshold.",
+}, []string{"op"})
+
+// SetSlowQuery 修改慢查询的阈值和是否记录参数，threshold 为 0 时不记录慢查询
+func (d *DB) SetSlowQuery(threshold time.Duration, logArgs bool) {
+	d.slowThreshold.Store(int64(threshold))
+	d.slowLogArgs.Store(logArgs)
+}
+
+// observe 结束语句的 span，耗时超过 mysql.slow_threshold 时计数并以 WARN 级别记录 SQL、参数、行数和调用位置
+// rows 为 -1 表示行数未知；返回 Rows 的查询只统计到返回第一行为止的耗时
+func (d *DB) observe(ctx context.Context, op, query string, args []interface{}, start time.Time, rows int64, err error) {
+	endSpan(ctx, op, rows, err)
+	threshold := time.Duration(d.slowThreshold.Load())
+	elapsed := time.Since(start)
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+	slowQueries.WithLabelValues(op).Inc()
+	fields := []zap.Field{
+		zap.String("op", op),
+		zap.String("sql", compactSQL(query)),
+		zap.Duration("elapsed", elapsed),
+		zap.Duration("threshold", threshold),
+		zap.String("caller", queryCaller()),
+	}
+	if d.slowLogArgs.Load() {
+		fields = append(fields, zap.Strings("args", sanitizeArgs(query, args)))
+	}
+	if rows >= 0 {
+		fields = append(fields, zap.Int64("rows", rows))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	// caller 为调用 DAO 的业务代码，已经足够定位，不需要这里的调用位置和堆栈
+	logger.FromContext(ctx).Named("dao.mysql").
+		WithOptions(zap.WithCaller(false), zap.AddStacktrace(zapcore.FatalLevel)).
+		Warn("slow query", fields...)
+}
+
+// compactSQL 把多行的 SQL 压缩为一行并截断
+func compactSQL(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxSlowSQL {
+		query = query[:maxSlowSQL] + "..."
+	}
+	return query
+}
+
+// sanitizeArgs 参数转换为字符串，长字符串截断，二进制只记录长度；
+// 能从 SQL 中找到参数对应的列时记录为 列=值，列名包含 log.redact.fields 的参数整体脱敏，其他参数按 log.redact.patterns 脱敏
+func sanitizeArgs(query string, args []interface{}) []string {
+	names := argNames(query, len(args))
+	s := make([]string, 0, len(args))
+	for i, arg := range args {
+		var str string
+		switch v := arg.(type) {
+		case nil:
+			str = "NULL"
+		case []byte:
+			str = fmt.Sprintf("<%d bytes>", len(v))
+		case time.Time:
+			str = v.Format(time.RFC3339Nano)
+		default:
+			str = fmt.Sprint(v)
+			if len(str) > maxSlowArg {
+				str = str[:maxSlowArg] + "..."
+			}
+		}
+		if str = logger.Redact(names[i], str); names[i] != "" {
+			str = names[i] + "=" + str
+		}
+		s = append(s, str)
+	}
+	return s
+}
+
+var (
+	namedParam = regexp.MustCompile(`(^|[^:]):(\w+)`)
+	insertCols = regexp.MustCompile("(?is)^\\s*(?:INSERT|REPLACE)\\s+(?:IGNORE\\s+)?INTO\\s+[\\w.`\"]+\\s*\\(([^)]*)\\)\\s*VALUES")
+	// placeholder ? 或者 PostgreSQL 的 $1
+	placeholder = regexp.MustCompile(`\?|\$\d+`)
+	// columnBefore 占位符之前的列名，例如 u.password = ?、status IN (?
+	columnBefore = regexp.MustCompile("(?i)([\\w`\"]+)\\s*(?:=|<>|!=|<=|>=|<|>|\\bLIKE|\\bIN\\s*\\()\\s*$")
+)
+
+// argNames 按 SQL 推断每个参数对应的列名，推断不出来的为空字符串：
+// NamedExec 的 :name；INSERT 的列；col = ?、col IN (?, ?) 这种条件和 UPDATE 的 SET
+func argNames(query string, n int) []string {
+	names := make([]string, n)
+	if m := namedParam.FindAllStringSubmatch(query, -1); len(m) == n {
+		for i := range m {
+			names[i] = m[i][2]
+		}
+		return names
+	}
+	var cols []string
+	valuesAt := -1
+	if m := insertCols.FindStringSubmatchIndex(query); m != nil {
+		for _, c := range strings.Split(query[m[2]:m[3]], ",") {
+			cols = append(cols, unquote(c))
+		}
+		valuesAt = m[1]
+	}
+	var last string
+	for i, loc := range placeholder.FindAllStringIndex(query, -1) {
+		if i >= n {
+			break
+		}
+		if valuesAt >= 0 && loc[0] >= valuesAt && len(cols) > 0 {
+			// 批量插入时每一行的参数按列的顺序重复
+			names[i] = cols[i%len(cols)]
+			continue
+		}
+		before := strings.TrimRight(query[:loc[0]], " \t\n")
+		if m := columnBefore.FindStringSubmatch(before); m != nil {
+			last = unquote(m[1])
+			names[i] = last
+		} else if strings.HasSuffix(before, ",") {
+			// IN 列表中的后续参数
+			names[i] = last
+		} else {
+			last = ""
+		}
+	}
+	return names
+}
+
+// unquote 去掉列名的引号和表名
+func unquote(col string) string {
+	col = strings.Trim(strings.TrimSpace(col), "`\"")
+	if i := strings.LastIndexByte(col, '.'); i >= 0 {
+		col = col[i+1:]
+	}
+	return col
+}
+
+// queryCaller 返回调用栈中第一个不在 dao/mysql 和 sqlx 中的位置
+func queryCaller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "web_app/dao/mysql.") && !strings.HasPrefix(f.Function, "github.com/jmoiron/sqlx.") {
+			return fmt.Sprintf("%s:%d", trimPath(f.File), f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// trimPath 只保留文件所在的目录和文件名，与日志中的 caller 格式相同
+func trimPath(file string) string {
+	i := strings.LastIndexByte(file, '/')
+	if i < 0 {
+		return file
+	}
+	if j := strings.LastIndexByte(file[:i], '/'); j >= 0 {
+		return file[j+1:]
+	}
+	return file
+}
+
+// selectedRows 返回 Select 读取的行数，dest 不是切片时返回 -1
+func selectedRows(dest interface{}) int64 {
+	v := reflect.ValueOf(dest)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return -1
+	}
+	return int64(v.Len())
+}
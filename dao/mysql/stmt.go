@@ -0,0 +1,170 @@
+package mysql
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// stmtCacheRequests 预处理语句缓存的命中次数，result 为 hit 或 miss
+var stmtCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "mysql_stmt_cache_requests_total",
+	Help: "Number of prepared statement cache lookups by result (hit or miss).",
+}, []string{"result"})
+
+// execer 执行语句的连接：缓存的预处理语句或者连接池本身
+type execer interface {
+	sqlx.QueryerContext
+	sqlx.ExecerContext
+}
+
+// prepared 把预处理语句包装为 execer，执行时忽略传入的 query
+type prepared struct {
+	*sqlx.Stmt
+}
+
+func (p prepared) QueryContext(ctx context.Context, _ string, args ...interface{}) (*sql.Rows, error) {
+	return p.Stmt.QueryContext(ctx, args...)
+}
+
+func (p prepared) QueryxContext(ctx context.Context, _ string, args ...interface{}) (*sqlx.Rows, error) {
+	return p.Stmt.QueryxContext(ctx, args...)
+}
+
+func (p prepared) QueryRowxContext(ctx context.Context, _ string, args ...interface{}) *sqlx.Row {
+	return p.Stmt.QueryRowxContext(ctx, args...)
+}
+
+func (p prepared) ExecContext(ctx context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	return p.Stmt.ExecContext(ctx, args...)
+}
+
+// stmtKey 预处理语句属于某个连接池（主库或副本），database/sql 在池中的每个连接上按需重新预处理
+type stmtKey struct {
+	conn  *sqlx.DB
+	query string
+}
+
+type stmtEntry struct {
+	key  stmtKey
+	stmt *sqlx.Stmt
+	// refs 正在使用的次数，evicted 已经移出缓存，最后一次使用结束后关闭
+	refs    int
+	evicted bool
+}
+
+// stmtCache 按 SQL 缓存预处理语句的 LRU，超过 size 时关闭最久未使用的语句
+type stmtCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[stmtKey]*list.Element
+}
+
+// SetStmtCacheSize 修改预处理语句缓存的大小（主库和副本合计），0 表示不缓存，每条语句都直接执行；
+// 缩小时关闭多出的语句，正在使用的语句在使用结束后关闭
+func (d *DB) SetStmtCacheSize(size int) {
+	c := &d.stmts
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	c.size = size
+	if c.ll == nil {
+		c.ll = list.New()
+		c.items = make(map[stmtKey]*list.Element)
+	}
+	for c.ll.Len() > size {
+		c.evict(c.ll.Back())
+	}
+}
+
+// prepared 返回 query 在 conn 上缓存的预处理语句，没有时预处理并放入缓存；不缓存时返回 conn 本身
+// 语句执行完（返回 Rows 时为 Query 返回后）调用 release，之后即使语句被移出缓存也不影响 Rows 的读取
+func (d *DB) prepared(ctx context.Context, conn *sqlx.DB, query string) (q execer, release func(), err error) {
+	c := &d.stmts
+	key := stmtKey{conn: conn, query: query}
+	c.mu.Lock()
+	if c.size == 0 {
+		c.mu.Unlock()
+		return conn, func() {}, nil
+	}
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		entry := c.acquire(e)
+		c.mu.Unlock()
+		stmtCacheRequests.WithLabelValues("hit").Inc()
+		return prepared{entry.stmt}, func() { c.release(entry) }, nil
+	}
+	c.mu.Unlock()
+	stmtCacheRequests.WithLabelValues("miss").Inc()
+	// 预处理需要访问数据库，不持有锁；同一条 SQL 同时预处理时保留先放入缓存的
+	stmt, err := conn.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		_ = stmt.Close()
+		c.ll.MoveToFront(e)
+		entry := c.acquire(e)
+		return prepared{entry.stmt}, func() { c.release(entry) }, nil
+	}
+	entry := &stmtEntry{key: key, stmt: stmt, refs: 1}
+	if c.size == 0 {
+		// 预处理期间关闭了缓存，语句在这次使用结束后关闭
+		entry.evicted = true
+	} else {
+		c.items[key] = c.ll.PushFront(entry)
+		for c.ll.Len() > c.size {
+			c.evict(c.ll.Back())
+		}
+	}
+	return prepared{stmt}, func() { c.release(entry) }, nil
+}
+
+// acquire 增加语句的使用次数，调用方持有锁
+func (c *stmtCache) acquire(e *list.Element) *stmtEntry {
+	entry := e.Value.(*stmtEntry)
+	entry.refs++
+	return entry
+}
+
+// release 减少语句的使用次数，已经移出缓存并且没有在使用时关闭
+func (c *stmtCache) release(entry *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		_ = entry.stmt.Close()
+	}
+}
+
+// evict 把语句移出缓存，没有在使用时关闭，调用方持有锁
+func (c *stmtCache) evict(e *list.Element) {
+	entry := e.Value.(*stmtEntry)
+	c.ll.Remove(e)
+	delete(c.items, entry.key)
+	entry.evicted = true
+	if entry.refs == 0 {
+		_ = entry.stmt.Close()
+	}
+}
+
+// closeStmts 关闭所有缓存的语句，关闭连接池前调用
+func (d *DB) closeStmts() {
+	c := &d.stmts
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.ll != nil && c.ll.Len() > 0 {
+		c.evict(c.ll.Back())
+	}
+	c.size = 0
+}
@@ -0,0 +1,51 @@
+package mysql
+
+import (
+	"context"
+	"web_app/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dbSystem mysql.driver 对应的 OpenTelemetry db.system
+var dbSystem = map[string]string{DriverMySQL: "mysql", DriverPostgres: "postgresql", DriverSQLite: "sqlite"}
+
+// startSpan 为一条语句创建子 span，SQL 中只有占位符，不记录参数；没有启用链路追踪时不做任何事
+func (d *DB) startSpan(ctx context.Context, op, query string) context.Context {
+	if !tracing.Enabled() {
+		return ctx
+	}
+	ctx, _ = tracing.Tracer("web_app/dao/mysql").Start(ctx, "db."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", dbSystem[d.DriverName()]),
+			attribute.String("db.name", d.dbName),
+			attribute.String("db.operation", op),
+			attribute.String("db.statement", compactSQL(query)),
+			attribute.String("server.address", d.addr),
+		),
+	)
+	return ctx
+}
+
+// endSpan 记录行数和错误并结束 startSpan 创建的 span，rows 为 -1 表示行数未知
+func endSpan(ctx context.Context, op string, rows int64, err error) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	if rows >= 0 {
+		key := "db.rows_returned"
+		if op == "exec" {
+			key = "db.rows_affected"
+		}
+		span.SetAttributes(attribute.Int64(key, rows))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
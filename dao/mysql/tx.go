@@ -0,0 +1,207 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"web_app/logger"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+type txCtxKey struct{}
+
+// txState WithTx 保存在 context 中的事务，depth 为嵌套的层数，用于生成保存点的名称
+// managed 为 true 表示由 WithTx 开启，db 为开启事务的连接池，afterCommit 为提交后执行的函数，见 AfterCommit
+type txState struct {
+	tx      *sqlx.Tx
+	db      *DB
+	managed bool
+
+	mu          sync.Mutex
+	depth       int
+	afterCommit []func()
+}
+
+// txs WithTx 开启的事务，在 fn 中调用 ContextWithTx 时复用同一个 txState
+var txs sync.Map
+
+// ambientTx 返回 ContextWithTx 保存在 ctx 中、可以在 d 上加入的事务；其他连接池开启的事务不加入
+func (d *DB) ambientTx(ctx context.Context) (*txState, bool) {
+	s, ok := ctx.Value(txCtxKey{}).(*txState)
+	if !ok || (s.db != nil && s.db != d) {
+		return nil, false
+	}
+	return s, true
+}
+
+// ContextWithTx 把事务保存到 context 中，在这个 context 上调用的 WithTx 会加入该事务（使用保存点），而不是开启新的事务
+//
+//	err := mysql.WithTx(ctx, func(tx *sqlx.Tx) error {
+//		ctx := mysql.ContextWithTx(ctx, tx)
+//		if err := createOrder(ctx, tx, order); err != nil {
+//			return err
+//		}
+//		return decreaseStock(ctx, order) // 内部的 WithTx 使用保存点，返回错误时只回滚到保存点
+//	})
+func ContextWithTx(ctx context.Context, tx *sqlx.Tx) context.Context {
+	if s, ok := ctx.Value(txCtxKey{}).(*txState); ok && s.tx == tx {
+		return ctx
+	}
+	if s, ok := txs.Load(tx); ok {
+		return context.WithValue(ctx, txCtxKey{}, s)
+	}
+	return context.WithValue(ctx, txCtxKey{}, &txState{tx: tx})
+}
+
+// AfterCommit ctx 中有 WithTx 开启的事务时在事务提交后执行 fn，事务回滚或者回滚到 fn 注册之前的保存点时不执行；
+// ctx 中没有事务，或者事务不是由 WithTx 开启（无法知道何时提交）时立即执行
+func AfterCommit(ctx context.Context, fn func()) {
+	s, ok := ctx.Value(txCtxKey{}).(*txState)
+	if !ok || !s.managed {
+		fn()
+		return
+	}
+	s.mu.Lock()
+	s.afterCommit = append(s.afterCommit, fn)
+	s.mu.Unlock()
+}
+
+// TxFromContext 返回 ContextWithTx 保存的事务
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	s, ok := ctx.Value(txCtxKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return s.tx, true
+}
+
+// WithTx 使用默认的连接池执行事务，见 (*DB).WithTx
+func WithTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	if db == nil {
+		return ErrNotInitialized
+	}
+	return db.WithTx(ctx, fn)
+}
+
+// WithTx 在主库上开启事务并执行 fn，fn 返回错误或者 panic 时回滚，否则提交；panic 回滚后会继续向上抛出
+// 熔断时不开启事务，直接返回 ErrUnavailable；维护模式下开启只读事务，数据库拒绝写入的错误转换为 ErrReadOnly；ctx 中已经有 d 上的事务（见 ContextWithTx）时不开启新的事务，
+// 而是在该事务中创建保存点，fn 失败时只回滚到保存点；没有通过 ContextWithTx 传递事务时总是开启新的事务
+func (d *DB) WithTx(ctx context.Context, fn func(tx *sqlx.Tx) error) (err error) {
+	if s, ok := d.ambientTx(ctx); ok {
+		return s.savepoint(ctx, fn)
+	}
+	var (
+		tx   *sqlx.Tx
+		opts *sql.TxOptions
+	)
+	if d.ReadOnly() {
+		opts = &sql.TxOptions{ReadOnly: true}
+	}
+	if err = d.guard(ctx, func() (err error) {
+		tx, err = d.BeginTxx(ctx, opts)
+		return
+	}); err != nil {
+		return
+	}
+	s := &txState{tx: tx, db: d, managed: true}
+	txs.Store(tx, s)
+	defer func() {
+		txs.Delete(tx)
+		if p := recover(); p != nil {
+			rollback(tx.Rollback, "rollback")
+			panic(p)
+		}
+		if err != nil {
+			rollback(tx.Rollback, "rollback")
+			err = readOnlyError(err)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			err = readOnlyError(err)
+			return
+		}
+		s.mu.Lock()
+		fns := s.afterCommit
+		s.mu.Unlock()
+		for _, fn := range fns {
+			fn()
+		}
+	}()
+	return fn(tx)
+}
+
+// savepoint 在已有的事务中嵌套执行 fn
+func (s *txState) savepoint(ctx context.Context, fn func(tx *sqlx.Tx) error) (err error) {
+	s.mu.Lock()
+	s.depth++
+	// 回滚到保存点时丢弃之后注册的 AfterCommit
+	mark := len(s.afterCommit)
+	name := fmt.Sprintf("sp_%d", s.depth)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.depth--
+		s.mu.Unlock()
+	}()
+	discard := func() {
+		s.mu.Lock()
+		s.afterCommit = s.afterCommit[:mark]
+		s.mu.Unlock()
+	}
+	if _, err = s.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return
+	}
+	rollbackTo := func() error {
+		_, err := s.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback(rollbackTo, "rollback to savepoint "+name)
+			discard()
+			panic(p)
+		}
+		if err != nil {
+			rollback(rollbackTo, "rollback to savepoint "+name)
+			discard()
+			return
+		}
+		_, err = s.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	}()
+	return fn(s.tx)
+}
+
+// txConn 事务中的语句同样带有 query_timeout 的超时，Repository 在 ctx 中的事务里执行时使用；
+// 超时只取消当前语句，事务本身的 ctx 为 WithTx 的 ctx
+type txConn struct {
+	*sqlx.Tx
+	db *DB
+}
+
+func (t txConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := t.db.withTimeout(ctx)
+	defer cancel()
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+func (t txConn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, cancel := t.db.withTimeout(ctx)
+	defer cancel()
+	return t.Tx.SelectContext(ctx, dest, query, args...)
+}
+
+func (t txConn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, cancel := t.db.withTimeout(ctx)
+	defer cancel()
+	return t.Tx.GetContext(ctx, dest, query, args...)
+}
+
+// rollback 回滚失败时只记录日志，返回给调用方的仍然是导致回滚的错误
+func rollback(fn func() error, op string) {
+	if err := fn(); err != nil {
+		logger.Named("dao.mysql").Error("transaction "+op+" failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"context"
+	"web_app/models"
+)
+
+// 示例用户模块的数据访问，表结构见 migrations/<driver>/00004_create_users.sql
+
+const userTable = "users"
+
+func users() (*Repository[models.User], error) {
+	db := Default()
+	if db == nil {
+		return nil, ErrNotInitialized
+	}
+	return NewRepository[models.User](db, userTable), nil
+}
+
+// CheckUserExist 用户名是否已经被使用，查询主库
+func CheckUserExist(ctx context.Context, username string) (exist bool, err error) {
+	r, err := users()
+	if err != nil {
+		return
+	}
+	n, err := r.Count(UsePrimary(ctx), "username = ?", username)
+	return n > 0, err
+}
+
+// InsertUser 写入新用户，用户名已经存在时返回的错误满足 IsDuplicateUsername
+func InsertUser(ctx context.Context, u *models.User) (err error) {
+	r, err := users()
+	if err != nil {
+		return
+	}
+	return r.Insert(ctx, u)
+}
+
+// IsDuplicateUsername err 是否为违反用户名唯一索引的错误，ID 冲突等其他唯一索引的错误返回 false
+func IsDuplicateUsername(err error) bool {
+	return IsDuplicateKey(err, "uk_username", "uk_users_username", "users.username")
+}
+
+// GetUserByID 按 ID 查询用户，不存在时返回 ErrNotFound
+func GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	r, err := users()
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, id)
+}
+
+// GetUserByUsername 按用户名查询用户，不存在时返回 ErrNotFound；登录时调用，查询主库，注册后马上登录不受副本延迟影响
+func GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	r, err := users()
+	if err != nil {
+		return nil, err
+	}
+	list, err := r.List(UsePrimary(ctx), ListOptions{Where: "username = ?", Args: []interface{}{username}, Page: 1, PageSize: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return &list[0], nil
+}
@@ -0,0 +1,162 @@
+package redis
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// bloomPrefix 布隆过滤器的 key 的前缀
+const bloomPrefix = "bloom:"
+
+// maxBloomBits Redis 字符串最大 512MB
+const maxBloomBits = 1 << 32
+
+var (
+	// bloomAddScript、bloomExistsScript 没有 RedisBloom 模块时用位图实现，一次设置或检查 k 个位
+	bloomAddScript    = mustScript("bloom_add")
+	bloomExistsScript = mustScript("bloom_exists")
+)
+
+// bloomMode 布隆过滤器的实现方式
+type bloomMode int
+
+const (
+	bloomUnknown bloomMode = iota
+	// bloomNative Redis 加载了 RedisBloom 模块，使用 BF.ADD、BF.EXISTS
+	bloomNative
+	// bloomBitmap 使用 SETBIT、GETBIT 实现
+	bloomBitmap
+)
+
+// BloomFilter 布隆过滤器，判断一个元素是否已经出现过，例如“这个用户是否已经看过这条推荐”：
+// Exists 返回 false 时一定没有加入过，返回 true 时有 error_rate 的概率误判；元素不能删除
+//
+//	seen := redis.NewBloomFilter("feed:seen:"+userID, 10000, 0.001)
+//	if ok, err := seen.Exists(ctx, postID); err == nil && !ok {
+//		_, _ = seen.Add(ctx, postID)
+//	}
+//
+// Redis 加载了 RedisBloom 模块（Redis Stack、部分云服务）时使用 BF.RESERVE 创建的原生过滤器，否则使用位图实现，
+// 第一次使用时按已有的 key 的类型或者 BF.RESERVE 是否可用确定，之后不再改变
+type BloomFilter struct {
+	key       string
+	capacity  uint64
+	errorRate float64
+	// bits、hashes 位图实现的位数和哈希函数的个数
+	bits   uint64
+	hashes int
+
+	mu   sync.Mutex
+	mode bloomMode
+}
+
+// NewBloomFilter 创建名为 name 的布隆过滤器，使用默认的客户端；capacity 为预计加入的元素个数，超过后误判率会上升，
+// errorRate 为误判率，例如 0.001
+func NewBloomFilter(name string, capacity uint64, errorRate float64) *BloomFilter {
+	if capacity == 0 {
+		capacity = 1
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		errorRate = 0.01
+	}
+	// m = -n*ln(p)/(ln2)^2，k = m/n*ln2
+	bits := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2)))
+	if bits > maxBloomBits {
+		bits = maxBloomBits
+	}
+	hashes := int(math.Round(float64(bits) / float64(capacity) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &BloomFilter{key: bloomPrefix + name, capacity: capacity, errorRate: errorRate, bits: bits, hashes: hashes}
+}
+
+// Add 加入元素，返回 true 表示之前不存在（可能因为误判返回 false）
+func (b *BloomFilter) Add(ctx context.Context, item string) (bool, error) {
+	c := Client()
+	if c == nil {
+		return false, ErrNotInitialized
+	}
+	key := Key(b.key)
+	mode, err := b.detect(ctx, c, key)
+	if err != nil {
+		return false, err
+	}
+	if mode == bloomNative {
+		return c.Do(ctx, "BF.ADD", key, item).Bool()
+	}
+	n, err := bloomAddScript.Run(ctx, c, []string{key}, b.offsets(item)...).Int64()
+	return n == 1, err
+}
+
+// Exists 判断元素是否可能已经加入过
+func (b *BloomFilter) Exists(ctx context.Context, item string) (bool, error) {
+	c := Client()
+	if c == nil {
+		return false, ErrNotInitialized
+	}
+	key := Key(b.key)
+	mode, err := b.detect(ctx, c, key)
+	if err != nil {
+		return false, err
+	}
+	if mode == bloomNative {
+		return c.Do(ctx, "BF.EXISTS", key, item).Bool()
+	}
+	n, err := bloomExistsScript.Run(ctx, c, []string{key}, b.offsets(item)...).Int64()
+	return n == 1, err
+}
+
+// detect 确定实现方式：已有的 key 按类型确定，否则尝试 BF.RESERVE，命令不存在时使用位图
+func (b *BloomFilter) detect(ctx context.Context, c redis.UniversalClient, key string) (bloomMode, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.mode != bloomUnknown {
+		return b.mode, nil
+	}
+	typ, err := c.Type(ctx, key).Result()
+	if err != nil {
+		return bloomUnknown, err
+	}
+	switch typ {
+	case "string":
+		b.mode = bloomBitmap
+	case "none":
+		err = c.Do(ctx, "BF.RESERVE", key, b.errorRate, b.capacity).Err()
+		switch {
+		case err == nil, strings.Contains(err.Error(), "item exists"):
+			b.mode = bloomNative
+		case strings.Contains(strings.ToLower(err.Error()), "unknown command"):
+			b.mode = bloomBitmap
+		default:
+			return bloomUnknown, err
+		}
+	default:
+		// RedisBloom 的类型为 MBbloom--
+		b.mode = bloomNative
+	}
+	return b.mode, nil
+}
+
+// offsets 按双重哈希 h1+i*h2 计算元素在位图中的 k 个位置
+func (b *BloomFilter) offsets(item string) []interface{} {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(item))
+	sum := h.Sum(nil)
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+	h2 |= 1
+	offsets := make([]interface{}, b.hashes)
+	for i := range offsets {
+		offsets[i] = (h1 + uint64(i)*h2) % b.bits
+	}
+	return offsets
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// hllPrefix HyperLogLog 的 key 的前缀
+const hllPrefix = "hll:"
+
+// AddUnique 把 members 加入 HyperLogLog key（例如 uv:20060102），用于统计 UV 这样的去重计数，
+// 每个 key 最多占用 12KB，误差约 0.81%；ttl 大于 0 时设置过期时间
+//
+//	err := redis.AddUnique(ctx, "uv:"+time.Now().Format("20060102"), 48*time.Hour, userID)
+func AddUnique(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	c := Client()
+	if c == nil {
+		return ErrNotInitialized
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	key = Key(hllPrefix + key)
+	_, err := c.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.PFAdd(ctx, key, args...)
+		if ttl > 0 {
+			p.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// CountUnique 返回一个或多个 HyperLogLog 合并之后的去重数量，例如最近 7 天的 UV；
+// cluster 中多个 key 需要在同一个 slot，使用 {uv}:20060102 这样的 hash tag
+func CountUnique(ctx context.Context, keys ...string) (int64, error) {
+	c := Client()
+	if c == nil {
+		return 0, ErrNotInitialized
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = Key(hllPrefix + k)
+	}
+	return c.PFCount(ctx, full...).Result()
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Nil key 不存在，与 go-redis 的 redis.Nil 相同，使用 errors.Is(err, redis.Nil) 判断
+var Nil = redis.Nil
+
+// Key 在 key 前加上 redis.key_prefix（例如 web_app:dev:），直接通过 Client() 执行命令时使用，
+// 本包的 Get、Set、锁、限流以及 cache、streams 包会自动加上前缀。Cluster 中的 hash tag 写在 key 中即可，前缀不影响 slot 的计算
+//
+//	client.Incr(ctx, redis.Key("counter:"+id))
+func Key(key string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return prefix + key
+}
+
+// Set 使用默认的客户端把 v 序列化为 JSON 写入 key（自动加上前缀），ttl 为 0 时不过期
+func Set[T any](ctx context.Context, key string, v T, ttl time.Duration) error {
+	c := Client()
+	if c == nil {
+		return ErrNotInitialized
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, Key(key), b, ttl).Err()
+}
+
+// Get 使用默认的客户端读取 Set 写入的 key 并反序列化为 T，key 不存在时返回 Nil
+//
+//	profile, err := redis.Get[Profile](ctx, "profile:"+id)
+//	if errors.Is(err, redis.Nil) {
+//		// 没有缓存
+//	}
+func Get[T any](ctx context.Context, key string) (v T, err error) {
+	c := Client()
+	if c == nil {
+		return v, ErrNotInitialized
+	}
+	b, err := c.Get(ctx, Key(key)).Bytes()
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &v)
+	return
+}
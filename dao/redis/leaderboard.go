@@ -0,0 +1,179 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// leaderboardPrefix 排行榜的 key 的前缀
+const leaderboardPrefix = "leaderboard:"
+
+// Window 排行榜的统计周期
+type Window int
+
+const (
+	// WindowAll 不分周期，一直累计
+	WindowAll Window = iota
+	// WindowDay 按自然日统计，key 为 leaderboard:<name>:20060102
+	WindowDay
+	// WindowWeek 按 ISO 周（周一开始）统计，key 为 leaderboard:<name>:2006W01
+	WindowWeek
+)
+
+// Entry 排行榜中的一项，Rank 从 1 开始
+type Entry struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+	Rank   int64   `json:"rank"`
+}
+
+// Leaderboard 基于有序集合的排行榜，分数高的排在前面，分数相同时按成员的字典序倒序
+//
+//	hot := redis.NewLeaderboard("post:hot", redis.WindowDay)
+//	_, err := hot.Incr(ctx, postID, 1)
+//	top, err := hot.Top(ctx, 10)
+//	yesterday, err := hot.At(time.Now().AddDate(0, 0, -1)).Top(ctx, 10)
+type Leaderboard struct {
+	name   string
+	window Window
+	// at 不为零时固定在包含该时间的周期，否则为当前周期
+	at time.Time
+}
+
+// NewLeaderboard 创建名为 name 的排行榜，使用默认的客户端，按周期统计时保留当前和上一个周期，更早的自动过期
+func NewLeaderboard(name string, window Window) *Leaderboard {
+	return &Leaderboard{name: name, window: window}
+}
+
+// At 返回包含时间 t 的周期的排行榜，用于查询上一个周期；WindowAll 时与 l 相同
+func (l *Leaderboard) At(t time.Time) *Leaderboard {
+	return &Leaderboard{name: l.name, window: l.window, at: t}
+}
+
+// Key 当前周期在 Redis 中的 key（包括 redis.key_prefix）
+func (l *Leaderboard) Key() string {
+	key, _ := l.key()
+	return key
+}
+
+// key 返回周期的 key 和过期时间，周期结束之后再保留一个周期，可以查询上一个周期的排名；WindowAll 时不过期，过期时间为零值
+func (l *Leaderboard) key() (string, time.Time) {
+	t := l.at
+	if t.IsZero() {
+		t = time.Now()
+	}
+	base := leaderboardPrefix + l.name
+	switch l.window {
+	case WindowDay:
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return Key(base + ":" + start.Format("20060102")), start.AddDate(0, 0, 2)
+	case WindowWeek:
+		year, week := t.ISOWeek()
+		// Weekday 中周日为 0，ISO 周从周一开始
+		offset := (int(t.Weekday()) + 6) % 7
+		start := time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+		return Key(fmt.Sprintf("%s:%04dW%02d", base, year, week)), start.AddDate(0, 0, 14)
+	default:
+		return Key(base), time.Time{}
+	}
+}
+
+// Incr 给 member 的分数加上 delta（可以为负数），返回新的分数
+func (l *Leaderboard) Incr(ctx context.Context, member string, delta float64) (score float64, err error) {
+	c := Client()
+	if c == nil {
+		return 0, ErrNotInitialized
+	}
+	key, expireAt := l.key()
+	var cmd *redis.FloatCmd
+	_, err = c.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		cmd = p.ZIncrBy(ctx, key, delta, member)
+		if !expireAt.IsZero() {
+			p.ExpireAt(ctx, key, expireAt)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	return cmd.Val(), nil
+}
+
+// Top 返回分数最高的前 n 项
+func (l *Leaderboard) Top(ctx context.Context, n int) ([]Entry, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	return l.Range(ctx, 1, int64(n))
+}
+
+// Range 返回排名在 [from, to] 之间的项，排名从 1 开始，用于分页
+func (l *Leaderboard) Range(ctx context.Context, from, to int64) ([]Entry, error) {
+	c := Client()
+	if c == nil {
+		return nil, ErrNotInitialized
+	}
+	if from < 1 || to < from {
+		return nil, nil
+	}
+	zs, err := c.ZRevRangeWithScores(ctx, l.Key(), from-1, to-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, len(zs))
+	for i, z := range zs {
+		member, _ := z.Member.(string)
+		entries[i] = Entry{Member: member, Score: z.Score, Rank: from + int64(i)}
+	}
+	return entries, nil
+}
+
+// Rank 返回 member 的排名和分数，不在排行榜中时返回 Nil
+func (l *Leaderboard) Rank(ctx context.Context, member string) (e Entry, err error) {
+	c := Client()
+	if c == nil {
+		return e, ErrNotInitialized
+	}
+	key := l.Key()
+	var (
+		rank  *redis.IntCmd
+		score *redis.FloatCmd
+	)
+	_, err = c.Pipelined(ctx, func(p redis.Pipeliner) error {
+		rank = p.ZRevRank(ctx, key, member)
+		score = p.ZScore(ctx, key, member)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	return Entry{Member: member, Score: score.Val(), Rank: rank.Val() + 1}, nil
+}
+
+// Count 排行榜中的成员数
+func (l *Leaderboard) Count(ctx context.Context) (int64, error) {
+	c := Client()
+	if c == nil {
+		return 0, ErrNotInitialized
+	}
+	return c.ZCard(ctx, l.Key()).Result()
+}
+
+// Remove 从排行榜中删除成员，例如帖子被删除之后
+func (l *Leaderboard) Remove(ctx context.Context, members ...string) error {
+	c := Client()
+	if c == nil {
+		return ErrNotInitialized
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	return c.ZRem(ctx, l.Key(), args...).Err()
+}
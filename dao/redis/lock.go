@@ -0,0 +1,280 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"web_app/logger"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotInitialized 默认的客户端没有初始化
+	ErrNotInitialized = errors.New("redis client is not initialized")
+	// ErrLockNotAcquired 锁已被其他实例持有
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	// ErrLockNotHeld Unlock 时锁已经过期或者被其他实例持有
+	ErrLockNotHeld = errors.New("lock not held")
+)
+
+// lockPrefix 锁的 key 的前缀
+const lockPrefix = "lock:"
+
+// MinLockTTL 锁的最短过期时间：续期按毫秒设置过期时间并且每 ttl/3 执行一次，有效期还要扣除时钟漂移，
+// 更短的 ttl 续期来不及完成，0 则会创建一个永不过期的 key
+const MinLockTTL = 100 * time.Millisecond
+
+var (
+	// extendScript 只有 token 相同（仍然持有锁）时才续期
+	extendScript = mustScript("lock_extend")
+	// releaseScript 只有 token 相同时才删除，避免删掉过期后被其他实例获取的锁
+	releaseScript = mustScript("lock_release")
+)
+
+// Locker 基于 Redis 的分布式锁。只有一个客户端时为普通的 SET NX；有多个相互独立的 Redis 节点时使用 Redlock 算法，
+// 在多数（N/2+1）节点上获取成功、并且耗时小于 ttl 时才算获取到锁，单个节点宕机不影响锁的可用性和互斥
+type Locker struct {
+	clients []redis.UniversalClient
+}
+
+// NewLocker 使用一个或多个客户端创建 Locker，多个客户端应连接到相互独立的 Redis（不是同一个 cluster 或主从）
+//
+//	locker := redis.NewLocker(c1, c2, c3)
+func NewLocker(clients ...redis.UniversalClient) *Locker {
+	return &Locker{clients: clients}
+}
+
+// Mutex 获取到的锁，持有期间每 ttl/3 自动续期，直到 Unlock；续期失败（锁已经过期并被其他实例获取）时关闭 Done
+type Mutex struct {
+	l     *Locker
+	key   string
+	token string
+	ttl   time.Duration
+	done  chan struct{}
+	stop  chan struct{}
+	once  sync.Once
+	// exited watchdog 已经退出
+	exited chan struct{}
+}
+
+// Lock 使用默认的客户端获取锁，见 (*Locker).Lock
+func Lock(ctx context.Context, key string, ttl time.Duration) (*Mutex, error) {
+	c := Client()
+	if c == nil {
+		return nil, ErrNotInitialized
+	}
+	return NewLocker(c).Lock(ctx, key, ttl)
+}
+
+// WaitLock 使用默认的客户端等待获取锁，见 (*Locker).WaitLock
+func WaitLock(ctx context.Context, key string, ttl time.Duration) (*Mutex, error) {
+	c := Client()
+	if c == nil {
+		return nil, ErrNotInitialized
+	}
+	return NewLocker(c).WaitLock(ctx, key, ttl)
+}
+
+// WithLock 使用默认的客户端获取锁并执行 fn，见 (*Locker).WithLock
+func WithLock(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	c := Client()
+	if c == nil {
+		return ErrNotInitialized
+	}
+	return NewLocker(c).WithLock(ctx, key, ttl, fn)
+}
+
+// Lock 尝试获取名为 key 的锁（Redis 中的 key 为 <key_prefix>lock:<key>），已被其他实例持有时立即返回 ErrLockNotAcquired
+// ttl 为锁的过期时间，不能小于 MinLockTTL，持有期间自动续期，进程崩溃后最多 ttl 之后其他实例可以获取
+func (l *Locker) Lock(ctx context.Context, key string, ttl time.Duration) (*Mutex, error) {
+	if ttl < MinLockTTL {
+		return nil, fmt.Errorf("lock ttl %s is shorter than the minimum %s", ttl, MinLockTTL)
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	m := &Mutex{l: l, key: Key(lockPrefix + key), token: token, ttl: ttl,
+		done: make(chan struct{}), stop: make(chan struct{}), exited: make(chan struct{})}
+	if err = m.acquire(ctx); err != nil {
+		return nil, err
+	}
+	go m.watchdog()
+	return m, nil
+}
+
+// WaitLock 获取锁，已被其他实例持有时每隔 ttl/10（至少 10ms）重试，直到获取到或者 ctx 结束
+func (l *Locker) WaitLock(ctx context.Context, key string, ttl time.Duration) (*Mutex, error) {
+	interval := ttl / 10
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	for {
+		m, err := l.Lock(ctx, key, ttl)
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return m, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", err, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// WithLock 获取锁并执行 fn，执行完后释放；锁已被其他实例持有时不执行 fn，返回 ErrLockNotAcquired
+// 续期失败（锁丢失）时取消传给 fn 的 ctx。定时任务只需要一个实例执行时使用：
+//
+//	err := redis.WithLock(ctx, "cron:daily_report", time.Minute, runDailyReport)
+//	if errors.Is(err, redis.ErrLockNotAcquired) {
+//		return nil // 其他实例正在执行
+//	}
+func (l *Locker) WithLock(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) error) (err error) {
+	m, err := l.Lock(ctx, key, ttl)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-m.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	defer func() {
+		// 释放锁不受 ctx 取消的影响，由客户端的读写超时限制
+		if uerr := m.Unlock(context.Background()); uerr != nil && err == nil && !errors.Is(uerr, ErrLockNotHeld) {
+			err = uerr
+		}
+	}()
+	return fn(ctx)
+}
+
+// Key 锁在 Redis 中的 key
+func (m *Mutex) Key() string {
+	return m.key
+}
+
+// Done 锁丢失（续期失败）或者 Unlock 之后关闭，长时间执行的任务应检查，锁丢失后停止执行
+func (m *Mutex) Done() <-chan struct{} {
+	return m.done
+}
+
+// Unlock 停止续期并释放锁，锁已经过期或者被其他实例持有时返回 ErrLockNotHeld
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.once.Do(func() { close(m.stop) })
+	<-m.exited
+	n, err := m.eval(ctx, releaseScript)
+	if n >= m.l.quorum() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+// acquire 在所有节点上 SET NX，多数节点成功并且还在有效期内时返回 nil，否则释放已经获取的节点
+func (m *Mutex) acquire(ctx context.Context) error {
+	start := time.Now()
+	n, err := m.each(ctx, func(ctx context.Context, c redis.UniversalClient) (bool, error) {
+		return c.SetNX(ctx, m.key, m.token, m.ttl).Result()
+	})
+	if n >= m.l.quorum() && m.valid(start) {
+		return nil
+	}
+	_, _ = m.eval(context.Background(), releaseScript)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLockNotAcquired, err)
+	}
+	return ErrLockNotAcquired
+}
+
+// valid 获取或续期开始于 start 时锁是否还在有效期内，时钟漂移按 ttl 的 1% 加 2ms 计算
+func (m *Mutex) valid(start time.Time) bool {
+	drift := m.ttl/100 + 2*time.Millisecond
+	return time.Since(start) < m.ttl-drift
+}
+
+// watchdog 每 ttl/3 续期一次，锁已经不再持有或者超过 ttl 都没有续期成功（网络故障）时认为锁已丢失
+func (m *Mutex) watchdog() {
+	defer close(m.exited)
+	defer close(m.done)
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), m.ttl/3)
+		n, err := m.eval(ctx, extendScript, m.ttl.Milliseconds())
+		cancel()
+		if n >= m.l.quorum() && m.valid(start) {
+			last = start
+			continue
+		}
+		if err == nil || time.Since(last) >= m.ttl {
+			logger.Named("dao.redis").Warn("redis lock lost", zap.String("key", m.key), zap.Error(err))
+			return
+		}
+	}
+}
+
+// eval 在所有节点上执行 extendScript 或 releaseScript，返回返回值为 1 的节点数
+func (m *Mutex) eval(ctx context.Context, script *Script, args ...interface{}) (int, error) {
+	return m.each(ctx, func(ctx context.Context, c redis.UniversalClient) (bool, error) {
+		n, err := script.Run(ctx, c, []string{m.key}, append([]interface{}{m.token}, args...)...).Int64()
+		return n == 1, err
+	})
+}
+
+// each 并发地在所有节点上执行 fn，返回 fn 返回 true 的节点数和第一个错误
+func (m *Mutex) each(ctx context.Context, fn func(ctx context.Context, c redis.UniversalClient) (bool, error)) (n int, err error) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range m.l.clients {
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, e := fn(ctx, c)
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				n++
+			}
+			if e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+	wg.Wait()
+	return
+}
+
+// quorum 获取锁需要成功的节点数
+func (l *Locker) quorum() int {
+	return len(l.clients)/2 + 1
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
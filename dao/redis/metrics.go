@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector 每次抓取时读取当前默认客户端的连接池状态（PoolStats），客户端在配置热加载时替换后读取新的客户端，
+// cluster 时为所有节点的合计
+type poolCollector struct {
+	hits, misses, timeouts, total, idle, stale *prometheus.Desc
+}
+
+func newPoolCollector() *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("redis_pool_"+name, help, nil, nil)
+	}
+	return &poolCollector{
+		hits:     desc("hits_total", "Number of times a free connection was found in the pool."),
+		misses:   desc("misses_total", "Number of times a free connection was not found in the pool."),
+		timeouts: desc("timeouts_total", "Number of times a wait for a connection timed out."),
+		total:    desc("connections", "Number of total connections in the pool."),
+		idle:     desc("idle_connections", "Number of idle connections in the pool."),
+		stale:    desc("stale_connections_total", "Number of stale connections removed from the pool."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.total
+	ch <- c.idle
+	ch <- c.stale
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	client := Client()
+	if client == nil {
+		return
+	}
+	s := client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(s.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.CounterValue, float64(s.StaleConns))
+}
+
+// RegisterMetrics 把默认客户端的连接池状态注册为 Prometheus 指标：redis_pool_hits_total、redis_pool_misses_total、
+// redis_pool_timeouts_total、redis_pool_connections、redis_pool_idle_connections、redis_pool_stale_connections_total；
+// Init 时自动注册，重复注册时忽略
+func RegisterMetrics(reg prometheus.Registerer) error {
+	err := reg.Register(newPoolCollector())
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		return nil
+	}
+	return err
+}
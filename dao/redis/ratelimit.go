@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// rateLimitPrefix 限流计数的 key 的前缀
+const rateLimitPrefix = "ratelimit:"
+
+var (
+	// slidingWindowScript 滑动窗口：有序集合中保存窗口内每次请求的时间（微秒），
+	// 先删除窗口之外的，数量小于 limit 时放行并记录本次请求；使用 Redis 的时间，不受各实例时钟的影响
+	slidingWindowScript = mustScript("ratelimit_sliding_window")
+	// tokenBucketScript 令牌桶：容量为 limit，每 window 补满，哈希中保存剩余的令牌数和上次补充的时间（微秒）
+	tokenBucketScript = mustScript("ratelimit_token_bucket")
+)
+
+// LimitResult 限流的结果
+type LimitResult struct {
+	Allowed bool
+	// Remaining 窗口内还可以放行的次数
+	Remaining int
+	// RetryAfter 被拒绝时经过多久之后可以再次请求，HTTP 接口可以设置为 Retry-After 响应头
+	RetryAfter time.Duration
+}
+
+// Limiter 基于 Redis 的限流器，key 为限流的对象（例如 sms:13800000000、api:<user_id>），
+// 每个 window 内最多放行 limit 次；多个实例共用同一个计数，Lua 脚本保证原子性
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (LimitResult, error)
+}
+
+var (
+	_ Limiter = (*SlidingWindowLimiter)(nil)
+	_ Limiter = (*TokenBucketLimiter)(nil)
+)
+
+// SlidingWindowLimiter 滑动窗口限流，任意 window 长的时间内最多放行 limit 次，精确但每个 key 需要保存 limit 条记录，
+// 适合短信验证码、登录尝试这样 limit 较小、需要严格限制的场景
+type SlidingWindowLimiter struct {
+	client redis.UniversalClient
+}
+
+// NewSlidingWindow 创建滑动窗口限流器，client 为 nil 时使用默认的客户端
+func NewSlidingWindow(client redis.UniversalClient) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{client: client}
+}
+
+// Allow 判断 key 的本次请求是否放行，放行时计入窗口，拒绝的请求不计入
+func (l *SlidingWindowLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (LimitResult, error) {
+	member, err := newToken()
+	if err != nil {
+		return LimitResult{}, err
+	}
+	return runLimit(ctx, l.client, slidingWindowScript, key, limit, window, member)
+}
+
+// TokenBucketLimiter 令牌桶限流，桶的容量为 limit，令牌按 limit/window 的速度匀速补充，允许最多 limit 次的突发，
+// 每个 key 只保存两个字段，适合接口限流这样 limit 较大的场景
+type TokenBucketLimiter struct {
+	client redis.UniversalClient
+}
+
+// NewTokenBucket 创建令牌桶限流器，client 为 nil 时使用默认的客户端
+func NewTokenBucket(client redis.UniversalClient) *TokenBucketLimiter {
+	return &TokenBucketLimiter{client: client}
+}
+
+// Allow 从 key 的令牌桶中取一个令牌，没有令牌时拒绝
+func (l *TokenBucketLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (LimitResult, error) {
+	return runLimit(ctx, l.client, tokenBucketScript, key, limit, window)
+}
+
+// Allow 使用默认的客户端按滑动窗口限流，见 SlidingWindowLimiter
+//
+//	res, err := redis.Allow(ctx, "sms:"+phone, 5, time.Hour)
+//	if err == nil && !res.Allowed {
+//		// 发送过于频繁，res.RetryAfter 之后再试
+//	}
+func Allow(ctx context.Context, key string, limit int, window time.Duration) (LimitResult, error) {
+	return NewSlidingWindow(nil).Allow(ctx, key, limit, window)
+}
+
+func runLimit(ctx context.Context, c redis.UniversalClient, script *Script, key string, limit int, window time.Duration, args ...interface{}) (res LimitResult, err error) {
+	if limit <= 0 || window < time.Millisecond {
+		return res, errors.New("rate limit must be positive and window at least 1ms")
+	}
+	if c == nil {
+		if c = Client(); c == nil {
+			return res, ErrNotInitialized
+		}
+	}
+	args = append([]interface{}{limit, window.Microseconds()}, args...)
+	v, err := script.Run(ctx, c, []string{Key(rateLimitPrefix + key)}, args...).Int64Slice()
+	if err != nil {
+		return
+	}
+	return LimitResult{Allowed: v[0] == 1, Remaining: int(v[1]), RetryAfter: time.Duration(v[2]) * time.Microsecond}, nil
+}
@@ -2,34 +2,188 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"web_app/health"
+	"web_app/logger"
+	"web_app/settings"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
-	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
+// redis.mode 的取值
+const (
+	ModeSingle   = "single"
+	ModeCluster  = "cluster"
+	ModeSentinel = "sentinel"
+)
+
+// pingTimeout readiness 检查的超时时间
+const pingTimeout = time.Second
+
+// closeGracePeriod 配置热加载替换客户端之后，等待旧客户端上正在执行的命令完成再关闭的时间
+const closeGracePeriod = 10 * time.Second
+
 // 声明一个全局的 rdb 变量
-var rdb *redis.Client
-
-// 初始化连接
-func Init() (err error) {
-	// NewClient将客户端返回给Options指定的Redis Server。
-	// Options保留设置以建立redis连接。
-	rdb = redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", viper.GetString("redis.host"), viper.GetInt("redis.port")),
-		Password: viper.GetString("redis.password"), // 没有密码，默认值
-		DB:       viper.GetInt("redis.db"),          // 默认DB 0 连接到服务器后要选择的数据库。
-		PoolSize: viper.GetInt("redis.pool_size"),   // 最大套接字连接数。 默认情况下，每个可用CPU有10个连接，由runtime.GOMAXPROCS报告。
+var (
+	mu  sync.RWMutex
+	rdb redis.UniversalClient
+	// prefix 展开之后的 redis.key_prefix
+	prefix string
+)
+
+// Init 根据 Redis 配置初始化默认的客户端并返回，之后也可以通过 Client 获取
+// 连接参数在运行时修改后会新建客户端替换掉旧的，旧的在 10s 之后关闭，需要长期持有时使用 Client() 而不是保存返回值；
+// key_prefix 需要重启才能生效
+func Init(cfg *settings.RedisConfig) (client redis.UniversalClient, err error) {
+	if client, err = New(cfg); err != nil {
+		return
+	}
+	var app settings.AppConfig
+	if c := settings.Current(); c != nil {
+		app = c.App
+	}
+	mu.Lock()
+	rdb = client
+	prefix = expandPrefix(cfg.KeyPrefix, &app)
+	mu.Unlock()
+	// Redis 不可用时 /readiness 返回 503
+	health.Register("redis", Ping)
+	if err := RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+		logger.Named("dao.redis").Error("register redis metrics failed", zap.Error(err))
+	}
+
+	current := *cfg
+	// go-redis 的连接参数在创建之后不能修改，配置变化时新建一个客户端替换掉旧的
+	settings.OnChange(func(c settings.Config) {
+		next := c.Redis
+		// 修改前缀之后已有的 key（流的消费者、延时任务、锁、会话等）都找不到了，前缀只在启动时生效
+		if p := expandPrefix(next.KeyPrefix, &c.App); p != Key("") {
+			logger.Named("dao.redis").Warn("redis.key_prefix changed, restart required to take effect",
+				zap.String("current", Key("")), zap.String("new", p))
+		}
+		next.KeyPrefix = current.KeyPrefix
+		if reflect.DeepEqual(next, current) {
+			return
+		}
+		client, err := New(&next)
+		if err != nil {
+			logger.Named("dao.redis").Error("reconnect redis failed, keep using the old client", zap.Error(err))
+			return
+		}
+		mu.Lock()
+		old := rdb
+		rdb = client
+		mu.Unlock()
+		// 已经通过 Client() 取到旧客户端的命令仍在执行，稍后再关闭；Pub/Sub 等长连接在旧客户端关闭后重新连接到新的客户端
+		time.AfterFunc(closeGracePeriod, func() { _ = old.Close() })
+		current = next
+		logger.Named("dao.redis").Info("redis client reloaded", zap.String("mode", next.Mode), zap.Strings("addrs", addrs(&next)))
 	})
+	return
+}
+
+// New 根据 Redis 配置创建客户端并用 ping 验证连接，预先加载注册的 Lua 脚本，启用链路追踪时每条命令生成一个 span，按 redis.mode 返回 *redis.Client、*redis.ClusterClient 或者哨兵模式的 *redis.Client，
+// 单元测试或者需要连接其他 Redis 时使用，业务代码一般使用 Init 初始化的默认客户端
+func New(cfg *settings.RedisConfig) (client redis.UniversalClient, err error) {
+	opts, err := Options(cfg)
+	if err != nil {
+		return
+	}
+	switch cfg.Mode {
+	case ModeCluster:
+		if cfg.DB != 0 {
+			return nil, errors.New("redis.db must be 0 in cluster mode")
+		}
+		client = redis.NewClusterClient(opts.Cluster())
+	case ModeSentinel:
+		client = redis.NewFailoverClient(opts.Failover())
+	default:
+		client = redis.NewClient(opts.Simple())
+	}
+	client.AddHook(tracingHook{addr: opts.Addrs[0], db: cfg.DB})
 
 	// Background返回一个非空的Context。它永远不会被取消，没有值，也没有截止日期。
 	// 它通常由main函数、初始化和测试使用，并作为传入请求的顶级上下文
 	ctx := context.Background()
 
-	_, err = rdb.Ping(ctx).Result()
+	if _, err = client.Ping(ctx).Result(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	if lerr := LoadScripts(ctx, client); lerr != nil {
+		logger.Named("dao.redis").Warn("preload lua scripts failed, falling back to EVAL", zap.Error(lerr))
+	}
+	return client, nil
+}
+
+// Options 把 Redis 配置转换为 go-redis 的 UniversalOptions，零值使用 go-redis 的默认值，
+// 再通过 Simple、Cluster、Failover 转换为对应模式的 Options；开启 TLS 时读取证书失败返回错误
+func Options(cfg *settings.RedisConfig) (opts *redis.UniversalOptions, err error) {
+	opts = &redis.UniversalOptions{
+		Addrs:            addrs(cfg),
+		MasterName:       cfg.MasterName,
+		SentinelPassword: cfg.SentinelPassword,
+		Username:         cfg.Username,
+		Password:         cfg.Password,     // 没有密码，默认值
+		DB:               cfg.DB,           // 默认DB 0 连接到服务器后要选择的数据库。
+		PoolSize:         cfg.PoolSize,     // 最大套接字连接数。 默认情况下，每个可用CPU有10个连接，由runtime.GOMAXPROCS报告。cluster 时为每个节点的连接数
+		MinIdleConns:     cfg.MinIdleConns, // 保持的最少空闲连接数
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+		MaxRetries:       cfg.MaxRetries,
+		MinRetryBackoff:  cfg.MinRetryBackoff,
+		MaxRetryBackoff:  cfg.MaxRetryBackoff,
+	}
+	if cfg.TLS.Enable {
+		// server_name 为空时按每个节点的地址校验证书
+		opts.TLSConfig, err = cfg.TLS.Load("redis.tls")
+	}
 	return
 }
 
+// expandPrefix 把 key_prefix 中的 {app}、{env} 替换为应用的名称和环境
+func expandPrefix(p string, app *settings.AppConfig) string {
+	return strings.NewReplacer("{app}", app.Name, "{env}", app.Env).Replace(p)
+}
+
+// addrs 节点的地址，redis.addrs 为空时为 host:port
+func addrs(cfg *settings.RedisConfig) []string {
+	if len(cfg.Addrs) > 0 {
+		return cfg.Addrs
+	}
+	return []string{fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)}
+}
+
+// Client 返回当前使用的客户端，没有初始化时返回 nil
+// 业务代码只依赖 redis.UniversalClient 接口，单机、cluster、sentinel 之间切换时不需要修改
+func Client() redis.UniversalClient {
+	mu.RLock()
+	defer mu.RUnlock()
+	return rdb
+}
+
+// Ping 检查默认的客户端是否可用，超时时间最长为 1s
+func Ping(ctx context.Context) error {
+	c := Client()
+	if c == nil {
+		return ErrNotInitialized
+	}
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return c.Ping(ctx).Err()
+}
+
+// Close 关闭默认的客户端
 func Close() {
-	_ = rdb.Close()
+	if c := Client(); c != nil {
+		_ = c.Close()
+	}
 }
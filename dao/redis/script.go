@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scriptFS 本包使用的 Lua 脚本，文件名（不含 .lua）为脚本的名称
+//
+//go:embed scripts/*.lua
+var scriptFS embed.FS
+
+var (
+	scriptsMu sync.Mutex
+	scripts   = make(map[string]*Script)
+)
+
+// Script 注册的 Lua 脚本，Run 时先 EVALSHA，Redis 中没有该脚本（NOSCRIPT，例如 Redis 重启或故障切换之后）时自动改为 EVAL
+type Script struct {
+	*redis.Script
+	name string
+}
+
+// RegisterScript 注册名为 name 的 Lua 脚本，Init 时通过 SCRIPT LOAD 预先加载到 Redis，之后 Run 直接 EVALSHA 只传输 SHA1；
+// 在包级变量中调用，名称重复时 panic。其他包的脚本可以用 go:embed 嵌入后注册：
+//
+//	//go:embed vote.lua
+//	var voteLua string
+//	var voteScript = redis.RegisterScript("post_vote", voteLua)
+//
+//	func Vote(ctx context.Context, postID, userID string, dir int) (int64, error) {
+//		return voteScript.Run(ctx, nil, []string{redis.Key("post:votes:" + postID)}, userID, dir).Int64()
+//	}
+func RegisterScript(name, src string) *Script {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	if _, ok := scripts[name]; ok {
+		panic(fmt.Sprintf("redis: duplicate script %q", name))
+	}
+	s := &Script{Script: redis.NewScript(src), name: name}
+	scripts[name] = s
+	return s
+}
+
+// mustScript 注册 scripts 目录中嵌入的脚本
+func mustScript(name string) *Script {
+	b, err := scriptFS.ReadFile("scripts/" + name + ".lua")
+	if err != nil {
+		panic(fmt.Sprintf("redis: script %q not found: %v", name, err))
+	}
+	return RegisterScript(name, string(b))
+}
+
+// Name 注册时的名称
+func (s *Script) Name() string {
+	return s.name
+}
+
+// Run 执行脚本，c 为 nil 时使用默认的客户端，结果通过 Int64、Int64Slice、Text 等方法按类型读取
+func (s *Script) Run(ctx context.Context, c redis.Scripter, keys []string, args ...interface{}) *redis.Cmd {
+	if c == nil {
+		if client := Client(); client != nil {
+			c = client
+		} else {
+			cmd := redis.NewCmd(ctx)
+			cmd.SetErr(ErrNotInitialized)
+			return cmd
+		}
+	}
+	return s.Script.Run(ctx, c, keys, args...)
+}
+
+// LoadScripts 把所有注册的脚本加载到 c 中，cluster 时加载到每个节点；Init 和重新连接时自动调用，
+// 加载失败不影响使用，Run 时会改为 EVAL
+func LoadScripts(ctx context.Context, c redis.UniversalClient) error {
+	scriptsMu.Lock()
+	list := make([]*Script, 0, len(scripts))
+	for _, s := range scripts {
+		list = append(list, s)
+	}
+	scriptsMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	load := func(ctx context.Context, c redis.Scripter) error {
+		for _, s := range list {
+			if err := s.Load(ctx, c).Err(); err != nil {
+				return fmt.Errorf("load script %s: %w", s.name, err)
+			}
+		}
+		return nil
+	}
+	if cc, ok := c.(*redis.ClusterClient); ok {
+		return cc.ForEachShard(ctx, func(ctx context.Context, node *redis.Client) error {
+			return load(ctx, node)
+		})
+	}
+	return load(ctx, c)
+}
@@ -0,0 +1,8 @@
+-- 把 ARGV 中的每一位设置为 1，任意一位原来为 0 时返回 1（新加入）
+local added = 0
+for _, offset in ipairs(ARGV) do
+	if redis.call("SETBIT", KEYS[1], offset, 1) == 0 then
+		added = 1
+	end
+end
+return added
@@ -0,0 +1,7 @@
+-- ARGV 中的每一位都为 1 时返回 1（可能存在）
+for _, offset in ipairs(ARGV) do
+	if redis.call("GETBIT", KEYS[1], offset) == 0 then
+		return 0
+	end
+end
+return 1
@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"web_app/tracing"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingHook 为每条命令（pipeline、事务为一个 span）创建请求 span 的子 span，只记录命令名，不记录 key 和参数；
+// 没有启用链路追踪时不做任何事
+type tracingHook struct {
+	addr string
+	db   int
+}
+
+var _ redis.Hook = tracingHook{}
+
+func (h tracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h tracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !tracing.Enabled() {
+			return next(ctx, cmd)
+		}
+		ctx, span := h.start(ctx, "redis."+cmd.Name(), cmd.Name())
+		err := next(ctx, cmd)
+		end(span, cmd.Err())
+		return err
+	}
+}
+
+func (h tracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !tracing.Enabled() {
+			return next(ctx, cmds)
+		}
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		ctx, span := h.start(ctx, "redis.pipeline", strings.Join(names, " "))
+		span.SetAttributes(attribute.Int("db.redis.num_cmd", len(cmds)))
+		err := next(ctx, cmds)
+		end(span, err)
+		return err
+	}
+}
+
+func (h tracingHook) start(ctx context.Context, name, op string) (context.Context, trace.Span) {
+	return tracing.Tracer("web_app/dao/redis").Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", op),
+			attribute.Int("db.redis.database_index", h.db),
+			attribute.String("server.address", h.addr),
+		),
+	)
+}
+
+// end 记录错误并结束 span，key 不存在（redis.Nil）不是错误
+func end(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// watchAttempts Watch 在 key 被其他客户端修改时最多尝试的次数
+	watchAttempts = 10
+	// 重试的等待时间按指数增长并随机浮动，避免同时冲突的客户端再次同时重试
+	minWatchBackoff = time.Millisecond
+	maxWatchBackoff = 100 * time.Millisecond
+)
+
+// ErrTxConflict Watch 重试了 watchAttempts 次仍然冲突，与 go-redis 的 redis.TxFailedErr 相同
+var ErrTxConflict = redis.TxFailedErr
+
+// Pipelined 使用默认的客户端把 fn 中的多条命令一次发送，只有一次网络往返；命令之间不是原子的，
+// 返回第一个失败的命令的错误，每条命令的结果从 fn 中保存的 Cmd 读取
+//
+//	var score *goredis.FloatCmd
+//	_, err := redis.Pipelined(ctx, func(p goredis.Pipeliner) error {
+//		score = p.ZIncrBy(ctx, redis.Key("post:score"), 1, postID)
+//		p.SAdd(ctx, redis.Key("post:voted:"+postID), userID)
+//		return nil
+//	})
+func Pipelined(ctx context.Context, fn func(p redis.Pipeliner) error) ([]redis.Cmder, error) {
+	c := Client()
+	if c == nil {
+		return nil, ErrNotInitialized
+	}
+	return c.Pipelined(ctx, fn)
+}
+
+// TxPipelined 与 Pipelined 相同，但命令包在 MULTI/EXEC 中原子地执行；cluster 中所有 key 需要在同一个 slot
+func TxPipelined(ctx context.Context, fn func(p redis.Pipeliner) error) ([]redis.Cmder, error) {
+	c := Client()
+	if c == nil {
+		return nil, ErrNotInitialized
+	}
+	return c.TxPipelined(ctx, fn)
+}
+
+// Watch 使用默认的客户端执行基于 WATCH 的乐观事务：fn 中读取 keys 的当前值，再通过 tx.TxPipelined 写入，
+// EXEC 之前 keys 被其他客户端修改时事务不会执行，Watch 等待一段随机的时间后重新调用 fn，最多 10 次，仍然冲突时返回 ErrTxConflict
+// keys 不包括 redis.key_prefix，fn 中使用 redis.Key(key)；cluster 中所有 key 需要在同一个 slot
+//
+//	err := redis.Watch(ctx, func(tx *goredis.Tx) error {
+//		n, err := tx.Get(ctx, redis.Key("stock:"+id)).Int()
+//		if err != nil {
+//			return err
+//		}
+//		if n <= 0 {
+//			return ErrSoldOut
+//		}
+//		_, err = tx.TxPipelined(ctx, func(p goredis.Pipeliner) error {
+//			p.Set(ctx, redis.Key("stock:"+id), n-1, 0)
+//			return nil
+//		})
+//		return err
+//	}, "stock:"+id)
+func Watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	c := Client()
+	if c == nil {
+		return ErrNotInitialized
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = Key(k)
+	}
+	backoff := minWatchBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.Watch(ctx, fn, full...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+		if attempt == watchAttempts {
+			return fmt.Errorf("%w after %d attempts", ErrTxConflict, attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", err, ctx.Err())
+		case <-time.After(backoff/2 + time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package seeds 本地开发、测试环境的种子数据，通过 ./web_app seed 按需写入
+//
+// 种子数据可以是本目录下的 SQL 文件，也可以是本包中通过 Register 注册的 Go 函数，
+// 两者按名称（SQL 文件为去掉 .sql 的文件名）一起排序执行，建议使用数字前缀控制顺序，例如 001_users.sql、002_posts.go
+//
+//	func init() {
+//		seeds.Register("002_posts", func(ctx context.Context, db *mysql.DB) error {
+//			posts := mysql.NewRepository[Post](db, "post")
+//			_, err := posts.Upsert(ctx, []Post{{ID: 1, Title: "hello"}}, "title")
+//			return err
+//		})
+//	}
+//
+// 种子数据每次都会完整执行，应是幂等的（INSERT IGNORE、ON CONFLICT DO NOTHING、Repository.Upsert 等），
+// SQL 文件使用当前驱动的方言，每条语句以行尾的 ; 结束
+package seeds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Func Go 实现的种子数据，在事务中执行，ctx 中带有该事务，Repository 会自动使用
+type Func func(ctx context.Context, db *mysql.DB) error
+
+var funcs = make(map[string]Func)
+
+// Register 注册 Go 实现的种子数据，在本包的 init 中调用，name 重复时 panic
+func Register(name string, fn Func) {
+	if _, ok := funcs[name]; ok {
+		panic(fmt.Sprintf("seeds: duplicate seed %q", name))
+	}
+	funcs[name] = fn
+}
+
+// seed 一个种子数据，file 和 fn 只有一个不为空
+type seed struct {
+	name string
+	file string
+	fn   Func
+}
+
+// Run 依次执行种子数据，names 为空时执行所有种子数据，否则只执行指定的；
+// app.env 不在 seed.envs 中时拒绝执行，避免误写入生产环境。每个种子数据在单独的事务中执行，失败时回滚并停止
+func Run(ctx context.Context, db *mysql.DB, env string, cfg *settings.SeedConfig, names ...string) (err error) {
+	allowed := false
+	for _, e := range cfg.Envs {
+		allowed = allowed || (e != "" && e == env)
+	}
+	if !allowed {
+		return fmt.Errorf("seeding is not allowed in env %q, allowed envs: %s", env, strings.Join(cfg.Envs, ", "))
+	}
+	all, err := load(cfg.Dir)
+	if err != nil {
+		return
+	}
+	selected := all
+	if len(names) > 0 {
+		byName := make(map[string]seed, len(all))
+		for _, s := range all {
+			byName[s.name] = s
+		}
+		selected = selected[:0:0]
+		for _, name := range names {
+			s, ok := byName[strings.TrimSuffix(name, ".sql")]
+			if !ok {
+				return fmt.Errorf("unknown seed %q", name)
+			}
+			selected = append(selected, s)
+		}
+	}
+	log := logger.Named("seeds")
+	for _, s := range selected {
+		start := time.Now()
+		if err = db.WithTx(ctx, func(tx *sqlx.Tx) error {
+			if s.fn != nil {
+				return s.fn(mysql.ContextWithTx(ctx, tx), db)
+			}
+			return execFile(ctx, tx, s.file)
+		}); err != nil {
+			return fmt.Errorf("seed %s: %w", s.name, err)
+		}
+		log.Info("seed applied", zap.String("seed", s.name), zap.Duration("elapsed", time.Since(start)))
+	}
+	return
+}
+
+// load 读取 dir 中的 SQL 文件和注册的 Go 函数，按名称排序，dir 不存在时只有 Go 函数
+func load(dir string) (seeds []seed, err error) {
+	for name, fn := range funcs {
+		seeds = append(seeds, seed{name: name, fn: fn})
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".sql")
+		if _, ok := funcs[name]; ok {
+			return nil, fmt.Errorf("seed %q is both a sql file and a registered func", name)
+		}
+		seeds = append(seeds, seed{name: name, file: f})
+	}
+	sort.Slice(seeds, func(i, j int) bool { return seeds[i].name < seeds[j].name })
+	return
+}
+
+// execFile 逐条执行 SQL 文件中的语句，MySQL 驱动默认不支持一次执行多条语句
+func execFile(ctx context.Context, tx *sqlx.Tx, file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range splitStatements(string(b)) {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements 按行尾的 ; 拆分语句，忽略语句之间的空行和 -- 注释
+func splitStatements(s string) (stmts []string) {
+	var cur []string
+	for _, line := range strings.Split(s, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(cur) == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		cur = append(cur, line)
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.Join(cur, "\n"))
+			cur = nil
+		}
+	}
+	if len(cur) > 0 {
+		stmts = append(stmts, strings.Join(cur, "\n"))
+	}
+	return
+}
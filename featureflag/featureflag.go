@@ -0,0 +1,260 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web_app/dao/redis"
+	"web_app/logger"
+	"web_app/pubsub"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Config 功能开关配置，对应配置文件中的 feature_flags
+//
+//	feature_flags:
+//	  redis_key: "feature_flags"
+//	  refresh_interval: 10s
+//	  flags:
+//	    new_checkout:
+//	      enabled: true
+//	      percentage: 20
+type Config struct {
+	// RedisKey 保存覆盖值的 hash（自动加上 redis.key_prefix），field 为开关名，值为 on/off 或 0-100 的放量比例，为空表示不使用 Redis
+	RedisKey string `mapstructure:"redis_key"`
+	// RefreshInterval 重新读取 Redis 中覆盖值的间隔，覆盖值缓存在内存中，请求不会访问 Redis；
+	// 向 featureflag:reload 频道发布消息时立即重新读取
+	RefreshInterval time.Duration   `mapstructure:"refresh_interval" validate:"min=1s"`
+	Flags           map[string]Flag `mapstructure:"flags" validate:"dive"`
+}
+
+// Flag 单个功能开关
+type Flag struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Percentage 放量比例 0-100，按用户（或 IP）稳定地分桶，不配置表示全量
+	Percentage *int `mapstructure:"percentage" validate:"omitempty,min=0,max=100"`
+}
+
+const (
+	// 配置文件中的 key
+	configKey = "feature_flags"
+	// ReloadChannel 修改 Redis 中的覆盖值之后向这个频道发布消息，所有实例立即重新读取
+	ReloadChannel = "featureflag:reload"
+)
+
+var (
+	current atomic.Pointer[Config]
+	// overrides 最近一次从 Redis 读取的覆盖值
+	overrides atomic.Pointer[map[string]Flag]
+	stop      chan struct{}
+	stopOnce  sync.Once
+)
+
+func init() {
+	settings.Register(configKey, Config{RedisKey: "feature_flags", RefreshInterval: 10 * time.Second})
+}
+
+// Init 读取功能开关配置和 Redis 中的覆盖值，并在配置热加载时更新，之后每 refresh_interval 在后台重新读取覆盖值；
+// 需要在 redis.Init 之后、pubsub.Start 之前调用，退出时调用 Close
+func Init() (err error) {
+	if err = load(); err != nil {
+		return
+	}
+	settings.OnChange(func(settings.Config) {
+		if err := load(); err != nil {
+			logger.Named("featureflag").Error("reload feature flags failed", zap.Error(err))
+		}
+	})
+	refresh(context.Background())
+	pubsub.Handle(ReloadChannel, func(ctx context.Context, msg *pubsub.Message) error {
+		refresh(ctx)
+		return nil
+	})
+	stop = make(chan struct{})
+	go refreshLoop()
+	return
+}
+
+// Close 停止后台读取覆盖值
+func Close() {
+	if stop != nil {
+		stopOnce.Do(func() { close(stop) })
+	}
+}
+
+func load() error {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil {
+		return err
+	}
+	current.Store(cfg)
+	return nil
+}
+
+// refreshLoop 每 refresh_interval 重新读取一次覆盖值，间隔在配置热加载之后的下一次生效
+func refreshLoop() {
+	timer := time.NewTimer(current.Load().RefreshInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			refresh(context.Background())
+			timer.Reset(current.Load().RefreshInterval)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// refresh 从 Redis 读取所有的覆盖值替换掉内存中的，读取失败时保留上一次的结果
+func refresh(ctx context.Context) {
+	cfg := current.Load()
+	client := redis.Client()
+	if cfg == nil || cfg.RedisKey == "" || client == nil {
+		overrides.Store(nil)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	values, err := client.HGetAll(ctx, redis.Key(cfg.RedisKey)).Result()
+	if err != nil {
+		logger.Named("featureflag").Warn("load feature flag overrides from redis failed, keep the last ones", zap.Error(err))
+		return
+	}
+	flags := make(map[string]Flag, len(values))
+	for name, value := range values {
+		if flag, ok := parseOverride(value); ok {
+			flags[name] = flag
+		}
+	}
+	overrides.Store(&flags)
+}
+
+// loadOverrides 内存中的覆盖值，没有时返回 nil
+func loadOverrides() map[string]Flag {
+	if m := overrides.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+type ctxKey int
+
+const (
+	stateKey ctxKey = iota
+	rolloutKey
+)
+
+// requestState Middleware 在请求开始时计算好的所有开关的状态，key 为计算时使用的分桶 key
+type requestState struct {
+	key     string
+	enabled map[string]bool
+}
+
+// WithKey 设置放量分桶使用的 key，一般为用户 ID
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, rolloutKey, key)
+}
+
+// IsEnabled 判断功能开关是否打开，放量分桶的 key 依次为 WithKey 设置的 key、auth.Middleware 保存的用户 ID、Middleware 使用的 key；
+// 经过 Middleware 的请求在 key 相同时直接使用请求开始时计算好的结果，同一个请求内结果保持一致，key 不同（例如登录后按用户分桶）时重新计算
+func IsEnabled(ctx context.Context, name string) bool {
+	state, _ := ctx.Value(stateKey).(*requestState)
+	key := rolloutKeyOf(ctx, state)
+	if state != nil && state.key == key {
+		return state.enabled[name]
+	}
+	cfg := current.Load()
+	if cfg == nil {
+		return false
+	}
+	flag, ok := cfg.Flags[name]
+	if override, found := loadOverrides()[name]; found {
+		flag, ok = override, true
+	}
+	return ok && flag.enabledFor(name, key)
+}
+
+// rolloutKeyOf ctx 中放量分桶使用的 key，见 IsEnabled
+func rolloutKeyOf(ctx context.Context, state *requestState) string {
+	if key, ok := ctx.Value(rolloutKey).(string); ok {
+		return key
+	}
+	if userID, _ := logger.User(ctx); userID != nil {
+		return fmt.Sprint(userID)
+	}
+	if state != nil {
+		return state.key
+	}
+	return ""
+}
+
+// Middleware 在请求开始时计算所有功能开关的状态并注入到请求的 context 中
+// keyFunc 返回放量分桶使用的 key，为 nil 时使用当前用户 ID，没有登录时使用客户端 IP；
+// 全局的 Middleware 在 auth.Middleware 之前执行，此时只有 IP，登录的请求在 IsEnabled 时按用户 ID 重新计算
+func Middleware(keyFunc func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := current.Load()
+		if cfg == nil {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		var key string
+		if keyFunc != nil {
+			key = keyFunc(c)
+			ctx = WithKey(ctx, key)
+		} else {
+			key = rolloutKeyOf(c, &requestState{key: c.ClientIP()})
+		}
+		flags := make(map[string]Flag, len(cfg.Flags))
+		for name, flag := range cfg.Flags {
+			flags[name] = flag
+		}
+		for name, flag := range loadOverrides() {
+			flags[name] = flag
+		}
+		state := &requestState{key: key, enabled: make(map[string]bool, len(flags))}
+		for name, flag := range flags {
+			state.enabled[name] = flag.enabledFor(name, key)
+		}
+		c.Request = c.Request.WithContext(context.WithValue(ctx, stateKey, state))
+		c.Next()
+	}
+}
+
+// enabledFor 按 name+key 的哈希值分桶，保证同一个用户多次访问的结果一致
+func (f Flag) enabledFor(name, key string) bool {
+	if !f.Enabled {
+		return false
+	}
+	if f.Percentage == nil || *f.Percentage >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + ":" + key))
+	return int(h.Sum32()%100) < *f.Percentage
+}
+
+// parseOverride 解析覆盖值：on/true 全量打开，off/false 关闭，0-100 按比例放量
+func parseOverride(value string) (Flag, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "on", "true":
+		return Flag{Enabled: true}, true
+	case "off", "false":
+		return Flag{Enabled: false}, true
+	}
+	p, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || p < 0 || p > 100 {
+		return Flag{}, false
+	}
+	return Flag{Enabled: true, Percentage: &p}, true
+}
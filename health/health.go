@@ -0,0 +1,116 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckFunc 检查一个依赖是否可用，返回错误表示不可用
+type CheckFunc func(ctx context.Context) error
+
+// checkTimeout 所有检查的总超时时间，kubelet 的探针默认 1s 超时
+const checkTimeout = time.Second
+
+// Result.Status 的取值
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	// StatusShuttingDown 收到关机信号之后，依赖正常时 readiness 也返回 503
+	StatusShuttingDown = "shutting_down"
+)
+
+var (
+	mu     sync.RWMutex
+	checks = make(map[string]CheckFunc)
+	// draining 调用过 Drain
+	draining atomic.Bool
+)
+
+// Register 注册 readiness 检查，一般在依赖初始化成功之后调用，同名的检查会被覆盖；
+// MySQL、Redis 和 pubsub 已经注册，其他依赖（例如第三方接口）按需注册
+//
+//	health.Register("mysql", mysql.Ping)
+func Register(name string, check CheckFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// Drain 标记实例正在关机，之后 readiness 一直返回 503，负载均衡不再转发新的请求；
+// 优雅关机时在关闭 HTTP 服务之前调用，并等待 app.shutdown_delay，让负载均衡有时间发现
+func Drain() {
+	draining.Store(true)
+}
+
+// Draining 是否调用过 Drain
+func Draining() bool {
+	return draining.Load()
+}
+
+// Result 检查结果，Checks 中的值为 ok 或者错误信息
+type Result struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Check 并发执行所有检查，任意一个失败时 Status 为 unavailable，都通过但是调用过 Drain 时为 shutting_down
+func Check(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	mu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	funcs := make([]CheckFunc, len(names))
+	for i, name := range names {
+		funcs[i] = checks[name]
+	}
+	mu.RUnlock()
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range funcs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = funcs[i](ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	r := Result{Status: StatusOK, Checks: make(map[string]string, len(names))}
+	for i, name := range names {
+		r.Checks[name] = StatusOK
+		if errs[i] != nil {
+			r.Status = StatusUnavailable
+			r.Checks[name] = errs[i].Error()
+		}
+	}
+	if r.Status == StatusOK && Draining() {
+		r.Status = StatusShuttingDown
+	}
+	return r
+}
+
+// ReadinessHandler 所有检查都通过时返回 200，否则（包括关机过程中）返回 503，Kubernetes 据此把实例从 Service 中摘除
+func ReadinessHandler(c *gin.Context) {
+	r := Check(c.Request.Context())
+	status := http.StatusOK
+	if r.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, r)
+}
+
+// LivenessHandler 进程能处理请求即返回 200，不检查依赖，避免数据库故障时所有实例被重启
+func LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": StatusOK})
+}
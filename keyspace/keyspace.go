@@ -0,0 +1,159 @@
+// Package keyspace 订阅 Redis 的键空间通知（keyspace notifications），key 过期或者被淘汰时调用注册的处理函数，
+// 不需要轮询就可以在 TTL 到期时执行操作，例如订单超时取消
+//
+//	func init() {
+//		keyspace.OnExpired("order:timeout:", func(ctx context.Context, key string) error {
+//			return orders.CancelIfUnpaid(ctx, strings.TrimPrefix(key, "order:timeout:"))
+//		})
+//	}
+//	err := redis.Client().Set(ctx, redis.Key("order:timeout:"+id), 1, 30*time.Minute).Err()
+//
+// 通知基于 Pub/Sub：每个实例都会收到同一个事件，处理函数应是幂等的（例如 UPDATE ... WHERE status = 'pending'）；
+// 没有实例在线时事件会丢失，过期事件在 Redis 实际删除 key 时才发送，可能晚于 TTL。需要可靠执行时使用 tasks 包的延迟任务
+package keyspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"web_app/dao/redis"
+	"web_app/pubsub"
+	"web_app/settings"
+)
+
+// Config 键空间通知配置，对应配置文件中的 keyspace
+type Config struct {
+	// Enable 为 false 时不订阅，注册的处理函数不会被调用
+	Enable bool `mapstructure:"enable"`
+	// ConfigureServer 启动时在 notify-keyspace-events 已有的设置上追加 Exe 开启通知，
+	// 云服务一般禁止 CONFIG 命令，需要在控制台中设置并关闭这个选项
+	ConfigureServer bool `mapstructure:"configure_server"`
+}
+
+// 配置文件中的 key
+const configKey = "keyspace"
+
+// 事件的类型
+const (
+	eventExpired = "expired"
+	eventEvicted = "evicted"
+)
+
+// Handler 事件的处理函数，key 不包括 redis.key_prefix
+type Handler func(ctx context.Context, key string) error
+
+type handler struct {
+	prefix string
+	h      Handler
+}
+
+var (
+	mu       sync.Mutex
+	handlers = make(map[string][]handler)
+	started  bool
+)
+
+func init() {
+	settings.Register(configKey, Config{ConfigureServer: true})
+}
+
+// OnExpired 注册 key 以 prefix 开头（不包括 redis.key_prefix）的 key 过期时的处理函数，在 Init 之前（一般在 init 中）调用
+func OnExpired(prefix string, h Handler) {
+	register(eventExpired, prefix, h)
+}
+
+// OnEvicted 注册 key 因为内存不足被淘汰（maxmemory-policy）时的处理函数，见 OnExpired
+func OnEvicted(prefix string, h Handler) {
+	register(eventEvicted, prefix, h)
+}
+
+func register(event, prefix string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	if started {
+		panic(fmt.Sprintf("keyspace: register %s handler for %q after Init", event, prefix))
+	}
+	handlers[event] = append(handlers[event], handler{prefix: prefix, h: h})
+}
+
+// Init 读取 keyspace 配置，启用时通过 pubsub 订阅当前 redis.db 的 expired、evicted 事件，需要在 redis.Init 之后、pubsub.Start 之前调用
+// cluster 中每个节点只发送自己的 key 的事件，而订阅只连接一个节点，所以只支持单机和 sentinel
+func Init() (err error) {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	started = true
+	if !cfg.Enable || len(handlers) == 0 {
+		return
+	}
+	current := settings.Current()
+	if current == nil {
+		return errors.New("keyspace requires settings to be initialized")
+	}
+	if current.Redis.Mode == redis.ModeCluster {
+		return errors.New("keyspace notifications are not supported in redis cluster mode")
+	}
+	if cfg.ConfigureServer {
+		client := redis.Client()
+		if client == nil {
+			return redis.ErrNotInitialized
+		}
+		// 在服务端已有的设置上追加，不覆盖其他服务开启的事件
+		ctx := context.Background()
+		var res map[string]string
+		if res, err = client.ConfigGet(ctx, "notify-keyspace-events").Result(); err != nil {
+			return fmt.Errorf("read keyspace notifications: %w", err)
+		}
+		current := res["notify-keyspace-events"]
+		if flags := mergeFlags(current, "Exe"); flags != current {
+			if err = client.ConfigSet(ctx, "notify-keyspace-events", flags).Err(); err != nil {
+				return fmt.Errorf("enable keyspace notifications: %w", err)
+			}
+		}
+	}
+	for event := range handlers {
+		event := event
+		pubsub.Handle(fmt.Sprintf("__keyevent@%d__:%s", current.Redis.DB, event), func(ctx context.Context, msg *pubsub.Message) error {
+			return dispatch(ctx, event, msg.Payload)
+		})
+	}
+	return
+}
+
+// mergeFlags 把 notify-keyspace-events 的 flags 追加到 current 中缺少的部分，
+// E 表示 __keyevent@<db>__ 频道，x 为过期事件，e 为淘汰事件，A 表示包括 x、e 在内的所有事件
+func mergeFlags(current, flags string) string {
+	merged := current
+	for _, f := range flags {
+		if strings.ContainsRune(merged, f) || (strings.ContainsRune("g$lshzxetd", f) && strings.ContainsRune(merged, 'A')) {
+			continue
+		}
+		merged += string(f)
+	}
+	return merged
+}
+
+// dispatch 调用 key 匹配的所有处理函数，没有 redis.key_prefix 的 key 属于其他环境，忽略
+func dispatch(ctx context.Context, event, key string) error {
+	prefix := redis.Key("")
+	if !strings.HasPrefix(key, prefix) {
+		return nil
+	}
+	key = strings.TrimPrefix(key, prefix)
+	var errs []error
+	for _, h := range handlers[event] {
+		if strings.HasPrefix(key, h.prefix) {
+			// 一个处理函数失败不影响其他的，错误由 pubsub 记录日志
+			errs = append(errs, h.h(ctx, key))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s %s: %w", event, key, err)
+	}
+	return nil
+}
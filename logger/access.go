@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessRules log.access 中的 skip_paths 和 slow_threshold，配置热加载时整体替换
+type accessRules struct {
+	skip          map[string]bool
+	slowThreshold time.Duration
+}
+
+var currentAccessRules atomic.Pointer[accessRules]
+
+func setAccessRules(cfg *settings.AccessLogConfig) {
+	r := &accessRules{skip: make(map[string]bool, len(cfg.SkipPaths)), slowThreshold: cfg.SlowThreshold}
+	for _, p := range cfg.SkipPaths {
+		r.skip[p] = true
+	}
+	currentAccessRules.Store(r)
+}
+
+// GinLoggerOption GinLogger 的选项，与 log.access 中的配置同时生效
+type GinLoggerOption func(*ginLoggerOptions)
+
+type ginLoggerOptions struct {
+	skip          map[string]bool
+	slowThreshold time.Duration
+}
+
+// WithSkipPaths 不记录这些路由的访问日志，例如健康检查、指标采集，出错的请求仍然会记录
+func WithSkipPaths(paths ...string) GinLoggerOption {
+	return func(o *ginLoggerOptions) {
+		for _, p := range paths {
+			o.skip[p] = true
+		}
+	}
+}
+
+// WithSlowThreshold 耗时超过 d 的请求以 WARN 级别记录并带上 slow=true，覆盖 log.access.slow_threshold
+func WithSlowThreshold(d time.Duration) GinLoggerOption {
+	return func(o *ginLoggerOptions) {
+		o.slowThreshold = d
+	}
+}
+
+// skipAccess 判断是否跳过这个请求的访问日志
+func (o *ginLoggerOptions) skipAccess(c *gin.Context) bool {
+	if c.Writer.Status() >= http.StatusBadRequest {
+		return false
+	}
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	if o.skip[path] {
+		return true
+	}
+	r := currentAccessRules.Load()
+	return r != nil && r.skip[path]
+}
+
+// isSlow 判断请求是否为慢请求，没有通过选项设置阈值时使用 log.access.slow_threshold，阈值为 0 表示不判断
+func (o *ginLoggerOptions) isSlow(cost time.Duration) bool {
+	threshold := o.slowThreshold
+	if threshold == 0 {
+		if r := currentAccessRules.Load(); r != nil {
+			threshold = r.slowThreshold
+		}
+	}
+	return threshold > 0 && cost >= threshold
+}
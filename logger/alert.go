@@ -0,0 +1,283 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"web_app/settings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// alerter 按 log.alert 的配置发送告警，配置热加载时整体替换（节流的状态也会重置）
+type alerter struct {
+	cfg      settings.AlertConfig
+	level    zapcore.Level
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	throttle time.Duration
+
+	mu         sync.Mutex
+	lastSent   map[string]time.Time
+	suppressed map[string]int
+}
+
+// fatalAlertTimeout DPanic 及以上级别的告警同步发送的最长时间，之后进程可能退出
+const fatalAlertTimeout = 2 * time.Second
+
+var (
+	currentAlerter atomic.Pointer[alerter]
+	// alertQueue 待发送的告警，由一个后台 goroutine 发送
+	alertQueue    = make(chan string, 100)
+	alertLoopOnce sync.Once
+)
+
+// setAlerter 按配置创建 alerter，webhook 为空时关闭告警
+func setAlerter(cfg *settings.AlertConfig) error {
+	if cfg.Webhook == "" {
+		currentAlerter.Store(nil)
+		return nil
+	}
+	a := &alerter{
+		cfg:        *cfg,
+		level:      zapcore.ErrorLevel,
+		throttle:   cfg.Throttle,
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+	if cfg.Level != "" {
+		l, err := zapcore.ParseLevel(cfg.Level)
+		if err != nil {
+			return err
+		}
+		a.level = l
+	}
+	if a.throttle <= 0 {
+		a.throttle = 5 * time.Minute
+	}
+	if a.cfg.Timeout <= 0 {
+		a.cfg.Timeout = 5 * time.Second
+	}
+	for _, p := range cfg.Include {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		a.include = append(a.include, re)
+	}
+	for _, p := range cfg.Exclude {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		a.exclude = append(a.exclude, re)
+	}
+	currentAlerter.Store(a)
+	alertLoopOnce.Do(func() { go sendAlerts() })
+	return nil
+}
+
+// match 判断日志内容（message 和 error 字段）是否需要告警
+func (a *alerter) match(text string) bool {
+	for _, re := range a.exclude {
+		if re.MatchString(text) {
+			return false
+		}
+	}
+	if len(a.include) == 0 {
+		return true
+	}
+	for _, re := range a.include {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow 节流，相同 key 在 throttle 内只告警一次，返回期间被忽略的次数
+func (a *alerter) allow(key string, now time.Time) (ok bool, suppressed int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, sent := a.lastSent[key]; sent && now.Sub(last) < a.throttle {
+		a.suppressed[key]++
+		return false, 0
+	}
+	a.lastSent[key] = now
+	suppressed = a.suppressed[key]
+	delete(a.suppressed, key)
+	return true, suppressed
+}
+
+// enqueueAlert 告警在后台 goroutine 中发送，队列满时丢弃，不阻塞写日志；DPanic 及以上级别的告警不经过队列
+func enqueueAlert(text string) {
+	select {
+	case alertQueue <- text:
+	default:
+	}
+}
+
+// sendAlerts 使用当前的配置发送队列中的告警
+func sendAlerts() {
+	for text := range alertQueue {
+		a := currentAlerter.Load()
+		if a == nil {
+			continue
+		}
+		a.sendWithTimeout(text, a.cfg.Timeout)
+	}
+}
+
+// sendWithTimeout 发送一条告警，失败时写到标准错误
+func (a *alerter) sendWithTimeout(text string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := a.send(ctx, text); err != nil {
+		// 不能写到 zap 中，否则发送失败的错误日志又会触发告警
+		fmt.Fprintf(os.Stderr, "send %s alert failed, error: %v\n", a.cfg.Provider, err)
+	}
+}
+
+func (a *alerter) send(ctx context.Context, text string) error {
+	webhook, err := url.Parse(a.cfg.Webhook)
+	if err != nil {
+		return err
+	}
+	var payload interface{}
+	switch a.cfg.Provider {
+	case "dingtalk":
+		payload = map[string]interface{}{"msgtype": "text", "text": map[string]string{"content": text}}
+		if a.cfg.Secret != "" {
+			// 钉钉的签名：HmacSHA256(timestamp + "\n" + secret)，密钥为 secret，时间戳为毫秒
+			ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			mac := hmac.New(sha256.New, []byte(a.cfg.Secret))
+			mac.Write([]byte(ts + "\n" + a.cfg.Secret))
+			sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+			q := webhook.Query()
+			q.Set("timestamp", ts)
+			q.Set("sign", sign)
+			webhook.RawQuery = q.Encode()
+		}
+	case "feishu":
+		body := map[string]interface{}{"msg_type": "text", "content": map[string]string{"text": text}}
+		if a.cfg.Secret != "" {
+			// 飞书的签名：以 timestamp + "\n" + secret 为密钥对空字符串做 HmacSHA256，时间戳为秒
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(ts+"\n"+a.cfg.Secret))
+			body["timestamp"] = ts
+			body["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+		payload = body
+	default:
+		payload = map[string]string{"text": text}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doSinkRequest(req)
+}
+
+// alertCore 把匹配的错误日志发送为告警
+type alertCore struct {
+	fields []zapcore.Field
+}
+
+func (c *alertCore) Enabled(l zapcore.Level) bool {
+	a := currentAlerter.Load()
+	return a != nil && l >= a.level
+}
+
+func (c *alertCore) With(fields []zapcore.Field) zapcore.Core {
+	return &alertCore{fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *alertCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *alertCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	a := currentAlerter.Load()
+	if a == nil {
+		return nil
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	errText, _ := enc.Fields["error"].(string)
+	if !a.match(ent.Message + "\n" + errText) {
+		return nil
+	}
+	ok, suppressed := a.allow(ent.Message+"@"+ent.Caller.TrimmedPath(), ent.Time)
+	if !ok {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s: %s\n", appName(), ent.Level.CapitalString(), ent.Message)
+	if errText != "" {
+		fmt.Fprintf(&b, "error: %s\n", errText)
+	}
+	if ent.Caller.Defined {
+		fmt.Fprintf(&b, "caller: %s\n", ent.Caller.TrimmedPath())
+	}
+	if id, ok := enc.Fields[RequestIDKey]; ok {
+		fmt.Fprintf(&b, "request_id: %v\n", id)
+	}
+	if host, err := os.Hostname(); err == nil {
+		fmt.Fprintf(&b, "host: %s\n", host)
+	}
+	fmt.Fprintf(&b, "time: %s", ent.Time.Format(time.RFC3339))
+	if suppressed > 0 {
+		fmt.Fprintf(&b, "\n（过去 %s 内相同的日志还有 %d 条未告警）", a.throttle, suppressed)
+	}
+	// Fatal、Panic 写完日志之后进程随即退出，后台 goroutine 来不及发送，所以同步发送
+	if ent.Level >= zapcore.DPanicLevel {
+		timeout := a.cfg.Timeout
+		if timeout > fatalAlertTimeout {
+			timeout = fatalAlertTimeout
+		}
+		a.sendWithTimeout(b.String(), timeout)
+		return nil
+	}
+	enqueueAlert(b.String())
+	return nil
+}
+
+func (c *alertCore) Sync() error {
+	return nil
+}
+
+// appName 告警中显示的应用名称
+func appName() string {
+	if cfg := settings.Current(); cfg != nil && cfg.App.Name != "" {
+		return cfg.App.Name
+	}
+	return "web_app"
+}
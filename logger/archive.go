@@ -0,0 +1,225 @@
+package logger
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"web_app/settings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.uber.org/zap"
+)
+
+// 轮转出来的文件名中的时间格式：lumberjack 为 web_app-2006-01-02T15-04-05.000.log，timeRotateWriter 为 web_app-2006-01-02.log
+var archiveLayouts = []string{"2006-01-02T15-04-05.000", "2006-01-02-15", "2006-01-02"}
+
+const (
+	// archiveGracePeriod 最近修改过的文件可能还在写入，暂不上传
+	archiveGracePeriod = time.Minute
+	archiveTimeout     = 5 * time.Minute
+)
+
+// archiver 定期把轮转后的日志文件上传到对象存储，上传成功后删除本地文件
+type archiver struct {
+	cfg    settings.LogArchiveConfig
+	client *minio.Client
+	prefix string
+
+	mu    sync.Mutex
+	files map[string]bool
+	// uploaded keep_local 时已经上传过的文件，重启之后会重新上传一次（对象名相同，覆盖之前的对象）
+	uploaded    map[string]bool
+	lastCleanup time.Time
+}
+
+var currentArchiver *archiver
+
+// initArchive 按 log.archive 创建 archiver，并在后台定期检查 filenames 轮转出来的文件
+func initArchive(cfg *settings.LogArchiveConfig, filenames ...string) (err error) {
+	if cfg.Bucket == "" {
+		return
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return
+	}
+	a := &archiver{cfg: *cfg, client: client, files: make(map[string]bool), uploaded: make(map[string]bool)}
+	if a.cfg.Interval <= 0 {
+		a.cfg.Interval = time.Minute
+	}
+	host, _ := os.Hostname()
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = appName()
+	}
+	a.prefix = path.Join(prefix, host)
+	for _, name := range filenames {
+		if name != "" {
+			a.files[name] = true
+		}
+	}
+	currentArchiver = a
+	go a.run()
+	return
+}
+
+// AddArchiveFile 让审计日志等在 logger 之外创建的日志文件也上传到对象存储，没有启用 log.archive 时不做任何事
+func AddArchiveFile(filename string) {
+	a := currentArchiver
+	if a == nil || filename == "" {
+		return
+	}
+	a.mu.Lock()
+	a.files[filename] = true
+	a.mu.Unlock()
+}
+
+func (a *archiver) run() {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		a.mu.Lock()
+		files := make([]string, 0, len(a.files))
+		for name := range a.files {
+			files = append(files, name)
+		}
+		a.mu.Unlock()
+		for _, name := range files {
+			for _, backup := range rotatedFiles(name) {
+				if a.uploaded[backup] {
+					continue
+				}
+				if err := a.upload(backup); err != nil {
+					Named("logger.archive").Error("upload log file failed", zap.String("file", backup), zap.Error(err))
+				}
+			}
+		}
+		for name := range a.uploaded {
+			// 本地文件已经被 max_backups、max_age 清理
+			if _, err := os.Stat(name); os.IsNotExist(err) {
+				delete(a.uploaded, name)
+			}
+		}
+		// 对象存储中的过期日志每小时清理一次
+		if a.cfg.RetentionDays > 0 && time.Since(a.lastCleanup) >= time.Hour {
+			a.cleanup()
+			a.lastCleanup = time.Now()
+		}
+	}
+}
+
+// rotatedFiles 找出 filename 轮转出来的、不会再写入的文件
+func rotatedFiles(filename string) []string {
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filepath.Base(filename), ext) + "-"
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(filename), prefix+"*"+ext))
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	var files []string
+	for _, name := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), prefix), ext)
+		rotated := false
+		for _, layout := range archiveLayouts {
+			if _, err := time.ParseInLocation(layout, stamp, time.Local); err == nil {
+				// 按时间轮转时，当前周期的文件还在写入
+				rotated = stamp != now.Format(layout)
+				break
+			}
+		}
+		if !rotated {
+			continue
+		}
+		if fi, err := os.Stat(name); err != nil || now.Sub(fi.ModTime()) < archiveGracePeriod {
+			continue
+		}
+		files = append(files, name)
+	}
+	return files
+}
+
+// upload 上传一个文件，上传成功后删除本地文件
+func (a *archiver) upload(name string) (err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	object := path.Join(a.prefix, filepath.Base(name))
+	var r io.Reader = f
+	size := int64(-1)
+	opts := minio.PutObjectOptions{ContentType: "text/plain"}
+	if a.cfg.Compress {
+		object += ".gz"
+		opts.ContentType = "application/gzip"
+		// 压缩后的大小未知，minio-go 会使用分片上传，分片大小限制为 16MB，避免占用过多内存
+		opts.PartSize = 16 << 20
+		pr, pw := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			zw := gzip.NewWriter(pw)
+			_, err := io.Copy(zw, f)
+			if err == nil {
+				err = zw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		// PutObject 没有读完就失败时关闭读端，写入的 goroutine 随之返回，而不是一直阻塞在 pw.Write
+		defer func() {
+			_ = pr.Close()
+			<-done
+		}()
+		r = pr
+	} else if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+	defer cancel()
+	if _, err = a.client.PutObject(ctx, a.cfg.Bucket, object, r, size, opts); err != nil {
+		return
+	}
+	Named("logger.archive").Info("log file uploaded", zap.String("file", name), zap.String("object", object))
+	if a.cfg.KeepLocal {
+		// 保留的文件由 max_backups、max_age 清理
+		a.uploaded[name] = true
+		return
+	}
+	return os.Remove(name)
+}
+
+// cleanup 删除对象存储中超过 retention_days 天的日志
+func (a *archiver) cleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+	defer cancel()
+	cutoff := time.Now().AddDate(0, 0, -a.cfg.RetentionDays)
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+		for obj := range a.client.ListObjects(ctx, a.cfg.Bucket, minio.ListObjectsOptions{Prefix: a.prefix + "/", Recursive: true}) {
+			if obj.Err != nil {
+				Named("logger.archive").Error("list archived log files failed", zap.Error(obj.Err))
+				return
+			}
+			if obj.LastModified.Before(cutoff) {
+				objects <- obj
+			}
+		}
+	}()
+	for e := range a.client.RemoveObjects(ctx, a.cfg.Bucket, objects, minio.RemoveObjectsOptions{}) {
+		Named("logger.archive").Error("remove archived log file failed", zap.String("object", e.ObjectName), zap.Error(e.Err))
+	}
+}
@@ -0,0 +1,163 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// bodyRules log.body 的配置，配置热加载时整体替换
+type bodyRules struct {
+	routes       map[string]bool
+	maxBytes     int
+	contentTypes []string
+}
+
+var currentBodyRules atomic.Pointer[bodyRules]
+
+// 默认记录的 Content-Type，文件上传等二进制内容不记录
+var defaultBodyContentTypes = []string{"application/json", "application/x-www-form-urlencoded", "application/xml", "text/"}
+
+func setBodyRules(cfg *settings.BodyLogConfig) {
+	r := &bodyRules{
+		routes:       make(map[string]bool, len(cfg.Routes)),
+		maxBytes:     cfg.MaxKB * 1024,
+		contentTypes: cfg.ContentTypes,
+	}
+	for _, p := range cfg.Routes {
+		r.routes[p] = true
+	}
+	if r.maxBytes <= 0 {
+		r.maxBytes = 4 * 1024
+	}
+	if len(r.contentTypes) == 0 {
+		r.contentTypes = defaultBodyContentTypes
+	}
+	currentBodyRules.Store(r)
+}
+
+// loggable Content-Type 以 contentTypes 中的任意一个开头时才记录内容
+func (r *bodyRules) loggable(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, t := range r.contentTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// BodyLogger 记录 log.body.routes 中的路由的请求体和响应体，每个最多记录 log.body.max_kb KB，用于调试 webhook 等接口
+// 日志使用名为 http.body 的 logger，记录之前按 log.redact 脱敏
+func BodyLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := currentBodyRules.Load()
+		if r == nil || !r.routes[c.FullPath()] {
+			c.Next()
+			return
+		}
+		var reqBody []byte
+		var reqTruncated bool
+		if c.Request.Body != nil && r.loggable(c.ContentType()) {
+			reqBody, reqTruncated = peekBody(c, r.maxBytes)
+		}
+		w := &bodyWriter{ResponseWriter: c.Writer, limit: r.maxBytes}
+		c.Writer = w
+		c.Next()
+
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", c.Writer.Status()),
+		}
+		redact := getRedactor()
+		if reqBody != nil {
+			fields = append(fields,
+				zap.String("request_body", redact.redactBody(string(reqBody))),
+				zap.Bool("request_body_truncated", reqTruncated),
+			)
+		}
+		if r.loggable(w.Header().Get("Content-Type")) {
+			fields = append(fields,
+				zap.String("response_body", redact.redactBody(w.body.String())),
+				zap.Bool("response_body_truncated", w.truncated),
+			)
+		}
+		FromContext(c).Named("http.body").Info(c.Request.URL.Path, fields...)
+	}
+}
+
+// peekBody 读取请求体的前 limit 个字节，读取的内容会放回请求体中，不影响后续的处理
+func peekBody(c *gin.Context, limit int) (body []byte, truncated bool) {
+	buf, err := io.ReadAll(io.LimitReader(c.Request.Body, int64(limit)+1))
+	c.Request.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(buf), c.Request.Body), Closer: c.Request.Body}
+	if err != nil {
+		return nil, false
+	}
+	if len(buf) > limit {
+		return buf[:limit], true
+	}
+	return buf, false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyWriter 在写响应的同时保存响应体的前 limit 个字节
+type bodyWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyWriter) capture(b []byte) {
+	if remain := w.limit - w.body.Len(); remain < len(b) {
+		w.truncated = true
+		if remain > 0 {
+			w.body.Write(b[:remain])
+		}
+		return
+	}
+	w.body.Write(b)
+}
+
+// jsonFieldPattern 匹配 JSON 中的 "key": value，截断后不完整的 JSON 也可以处理
+var jsonFieldPattern = regexp.MustCompile(`"([^"\\]+)"\s*:\s*("(?:[^"\\]|\\.)*"|[^,{}\[\]\s"]+)`)
+
+// redactBody 脱敏请求体和响应体：JSON 中敏感字段的值、表单中敏感参数的值，以及匹配脱敏正则的内容
+func (r *redactor) redactBody(body string) string {
+	if len(r.fields) > 0 {
+		body = jsonFieldPattern.ReplaceAllStringFunc(body, func(m string) string {
+			key := jsonFieldPattern.FindStringSubmatch(m)[1]
+			if !r.sensitive(key) {
+				return m
+			}
+			return `"` + key + `":"` + redactMask + `"`
+		})
+		if !strings.ContainsAny(body, "{[<") {
+			// 表单
+			return r.redactQuery(body)
+		}
+	}
+	return r.redactString(body)
+}
@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Skip 返回额外跳过 skip 层调用的 logger，自己封装记录日志的辅助函数时使用，记录的调用位置为辅助函数的调用方
+//
+//	func logError(ctx context.Context, msg string, err error) {
+//		logger.Skip(ctx, 1).Error(msg, zap.Error(err))
+//	}
+func Skip(ctx context.Context, skip int) *zap.Logger {
+	return FromContext(ctx).WithOptions(zap.AddCallerSkip(skip))
+}
+
+// Debug 使用 FromContext(ctx) 记录 debug 日志，调用位置为 Debug 的调用方
+func Debug(ctx context.Context, msg string, fields ...zap.Field) {
+	Skip(ctx, 1).Debug(msg, fields...)
+}
+
+// Info 使用 FromContext(ctx) 记录 info 日志，调用位置为 Info 的调用方
+func Info(ctx context.Context, msg string, fields ...zap.Field) {
+	Skip(ctx, 1).Info(msg, fields...)
+}
+
+// Warn 使用 FromContext(ctx) 记录 warn 日志，调用位置为 Warn 的调用方
+func Warn(ctx context.Context, msg string, fields ...zap.Field) {
+	Skip(ctx, 1).Warn(msg, fields...)
+}
+
+// Error 使用 FromContext(ctx) 记录 error 日志，调用位置为 Error 的调用方
+func Error(ctx context.Context, msg string, fields ...zap.Field) {
+	Skip(ctx, 1).Error(msg, fields...)
+}
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// RequestIDKey 请求 ID 保存在 gin.Context 中的 key
+	RequestIDKey = "request_id"
+	// TraceIDKey、SpanIDKey 上游传入的 W3C Trace Context（traceparent 请求头）保存在 gin.Context 中的 key
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
+	// UserIDKey、TenantIDKey 认证中间件把当前登录用户的 ID 和租户 ID 保存在 gin.Context 中的 key
+	// 访问日志、FromContext 返回的 logger 和上报到 Sentry 的事件都会带上这两个字段
+	UserIDKey   = "user_id"
+	TenantIDKey = "tenant_id"
+)
+
+type (
+	requestIDCtxKey struct{}
+	traceCtxKey     struct{}
+	userCtxKey      struct{}
+)
+
+type userIDs struct {
+	userID   interface{}
+	tenantID interface{}
+}
+
+type traceIDs struct {
+	traceID string
+	spanID  string
+}
+
+// WithRequestID 把请求 ID 保存到 context 中
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestID 从 context 中取出请求 ID，*gin.Context 和 c.Request.Context() 都可以
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(requestIDCtxKey{}).(string); ok {
+		return id
+	}
+	// gin.Context 的 Value 方法会查找 c.Keys 中的值
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// WithTrace 把链路追踪的 trace ID 和 span ID 保存到 context 中
+func WithTrace(ctx context.Context, traceID, spanID string) context.Context {
+	return context.WithValue(ctx, traceCtxKey{}, traceIDs{traceID: traceID, spanID: spanID})
+}
+
+// Trace 从 context 中取出 trace ID 和 span ID，*gin.Context 和 c.Request.Context() 都可以
+func Trace(ctx context.Context) (traceID, spanID string) {
+	if ctx == nil {
+		return "", ""
+	}
+	if ids, ok := ctx.Value(traceCtxKey{}).(traceIDs); ok {
+		return ids.traceID, ids.spanID
+	}
+	traceID, _ = ctx.Value(TraceIDKey).(string)
+	spanID, _ = ctx.Value(SpanIDKey).(string)
+	return
+}
+
+// WithUser 把当前用户的 ID 和租户 ID 保存到 context 中，没有租户时 tenantID 传 nil
+// 只需要在 gin 中使用时，c.Set(logger.UserIDKey, id) 也可以
+func WithUser(ctx context.Context, userID, tenantID interface{}) context.Context {
+	return context.WithValue(ctx, userCtxKey{}, userIDs{userID: userID, tenantID: tenantID})
+}
+
+// User 从 context 中取出用户 ID 和租户 ID，*gin.Context 和 c.Request.Context() 都可以，没有时为 nil
+func User(ctx context.Context) (userID, tenantID interface{}) {
+	if ctx == nil {
+		return nil, nil
+	}
+	if ids, ok := ctx.Value(userCtxKey{}).(userIDs); ok {
+		return ids.userID, ids.tenantID
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		// gin.Context 默认不会查找 c.Request.Context() 中的值
+		if c.Request != nil {
+			if ids, ok := c.Request.Context().Value(userCtxKey{}).(userIDs); ok {
+				return ids.userID, ids.tenantID
+			}
+		}
+		userID, _ = c.Get(UserIDKey)
+		tenantID, _ = c.Get(TenantIDKey)
+		return
+	}
+	return ctx.Value(UserIDKey), ctx.Value(TenantIDKey)
+}
+
+// userFields 用户 ID 和租户 ID 的日志字段，没有时不记录
+func userFields(ctx context.Context) []zap.Field {
+	userID, tenantID := User(ctx)
+	var fields []zap.Field
+	if userID != nil {
+		fields = append(fields, zap.Any(UserIDKey, userID))
+	}
+	if tenantID != nil {
+		fields = append(fields, zap.Any(TenantIDKey, tenantID))
+	}
+	return fields
+}
+
+// FromContext 返回带有请求 ID 字段的 logger，同一个请求的日志可以通过 request_id 关联起来
+// 请求带有 traceparent 时还会带上 trace_id 和 span_id，与链路追踪关联，认证之后还会带上 user_id 和 tenant_id
+//
+//	logger.FromContext(c).Info("create post", zap.Int64("post_id", id))
+func FromContext(ctx context.Context) *zap.Logger {
+	l := zap.L()
+	var fields []zap.Field
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, zap.String(RequestIDKey, id))
+	}
+	if traceID, spanID := Trace(ctx); traceID != "" {
+		fields = append(fields, zap.String(TraceIDKey, traceID), zap.String(SpanIDKey, spanID))
+	}
+	fields = append(fields, userFields(ctx)...)
+	if len(fields) > 0 {
+		l = l.With(fields...)
+	}
+	return l
+}
@@ -0,0 +1,98 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"web_app/settings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// IncidentIDKey panic 的事件 ID 在日志和 500 响应中的字段名
+const IncidentIDKey = "incident_id"
+
+// maxGoroutineDump goroutine 堆栈最多记录的大小
+const maxGoroutineDump = 64 << 20
+
+var (
+	crashMu     sync.Mutex
+	crashWriter zapcore.WriteSyncer
+	crashCfg    settings.CrashReportConfig
+	startTime   = time.Now()
+)
+
+// initCrashReport 按 log.crash 打开崩溃报告文件，修改后需要重启服务
+func initCrashReport(cfg *settings.CrashReportConfig) {
+	crashMu.Lock()
+	defer crashMu.Unlock()
+	crashCfg = *cfg
+	crashWriter = nil
+	if cfg.Filename != "" {
+		crashWriter = getLogWriter(cfg.Filename, "", cfg.MaxSize, cfg.MaxBackups, cfg.MaxAge)
+	}
+}
+
+// newIncidentID 生成事件 ID，以时间开头便于按时间查找，例如 20230620T150405-1a2b3c4d
+func newIncidentID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// crashReport 一次 panic 的现场信息
+type crashReport struct {
+	incidentID string
+	requestID  string
+	err        interface{}
+	request    string
+	stack      []byte
+}
+
+// writeCrashReport 把 panic 的现场信息、运行时状态和（可选的）所有 goroutine 的堆栈写入崩溃报告文件
+func writeCrashReport(r *crashReport) error {
+	crashMu.Lock()
+	defer crashMu.Unlock()
+	if crashWriter == nil {
+		return nil
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "===== incident %s at %s =====\n", r.incidentID, time.Now().Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "request_id: %s\n", r.requestID)
+	fmt.Fprintf(&b, "error: %v\n", r.err)
+	fmt.Fprintf(&b, "\n--- request ---\n%s\n", strings.TrimSpace(r.request))
+	fmt.Fprintf(&b, "\n--- runtime ---\n")
+	fmt.Fprintf(&b, "go: %s, gomaxprocs: %d, num_cpu: %d, uptime: %s\n",
+		runtime.Version(), runtime.GOMAXPROCS(0), runtime.NumCPU(), time.Since(startTime).Round(time.Second))
+	fmt.Fprintf(&b, "goroutines: %d, heap_alloc: %d, heap_inuse: %d, sys: %d, num_gc: %d, pause_total: %s\n",
+		runtime.NumGoroutine(), ms.HeapAlloc, ms.HeapInuse, ms.Sys, ms.NumGC, time.Duration(ms.PauseTotalNs))
+	fmt.Fprintf(&b, "\n--- stack ---\n%s\n", r.stack)
+	if crashCfg.GoroutineDump {
+		fmt.Fprintf(&b, "\n--- goroutines ---\n%s\n", goroutineDump())
+	}
+	b.WriteString("\n")
+	if _, err := crashWriter.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	return crashWriter.Sync()
+}
+
+// goroutineDump 所有 goroutine 的堆栈，缓冲区不够时加倍，最多 maxGoroutineDump
+func goroutineDump() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxGoroutineDump {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
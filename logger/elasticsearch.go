@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"web_app/settings"
+)
+
+// elasticsearchSender 通过 _bulk 接口批量写入日志，每条日志是一个文档
+type elasticsearchSender struct {
+	url    string
+	cfg    *settings.ElasticsearchSinkConfig
+	action []byte
+}
+
+func newElasticsearchSender(cfg *settings.ElasticsearchSinkConfig) *elasticsearchSender {
+	// 使用 create 而不是 index，索引和 data stream 都可以写入
+	action, _ := json.Marshal(map[string]interface{}{"create": map[string]string{"_index": cfg.Index}})
+	return &elasticsearchSender{
+		url:    strings.TrimSuffix(cfg.Endpoint, "/") + "/_bulk",
+		cfg:    cfg,
+		action: action,
+	}
+}
+
+func (s *elasticsearchSender) Send(ctx context.Context, batch []sinkEntry) error {
+	var body bytes.Buffer
+	for _, e := range batch {
+		body.Write(s.action)
+		body.WriteByte('\n')
+		body.Write(e.line)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// _bulk 接口部分文档写入失败时状态码仍然是 200，需要检查 errors 字段
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s", req.URL.Redacted(), resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var reason string
+	for _, item := range result.Items {
+		for _, r := range item {
+			if r.Status/100 != 2 {
+				failed++
+				reason = r.Error.Type + ": " + r.Error.Reason
+			}
+		}
+	}
+	return fmt.Errorf("%d of %d documents failed, last error: %s", failed, len(batch), reason)
+}
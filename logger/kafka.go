@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"web_app/settings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSender 每条日志作为一条消息写入 topic，由下游（例如 Logstash、Vector）消费后写入存储
+type kafkaSender struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSender(cfg *settings.KafkaSinkConfig) *kafkaSender {
+	batchSize := cfg.Batch.Size
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &kafkaSender{writer: &kafka.Writer{
+		Addr:     kafka.TCP(cfg.Brokers...),
+		Topic:    cfg.Topic,
+		Balancer: &kafka.LeastBytes{},
+		// 攒批由 batchWriter 负责，WriteMessages 收到一批之后不需要再等待
+		BatchSize:    batchSize,
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: kafka.RequireOne,
+	}}
+}
+
+func (s *kafkaSender) Send(ctx context.Context, batch []sinkEntry) error {
+	msgs := make([]kafka.Message, 0, len(batch))
+	for _, e := range batch {
+		msgs = append(msgs, kafka.Message{Value: e.line, Time: e.time})
+	}
+	return s.writer.WriteMessages(ctx, msgs...)
+}
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// LevelHandler 返回查看和修改日志级别的 http.Handler，name 为空时对应应用日志，access 对应访问日志
+// 其它的 name 对应 log.levels 中配置的模块，未知的 name 返回 nil
+//
+//	GET  返回 {"level":"info"}
+//	PUT  请求体为 {"level":"debug"}，也可以是表单 level=debug
+func LevelHandler(name string) http.Handler {
+	if l, ok := atomicLevel(name); ok {
+		return l
+	}
+	return nil
+}
+
+func atomicLevel(name string) (zap.AtomicLevel, bool) {
+	switch name {
+	case "", "app":
+		return level, true
+	case "access":
+		return accessLevel, true
+	}
+	if levels := moduleLevels.Load(); levels != nil {
+		al, ok := (*levels)[name]
+		return al, ok
+	}
+	return zap.AtomicLevel{}, false
+}
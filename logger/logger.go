@@ -2,33 +2,58 @@ package logger
 
 import (
 	"net"
-	"net/http"
 	"net/http/httputil"
 	"os"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
+	"web_app/response"
+	"web_app/settings"
+
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func Init() (err error) {
-	writeSyncer := getLogWriter(
-		viper.GetString("log.filename"),
-		viper.GetInt("log.max_size"),
-		viper.GetInt("log.max_backups"),
-		viper.GetInt("log.max_age"),
-	)
+var (
+	// level 全局 logger 的日志级别，AtomicLevel 可以在运行时安全地修改
+	level = zap.NewAtomicLevel()
+	// accessLevel 访问日志的级别，与应用日志相互独立
+	accessLevel = zap.NewAtomicLevel()
+	// accessLogger GinLogger 使用的访问日志 logger，Init 之前使用全局 logger
+	accessLogger *zap.Logger
+	// configLevels 最近一次从配置中读取到的日志级别，通过 LevelHandler 临时调整的级别只有在配置中的级别变化时才会被覆盖；
+	// 配置热加载的回调可能并发执行，读写时持有 configMu
+	configLevels = make(map[string]string)
+	configMu     sync.Mutex
+)
+
+// Init 根据日志配置初始化全局的 zap logger
+// mode 为 app.mode，非 release 模式下会同时以带颜色的 console 格式输出到终端
+func Init(cfg *settings.LogConfig, mode string) (err error) {
+	writeSyncer := withBuffer(getLogWriter(cfg.Filename, cfg.Rotation, cfg.MaxSize, cfg.MaxBackups, cfg.MaxAge), &cfg.Buffer)
 	encoder := getEncoder()
-	var l = new(zapcore.Level)
-	err = l.UnmarshalText([]byte(viper.GetString("log.level")))
+	err = level.UnmarshalText([]byte(cfg.Level))
+	if err != nil {
+		return
+	}
+	if err = accessLevel.UnmarshalText([]byte(accessLevelOf(&cfg.Access))); err != nil {
+		return
+	}
+	r, err := newRedactor(&cfg.Redact)
 	if err != nil {
 		return
 	}
+	currentRedactor.Store(r)
+	setRouteSampling(cfg.Access.Sampling)
+	setAccessRules(&cfg.Access)
+	setBodyRules(&cfg.Body)
+	if err = setModuleLevels(cfg.Levels); err != nil {
+		return
+	}
 	// NewCore创建一个向WriteSyncer写入日志的Core。
 
 	// A WriteSyncer is an io.Writer that can also flush any buffered data. Note
@@ -39,23 +64,151 @@ func Init() (err error) {
 	// true for itself and all higher logging levels. For example WarnLevel.Enabled()
 	// will return true for WarnLevel, ErrorLevel, DPanicLevel, PanicLevel, and
 	// FatalLevel, but return false for InfoLevel and DebugLevel.
-	core := zapcore.NewCore(encoder, writeSyncer, l)
+	// 每个 Core 外面包一层脱敏和按模块的级别过滤
+	core := newAppCore(encoder, writeSyncer)
+	if mode != gin.ReleaseMode {
+		// NewTee 把日志同时写给多个 Core，文件中仍然是 JSON 格式，终端中是便于阅读的 console 格式
+		core = zapcore.NewTee(core, newAppCore(getConsoleEncoder(), zapcore.Lock(os.Stdout)))
+	}
+	sinks, err := newSinks(&cfg.Sinks)
+	if err != nil {
+		return
+	}
+	core = withSinks(core, sinks, func(ws zapcore.WriteSyncer) zapcore.Core {
+		return newAppCore(getEncoder(), ws)
+	})
+	if err = setAlerter(&cfg.Alert); err != nil {
+		return
+	}
+	core = zapcore.NewTee(core, newRedactCore(&alertCore{}))
+	core = zapcore.NewTee(newSampler(core, &cfg.Sampling), newModuleCore(&metricsCore{LevelEnabler: anyLevel{}}))
 
 	// New constructs a new Logger from the provided zapcore.Core and Options. If
 	// the passed zapcore.Core is nil, it falls back to using a no-op
 	// implementation.
 
-	// AddCaller configures the Logger to annotate each message with the filename,
-	// line number, and function name of zap's caller. See also WithCaller.
-	logger := zap.New(core, zap.AddCaller())
+	opts, err := loggerOptions(cfg, mode)
+	if err != nil {
+		return
+	}
+	logger := zap.New(core, opts...)
 	// 替换 zap 库中全局的logger
 	zap.ReplaceGlobals(logger)
+	accessLogger = newAccessLogger(cfg, writeSyncer, sinks, mode)
+	if err = initArchive(&cfg.Archive, cfg.Filename, cfg.Access.Filename, cfg.Crash.Filename); err != nil {
+		return
+	}
+	initCrashReport(&cfg.Crash)
+	configMu.Lock()
+	configLevels["app"] = cfg.Level
+	configLevels["access"] = accessLevelOf(&cfg.Access)
+	configMu.Unlock()
+	// 配置热加载时调整日志级别
+	settings.OnChange(func(c settings.Config) {
+		applyConfigLevel("app", c.Log.Level)
+		applyConfigLevel("access", accessLevelOf(&c.Log.Access))
+		setRouteSampling(c.Log.Access.Sampling)
+		setAccessRules(&c.Log.Access)
+		setBodyRules(&c.Log.Body)
+		if err := setAlerter(&c.Log.Alert); err != nil {
+			zap.L().Error("update log alert config failed", zap.Error(err))
+		}
+		if err := setModuleLevels(c.Log.Levels); err != nil {
+			zap.L().Error("change module log levels failed", zap.Error(err))
+		}
+		r, err := newRedactor(&c.Log.Redact)
+		if err != nil {
+			zap.L().Error("update log redact rules failed", zap.Error(err))
+			return
+		}
+		currentRedactor.Store(r)
+	})
 	return
 	// Sugar封装了Logger，以提供更符合人体工程学的API，但速度略慢。糖化一个Logger的成本非常低，
 	// 因此一个应用程序同时使用Loggers和SugaredLoggers是合理的，在性能敏感代码的边界上在它们之间进行转换。
 	//sugarLogger = logger.Sugar()
 }
 
+// applyConfigLevel 配置中的日志级别有变化时才修改，静默的重新加载不会覆盖 LevelHandler 临时调整的级别
+func applyConfigLevel(name, l string) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if configLevels[name] == l {
+		return
+	}
+	al, _ := atomicLevel(name)
+	if err := al.UnmarshalText([]byte(l)); err != nil {
+		zap.L().Error("change log level failed", zap.String("logger", name), zap.String("level", l), zap.Error(err))
+		return
+	}
+	configLevels[name] = l
+	zap.L().Info("log level changed", zap.String("logger", name), zap.String("level", l))
+}
+
+// newAppCore 应用日志的 Core，按 logger 名称使用 log.levels 中的级别过滤，并对日志脱敏
+func newAppCore(enc zapcore.Encoder, ws zapcore.WriteSyncer) zapcore.Core {
+	// moduleCore 需要在最外层，它的 Check 决定是否记录
+	return newModuleCore(newRedactCore(zapcore.NewCore(enc, ws, anyLevel{})))
+}
+
+// newAccessLogger 创建访问日志 logger，配置了 log.access.filename 时写入单独的文件，否则与应用日志写入同一个文件
+// 访问日志的调用位置总是 GinLogger，所以不记录 caller
+func newAccessLogger(logCfg *settings.LogConfig, appWriter zapcore.WriteSyncer, sinks []logSink, mode string) *zap.Logger {
+	writeSyncer := appWriter
+	if cfg := &logCfg.Access; cfg.Filename != "" {
+		writeSyncer = withBuffer(getLogWriter(cfg.Filename, cfg.Rotation, cfg.MaxSize, cfg.MaxBackups, cfg.MaxAge), &logCfg.Buffer)
+	}
+	core := newRedactCore(zapcore.NewCore(getEncoder(), writeSyncer, accessLevel))
+	if mode != gin.ReleaseMode {
+		core = zapcore.NewTee(core, newRedactCore(zapcore.NewCore(getConsoleEncoder(), zapcore.Lock(os.Stdout), accessLevel)))
+	}
+	core = withSinks(core, sinks, func(ws zapcore.WriteSyncer) zapcore.Core {
+		return newRedactCore(zapcore.NewCore(getEncoder(), ws, accessLevel))
+	})
+	core = zapcore.NewTee(core, &metricsCore{LevelEnabler: accessLevel})
+	return zap.New(core).Named("access")
+}
+
+// withBuffer 按 log.buffer 给日志文件加上缓冲
+func withBuffer(ws zapcore.WriteSyncer, cfg *settings.LogBufferConfig) zapcore.WriteSyncer {
+	if cfg.SizeKB <= 0 {
+		return ws
+	}
+	// 退出前调用 Sync 写入缓冲区中的日志即可，zap v1.21 的 Stop 与后台定时写入之间可能死锁，所以不调用 Stop
+	return &zapcore.BufferedWriteSyncer{
+		WS:            ws,
+		Size:          cfg.SizeKB * 1024,
+		FlushInterval: cfg.FlushInterval,
+	}
+}
+
+// accessLevelOf 访问日志的级别，没有配置时为 info
+func accessLevelOf(cfg *settings.AccessLogConfig) string {
+	if cfg.Level == "" {
+		return zapcore.InfoLevel.String()
+	}
+	return cfg.Level
+}
+
+// Access 返回访问日志使用的 logger
+func Access() *zap.Logger {
+	if accessLogger == nil {
+		return zap.L()
+	}
+	return accessLogger
+}
+
+// Sync 把应用日志和访问日志中缓冲的内容写入文件和日志平台
+func Sync() error {
+	err := zap.L().Sync()
+	if accessLogger != nil {
+		if e := accessLogger.Sync(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
 func getEncoder() zapcore.Encoder {
 	// NewJSONEncoder创建了一个快速、低分配的JSON编码器。编码器适当地转义所有字段键和值。
 	// NewProductionEncoderConfig returns an opinionated EncoderConfig for
@@ -69,7 +222,60 @@ func getEncoder() zapcore.Encoder {
 	return zapcore.NewJSONEncoder(encoderConfig)
 }
 
-func getLogWriter(filename string, maxSize, maxBackup, maxAge int) zapcore.WriteSyncer {
+// getConsoleEncoder 开发环境输出到终端的编码器，日志级别带颜色
+func getConsoleEncoder() zapcore.Encoder {
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout("2006-01-02 15:04:05.000")
+	encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	encoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
+	return zapcore.NewConsoleEncoder(encoderConfig)
+}
+
+// loggerOptions 按配置设置调用位置、堆栈和 DPanic 的行为
+func loggerOptions(cfg *settings.LogConfig, mode string) ([]zap.Option, error) {
+	var opts []zap.Option
+	if !cfg.DisableCaller {
+		// AddCaller configures the Logger to annotate each message with the filename,
+		// line number, and function name of zap's caller. See also WithCaller.
+		opts = append(opts, zap.AddCaller())
+	}
+	// 生产环境下 error 及以上级别的日志带上堆栈，开发环境下 warn 及以上级别带上堆栈
+	stacktraceLevel := zapcore.ErrorLevel
+	if mode != gin.ReleaseMode {
+		stacktraceLevel = zapcore.WarnLevel
+	}
+	if cfg.StacktraceLevel != "" {
+		l, err := zapcore.ParseLevel(cfg.StacktraceLevel)
+		if err != nil {
+			return nil, err
+		}
+		stacktraceLevel = l
+	}
+	opts = append(opts, zap.AddStacktrace(stacktraceLevel))
+	if mode != gin.ReleaseMode {
+		// 开发环境下 DPanic 级别的日志会 panic，便于尽早发现问题，生产环境下只记录日志
+		opts = append(opts, zap.Development())
+	}
+	return opts, nil
+}
+
+// NewFileWriter 创建按 rotation（size/daily/hourly）轮转的日志文件，供审计日志等单独的日志文件使用
+func NewFileWriter(filename, rotation string, maxSize, maxBackup, maxAge int) zapcore.WriteSyncer {
+	return getLogWriter(filename, rotation, maxSize, maxBackup, maxAge)
+}
+
+// getLogWriter 根据 rotation 选择日志文件的轮转方式，默认按大小轮转
+func getLogWriter(filename, rotation string, maxSize, maxBackup, maxAge int) zapcore.WriteSyncer {
+	switch rotation {
+	case RotateDaily, RotateHourly:
+		return newTimeRotateWriter(filename, rotation, maxBackup, maxAge)
+	default:
+		return getSizeRotateWriter(filename, maxSize, maxBackup, maxAge)
+	}
+}
+
+// getSizeRotateWriter 使用 lumberjack 按文件大小轮转
+func getSizeRotateWriter(filename string, maxSize, maxBackup, maxAge int) zapcore.WriteSyncer {
 	// Logger is an io.WriteCloser that writes to the specified filename.
 	// 日志记录器在第一次写入时打开或创建日志文件。如果文件存在并且小于MaxSize兆字节，则lumberjack将打开并追加该文件。
 	// 如果该文件存在并且其大小为>= MaxSize兆字节，
@@ -95,31 +301,52 @@ func getLogWriter(filename string, maxSize, maxBackup, maxAge int) zapcore.Write
 	return zapcore.AddSync(lumberJackLogger)
 }
 
-// GinLogger
-func GinLogger() gin.HandlerFunc {
+// GinLogger 把每个请求记录到访问日志中
+// 可以通过选项或者 log.access.skip_paths、log.access.slow_threshold 跳过部分路由、标记慢请求
+func GinLogger(opts ...GinLoggerOption) gin.HandlerFunc {
+	o := &ginLoggerOptions{skip: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(o)
+	}
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
 		query := c.Request.URL.RawQuery
 		c.Next() // 执行后续中间件
+		if o.skipAccess(c) {
+			return
+		}
 
 		// Since returns the time elapsed since t.
 		// It is shorthand for time.Now().Sub(t).
 		cost := time.Since(start)
-		zap.L().Info(path,
+		// 慢请求总是记录，不参与采样
+		slow := o.isSlow(cost)
+		if !slow && !sampleAccess(c) {
+			return
+		}
+		fields := []zap.Field{
+			zap.String(RequestIDKey, c.GetString(RequestIDKey)),
 			zap.Int("status", c.Writer.Status()),
 			zap.String("method", c.Request.Method),
 			zap.String("path", path),
-			zap.String("query", query),
+			zap.String("query", getRedactor().redactQuery(query)),
 			zap.String("ip", c.ClientIP()),
 			zap.String("user-agent", c.Request.UserAgent()),
 			zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
 			zap.Duration("cost", cost), // 运行时间
-		)
+		}
+		// 认证中间件在 c.Next 中执行，这时已经可以取到当前用户
+		fields = append(fields, userFields(c)...)
+		if slow {
+			Access().Warn(path, append(fields, zap.Bool("slow", true))...)
+			return
+		}
+		Access().Info(path, fields...)
 	}
 }
 
-// GinRecovery
+// GinRecovery 捕获 panic 并返回 500，响应中带有事件 ID（incident_id），配置了 log.crash 时同时写入崩溃报告
 func GinRecovery(stack bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
@@ -135,11 +362,12 @@ func GinRecovery(stack bool) gin.HandlerFunc {
 					}
 				}
 
-				httpRequest, _ := httputil.DumpRequest(c.Request, false)
+				dump, _ := httputil.DumpRequest(c.Request, false)
+				httpRequest := getRedactor().redactRequest(string(dump))
 				if brokenPipe {
-					zap.L().Error(c.Request.URL.Path,
+					FromContext(c).Error(c.Request.URL.Path,
 						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
+						zap.String("request", httpRequest),
 					)
 					// If the connection is dead, we can't write a status to it.
 					c.Error(err.(error)) // nolint: errcheck
@@ -147,19 +375,41 @@ func GinRecovery(stack bool) gin.HandlerFunc {
 					return
 				}
 
+				// 上报到 Sentry 的事件 ID 记录在日志中，方便从日志跳转到 Sentry
+				eventID := zap.Skip()
+				if id := reportPanic(c, err); id != "" {
+					eventID = zap.String(sentryEventIDKey, id)
+				}
+				// 事件 ID 返回给调用方，反馈问题时可以据此找到日志和崩溃报告
+				incidentID := newIncidentID()
+				panicStack := debug.Stack()
+				if err := writeCrashReport(&crashReport{
+					incidentID: incidentID,
+					requestID:  c.GetString(RequestIDKey),
+					err:        err,
+					request:    httpRequest,
+					stack:      panicStack,
+				}); err != nil {
+					FromContext(c).Error("write crash report failed", zap.String(IncidentIDKey, incidentID), zap.Error(err))
+				}
 				if stack {
-					zap.L().Error("[Recovery from panic]",
+					// 已经记录了 panic 的完整堆栈，不再附加当前位置的堆栈
+					FromContext(c).WithOptions(zap.AddStacktrace(zapcore.FatalLevel)).Error("[Recovery from panic]",
 						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
-						zap.String("stack", string(debug.Stack())),
+						zap.String("request", httpRequest),
+						zap.String("stack", string(panicStack)),
+						zap.String(IncidentIDKey, incidentID),
+						eventID,
 					)
 				} else {
-					zap.L().Error("[Recovery from panic]",
+					FromContext(c).Error("[Recovery from panic]",
 						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
+						zap.String("request", httpRequest),
+						zap.String(IncidentIDKey, incidentID),
+						eventID,
 					)
 				}
-				c.AbortWithStatus(http.StatusInternalServerError)
+				response.ErrorWithData(c, response.CodeServerBusy, "internal server error", gin.H{IncidentIDKey: incidentID})
 			}
 		}()
 		c.Next()
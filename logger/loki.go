@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"web_app/settings"
+)
+
+// lokiSender 通过 Loki 的 push 接口写入日志，所有日志写入同一个日志流
+type lokiSender struct {
+	url    string
+	cfg    *settings.LokiSinkConfig
+	labels map[string]string
+}
+
+func newLokiSender(cfg *settings.LokiSinkConfig) *lokiSender {
+	labels := cfg.Labels
+	if len(labels) == 0 {
+		labels = map[string]string{"app": "web_app"}
+	}
+	return &lokiSender{
+		url:    strings.TrimSuffix(cfg.Endpoint, "/") + "/loki/api/v1/push",
+		cfg:    cfg,
+		labels: labels,
+	}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *lokiSender) Send(ctx context.Context, batch []sinkEntry) error {
+	values := make([][2]string, 0, len(batch))
+	for _, e := range batch {
+		values = append(values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), string(e.line)})
+	}
+	body, err := json.Marshal(map[string][]lokiStream{
+		"streams": {{Stream: s.labels, Values: values}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", s.cfg.TenantID)
+	}
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+	return doSinkRequest(req)
+}
+
+// doSinkRequest 发送请求，状态码不是 2xx 时返回错误
+func doSinkRequest(req *http.Request) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s", req.URL.Redacted(), resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap/zapcore"
+)
+
+// logEntries 按级别和 logger 名称统计的日志条数，根 logger 的名称为空，访问日志为 access
+// 在采样之前统计，被采样丢弃的日志也会计数，可以直接按 error 的增长速率告警
+var logEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "log_entries_total",
+	Help: "Number of log entries by level and logger name.",
+}, []string{"level", "logger"})
+
+// metricsCore 只计数不输出，级别的过滤由外层的 moduleCore 或者 enabler 决定
+type metricsCore struct {
+	zapcore.LevelEnabler
+}
+
+func (c *metricsCore) With([]zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c *metricsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *metricsCore) Write(ent zapcore.Entry, _ []zapcore.Field) error {
+	logEntries.WithLabelValues(ent.Level.String(), ent.LoggerName).Inc()
+	return nil
+}
+
+func (c *metricsCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	// moduleLevels log.levels 中配置的各模块日志级别，配置热加载时整体替换
+	moduleLevels atomic.Pointer[map[string]zap.AtomicLevel]
+	moduleMu     sync.Mutex
+)
+
+// Named 返回模块专用的 logger，日志中的 logger 字段为 name，级别由 log.levels 中的配置决定
+//
+//	log := logger.Named("dao.mysql")
+func Named(name string) *zap.Logger {
+	return zap.L().Named(name)
+}
+
+// setModuleLevels 按配置更新各模块的日志级别，配置中的级别没有变化的模块保留通过 LevelHandler 临时调整的级别
+func setModuleLevels(levels map[string]string) error {
+	moduleMu.Lock()
+	defer moduleMu.Unlock()
+	configMu.Lock()
+	defer configMu.Unlock()
+	old := moduleLevels.Load()
+	next := make(map[string]zap.AtomicLevel, len(levels))
+	for name, l := range levels {
+		key := "module:" + name
+		if old != nil {
+			if al, ok := (*old)[name]; ok && configLevels[key] == l {
+				next[name] = al
+				continue
+			}
+		}
+		al := zap.NewAtomicLevel()
+		if err := al.UnmarshalText([]byte(l)); err != nil {
+			return err
+		}
+		next[name] = al
+		configLevels[key] = l
+	}
+	moduleLevels.Store(&next)
+	return nil
+}
+
+// moduleLevel 查找模块的日志级别，name 没有配置时依次查找 name 的前缀，例如 dao.mysql.tx -> dao.mysql -> dao
+func moduleLevel(name string) (zap.AtomicLevel, bool) {
+	levels := moduleLevels.Load()
+	if levels == nil || len(*levels) == 0 {
+		return zap.AtomicLevel{}, false
+	}
+	for name != "" {
+		if al, ok := (*levels)[name]; ok {
+			return al, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return zap.AtomicLevel{}, false
+}
+
+// anyLevel 应用日志的 LevelEnabler，只要全局或者任意一个模块启用了该级别就返回 true
+// 具体某条日志是否记录由 moduleCore 根据 logger 名称判断
+type anyLevel struct{}
+
+func (anyLevel) Enabled(l zapcore.Level) bool {
+	if level.Enabled(l) {
+		return true
+	}
+	if levels := moduleLevels.Load(); levels != nil {
+		for _, al := range *levels {
+			if al.Enabled(l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// moduleCore 按日志的 logger 名称使用对应模块的级别过滤，没有配置的模块使用全局的级别
+type moduleCore struct {
+	zapcore.Core
+}
+
+func newModuleCore(core zapcore.Core) zapcore.Core {
+	return &moduleCore{Core: core}
+}
+
+func (c *moduleCore) With(fields []zapcore.Field) zapcore.Core {
+	return &moduleCore{Core: c.Core.With(fields)}
+}
+
+func (c *moduleCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	enabler := zapcore.LevelEnabler(level)
+	if al, ok := moduleLevel(ent.LoggerName); ok {
+		enabler = al
+	}
+	if enabler.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
@@ -0,0 +1,223 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"web_app/settings"
+)
+
+// otlpSender 通过 OTLP/HTTP（JSON 编码）把日志写入 OpenTelemetry Collector
+// 日志与链路、指标使用相同的资源属性，日志中的 trace_id、span_id 字段转换为 LogRecord 的 TraceId、SpanId
+type otlpSender struct {
+	url      string
+	cfg      *settings.OTLPSinkConfig
+	resource []otlpKeyValue
+}
+
+func newOTLPSender(cfg *settings.OTLPSinkConfig) *otlpSender {
+	attrs := map[string]string{"service.name": appName()}
+	if rev := VCSRevision(); rev != "" {
+		attrs["service.version"] = rev
+	}
+	if c := settings.Current(); c != nil && c.App.Env != "" {
+		attrs["deployment.environment"] = c.App.Env
+	}
+	for k, v := range cfg.Resource {
+		attrs[k] = v
+	}
+	resource := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		v := v
+		resource = append(resource, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: &v}})
+	}
+	sort.Slice(resource, func(i, j int) bool { return resource[i].Key < resource[j].Key })
+	return &otlpSender{
+		url:      strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/logs",
+		cfg:      cfg,
+		resource: resource,
+	}
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // OTLP/JSON 中 int64 编码为字符串
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"`
+	SpanID               string         `json:"spanId,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope      map[string]string `json:"scope"`
+	LogRecords []otlpLogRecord   `json:"logRecords"`
+}
+
+func (s *otlpSender) Send(ctx context.Context, batch []sinkEntry) error {
+	// logger 的名称（例如 access、dao.mysql）作为 InstrumentationScope
+	scopes := make(map[string]*otlpScopeLogs)
+	var names []string
+	for _, e := range batch {
+		name, record, ok := otlpRecord(e)
+		if !ok {
+			continue
+		}
+		sl, ok := scopes[name]
+		if !ok {
+			sl = &otlpScopeLogs{Scope: map[string]string{"name": name}}
+			scopes[name] = sl
+			names = append(names, name)
+		}
+		sl.LogRecords = append(sl.LogRecords, record)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	scopeLogs := make([]*otlpScopeLogs, 0, len(names))
+	for _, name := range names {
+		scopeLogs = append(scopeLogs, scopes[name])
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource":  map[string]interface{}{"attributes": s.resource},
+			"scopeLogs": scopeLogs,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	return doSinkRequest(req)
+}
+
+// otlpRecord 把 getEncoder 编码的一行 JSON 日志转换为 LogRecord，返回 logger 的名称
+func otlpRecord(e sinkEntry) (name string, r otlpLogRecord, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(e.line))
+	dec.UseNumber()
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		return "", r, false
+	}
+	name = appName()
+	if v, ok := m["logger"].(string); ok && v != "" {
+		name = v
+	}
+	t := e.time
+	if v, ok := m["time"].(string); ok {
+		if parsed, err := time.Parse("2006-01-02T15:04:05.000Z0700", v); err == nil {
+			t = parsed
+		}
+	}
+	level, _ := m["level"].(string)
+	msg, _ := m["msg"].(string)
+	r = otlpLogRecord{
+		TimeUnixNano:         strconv.FormatInt(t.UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(e.time.UnixNano(), 10),
+		SeverityNumber:       otlpSeverity(level),
+		SeverityText:         level,
+		Body:                 otlpAnyValue{StringValue: &msg},
+	}
+	r.TraceID, _ = m[TraceIDKey].(string)
+	r.SpanID, _ = m[SpanIDKey].(string)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		switch k {
+		case "logger", "time", "level", "msg", TraceIDKey, SpanIDKey:
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch k {
+		case "caller":
+			// 调用位置为 file:line
+			caller, _ := m[k].(string)
+			if i := strings.LastIndexByte(caller, ':'); i > 0 {
+				line := caller[i+1:]
+				file := caller[:i]
+				r.Attributes = append(r.Attributes,
+					otlpKeyValue{Key: "code.filepath", Value: otlpAnyValue{StringValue: &file}},
+					otlpKeyValue{Key: "code.lineno", Value: otlpAnyValue{IntValue: &line}},
+				)
+				continue
+			}
+			r.Attributes = append(r.Attributes, otlpKeyValue{Key: "code.filepath", Value: otlpValue(m[k])})
+		case "stacktrace":
+			r.Attributes = append(r.Attributes, otlpKeyValue{Key: "exception.stacktrace", Value: otlpValue(m[k])})
+		default:
+			r.Attributes = append(r.Attributes, otlpKeyValue{Key: k, Value: otlpValue(m[k])})
+		}
+	}
+	return name, r, true
+}
+
+func otlpValue(v interface{}) otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			s := v.String()
+			return otlpAnyValue{IntValue: &s}
+		}
+		f, _ := v.Float64()
+		return otlpAnyValue{DoubleValue: &f}
+	default:
+		// 对象和数组按 JSON 字符串发送
+		b, _ := json.Marshal(v)
+		s := string(b)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
+
+// otlpSeverity zap 的级别对应的 OpenTelemetry SeverityNumber
+func otlpSeverity(level string) int {
+	switch level {
+	case "DEBUG":
+		return 5
+	case "INFO":
+		return 9
+	case "WARN":
+		return 13
+	case "ERROR":
+		return 17
+	case "DPANIC":
+		return 18
+	case "PANIC":
+		return 21
+	case "FATAL":
+		return 24
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"web_app/settings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redactMask 脱敏后的值
+const redactMask = "******"
+
+// redactor 日志脱敏规则，配置热加载时整体替换
+type redactor struct {
+	fields   []string // 小写的字段名
+	patterns []*regexp.Regexp
+}
+
+var currentRedactor atomic.Pointer[redactor]
+
+func newRedactor(cfg *settings.RedactConfig) (*redactor, error) {
+	r := &redactor{}
+	for _, f := range cfg.Fields {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			r.fields = append(r.fields, f)
+		}
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// sensitive 名称中包含任意一个敏感字段名时返回 true
+func (r *redactor) sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, f := range r.fields {
+		if strings.Contains(name, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString 把字符串中匹配脱敏正则的部分替换掉
+func (r *redactor) redactString(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, redactMask)
+	}
+	return s
+}
+
+// redactField 敏感字段整体替换，字符串和错误类型的字段按正则替换，其它类型原样保留
+func (r *redactor) redactField(f zapcore.Field) zapcore.Field {
+	if r.sensitive(f.Key) {
+		return zap.String(f.Key, redactMask)
+	}
+	if len(r.patterns) == 0 {
+		return f
+	}
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.redactString(f.String)
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok {
+			return zap.String(f.Key, r.redactString(err.Error()))
+		}
+	}
+	return f
+}
+
+func (r *redactor) redactFields(fields []zapcore.Field) []zapcore.Field {
+	if len(fields) == 0 {
+		return fields
+	}
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		out[i] = r.redactField(f)
+	}
+	return out
+}
+
+// redactQuery 把 query 中敏感参数的值替换掉，参数的顺序保持不变
+func (r *redactor) redactQuery(query string) string {
+	if query == "" {
+		return query
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		if name, _, ok := strings.Cut(pair, "="); ok && r.sensitive(name) {
+			pairs[i] = name + "=" + redactMask
+		}
+	}
+	return r.redactString(strings.Join(pairs, "&"))
+}
+
+// redactRequest 脱敏 httputil.DumpRequest 的结果：请求行中的 query 和敏感的请求头
+func (r *redactor) redactRequest(dump string) string {
+	lines := strings.Split(dump, "\r\n")
+	for i, line := range lines {
+		if i == 0 {
+			// GET /path?query HTTP/1.1
+			method, rest, _ := strings.Cut(line, " ")
+			uri, proto, _ := strings.Cut(rest, " ")
+			if path, query, ok := strings.Cut(uri, "?"); ok {
+				lines[i] = method + " " + path + "?" + r.redactQuery(query) + " " + proto
+			}
+			continue
+		}
+		if name, _, ok := strings.Cut(line, ":"); ok && r.sensitive(name) {
+			lines[i] = name + ": " + redactMask
+		}
+	}
+	return r.redactString(strings.Join(lines, "\r\n"))
+}
+
+// Redact 按 log.redact 的规则脱敏不是日志字段的值，例如慢查询日志中 SQL 的参数：
+// name 包含敏感字段名时整体替换，否则替换匹配正则的部分
+func Redact(name, value string) string {
+	r := getRedactor()
+	if name != "" && r.sensitive(name) {
+		return redactMask
+	}
+	return r.redactString(value)
+}
+
+// getRedactor 返回当前的脱敏规则，Init 之前不做脱敏
+func getRedactor() *redactor {
+	if r := currentRedactor.Load(); r != nil {
+		return r
+	}
+	return &redactor{}
+}
+
+// redactCore 在写入日志之前对日志内容和字段做脱敏
+type redactCore struct {
+	zapcore.Core
+}
+
+func newRedactCore(core zapcore.Core) zapcore.Core {
+	return &redactCore{Core: core}
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(getRedactor().redactFields(fields))}
+}
+
+func (c *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	r := getRedactor()
+	ent.Message = r.redactString(ent.Message)
+	return c.Core.Write(ent, r.redactFields(fields))
+}
@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 按时间轮转的方式
+const (
+	RotateDaily  = "daily"
+	RotateHourly = "hourly"
+)
+
+// timeRotateWriter 按天或按小时把日志写入带日期的文件，例如 web_app.log -> web_app-2023-06-20.log
+// 跨过一个周期后的第一次写入时切换到新文件，并清理超过 maxAge 天或者超过 maxBackups 个的旧文件
+type timeRotateWriter struct {
+	dir, prefix, ext string
+	layout           string
+	maxBackups       int
+	maxAge           int
+
+	mu     sync.Mutex
+	file   *os.File
+	period string // 当前文件对应的周期，例如 2023-06-20
+}
+
+func newTimeRotateWriter(filename, rotation string, maxBackups, maxAge int) *timeRotateWriter {
+	ext := filepath.Ext(filename)
+	layout := "2006-01-02"
+	if rotation == RotateHourly {
+		layout = "2006-01-02-15"
+	}
+	return &timeRotateWriter{
+		dir:        filepath.Dir(filename),
+		prefix:     strings.TrimSuffix(filepath.Base(filename), ext) + "-",
+		ext:        ext,
+		layout:     layout,
+		maxBackups: maxBackups,
+		maxAge:     maxAge,
+	}
+}
+
+func (w *timeRotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if period := time.Now().Format(w.layout); w.file == nil || period != w.period {
+		if err := w.rotate(period); err != nil {
+			return 0, err
+		}
+	}
+	return w.file.Write(p)
+}
+
+// rotate 关闭当前文件并打开新周期的文件，调用方需持有 mu
+func (w *timeRotateWriter) rotate(period string) error {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return fmt.Errorf("create log dir failed: %w", err)
+	}
+	name := filepath.Join(w.dir, w.prefix+period+w.ext)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file failed: %w", err)
+	}
+	w.file, w.period = f, period
+	go w.cleanup()
+	return nil
+}
+
+// cleanup 清理旧的日志文件，文件名中的日期可以直接按字符串排序
+func (w *timeRotateWriter) cleanup() {
+	if w.maxBackups <= 0 && w.maxAge <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(w.dir, w.prefix+"*"+w.ext))
+	if err != nil {
+		return
+	}
+	var old []string
+	cutoff := time.Now().AddDate(0, 0, -w.maxAge)
+	for _, name := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), w.prefix), w.ext)
+		t, err := time.ParseInLocation(w.layout, stamp, time.Local)
+		if err != nil {
+			continue // 不是本 writer 生成的文件
+		}
+		if w.maxAge > 0 && t.Before(cutoff) {
+			_ = os.Remove(name)
+			continue
+		}
+		old = append(old, name)
+	}
+	// 当前文件不算在 maxBackups 中
+	sort.Strings(old)
+	if w.maxBackups > 0 && len(old) > w.maxBackups+1 {
+		for _, name := range old[:len(old)-w.maxBackups-1] {
+			_ = os.Remove(name)
+		}
+	}
+}
+
+func (w *timeRotateWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+func (w *timeRotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+)
+
+// routeRates 每个路由访问日志的采样率，配置热加载时整体替换
+var routeRates atomic.Pointer[map[string]float64]
+
+// newSampler 按 log.sampling 对 core 采样，initial 为 0 时原样返回
+func newSampler(core zapcore.Core, cfg *settings.SamplingConfig) zapcore.Core {
+	if cfg.Initial <= 0 {
+		return core
+	}
+	tick := cfg.Tick
+	if tick <= 0 {
+		tick = time.Second
+	}
+	return zapcore.NewSamplerWithOptions(core, tick, cfg.Initial, cfg.Thereafter)
+}
+
+func setRouteSampling(list []settings.RouteSampling) {
+	rates := make(map[string]float64, len(list))
+	for _, s := range list {
+		rates[s.Path] = s.Rate
+	}
+	routeRates.Store(&rates)
+}
+
+// sampleAccess 判断这个请求是否需要记录访问日志，出错的请求和没有配置采样率的路由总是记录
+func sampleAccess(c *gin.Context) bool {
+	if c.Writer.Status() >= http.StatusBadRequest {
+		return true
+	}
+	rates := routeRates.Load()
+	if rates == nil {
+		return true
+	}
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	rate, ok := (*rates)[path]
+	if !ok || rate >= 1 {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
@@ -0,0 +1,200 @@
+package logger
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"time"
+
+	"web_app/settings"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// sentryEventIDKey 已经上报过的日志带有这个字段，不会被 sentryCore 重复上报
+	sentryEventIDKey = "sentry_event_id"
+
+	sentryFlushTimeout = 2 * time.Second
+)
+
+var sentryEnabled bool
+
+// InitSentry 初始化 Sentry，并把 level 及以上级别的日志同时上报到 Sentry，需要在 Init 之后调用
+// sentry.dsn 为空时不启用
+func InitSentry(cfg *settings.SentryConfig, app *settings.AppConfig) (err error) {
+	if cfg.DSN == "" {
+		return
+	}
+	environment := cfg.Environment
+	if environment == "" {
+		environment = app.Env
+	}
+	if environment == "" {
+		environment = app.Mode
+	}
+	release := cfg.Release
+	if release == "" {
+		release = VCSRevision()
+	}
+	sampleRate := cfg.SampleRate
+	if sampleRate == 0 {
+		sampleRate = 1
+	}
+	err = sentry.Init(sentry.ClientOptions{
+		Dsn:         cfg.DSN,
+		Environment: environment,
+		Release:     release,
+		SampleRate:  sampleRate,
+		Debug:       cfg.Debug,
+		ServerName:  app.Name,
+	})
+	if err != nil {
+		return
+	}
+	lvl := zapcore.ErrorLevel
+	if cfg.Level != "" {
+		if lvl, err = zapcore.ParseLevel(cfg.Level); err != nil {
+			return
+		}
+	}
+	sentryEnabled = true
+	zap.ReplaceGlobals(zap.L().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, newRedactCore(&sentryCore{LevelEnabler: lvl}))
+	})))
+	return
+}
+
+// VCSRevision 构建信息中的 git 版本号，没有时返回空字符串
+func VCSRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// reportPanic 把 GinRecovery 捕获到的 panic 连同请求信息上报到 Sentry，返回事件 ID，没有启用时返回空字符串
+func reportPanic(c *gin.Context, err interface{}) string {
+	if !sentryEnabled {
+		return ""
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetRequest(c.Request)
+		if id := c.GetString(RequestIDKey); id != "" {
+			scope.SetTag(RequestIDKey, id)
+		}
+		userID, tenantID := User(c)
+		if userID != nil {
+			scope.SetUser(sentry.User{ID: fmt.Sprint(userID)})
+		}
+		if tenantID != nil {
+			scope.SetTag(TenantIDKey, fmt.Sprint(tenantID))
+		}
+	})
+	if id := hub.RecoverWithContext(c.Request.Context(), err); id != nil {
+		return string(*id)
+	}
+	return ""
+}
+
+// sentryCore 把日志转换为 Sentry 事件，字段中的 request_id、tenant_id 作为 tag，user_id 作为用户信息，error 作为异常
+type sentryCore struct {
+	zapcore.LevelEnabler
+	fields []zapcore.Field
+}
+
+func (c *sentryCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sentryCore{
+		LevelEnabler: c.LevelEnabler,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *sentryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sentryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	enc := zapcore.NewMapObjectEncoder()
+	var errs []error
+	for _, f := range all {
+		if f.Key == sentryEventIDKey {
+			return nil
+		}
+		if f.Type == zapcore.ErrorType {
+			if err, ok := f.Interface.(error); ok {
+				errs = append(errs, err)
+			}
+		}
+		f.AddTo(enc)
+	}
+
+	event := sentry.NewEvent()
+	event.Level = sentryLevel(ent.Level)
+	event.Message = ent.Message
+	event.Timestamp = ent.Time
+	event.Logger = ent.LoggerName
+	if ent.Caller.Defined {
+		event.Extra["caller"] = ent.Caller.TrimmedPath()
+	}
+	for k, v := range enc.Fields {
+		switch k {
+		case RequestIDKey, TenantIDKey:
+			event.Tags[k] = fmt.Sprint(v)
+		case UserIDKey:
+			event.User.ID = fmt.Sprint(v)
+		default:
+			event.Extra[k] = v
+		}
+	}
+	for _, err := range errs {
+		event.Exception = append(event.Exception, sentry.Exception{
+			Type:       reflect.TypeOf(err).String(),
+			Value:      err.Error(),
+			Stacktrace: sentry.ExtractStacktrace(err),
+		})
+	}
+	if len(event.Exception) == 0 {
+		event.Threads = []sentry.Thread{{Stacktrace: sentry.NewStacktrace(), Current: true}}
+	}
+	sentry.CaptureEvent(event)
+	if ent.Level > zapcore.ErrorLevel {
+		// panic/fatal 之后进程可能马上退出
+		sentry.Flush(sentryFlushTimeout)
+	}
+	return nil
+}
+
+func (c *sentryCore) Sync() error {
+	sentry.Flush(sentryFlushTimeout)
+	return nil
+}
+
+func sentryLevel(l zapcore.Level) sentry.Level {
+	switch l {
+	case zapcore.DebugLevel:
+		return sentry.LevelDebug
+	case zapcore.InfoLevel:
+		return sentry.LevelInfo
+	case zapcore.WarnLevel:
+		return sentry.LevelWarning
+	case zapcore.ErrorLevel:
+		return sentry.LevelError
+	default:
+		return sentry.LevelFatal
+	}
+}
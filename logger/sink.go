@@ -0,0 +1,211 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"web_app/settings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// sinkEntry 一条待发送的日志，line 为 JSON 编码后的日志（不含换行）
+type sinkEntry struct {
+	time time.Time
+	line []byte
+}
+
+// sinkSender 把一批日志发送到日志平台
+type sinkSender interface {
+	Send(ctx context.Context, batch []sinkEntry) error
+}
+
+// batchWriter 实现 zapcore.WriteSyncer，日志写入缓冲队列后立即返回，由后台 goroutine 批量发送
+// 队列满时按 overflow 丢弃日志或者阻塞写日志的 goroutine，发送失败的日志不会重试，避免日志平台故障时拖垮应用
+type batchWriter struct {
+	name     string
+	sender   sinkSender
+	entries  chan sinkEntry
+	flushReq chan chan struct{}
+	size     int
+	interval time.Duration
+	timeout  time.Duration
+	block    bool
+	dropped  atomic.Int64
+}
+
+func newBatchWriter(name string, sender sinkSender, cfg *settings.SinkBatchConfig) *batchWriter {
+	w := &batchWriter{
+		name:     name,
+		sender:   sender,
+		flushReq: make(chan chan struct{}),
+		size:     cfg.Size,
+		interval: cfg.FlushInterval,
+		timeout:  cfg.Timeout,
+		block:    cfg.Overflow == "block",
+	}
+	if w.size <= 0 {
+		w.size = 500
+	}
+	if w.interval <= 0 {
+		w.interval = time.Second
+	}
+	if w.timeout <= 0 {
+		w.timeout = 5 * time.Second
+	}
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 10000
+	}
+	w.entries = make(chan sinkEntry, bufferSize)
+	go w.run()
+	return w
+}
+
+func (w *batchWriter) Write(p []byte) (int, error) {
+	// zap 会复用 p 的内存，需要复制一份
+	line := make([]byte, len(p))
+	copy(line, p)
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	e := sinkEntry{time: time.Now(), line: line}
+	if w.block {
+		w.entries <- e
+		return len(p), nil
+	}
+	select {
+	case w.entries <- e:
+	default:
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Sync 等待队列中已有的日志发送完成
+func (w *batchWriter) Sync() error {
+	done := make(chan struct{})
+	select {
+	case w.flushReq <- done:
+	case <-time.After(w.timeout):
+		return fmt.Errorf("flush %s log sink timed out", w.name)
+	}
+	select {
+	case <-done:
+		return nil
+	case <-time.After(w.timeout):
+		return fmt.Errorf("flush %s log sink timed out", w.name)
+	}
+}
+
+func (w *batchWriter) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	batch := make([]sinkEntry, 0, w.size)
+	flush := func() {
+		if len(batch) > 0 {
+			w.send(batch)
+			batch = make([]sinkEntry, 0, w.size)
+		}
+		if n := w.dropped.Swap(0); n > 0 {
+			// 不能写到 zap 中，否则可能形成循环
+			fmt.Fprintf(os.Stderr, "%s log sink buffer is full, %d entries dropped\n", w.name, n)
+		}
+	}
+	for {
+		select {
+		case e := <-w.entries:
+			batch = append(batch, e)
+			if len(batch) >= w.size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case done := <-w.flushReq:
+			for drained := false; !drained; {
+				select {
+				case e := <-w.entries:
+					batch = append(batch, e)
+					if len(batch) >= w.size {
+						flush()
+					}
+				default:
+					drained = true
+				}
+			}
+			flush()
+			close(done)
+		}
+	}
+}
+
+func (w *batchWriter) send(batch []sinkEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	if err := w.sender.Send(ctx, batch); err != nil {
+		fmt.Fprintf(os.Stderr, "send %d entries to %s log sink failed, error: %v\n", len(batch), w.name, err)
+	}
+}
+
+// logSink 一个启用的日志平台，level 为 nil 时与所在 logger 的级别相同
+type logSink struct {
+	writer *batchWriter
+	level  zapcore.LevelEnabler
+}
+
+// newSinks 为 log.sinks 中每个启用的日志平台创建 batchWriter，应用日志和访问日志共用
+func newSinks(cfg *settings.LogSinksConfig) (sinks []logSink, err error) {
+	add := func(name, lvl string, batch *settings.SinkBatchConfig, sender sinkSender) error {
+		var s logSink
+		if lvl != "" {
+			l, err := zapcore.ParseLevel(lvl)
+			if err != nil {
+				return err
+			}
+			s.level = l
+		}
+		s.writer = newBatchWriter(name, sender, batch)
+		sinks = append(sinks, s)
+		return nil
+	}
+	if c := &cfg.Loki; c.Endpoint != "" {
+		if err = add("loki", c.Level, &c.Batch, newLokiSender(c)); err != nil {
+			return
+		}
+	}
+	if c := &cfg.Elasticsearch; c.Endpoint != "" {
+		if err = add("elasticsearch", c.Level, &c.Batch, newElasticsearchSender(c)); err != nil {
+			return
+		}
+	}
+	if c := &cfg.Kafka; len(c.Brokers) > 0 {
+		if err = add("kafka", c.Level, &c.Batch, newKafkaSender(c)); err != nil {
+			return
+		}
+	}
+	if c := &cfg.OTLP; c.Endpoint != "" {
+		if err = add("otlp", c.Level, &c.Batch, newOTLPSender(c)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// withSinks 把日志同时写入各个日志平台，没有单独配置级别的 sink 使用 newCore 创建与所在 logger 相同级别的 Core
+func withSinks(core zapcore.Core, sinks []logSink, newCore func(ws zapcore.WriteSyncer) zapcore.Core) zapcore.Core {
+	if len(sinks) == 0 {
+		return core
+	}
+	cores := []zapcore.Core{core}
+	for _, s := range sinks {
+		if s.level == nil {
+			cores = append(cores, newCore(s.writer))
+			continue
+		}
+		cores = append(cores, newRedactCore(zapcore.NewCore(getEncoder(), s.writer, s.level)))
+	}
+	return zapcore.NewTee(cores...)
+}
@@ -0,0 +1,88 @@
+// Package logic 业务逻辑，介于 controller（解析请求、响应）和 dao（读写数据库、Redis）之间，不依赖 gin
+package logic
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+	"web_app/auth"
+	"web_app/dao/mysql"
+	"web_app/models"
+	"web_app/pkg/snowflake"
+)
+
+var (
+	// ErrUserExist 注册时用户名已经被使用
+	ErrUserExist = errors.New("username already exists")
+	// ErrUserNotExist 用户不存在
+	ErrUserNotExist = errors.New("user does not exist")
+)
+
+// SignUp 注册：检查用户名是否已经被使用，生成用户 ID，保存密码的 bcrypt 哈希
+func SignUp(ctx context.Context, p *models.ParamSignUp) (u *models.User, err error) {
+	exist, err := mysql.CheckUserExist(ctx, p.Username)
+	if err != nil {
+		return
+	}
+	if exist {
+		return nil, ErrUserExist
+	}
+	hash, err := auth.HashPassword(p.Password)
+	if err != nil {
+		return
+	}
+	u = &models.User{
+		ID:        snowflake.GenID(),
+		Username:  p.Username,
+		Password:  hash,
+		Email:     p.Email,
+		CreatedAt: time.Now().Truncate(time.Millisecond),
+	}
+	if err = mysql.InsertUser(ctx, u); err != nil {
+		// 检查之后、写入之前用户名被其他请求使用，由唯一索引保证；ID 冲突等其他错误原样返回
+		if mysql.IsDuplicateUsername(err) {
+			return nil, ErrUserExist
+		}
+		return nil, err
+	}
+	return
+}
+
+// Login 校验用户名和密码，返回用户 ID；通过 auth.SetAuthenticator 用于 POST /api/v1/login
+func Login(ctx context.Context, username, password string) (userID string, err error) {
+	u, err := mysql.GetUserByUsername(ctx, username)
+	if errors.Is(err, mysql.ErrNotFound) {
+		// 用户不存在时同样比较一次密码，避免通过响应时间判断用户名是否存在
+		dummyOnce.Do(func() { dummyHash, _ = auth.HashPassword("web_app dummy password") })
+		auth.CheckPassword(dummyHash, password)
+		return "", auth.ErrInvalidCredentials
+	}
+	if err != nil {
+		return
+	}
+	if !auth.CheckPassword(u.Password, password) {
+		return "", auth.ErrInvalidCredentials
+	}
+	return strconv.FormatInt(u.ID, 10), nil
+}
+
+// dummyHash 用户不存在时用于比较的 bcrypt 哈希，与 auth.HashPassword 的 cost 相同，第一次使用时计算
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// GetProfile 查询当前用户的资料，userID 为 auth.UserID 的结果
+func GetProfile(ctx context.Context, userID string) (*models.User, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, ErrUserNotExist
+	}
+	u, err := mysql.GetUserByID(ctx, id)
+	if errors.Is(err, mysql.ErrNotFound) {
+		return nil, ErrUserNotExist
+	}
+	return u, err
+}
@@ -2,20 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	"web_app/audit"
+	"web_app/auth"
+	"web_app/cache"
+	_ "web_app/controller" // 注册示例的用户模块的路由
 	"web_app/dao/mysql"
 	"web_app/dao/redis"
+	"web_app/db/seeds"
+	"web_app/featureflag"
+	"web_app/health"
+	"web_app/keyspace"
 	"web_app/logger"
+	"web_app/middlewares"
+	"web_app/pkg/snowflake"
+	"web_app/pubsub"
+	"web_app/rbac"
 	"web_app/routes"
+	"web_app/sessions"
 	"web_app/settings"
-
-	"github.com/spf13/viper"
+	"web_app/streams"
+	"web_app/tasks"
+	"web_app/tracing"
+	"web_app/validation"
 
 	"go.uber.org/zap"
 )
@@ -23,53 +41,192 @@ import (
 // Go Web 开发通用的脚手架模版
 
 func main() {
+	os.Exit(run())
+}
+
+// run 启动服务直到收到关机信号，返回进程的退出码；os.Exit 不会执行 defer，所以放在 run 返回之后，
+// 这样关机失败时仍然会关闭连接、写入缓冲区中的日志
+func run() (code int) {
 	//	1. 加载配置
-	if err := settings.Init(); err != nil {
+	cfg, err := settings.Init()
+	if err != nil {
 		fmt.Printf("init settings failed, error: %v\n", err)
 		return
 	}
+	if settings.PrintConfigRequested() {
+		settings.Print(os.Stdout)
+		return
+	}
 	//	2. 初始化日志
-	if err := logger.Init(); err != nil {
+	if err := logger.Init(&cfg.Log, cfg.App.Mode); err != nil {
 		fmt.Printf("init logger failed, error: %v\n", err)
 		return
 	}
-	defer zap.L().Sync()
+	// 退出前写入缓冲区中的日志
+	defer logger.Sync()
+	if err := logger.InitSentry(&cfg.Sentry, &cfg.App); err != nil {
+		fmt.Printf("init sentry failed, error: %v\n", err)
+		return
+	}
+	if err := tracing.Init(&cfg.Tracing, &cfg.App); err != nil {
+		fmt.Printf("init tracing failed, error: %v\n", err)
+		return
+	}
+	// 退出前发送缓冲区中的 span
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = tracing.Shutdown(ctx)
+	}()
 	zap.L().Debug("logger initialized successfully")
+	//	初始化 ID 生成器，种子数据中也可能用到
+	if err := snowflake.Init(cfg.App.StartTime, cfg.App.MachineID); err != nil {
+		fmt.Printf("init snowflake failed, error: %v\n", err)
+		return
+	}
+	//	./web_app migrate <command> 只执行数据库迁移
+	if args := settings.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := migrate(cfg, args[1:]); err != nil {
+			fmt.Printf("migrate failed, error: %v\n", err)
+		}
+		return
+	}
+	//	./web_app seed [name...] 只写入种子数据
+	if args := settings.Args(); len(args) > 0 && args[0] == "seed" {
+		if err := seed(cfg, args[1:]); err != nil {
+			fmt.Printf("seed failed, error: %v\n", err)
+		}
+		return
+	}
 	//	3. 初始化 MySQL 连接
-	if err := mysql.Init(); err != nil {
+	if err := mysql.Init(&cfg.MySQL); err != nil {
 		fmt.Printf("init mysql failed, error: %v\n", err)
 		return
 	}
 	defer mysql.Close()
 	//	4. 初始化 Redis 连接
-	if err := redis.Init(); err != nil {
+	if _, err := redis.Init(&cfg.Redis); err != nil {
 		fmt.Printf("init redis failed, error: %v\n", err)
 		return
 	}
 	defer redis.Close()
-	//	5. 注册路由
-	router := routes.Setup()
-	//	6. 启动服务（优雅关机）
+	//	初始化审计日志，写入 MySQL 时依赖上面的连接
+	if err := audit.Init(&cfg.Audit); err != nil {
+		fmt.Printf("init audit failed, error: %v\n", err)
+		return
+	}
+	defer audit.Close()
+	//	5. 初始化功能开关
+	if err := featureflag.Init(); err != nil {
+		fmt.Printf("init feature flags failed, error: %v\n", err)
+		return
+	}
+	defer featureflag.Close()
+	//	初始化缓存配置
+	if err := cache.Init(); err != nil {
+		fmt.Printf("init cache failed, error: %v\n", err)
+		return
+	}
+	//	预热缓存，失败时只记录日志，请求会回源到数据库
+	if err := cache.Warm(context.Background()); err != nil {
+		zap.L().Warn("warm cache failed", zap.Error(err))
+	}
+	//	初始化会话配置
+	if err := sessions.Init(); err != nil {
+		fmt.Printf("init sessions failed, error: %v\n", err)
+		return
+	}
+	//	读取跨域配置，需要在 routes.Setup 之前
+	if err := middlewares.InitCORS(); err != nil {
+		fmt.Printf("init cors failed, error: %v\n", err)
+		return
+	}
+	//	读取限流配置，需要在 routes.Setup 之前
+	if err := middlewares.InitRateLimit(); err != nil {
+		fmt.Printf("init ratelimit failed, error: %v\n", err)
+		return
+	}
+	//	读取请求超时配置，需要在 routes.Setup 之前
+	if err := middlewares.InitTimeout(); err != nil {
+		fmt.Printf("init timeout failed, error: %v\n", err)
+		return
+	}
+	//	注册参数校验的错误信息，需要在 routes.Setup 之前
+	if err := validation.Init(cfg.App.Locale); err != nil {
+		fmt.Printf("init validation failed, error: %v\n", err)
+		return
+	}
+	//	初始化 JWT 认证
+	if err := auth.Init(); err != nil {
+		fmt.Printf("init auth failed, error: %v\n", err)
+		return
+	}
+	//	加载权限规则，并订阅其他实例修改规则的通知，需要在启动 Pub/Sub 订阅之前
+	if err := rbac.Init(); err != nil {
+		fmt.Printf("init rbac failed, error: %v\n", err)
+		return
+	}
+	//	订阅 key 过期、淘汰的通知，需要在启动 Pub/Sub 订阅之前
+	if err := keyspace.Init(); err != nil {
+		fmt.Printf("init keyspace notifications failed, error: %v\n", err)
+		return
+	}
+	//	启动 Redis Pub/Sub 订阅，处理函数在各模块的 init 中注册
+	if err := pubsub.Start(); err != nil {
+		fmt.Printf("start pubsub failed, error: %v\n", err)
+		return
+	}
+	//	启动 Redis Streams 消费，处理函数在各模块的 init 中注册
+	if err := streams.Start(); err != nil {
+		fmt.Printf("start streams failed, error: %v\n", err)
+		return
+	}
+	//	启动延迟任务的执行
+	if err := tasks.Start(); err != nil {
+		fmt.Printf("start tasks failed, error: %v\n", err)
+		return
+	}
+	//	6. 注册路由
+	router, err := routes.Setup(cfg)
+	if err != nil {
+		fmt.Printf("setup routes failed, error: %v\n", err)
+		return
+	}
+	//	7. 启动服务（优雅关机）
 	// 服务器定义运行HTTP服务器的参数。Server的零值是一个有效的配置。
 	srv := &http.Server{
 		// Addr可选地以“host:port”的形式指定服务器要监听的TCP地址。如果为空，则使用“:http”(端口80)。
 		// 服务名称在RFC 6335中定义，并由IANA分配
-		Addr:    fmt.Sprintf(":%d", viper.GetInt("app.port")),
+		Addr:    fmt.Sprintf(":%d", cfg.App.Port),
 		Handler: router,
 	}
+	// 先监听端口再启动服务，这样端口被占用时可以直接退出，app.port 为 0 时由系统分配一个空闲端口
+	ln, err := listen(&cfg.App)
+	if err != nil {
+		fmt.Printf("listen failed, error: %v\n", err)
+		return
+	}
+	zap.L().Info("server listening", zap.String("addr", ln.Addr().String()))
+	if cfg.App.AddrFile != "" {
+		// 把实际监听的地址写入文件，方便集成测试和本地多实例发现端口
+		if err := os.WriteFile(cfg.App.AddrFile, []byte(ln.Addr().String()), 0o644); err != nil {
+			zap.L().Error("write addr file failed", zap.String("file", cfg.App.AddrFile), zap.Error(err))
+		}
+		defer os.Remove(cfg.App.AddrFile)
+	}
 
 	go func() {
-		// 开启一个goroutine启动服务，如果不用 goroutine，下面的代码 ListenAndServe 会一直接收请求，处理请求，进入无限循环。代码就不会往下执行。
+		// 开启一个goroutine启动服务，如果不用 goroutine，下面的代码 Serve 会一直接收请求，处理请求，进入无限循环。代码就不会往下执行。
 
-		// ListenAndServe监听TCP网络地址srv.Addr，然后调用Serve来处理传入连接上的请求。接受的连接配置为使TCP能保持连接。
-		// ListenAndServe always returns a non-nil error. After Shutdown or Close,
+		// Serve在监听器ln上接受传入的连接，然后为每个连接创建一个goroutine来处理请求。
+		// Serve always returns a non-nil error. After Shutdown or Close,
 		// the returned error is ErrServerClosed.
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("listen: %s\n", err) // Fatalf 相当于Printf()之后再调用os.Exit(1)。
 		}
 	}()
 
-	// 等待中断信号来优雅地关闭服务器，为关闭服务器操作设置一个5秒的超时
+	// 等待中断信号来优雅地关闭服务器，为关闭服务器操作设置 app.shutdown_timeout 的超时
 
 	// make内置函数分配并初始化(仅)slice、map或chan类型的对象。
 	// 与new一样，第一个参数是类型，而不是值。
@@ -81,19 +238,28 @@ func main() {
 	// kill 默认会发送 syscall.SIGTERM 信号
 	// kill -2 发送 syscall.SIGINT 信号，Ctrl+C 就是触发系统SIGINT信号
 	// kill -9 发送 syscall.SIGKILL 信号，但是不能被捕获，所以不需要添加它
-	// signal.Notify把收到的 syscall.SIGINT或syscall.SIGTERM 信号转发给quit
+	// signal.Notify把收到的 app.shutdown_signals 中配置的信号（默认 syscall.SIGINT和syscall.SIGTERM）转发给quit
 
 	// Notify使包信号将传入的信号转发给c，如果没有提供信号，则将所有传入的信号转发给c，否则仅将提供的信号转发给c。
 	// 包信号不会阻塞发送到c:调用者必须确保c有足够的缓冲空间来跟上预期的信号速率。对于仅用于通知一个信号值的通道，大小为1的缓冲区就足够了。
 	// 允许使用同一通道多次调用Notify:每次调用都扩展发送到该通道的信号集。从集合中移除信号的唯一方法是调用Stop。
 	// 允许使用不同的通道和相同的信号多次调用Notify:每个通道独立地接收传入信号的副本。
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM) // 此处不会阻塞
-	<-quit                                               // 阻塞在此，当接收到上述两种信号时才会往下执行
-	zap.L().Info("Shutdown Server ...")
-	// 创建一个5秒超时的context
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	signal.Notify(quit, shutdownSignals(cfg.App.ShutdownSignals)...) // 此处不会阻塞
+	sig := <-quit                                                    // 阻塞在此，当接收到上述信号时才会往下执行
+	inFlight := middlewares.InFlightCount()
+	zap.L().Info("Shutdown Server ...", zap.String("signal", sig.String()), zap.Int64("in_flight", inFlight))
+	// 关机过程中再次收到信号，或者超过 app.force_exit_timeout 仍未退出时强制退出
+	go forceExit(quit, cfg.App.ForceExitTimeout)
+	// readiness 先返回 503，负载均衡摘除实例之后再关闭监听，期间新的请求仍然正常处理
+	health.Drain()
+	if cfg.App.ShutdownDelay > 0 {
+		zap.L().Info("draining before shutdown", zap.Duration("delay", cfg.App.ShutdownDelay))
+		time.Sleep(cfg.App.ShutdownDelay)
+	}
+	// 创建一个 app.shutdown_timeout 超时的context
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.App.ShutdownTimeout)
 	defer cancel()
-	// 5秒内优雅关闭服务（将未处理完的请求处理完再关闭服务），超过5秒就超时退出
+	// 超时时间内优雅关闭服务（将未处理完的请求处理完再关闭服务），超时就退出
 
 	// 关机将在不中断任何活动连接的情况下优雅地关闭服务器。
 	// Shutdown的工作原理是首先关闭所有打开的侦听器，然后关闭所有空闲连接，然后无限期地等待连接返回空闲状态，然后关闭。
@@ -102,8 +268,94 @@ func main() {
 	// 关闭不试图关闭或等待被劫持的连接，如WebSockets。如果需要的话，Shutdown的调用者应该单独通知这些长寿命连接关闭，并等待它们关闭。
 	// 一旦在服务器上调用Shutdown，它可能不会被重用;以后对Serve等方法的调用将返回ErrServerClosed。
 	if err := srv.Shutdown(ctx); err != nil {
-		zap.L().Fatal("Server Shutdown", zap.Error(err))
+		// 继续关闭后台任务和连接，全部完成之后以非 0 的退出码退出
+		code = 1
+		zap.L().Error("Server Shutdown", zap.Error(err),
+			zap.Int64("drained", inFlight-middlewares.InFlightCount()),
+			zap.Int64("abandoned", middlewares.InFlightCount()),
+		)
+	}
+
+	// HTTP 服务关闭之后停止订阅，在剩余的时间内等待正在处理的消息
+	if err := pubsub.Shutdown(ctx); err != nil {
+		zap.L().Error("pubsub shutdown timed out", zap.Error(err))
+	}
+	if err := streams.Shutdown(ctx); err != nil {
+		zap.L().Error("streams shutdown timed out", zap.Error(err))
+	}
+	if err := tasks.Shutdown(ctx); err != nil {
+		zap.L().Error("tasks shutdown timed out", zap.Error(err))
+	}
+
+	zap.L().Info("Server exiting", zap.Int64("drained", inFlight))
+	return
+}
+
+// migrate 执行数据库迁移命令，例如 ./web_app migrate up、./web_app migrate down、./web_app migrate status
+func migrate(cfg *settings.Config, args []string) (err error) {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: web_app migrate <%s> [version]", strings.Join(mysql.MigrateCommands, "|"))
+	}
+	db, err := mysql.New(&cfg.MySQL)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	return mysql.Migrate(context.Background(), db, args[0], args[1:]...)
+}
+
+// seed 写入种子数据，例如 ./web_app seed（全部）、./web_app seed 001_users，只允许在 seed.envs 中的环境执行
+func seed(cfg *settings.Config, names []string) (err error) {
+	db, err := mysql.New(&cfg.MySQL)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	return seeds.Run(context.Background(), db, cfg.App.Env, &cfg.Seed, names...)
+}
+
+// listen 监听 app.port，端口被占用且开启了 app.port_fallback 时改为监听系统分配的空闲端口
+func listen(cfg *settings.AppConfig) (net.Listener, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil && cfg.Port != 0 && cfg.PortFallback && errors.Is(err, syscall.EADDRINUSE) {
+		zap.L().Warn("port already in use, fallback to a random port", zap.Int("port", cfg.Port))
+		return net.Listen("tcp", ":0")
+	}
+	return ln, err
+}
+
+// shutdownSignals 把配置中的信号名转换为 os.Signal，没有配置时使用 SIGINT 和 SIGTERM
+func shutdownSignals(names []string) []os.Signal {
+	known := map[string]os.Signal{
+		"SIGINT":  syscall.SIGINT,
+		"SIGTERM": syscall.SIGTERM,
+		"SIGQUIT": syscall.SIGQUIT,
+		"SIGHUP":  syscall.SIGHUP,
+	}
+	signals := make([]os.Signal, 0, len(names))
+	for _, name := range names {
+		if sig, ok := known[name]; ok {
+			signals = append(signals, sig)
+		}
+	}
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
 	}
+	return signals
+}
 
-	zap.L().Info("Server exiting")
+// forceExit 再次收到关机信号或者等待超时之后强制退出
+func forceExit(quit <-chan os.Signal, timeout time.Duration) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+	select {
+	case sig := <-quit:
+		zap.L().Warn("received signal again, force exit", zap.String("signal", sig.String()))
+	case <-deadline:
+		zap.L().Warn("shutdown timed out, force exit", zap.Duration("timeout", timeout))
+	}
+	_ = logger.Sync()
+	os.Exit(1)
 }
@@ -0,0 +1,152 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CORSConfig 跨域配置，对应配置文件中的 cors
+type CORSConfig struct {
+	// Enable 为 false 时不处理跨域请求，浏览器中其他域名的页面无法调用接口
+	Enable bool `mapstructure:"enable"`
+	// AllowOrigins 允许的来源，例如 https://app.example.com；* 表示所有来源，https://*.example.com 匹配所有子域名
+	AllowOrigins []string `mapstructure:"allow_origins"`
+	AllowMethods []string `mapstructure:"allow_methods"`
+	// AllowHeaders 允许的请求头，* 表示允许预检请求中的所有请求头
+	AllowHeaders []string `mapstructure:"allow_headers"`
+	// ExposeHeaders 页面中的 JavaScript 可以读取的响应头
+	ExposeHeaders []string `mapstructure:"expose_headers"`
+	// AllowCredentials 允许带上 cookie，此时 AllowOrigins 不能为 *
+	AllowCredentials bool `mapstructure:"allow_credentials"`
+	// MaxAge 浏览器缓存预检请求结果的时间
+	MaxAge time.Duration `mapstructure:"max_age" validate:"min=0"`
+}
+
+// 配置文件中的 key
+const corsConfigKey = "cors"
+
+var corsDefaults = CORSConfig{
+	AllowMethods:  []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+	AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Accept-Language", "Authorization", HeaderRequestID},
+	ExposeHeaders: []string{HeaderRequestID},
+	MaxAge:        12 * time.Hour,
+}
+
+var currentCORS atomic.Pointer[CORSConfig]
+
+func init() {
+	settings.Register(corsConfigKey, corsDefaults)
+}
+
+// InitCORS 读取跨域配置，并在配置热加载时更新，需要在 routes.Setup 之前调用
+func InitCORS() (err error) {
+	if err = loadCORS(); err != nil {
+		return
+	}
+	settings.OnChange(func(settings.Config) {
+		if err := loadCORS(); err != nil {
+			logger.Named("cors").Error("reload cors config failed", zap.Error(err))
+		}
+	})
+	return
+}
+
+func loadCORS() error {
+	cfg, err := settings.Sub[CORSConfig](corsConfigKey)
+	if err != nil {
+		return err
+	}
+	if cfg.AllowCredentials && contains(cfg.AllowOrigins, "*") {
+		return errors.New("cors.allow_origins cannot be * when cors.allow_credentials is true")
+	}
+	currentCORS.Store(cfg)
+	return nil
+}
+
+// CORS 按 cors 配置处理跨域请求：来源允许时加上 Access-Control-Allow-* 响应头，预检请求（OPTIONS）直接响应 204，
+// 不允许的来源的预检请求响应 403；没有 Origin 请求头的请求不受影响
+func CORS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := currentCORS.Load()
+		origin := c.GetHeader("Origin")
+		if cfg == nil || !cfg.Enable || origin == "" {
+			c.Next()
+			return
+		}
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		c.Writer.Header().Add("Vary", "Origin")
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !allowOrigin(cfg.AllowOrigins, origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+		if contains(cfg.AllowOrigins, "*") {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if len(cfg.ExposeHeaders) > 0 {
+				c.Header("Access-Control-Expose-Headers", strings.Join(cfg.ExposeHeaders, ", "))
+			}
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Methods", strings.Join(cfg.AllowMethods, ", "))
+		if contains(cfg.AllowHeaders, "*") {
+			if h := c.GetHeader("Access-Control-Request-Headers"); h != "" {
+				c.Header("Access-Control-Allow-Headers", h)
+			}
+		} else if len(cfg.AllowHeaders) > 0 {
+			c.Header("Access-Control-Allow-Headers", strings.Join(cfg.AllowHeaders, ", "))
+		}
+		if cfg.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// allowOrigin origin 是否在 allowed 中，支持 * 和 https://*.example.com 形式的子域名通配
+func allowOrigin(allowed []string, origin string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+		if i := strings.Index(a, "*."); i >= 0 {
+			prefix, suffix := a[:i], a[i+1:]
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
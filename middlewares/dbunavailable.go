@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"web_app/dao/mysql"
+	"web_app/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// CodeDBUnavailable 数据库熔断时 503 响应中的错误码，客户端可以据此提示稍后重试
+	CodeDBUnavailable = response.NewCode("db_unavailable", http.StatusServiceUnavailable, mysql.ErrUnavailable.Error())
+	// CodeDBReadOnly 维护模式下写入时 503 响应中的错误码，客户端可以提示暂时只能查看
+	CodeDBReadOnly = response.NewCode("db_read_only", http.StatusServiceUnavailable, mysql.ErrReadOnly.Error())
+)
+
+// DBUnavailable handler 遇到 mysql.ErrUnavailable 或 mysql.ErrReadOnly 时调用 c.Error(err) 并直接返回（不写入响应），
+// 由这里统一返回 503 和对应的错误码，熔断时带有熔断器恢复前的 Retry-After
+//
+//	if err != nil {
+//		_ = c.Error(err)
+//		return
+//	}
+func DBUnavailable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Written() {
+			return
+		}
+		for _, e := range c.Errors {
+			if errors.Is(e.Err, mysql.ErrReadOnly) {
+				response.Error(c, CodeDBReadOnly)
+				return
+			}
+			if !errors.Is(e.Err, mysql.ErrUnavailable) {
+				continue
+			}
+			if d := mysql.Default(); d != nil && d.RetryAfter() > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(d.RetryAfter().Seconds()))))
+			}
+			response.Error(c, CodeDBUnavailable)
+			return
+		}
+	}
+}
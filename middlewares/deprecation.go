@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// APIVersionKey gin.Context 中保存请求的 API 版本（例如 v1）的 key，由 routes 的版本路由组设置
+const APIVersionKey = "api_version"
+
+// deprecatedRequests 调用已废弃接口的请求数，下线之前确认调用量已经降到零
+var deprecatedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_deprecated_requests_total",
+	Help: "Number of requests to deprecated endpoints by api version and route.",
+}, []string{"version", "route"})
+
+// Deprecation 接口废弃的信息
+type Deprecation struct {
+	// At 废弃的时间，为零时 Deprecation 响应头为 true
+	At time.Time
+	// Sunset 计划下线的时间（RFC 8594），为零时不发送 Sunset
+	Sunset time.Time
+	// Link 迁移说明的地址，作为 rel="deprecation" 的 Link 发送
+	Link string
+}
+
+// Deprecated 把接口标记为已废弃：响应中带有 Deprecation、Sunset 和 Link 头，客户端可以据此提醒迁移，
+// 并按版本和路由统计调用次数。可以用于单个路由、模块的路由组或者整个 API 版本
+//
+//	r.GET("/posts", middlewares.Deprecated(middlewares.Deprecation{Sunset: sunset, Link: "https://example.com/docs/v2"}), listPostsV1)
+func Deprecated(d Deprecation) gin.HandlerFunc {
+	deprecation := "true"
+	if !d.At.IsZero() {
+		// RFC 9745 的格式为 @<Unix 时间戳>
+		deprecation = "@" + strconv.FormatInt(d.At.Unix(), 10)
+	}
+	var sunset string
+	if !d.Sunset.IsZero() {
+		sunset = d.Sunset.UTC().Format(http.TimeFormat)
+	}
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("Deprecation", deprecation)
+		if sunset != "" {
+			h.Set("Sunset", sunset)
+		}
+		if d.Link != "" {
+			h.Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+		}
+		deprecatedRequests.WithLabelValues(c.GetString(APIVersionKey), c.FullPath()).Inc()
+		c.Next()
+	}
+}
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inFlight 正在处理中的请求数
+var inFlight atomic.Int64
+
+// InFlight 统计正在处理中的请求数，优雅关机时用来观察还有多少请求没有处理完
+func InFlight() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		c.Next()
+	}
+}
+
+// InFlightCount 返回正在处理中的请求数
+func InFlightCount() int64 {
+	return inFlight.Load()
+}
@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+	"web_app/dao/redis"
+)
+
+// sweepInterval 清理内存中已经补满的令牌桶的间隔
+const sweepInterval = time.Minute
+
+// maxBuckets 内存中最多保存的令牌桶数量，避免大量不同的 IP、API key 在两次清理之间耗尽内存
+const maxBuckets = 100000
+
+// evictSweepInterval 令牌桶数量达到上限时提前清理的最短间隔，避免每个新的 key 都遍历一次
+const evictSweepInterval = time.Second
+
+// memoryLimiter 内存中的令牌桶限流，与 redis.TokenBucketLimiter 的行为相同，计数只在当前实例中有效
+type memoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+var _ redis.Limiter = (*memoryLimiter)(nil)
+
+// bucket 一个 key 的令牌桶，tokens 为 last 时剩余的令牌数
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  int
+	window time.Duration
+}
+
+func newMemoryLimiter() *memoryLimiter {
+	return &memoryLimiter{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Allow 从 key 的令牌桶中取一个令牌，没有令牌时拒绝
+func (l *memoryLimiter) Allow(_ context.Context, key string, limit int, window time.Duration) (redis.LimitResult, error) {
+	if limit <= 0 || window < time.Millisecond {
+		return redis.LimitResult{}, errors.New("rate limit must be positive and window at least 1ms")
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.evict(now)
+		}
+		b = &bucket{tokens: float64(limit), last: now}
+		l.buckets[key] = b
+	}
+	// 配置热加载后使用新的容量和速度
+	b.limit, b.window = limit, window
+	b.tokens = b.available(now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return redis.LimitResult{Allowed: true, Remaining: int(b.tokens)}, nil
+	}
+	retry := time.Duration(math.Ceil((1 - b.tokens) / b.rate()))
+	return redis.LimitResult{RetryAfter: retry}, nil
+}
+
+// rate 每纳秒补充的令牌数
+func (b *bucket) rate() float64 {
+	return float64(b.limit) / float64(b.window)
+}
+
+// available now 时的令牌数
+func (b *bucket) available(now time.Time) float64 {
+	return math.Min(float64(b.limit), b.tokens+float64(now.Sub(b.last))*b.rate())
+}
+
+// sweep 每 sweepInterval 删除一次已经补满的令牌桶，补满的桶与新建的相同，避免不再请求的 key 一直占用内存
+func (l *memoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	l.removeFull(now)
+}
+
+// evict 令牌桶数量达到 maxBuckets 时腾出位置：先删除已经补满的桶（最多每 evictSweepInterval 一次），
+// 仍然没有位置时删除任意一个桶，被删除的 key 下次请求时重新从满的令牌桶开始
+func (l *memoryLimiter) evict(now time.Time) {
+	if now.Sub(l.lastSweep) >= evictSweepInterval {
+		l.lastSweep = now
+		l.removeFull(now)
+	}
+	for key := range l.buckets {
+		if len(l.buckets) < maxBuckets {
+			return
+		}
+		delete(l.buckets, key)
+	}
+}
+
+func (l *memoryLimiter) removeFull(now time.Time) {
+	for key, b := range l.buckets {
+		if b.available(now) >= float64(b.limit) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// HTTP 请求的 RED 指标，route 为路由模板（例如 /api/v1/posts/:id），没有匹配的路由为 unmatched，
+// status 为状态码的类别（2xx、4xx 等），避免按原始路径和状态码产生过多的时间序列
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by method, route and status class.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status class.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+	httpResponseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "HTTP response body size by method, route and status class.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+	}, []string{"method", "route", "status"})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served.",
+	}, func() float64 {
+		return float64(InFlightCount())
+	})
+)
+
+// routeUnmatched 没有匹配的路由（404、405）的 route 标签
+const routeUnmatched = "unmatched"
+
+// Metrics 记录每个请求的次数、耗时和响应大小，在 /metrics 中暴露；需要放在 logger.GinRecovery 之前，
+// 这样 panic 的请求记为 5xx。处理中的请求数由 InFlight 统计，为 http_requests_in_flight
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = routeUnmatched
+		}
+		labels := prometheus.Labels{"method": metricMethod(c.Request.Method), "route": route, "status": statusClass(c.Writer.Status())}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		httpResponseSize.With(labels).Observe(float64(size))
+	}
+}
+
+// statusClass 把状态码转换为 2xx、4xx 这样的类别
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// metricMethod 非标准的方法记为 OTHER，防止客户端用任意的方法名产生大量的时间序列
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
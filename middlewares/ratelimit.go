@@ -0,0 +1,144 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"web_app/dao/redis"
+	"web_app/logger"
+	"web_app/response"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// RateLimitConfig 接口限流配置，对应配置文件中的 ratelimit
+type RateLimitConfig struct {
+	// Enable 为 false 时 RateLimit 不限制任何请求
+	Enable bool `mapstructure:"enable"`
+	// Backend memory 在每个实例的内存中计数，适合单实例；redis 多个实例共用计数，见 redis.TokenBucketLimiter
+	Backend string `mapstructure:"backend" validate:"oneof=memory redis"`
+	// APIKeyHeader by 为 api_key 时读取 API key 的请求头
+	APIKeyHeader string `mapstructure:"api_key_header" validate:"required"`
+	// Policies 命名的限流策略，路由中通过 RateLimit(name) 使用
+	Policies map[string]RateLimitPolicy `mapstructure:"policies" validate:"dive"`
+}
+
+// RateLimitPolicy 一个限流策略：令牌桶的容量为 Limit，每 Window 补满，即平均每 Window 最多 Limit 次，允许 Limit 次的突发
+type RateLimitPolicy struct {
+	Limit  int           `mapstructure:"limit" validate:"min=1"`
+	Window time.Duration `mapstructure:"window" validate:"min=1ms"`
+	// By 限流的对象：ip 按客户端 IP；user 按登录用户（需要放在 auth.Middleware 之后），没有登录时按 IP；
+	// api_key 按 APIKeyHeader 中的 API key，没有时按 IP
+	By string `mapstructure:"by" validate:"oneof=ip user api_key"`
+}
+
+// 配置文件中的 key
+const rateLimitConfigKey = "ratelimit"
+
+// CodeRateLimited 请求过于频繁时 429 响应中的错误码
+var CodeRateLimited = response.NewCode("rate_limited", http.StatusTooManyRequests, "too many requests")
+
+var rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_rate_limited_total",
+	Help: "Number of requests rejected by rate limit policies.",
+}, []string{"policy"})
+
+// rateLimit 当前的配置和对应的限流器
+type rateLimit struct {
+	cfg     *RateLimitConfig
+	limiter redis.Limiter
+}
+
+var (
+	currentRateLimit atomic.Pointer[rateLimit]
+	// memory 配置热加载时保留内存中的计数
+	memory = newMemoryLimiter()
+)
+
+func init() {
+	settings.Register(rateLimitConfigKey, RateLimitConfig{Backend: "memory", APIKeyHeader: "X-API-Key"})
+}
+
+// InitRateLimit 读取限流配置，并在配置热加载时更新，需要在 routes.Setup 之前调用
+func InitRateLimit() (err error) {
+	if err = loadRateLimit(); err != nil {
+		return
+	}
+	settings.OnChange(func(settings.Config) {
+		if err := loadRateLimit(); err != nil {
+			logger.Named("ratelimit").Error("reload ratelimit config failed", zap.Error(err))
+		}
+	})
+	return
+}
+
+func loadRateLimit() error {
+	cfg, err := settings.Sub[RateLimitConfig](rateLimitConfigKey)
+	if err != nil {
+		return err
+	}
+	var limiter redis.Limiter = memory
+	if cfg.Backend == "redis" {
+		limiter = redis.NewTokenBucket(nil)
+	}
+	currentRateLimit.Store(&rateLimit{cfg: cfg, limiter: limiter})
+	return nil
+}
+
+// RateLimit 按 ratelimit.policies 中名为 policy 的策略限流，用于单个路由或者路由组，例如
+// r.POST("/login", middlewares.RateLimit("login"), loginHandler)；超过限制时响应 429、Retry-After 和 {"code": "rate_limited"}，
+// 没有启用或者没有配置这个策略时不限制；Redis 不可用时记录日志并放行，避免限流影响接口的可用性
+func RateLimit(policy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rl := currentRateLimit.Load()
+		if rl == nil || !rl.cfg.Enable {
+			c.Next()
+			return
+		}
+		p, ok := rl.cfg.Policies[policy]
+		if !ok {
+			c.Next()
+			return
+		}
+		key := "http:" + policy + ":" + clientKey(c, p.By, rl.cfg.APIKeyHeader)
+		res, err := rl.limiter.Allow(c.Request.Context(), key, p.Limit, p.Window)
+		if err != nil {
+			logger.FromContext(c).Warn("rate limit failed, request allowed", zap.String("policy", policy), zap.Error(err))
+			c.Next()
+			return
+		}
+		c.Header("X-RateLimit-Limit", strconv.Itoa(p.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if !res.Allowed {
+			rateLimited.WithLabelValues(policy).Inc()
+			c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(res.RetryAfter.Seconds())))))
+			response.Error(c, CodeRateLimited)
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientKey 限流对象的标识，带有类型前缀，API key 只保存哈希
+func clientKey(c *gin.Context, by, apiKeyHeader string) string {
+	switch by {
+	case "user":
+		if id := c.GetString(logger.UserIDKey); id != "" {
+			return "user:" + id
+		}
+	case "api_key":
+		if k := c.GetHeader(apiKeyHeader); k != "" {
+			sum := sha256.Sum256([]byte(k))
+			return "key:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"web_app/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderRequestID 请求 ID 的请求头和响应头
+const HeaderRequestID = "X-Request-ID"
+
+// RequestID 为每个请求生成请求 ID，上游（网关、调用方）已经传了 X-Request-ID 时沿用上游的值
+// 请求 ID 会写到响应头中，并保存到 gin.Context 和 c.Request.Context() 中供 logger.FromContext 使用
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(logger.RequestIDKey, id)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID 只接受长度合理的可见 ASCII 字符，避免把任意内容写进日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
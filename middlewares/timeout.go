@@ -0,0 +1,113 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+	"web_app/logger"
+	"web_app/response"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// TimeoutConfig 请求超时配置，对应配置文件中的 timeout
+type TimeoutConfig struct {
+	// Default 每个请求的超时时间，0 表示不限制
+	Default time.Duration `mapstructure:"default" validate:"min=0"`
+	// Routes 路由模板的前缀（例如 /api/v1/upload）对应的超时时间，匹配最长的前缀，0 表示不限制
+	Routes map[string]time.Duration `mapstructure:"routes" validate:"dive,min=0"`
+}
+
+// 配置文件中的 key
+const timeoutConfigKey = "timeout"
+
+var requestTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_request_timeouts_total",
+	Help: "Number of requests that exceeded their timeout by route.",
+}, []string{"route"})
+
+var currentTimeout atomic.Pointer[TimeoutConfig]
+
+func init() {
+	settings.Register(timeoutConfigKey, TimeoutConfig{
+		Default: 10 * time.Second,
+		// /debug/pprof/profile、trace 按 seconds 参数采样，不限制
+		Routes: map[string]time.Duration{"/debug/pprof": 0},
+	})
+}
+
+// InitTimeout 读取请求超时配置，并在配置热加载时更新，需要在 routes.Setup 之前调用
+func InitTimeout() (err error) {
+	if err = loadTimeout(); err != nil {
+		return
+	}
+	settings.OnChange(func(settings.Config) {
+		if err := loadTimeout(); err != nil {
+			logger.Named("timeout").Error("reload timeout config failed", zap.Error(err))
+		}
+	})
+	return
+}
+
+func loadTimeout() error {
+	cfg, err := settings.Sub[TimeoutConfig](timeoutConfigKey)
+	if err != nil {
+		return err
+	}
+	currentTimeout.Store(cfg)
+	return nil
+}
+
+// Timeout 给 c.Request.Context() 加上按路由配置的超时时间，handler 把它传给数据库、Redis 等调用，超时后这些调用被取消，
+// 慢的依赖不会让请求一直占用连接和 goroutine；超时后 handler 没有写入响应时响应 504 和 {"code": "timeout"}，
+// handler 通过 c.Error(err) 返回的 context.DeadlineExceeded 同样由 response.Middleware 响应 504。
+// 不使用 ctx 的代码（例如 CPU 密集的计算）不会被中断
+func Timeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		d := requestTimeout(route)
+		if d <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		req := c.Request
+		c.Request = req.WithContext(ctx)
+		c.Next()
+		// 外层的中间件（审计、访问日志等）使用原来的 ctx，不受超时的影响
+		c.Request = req
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		requestTimeouts.WithLabelValues(route).Inc()
+		if !c.Writer.Written() {
+			logger.FromContext(c).Warn("request timeout", zap.Duration("timeout", d))
+			response.Error(c, response.CodeTimeout)
+		}
+	}
+}
+
+// requestTimeout route 的超时时间：Routes 中最长的匹配前缀，没有匹配时为 Default
+func requestTimeout(route string) time.Duration {
+	cfg := currentTimeout.Load()
+	if cfg == nil {
+		return 0
+	}
+	d, longest := cfg.Default, -1
+	for prefix, t := range cfg.Routes {
+		if len(prefix) > longest && strings.HasPrefix(route, prefix) {
+			d, longest = t, len(prefix)
+		}
+	}
+	return d
+}
@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"web_app/logger"
+	"web_app/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderTraceparent W3C Trace Context 的请求头，格式为 version-trace_id-parent_id-flags
+const HeaderTraceparent = "traceparent"
+
+// TraceContext 解析上游（网关、调用方）传入的 traceparent 请求头，保存到 gin.Context 和 c.Request.Context() 中
+// logger.FromContext 记录的日志会带上 trace_id 和 span_id，发送到 OpenTelemetry Collector 后可以与链路关联
+// 配置了 tracing.endpoint 时为每个请求创建 server span，SQL 语句等作为它的子 span
+func TraceContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tracing.Enabled() {
+			serverSpan(c)
+			return
+		}
+		if traceID, spanID, ok := parseTraceparent(c.GetHeader(HeaderTraceparent)); ok {
+			c.Set(logger.TraceIDKey, traceID)
+			c.Set(logger.SpanIDKey, spanID)
+			c.Request = c.Request.WithContext(logger.WithTrace(c.Request.Context(), traceID, spanID))
+		}
+		c.Next()
+	}
+}
+
+// serverSpan 创建请求的 span，有 traceparent 时作为上游 span 的子 span，日志中的 span_id 为该 span 的 ID
+func serverSpan(c *gin.Context) {
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracing.Tracer("web_app/http").Start(ctx, c.Request.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("http.target", c.Request.URL.Path),
+			attribute.String("http.client_ip", c.ClientIP()),
+		),
+	)
+	defer span.End()
+	sc := span.SpanContext()
+	traceID, spanID := sc.TraceID().String(), sc.SpanID().String()
+	c.Set(logger.TraceIDKey, traceID)
+	c.Set(logger.SpanIDKey, spanID)
+	c.Request = c.Request.WithContext(logger.WithTrace(ctx, traceID, spanID))
+	c.Next()
+	status := c.Writer.Status()
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// parseTraceparent 解析 traceparent，trace ID 或 span ID 不合法（全 0）时返回 false
+func parseTraceparent(h string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", false
+	}
+	traceID, spanID = strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !validHexID(traceID, 32) || !validHexID(spanID, 16) || len(parts[3]) != 2 || !isHex(parts[3]) {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+// validHexID 长度为 n 的十六进制字符串，并且不能全部为 0
+func validHexID(s string, n int) bool {
+	return len(s) == n && isHex(s) && strings.Trim(s, "0") != ""
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,21 @@
+// Package models 各层之间传递的数据结构：数据库中的记录和接口的请求参数
+package models
+
+import "time"
+
+// User users 表中的一条记录，ID 由 pkg/snowflake 生成，JSON 中为字符串，避免 JavaScript 丢失精度
+type User struct {
+	ID        int64     `db:"id,pk" json:"id,string"`
+	Username  string    `db:"username" json:"username"`
+	Password  string    `db:"password" json:"-"` // auth.HashPassword 的结果
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// ParamSignUp 注册的请求参数
+type ParamSignUp struct {
+	Username   string `json:"username" binding:"required,min=3,max=64"`
+	Password   string `json:"password" binding:"required,min=8,maxbytes=72"` // bcrypt 不接受超过 72 字节的密码，按字节计算
+	RePassword string `json:"re_password" binding:"required,eqfield=Password"`
+	Email      string `json:"email" binding:"omitempty,email,max=255"`
+}
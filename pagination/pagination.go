@@ -0,0 +1,175 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultSize 没有 size 参数时每页的数量
+	DefaultSize = 20
+	// MaxSize 每页最多的数量，size 超过时按 MaxSize 处理
+	MaxSize = 100
+)
+
+// ErrInvalidCursor cursor 参数不是 EncodeCursor 生成的，或者与排序的列不匹配
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Params 请求中的分页参数，有 cursor 参数（第一页为空字符串）时使用游标分页，否则使用 page、size 的偏移分页
+//
+//	GET /api/v1/orders?page=2&size=20     偏移分页，响应中有 total
+//	GET /api/v1/orders?cursor=&size=20    游标分页的第一页，之后传入响应中的 next_cursor
+type Params struct {
+	Page   int    // 页码，从 1 开始，游标分页时为 0
+	Size   int    // 每页的数量
+	Cursor string // 上一页响应中的 next_cursor
+	cursor bool
+}
+
+// Parse 解析请求中的 page、size、cursor 参数，参数不合法时返回错误，handler 应返回 400
+func Parse(c *gin.Context) (p Params, err error) {
+	p.Size = DefaultSize
+	if s := c.Query("size"); s != "" {
+		if p.Size, err = strconv.Atoi(s); err != nil || p.Size < 1 {
+			return p, fmt.Errorf("invalid size %q", s)
+		}
+		if p.Size > MaxSize {
+			p.Size = MaxSize
+		}
+	}
+	if p.Cursor, p.cursor = c.GetQuery("cursor"); p.cursor {
+		if p.Cursor != "" {
+			if _, err = decode(p.Cursor); err != nil {
+				return p, err
+			}
+		}
+		return
+	}
+	p.Page = 1
+	if s := c.Query("page"); s != "" {
+		if p.Page, err = strconv.Atoi(s); err != nil || p.Page < 1 {
+			return p, fmt.Errorf("invalid page %q", s)
+		}
+	}
+	return
+}
+
+// IsCursor 是否使用游标分页
+func (p Params) IsCursor() bool {
+	return p.cursor
+}
+
+// Offset 偏移分页跳过的行数
+func (p Params) Offset() int {
+	if p.Page < 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.Size
+}
+
+// LimitOffset 返回追加在 SQL 末尾的 LIMIT 子句和参数；游标分页时多查询一行，用于判断是否还有下一页，见 Trim
+func (p Params) LimitOffset() (string, []interface{}) {
+	if p.cursor {
+		return " LIMIT ?", []interface{}{p.Size + 1}
+	}
+	return " LIMIT ? OFFSET ?", []interface{}{p.Size, p.Offset()}
+}
+
+// Keyset 生成游标分页的查询条件：按 columns 排序（desc 为 true 时降序）时位于 values 之后的行，
+// 例如 columns 为 created_at、id 时为 (created_at > ? OR (created_at = ? AND id > ?))
+// columns 的最后一列必须唯一（一般为主键），ORDER BY 的列和方向需要与这里相同
+func Keyset(columns []string, desc bool, values []interface{}) (string, []interface{}) {
+	op := " > ?"
+	if desc {
+		op = " < ?"
+	}
+	var (
+		or   []string
+		args []interface{}
+	)
+	for i := range columns {
+		and := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, columns[j]+" = ?")
+			args = append(args, values[j])
+		}
+		and = append(and, columns[i]+op)
+		args = append(args, values[i])
+		if len(and) == 1 {
+			or = append(or, and[0])
+		} else {
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+	}
+	return "(" + strings.Join(or, " OR ") + ")", args
+}
+
+// EncodeCursor 把最后一行排序列的值编码为 next_cursor，对客户端不透明
+func EncodeCursor(values ...interface{}) (string, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor 把 cursor 解码到 dest 中，dest 为与 EncodeCursor 的参数依次对应的指针
+func DecodeCursor(cursor string, dest ...interface{}) error {
+	values, err := decode(cursor)
+	if err != nil {
+		return err
+	}
+	if len(values) != len(dest) {
+		return ErrInvalidCursor
+	}
+	for i, v := range values {
+		if err = json.Unmarshal(v, dest[i]); err != nil {
+			return ErrInvalidCursor
+		}
+	}
+	return nil
+}
+
+func decode(cursor string) (values []json.RawMessage, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(b, &values) != nil || len(values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return
+}
+
+// Meta 响应中的分页信息，偏移分页时有 page、total，游标分页时有 next_cursor
+type Meta struct {
+	Page       int    `json:"page,omitempty"`
+	Size       int    `json:"size"`
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// Result 分页查询的结果，作为响应返回
+//
+//	{"items": [...], "pagination": {"page": 2, "size": 20, "total": 135, "has_more": true}}
+type Result[T any] struct {
+	Items []T  `json:"items"`
+	Meta  Meta `json:"pagination"`
+}
+
+// OffsetMeta 偏移分页的响应信息，total 为满足条件的总数
+func OffsetMeta(p Params, total int64) Meta {
+	return Meta{Page: p.Page, Size: p.Size, Total: &total, HasMore: int64(p.Offset()+p.Size) < total}
+}
+
+// Trim 去掉游标分页多查询的一行，返回是否还有下一页
+func Trim[T any](p Params, items []T) ([]T, bool) {
+	if len(items) > p.Size {
+		return items[:p.Size], true
+	}
+	return items, false
+}
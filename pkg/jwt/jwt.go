@@ -0,0 +1,219 @@
+// Package jwt 签发和校验访问令牌（access token）和刷新令牌（refresh token），支持 HS256（共享密钥）和 RS256（私钥签发、公钥校验）
+//
+//	m, err := jwt.New(cfg)
+//	pair, err := m.Issue(userID, jwt.NewFamily())
+//	claims, err := m.Parse(pair.AccessToken, jwt.TypeAccess)
+//
+// 不依赖 gin 和配置文件，登录、刷新的接口和中间件在 auth 包中
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// 支持的签名算法
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+// minSecretLen HS256 密钥的最小长度，与 SHA-256 的输出长度相同
+const minSecretLen = 32
+
+// TokenType 令牌的类型，保存在 claims 的 typ 中，防止把刷新令牌当作访问令牌使用
+type TokenType string
+
+const (
+	TypeAccess  TokenType = "access"
+	TypeRefresh TokenType = "refresh"
+)
+
+var (
+	// ErrExpired 令牌已过期，客户端应使用刷新令牌换取新的令牌
+	ErrExpired = errors.New("token is expired")
+	// ErrInvalid 令牌格式、签名、签发者或类型不正确
+	ErrInvalid = errors.New("token is invalid")
+)
+
+// Config 令牌的配置
+type Config struct {
+	Algorithm string `mapstructure:"algorithm" validate:"oneof=HS256 RS256"`
+	// Secret HS256 的密钥，至少 32 字节，通过环境变量或 secrets 设置
+	Secret string `mapstructure:"secret"`
+	// PrivateKeyFile、PublicKeyFile RS256 的 PEM 格式的密钥文件，只校验令牌的服务可以只配置公钥，
+	// 只配置私钥时从私钥中得到公钥
+	PrivateKeyFile string `mapstructure:"private_key_file" validate:"omitempty,file"`
+	PublicKeyFile  string `mapstructure:"public_key_file" validate:"omitempty,file"`
+	// Issuer 签发者（iss），校验时不一致的令牌无效
+	Issuer string `mapstructure:"issuer"`
+	// AccessTTL、RefreshTTL 访问令牌和刷新令牌的有效期
+	AccessTTL  time.Duration `mapstructure:"access_ttl" validate:"min=1s"`
+	RefreshTTL time.Duration `mapstructure:"refresh_ttl" validate:"gtfield=AccessTTL"`
+}
+
+// Claims 令牌中的声明，Subject 为用户 ID，ID（jti）每个令牌都不同；
+// Family 为一次登录的标识，刷新得到的令牌属于同一个 family，服务端可以据此撤销一次登录的所有令牌
+type Claims struct {
+	gojwt.RegisteredClaims
+	Type   TokenType `json:"typ"`
+	Family string    `json:"fam,omitempty"`
+}
+
+// TokenPair 登录、刷新时返回给客户端的令牌，ExpiresIn 为访问令牌的有效期（秒）；
+// RefreshID 为刷新令牌的 jti，服务端保存它来判断刷新令牌是否已经被使用过，不返回给客户端
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshID    string `json:"-"`
+}
+
+// Manager 按配置签发和校验令牌，可以并发使用
+type Manager struct {
+	cfg    Config
+	method gojwt.SigningMethod
+	// signKey、verifyKey HS256 时都是密钥，RS256 时为私钥和公钥，没有私钥时 signKey 为 nil
+	signKey   interface{}
+	verifyKey interface{}
+	parser    *gojwt.Parser
+}
+
+// New 按配置创建 Manager，密钥不符合要求或者读取密钥文件失败时返回错误
+func New(cfg Config) (*Manager, error) {
+	m := &Manager{cfg: cfg}
+	switch cfg.Algorithm {
+	case AlgorithmHS256:
+		if len(cfg.Secret) < minSecretLen {
+			return nil, fmt.Errorf("jwt secret must be at least %d bytes", minSecretLen)
+		}
+		m.method = gojwt.SigningMethodHS256
+		m.signKey, m.verifyKey = []byte(cfg.Secret), []byte(cfg.Secret)
+	case AlgorithmRS256:
+		m.method = gojwt.SigningMethodRS256
+		if err := m.loadRSAKeys(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", cfg.Algorithm)
+	}
+	opts := []gojwt.ParserOption{gojwt.WithValidMethods([]string{m.method.Alg()}), gojwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		opts = append(opts, gojwt.WithIssuer(cfg.Issuer))
+	}
+	m.parser = gojwt.NewParser(opts...)
+	return m, nil
+}
+
+func (m *Manager) loadRSAKeys() error {
+	if m.cfg.PrivateKeyFile == "" && m.cfg.PublicKeyFile == "" {
+		return errors.New("jwt RS256 requires private_key_file or public_key_file")
+	}
+	if m.cfg.PrivateKeyFile != "" {
+		b, err := os.ReadFile(m.cfg.PrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("read jwt private key: %w", err)
+		}
+		key, err := gojwt.ParseRSAPrivateKeyFromPEM(b)
+		if err != nil {
+			return fmt.Errorf("parse jwt private key: %w", err)
+		}
+		m.signKey, m.verifyKey = key, &key.PublicKey
+	}
+	if m.cfg.PublicKeyFile != "" {
+		b, err := os.ReadFile(m.cfg.PublicKeyFile)
+		if err != nil {
+			return fmt.Errorf("read jwt public key: %w", err)
+		}
+		key, err := gojwt.ParseRSAPublicKeyFromPEM(b)
+		if err != nil {
+			return fmt.Errorf("parse jwt public key: %w", err)
+		}
+		if priv, ok := m.signKey.(*rsa.PrivateKey); ok && !priv.PublicKey.Equal(key) {
+			return errors.New("jwt public key does not match private key")
+		}
+		m.verifyKey = key
+	}
+	return nil
+}
+
+// NewFamily 生成新的 family，登录时使用，刷新时沿用刷新令牌中的 family
+func NewFamily() string {
+	return newID()
+}
+
+// Issue 为用户 subject 签发 family 中一对新的访问令牌和刷新令牌，只配置了公钥时返回错误
+func (m *Manager) Issue(subject, family string) (pair *TokenPair, err error) {
+	if m.signKey == nil {
+		return nil, errors.New("jwt private key is not configured")
+	}
+	now := time.Now()
+	access, _, err := m.sign(subject, family, TypeAccess, now, m.cfg.AccessTTL)
+	if err != nil {
+		return
+	}
+	refresh, refreshID, err := m.sign(subject, family, TypeRefresh, now, m.cfg.RefreshTTL)
+	if err != nil {
+		return
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(m.cfg.AccessTTL / time.Second),
+		RefreshID:    refreshID,
+	}, nil
+}
+
+// RefreshTTL 刷新令牌的有效期，服务端保存的 family 的过期时间与之相同
+func (m *Manager) RefreshTTL() time.Duration {
+	return m.cfg.RefreshTTL
+}
+
+func (m *Manager) sign(subject, family string, typ TokenType, now time.Time, ttl time.Duration) (token, id string, err error) {
+	claims := Claims{
+		RegisteredClaims: gojwt.RegisteredClaims{
+			ID:        newID(),
+			Subject:   subject,
+			Issuer:    m.cfg.Issuer,
+			IssuedAt:  gojwt.NewNumericDate(now),
+			NotBefore: gojwt.NewNumericDate(now),
+			ExpiresAt: gojwt.NewNumericDate(now.Add(ttl)),
+		},
+		Type:   typ,
+		Family: family,
+	}
+	token, err = gojwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	return token, claims.ID, err
+}
+
+// Parse 校验令牌的签名、有效期、签发者和类型，过期时返回 ErrExpired，其他问题返回 ErrInvalid
+func (m *Manager) Parse(token string, typ TokenType) (*Claims, error) {
+	claims := new(Claims)
+	_, err := m.parser.ParseWithClaims(token, claims, func(*gojwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	})
+	switch {
+	case errors.Is(err, gojwt.ErrTokenExpired):
+		return nil, ErrExpired
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	case claims.Type != typ || claims.Subject == "":
+		return nil, fmt.Errorf("%w: not a %s token", ErrInvalid, typ)
+	}
+	return claims, nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
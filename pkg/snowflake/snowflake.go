@@ -0,0 +1,45 @@
+// Package snowflake 基于 Twitter Snowflake 生成全局唯一、按时间递增的 int64 ID：
+// 41 位毫秒时间戳（从 startTime 开始，约 69 年）+ 10 位机器 ID + 12 位序列号，每台机器每毫秒最多 4096 个；
+// 同一时间运行的每个实例的机器 ID 必须不同，否则可能生成重复的 ID
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	sf "github.com/bwmarrin/snowflake"
+)
+
+// MaxMachineID 机器 ID 的最大值，机器 ID 占 10 位
+const MaxMachineID = 1<<10 - 1
+
+// ErrNotInitialized 没有调用 Init
+var ErrNotInitialized = errors.New("snowflake not initialized")
+
+var node *sf.Node
+
+// Init 设置起始时间（格式为 2006-01-02，启用后不能修改，否则可能生成重复的 ID）和机器 ID，在生成 ID 之前调用
+func Init(startTime string, machineID int64) (err error) {
+	if machineID < 0 || machineID > MaxMachineID {
+		return fmt.Errorf("snowflake machine id %d out of range [0, %d]", machineID, MaxMachineID)
+	}
+	st, err := time.Parse("2006-01-02", startTime)
+	if err != nil {
+		return fmt.Errorf("invalid snowflake start time %q: %w", startTime, err)
+	}
+	if st.After(time.Now()) {
+		return fmt.Errorf("snowflake start time %q is in the future", startTime)
+	}
+	sf.Epoch = st.UnixMilli()
+	node, err = sf.NewNode(machineID)
+	return
+}
+
+// GenID 生成一个新的 ID，没有调用 Init 时 panic
+func GenID() int64 {
+	if node == nil {
+		panic(ErrNotInitialized)
+	}
+	return node.Generate().Int64()
+}
@@ -0,0 +1,324 @@
+// Package pubsub 基于 Redis Pub/Sub 的消息订阅，各模块在 init 中通过 Handle 注册频道的处理函数，main 中 Start 启动订阅
+//
+//	func init() {
+//		pubsub.Handle("config:invalidate", func(ctx context.Context, msg *pubsub.Message) error {
+//			return cache.Delete(ctx, msg.Payload)
+//		})
+//	}
+//	err := pubsub.Publish(ctx, "config:invalidate", "post:1")
+//
+// Pub/Sub 的消息不持久化，发布时没有在线的订阅者收到的消息会丢失，需要可靠投递时使用 Redis Streams
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web_app/dao/redis"
+	"web_app/health"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Config 订阅配置，对应配置文件中的 pubsub，Start 时读取
+type Config struct {
+	// Concurrency 同时执行的处理函数数量，达到上限时暂停读取消息
+	Concurrency int `mapstructure:"concurrency" validate:"min=1"`
+	// HandlerTimeout 每条消息的处理超时，0 表示不限制
+	HandlerTimeout time.Duration `mapstructure:"handler_timeout" validate:"min=0"`
+}
+
+// 配置文件中的 key
+const configKey = "pubsub"
+
+const (
+	// pingInterval 超过该时间没有收到消息时发送 PING，检查连接是否断开
+	pingInterval = 30 * time.Second
+	// 断开后重新订阅的等待时间按指数增长
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+)
+
+// Message 收到的消息
+type Message struct {
+	Channel string
+	// Pattern HandlePattern 注册的模式，Handle 注册的频道为空
+	Pattern string
+	Payload string
+}
+
+// Decode 把 JSON 格式的消息反序列化到 v 中
+func (m *Message) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(m.Payload), v)
+}
+
+// Handler 消息的处理函数，返回的错误和 panic 只记录日志，不影响其他消息
+type Handler func(ctx context.Context, msg *Message) error
+
+// messages 处理的消息数，channel 为注册的频道或模式，result 为 ok、error 或 panic
+var messages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pubsub_messages_total",
+	Help: "Number of Redis Pub/Sub messages handled by channel and result.",
+}, []string{"channel", "result"})
+
+var (
+	mu       sync.Mutex
+	handlers = make(map[string]Handler)
+	patterns = make(map[string]Handler)
+	sub      *subscriber
+)
+
+func init() {
+	settings.Register(configKey, Config{Concurrency: 16, HandlerTimeout: 30 * time.Second})
+}
+
+// Handle 注册频道 channel 的处理函数，在 Start 之前（一般在 init 中）调用，重复注册或者 Start 之后注册时 panic
+func Handle(channel string, h Handler) {
+	register(handlers, channel, h)
+}
+
+// HandlePattern 注册匹配模式（PSUBSCRIBE，例如 user:*）的处理函数，见 Handle
+func HandlePattern(pattern string, h Handler) {
+	register(patterns, pattern, h)
+}
+
+func register(m map[string]Handler, name string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	if sub != nil {
+		panic(fmt.Sprintf("pubsub: Handle %q after Start", name))
+	}
+	if _, ok := m[name]; ok {
+		panic(fmt.Sprintf("pubsub: duplicate handler for %q", name))
+	}
+	m[name] = h
+}
+
+// Publish 使用默认的 Redis 客户端发布消息，v 为 string、[]byte 时原样发送，否则序列化为 JSON
+func Publish(ctx context.Context, channel string, v interface{}) error {
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	var payload interface{}
+	switch v := v.(type) {
+	case string, []byte:
+		payload = v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		payload = b
+	}
+	return client.Publish(ctx, channel, payload).Err()
+}
+
+// subscriber 后台的订阅 goroutine
+type subscriber struct {
+	cfg     Config
+	cancel  context.CancelFunc
+	done    chan struct{}
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	psMu    sync.Mutex
+	ps      *goredis.PubSub
+	log     *zap.Logger
+	chNames []string
+	ptNames []string
+	// subscribed 当前连接已经订阅成功，断开之后到重新订阅之前为 false
+	subscribed atomic.Bool
+}
+
+// errNotSubscribed 连接断开还没有重新订阅，期间的消息会丢失
+var errNotSubscribed = errors.New("redis pubsub is not subscribed")
+
+// Start 读取 pubsub 配置并在后台订阅所有注册的频道，连接断开（包括 Redis 配置热加载替换客户端）后自动重新订阅；
+// 没有注册处理函数时不订阅
+func Start() error {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sub != nil {
+		return errors.New("pubsub already started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub = &subscriber{cfg: *cfg, cancel: cancel, done: make(chan struct{}),
+		sem: make(chan struct{}, cfg.Concurrency), log: logger.Named("pubsub")}
+	for name := range handlers {
+		sub.chNames = append(sub.chNames, name)
+	}
+	for name := range patterns {
+		sub.ptNames = append(sub.ptNames, name)
+	}
+	if len(sub.chNames)+len(sub.ptNames) == 0 {
+		close(sub.done)
+		return nil
+	}
+	go sub.run(ctx)
+	// 订阅断开时 /readiness 返回 503
+	s := sub
+	health.Register("pubsub", func(context.Context) error {
+		if !s.subscribed.Load() {
+			return errNotSubscribed
+		}
+		return nil
+	})
+	return nil
+}
+
+// Shutdown 停止订阅并等待正在执行的处理函数返回，ctx 结束时不再等待并返回 ctx 的错误
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	s := sub
+	mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	s.cancel()
+	s.psMu.Lock()
+	if s.ps != nil {
+		// 关闭连接让阻塞的读取立即返回
+		_ = s.ps.Close()
+	}
+	s.psMu.Unlock()
+	<-s.done
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *subscriber) run(ctx context.Context) {
+	defer close(s.done)
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		err := s.subscribe(ctx, &backoff)
+		if ctx.Err() != nil {
+			return
+		}
+		s.log.Warn("redis pubsub disconnected, resubscribing", zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// subscribe 使用当前的客户端订阅并读取消息，直到出错；订阅成功时把 backoff 重置为最小值
+func (s *subscriber) subscribe(ctx context.Context, backoff *time.Duration) error {
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	ps := client.Subscribe(ctx, s.chNames...)
+	defer ps.Close()
+	defer s.subscribed.Store(false)
+	if len(s.ptNames) > 0 {
+		if err := ps.PSubscribe(ctx, s.ptNames...); err != nil {
+			return err
+		}
+	}
+	s.psMu.Lock()
+	s.ps = ps
+	s.psMu.Unlock()
+	// Shutdown 在设置 ps 之前取消时不会关闭它
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for {
+		msg, err := ps.ReceiveTimeout(ctx, pingInterval)
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			if err = ps.Ping(ctx); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		switch m := msg.(type) {
+		case *goredis.Subscription:
+			*backoff = minBackoff
+			s.subscribed.Store(true)
+			s.log.Debug("redis pubsub subscribed", zap.String("kind", m.Kind), zap.String("channel", m.Channel))
+		case *goredis.Message:
+			if !s.dispatch(ctx, m) {
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// dispatch 在新的 goroutine 中处理消息，同时执行的数量达到上限时等待，ctx 结束时返回 false
+func (s *subscriber) dispatch(ctx context.Context, m *goredis.Message) bool {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			<-s.sem
+			s.wg.Done()
+		}()
+		s.handle(&Message{Channel: m.Channel, Pattern: m.Pattern, Payload: m.Payload})
+	}()
+	return true
+}
+
+// handle 调用处理函数，panic 时恢复并记录日志；使用独立的 ctx，Shutdown 时正在执行的处理函数不会被取消
+func (s *subscriber) handle(msg *Message) {
+	name, h := msg.Channel, handlers[msg.Channel]
+	if msg.Pattern != "" {
+		name, h = msg.Pattern, patterns[msg.Pattern]
+	}
+	if h == nil {
+		return
+	}
+	ctx := context.Background()
+	if s.cfg.HandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.HandlerTimeout)
+		defer cancel()
+	}
+	log := s.log.With(zap.String("channel", msg.Channel))
+	defer func() {
+		if p := recover(); p != nil {
+			messages.WithLabelValues(name, "panic").Inc()
+			log.Error("[Recovery from panic]", zap.Any("error", p), zap.String("stack", string(debug.Stack())))
+		}
+	}()
+	if err := h(ctx, msg); err != nil {
+		messages.WithLabelValues(name, "error").Inc()
+		log.Error("handle pubsub message failed", zap.Error(err))
+		return
+	}
+	messages.WithLabelValues(name, "ok").Inc()
+}
@@ -0,0 +1,224 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/logger"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/jmoiron/sqlx"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// policyCacheKey Redis 中缓存的所有规则（JSON），策略修改后删除
+const policyCacheKey = "rbac:policy"
+
+// adapterTimeout casbin 的 Adapter 接口没有 ctx，每次读写数据库和 Redis 的超时
+const adapterTimeout = 5 * time.Second
+
+const insertRuleSQL = "INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5) VALUES (?, ?, ?, ?, ?, ?, ?)"
+
+// rule casbin_rule 表中的一行
+type rule struct {
+	PType string `db:"ptype"`
+	V0    string `db:"v0"`
+	V1    string `db:"v1"`
+	V2    string `db:"v2"`
+	V3    string `db:"v3"`
+	V4    string `db:"v4"`
+	V5    string `db:"v5"`
+}
+
+func newRule(ptype string, values []string) rule {
+	r := rule{PType: ptype}
+	fields := []*string{&r.V0, &r.V1, &r.V2, &r.V3, &r.V4, &r.V5}
+	for i := 0; i < len(values) && i < len(fields); i++ {
+		*fields[i] = values[i]
+	}
+	return r
+}
+
+func (r rule) args() []interface{} {
+	return []interface{}{r.PType, r.V0, r.V1, r.V2, r.V3, r.V4, r.V5}
+}
+
+// line ptype 和去掉末尾空值之后的字段，即 persist.LoadPolicyArray 的参数
+func (r rule) line() []string {
+	line := []string{r.PType, r.V0, r.V1, r.V2, r.V3, r.V4, r.V5}
+	for len(line) > 1 && line[len(line)-1] == "" {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// adapter 把规则保存在 casbin_rule 表中，加载时优先读取 Redis 中的缓存，实现 persist.Adapter
+type adapter struct {
+	db       mysql.Querier
+	cacheTTL time.Duration
+	// reloading 大于 0 时正在处理其他实例的修改通知，直接读取数据库，见 reload
+	reloading atomic.Int32
+}
+
+var _ persist.Adapter = (*adapter)(nil)
+
+// LoadPolicy 加载所有规则，Redis 中没有缓存时从数据库读取并写入缓存；Redis 不可用时直接读取数据库
+func (a *adapter) LoadPolicy(m model.Model) error {
+	ctx, cancel := context.WithTimeout(context.Background(), adapterTimeout)
+	defer cancel()
+	if a.reloading.Load() > 0 {
+		lines, err := a.query(ctx)
+		if err != nil {
+			return err
+		}
+		return loadLines(lines, m)
+	}
+	lines, err := a.cached(ctx)
+	if err != nil {
+		if lines, err = a.query(ctx); err != nil {
+			return err
+		}
+		a.cache(ctx, lines)
+	}
+	return loadLines(lines, m)
+}
+
+// reload 收到修改通知时重新加载规则：修改方已经删除了缓存，所有实例同时从数据库读取，
+// 不再写入缓存，避免读到修改之前的数据的实例把旧的规则写回缓存；缓存由之后启动的实例重新写入
+func (a *adapter) reload(e *casbin.SyncedEnforcer) error {
+	a.reloading.Add(1)
+	defer a.reloading.Add(-1)
+	return e.LoadPolicy()
+}
+
+func loadLines(lines [][]string, m model.Model) error {
+	for _, line := range lines {
+		if err := persist.LoadPolicyArray(line, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *adapter) cached(ctx context.Context) ([][]string, error) {
+	client := redis.Client()
+	if client == nil || a.cacheTTL <= 0 {
+		return nil, redis.ErrNotInitialized
+	}
+	b, err := client.Get(ctx, redis.Key(policyCacheKey)).Bytes()
+	if err != nil {
+		if !errors.Is(err, goredis.Nil) {
+			logger.Named("rbac").Warn("read policy cache failed", zap.Error(err))
+		}
+		return nil, err
+	}
+	var lines [][]string
+	if err = json.Unmarshal(b, &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func (a *adapter) cache(ctx context.Context, lines [][]string) {
+	client := redis.Client()
+	if client == nil || a.cacheTTL <= 0 {
+		return
+	}
+	b, err := json.Marshal(lines)
+	if err == nil {
+		err = client.Set(ctx, redis.Key(policyCacheKey), b, a.cacheTTL).Err()
+	}
+	if err != nil {
+		logger.Named("rbac").Warn("write policy cache failed", zap.Error(err))
+	}
+}
+
+func (a *adapter) query(ctx context.Context) ([][]string, error) {
+	var rules []rule
+	if err := a.db.SelectContext(ctx, &rules, "SELECT ptype, v0, v1, v2, v3, v4, v5 FROM casbin_rule ORDER BY id"); err != nil {
+		return nil, fmt.Errorf("load casbin rules: %w", err)
+	}
+	lines := make([][]string, len(rules))
+	for i, r := range rules {
+		lines[i] = r.line()
+	}
+	return lines, nil
+}
+
+// invalidate 删除 Redis 中的缓存，规则修改之后调用
+func (a *adapter) invalidate(ctx context.Context) error {
+	client := redis.Client()
+	if client == nil {
+		return nil
+	}
+	return client.Del(ctx, redis.Key(policyCacheKey)).Err()
+}
+
+// SavePolicy 用 m 中的规则替换表中所有的规则
+func (a *adapter) SavePolicy(m model.Model) error {
+	var rules []rule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			for _, values := range ast.Policy {
+				rules = append(rules, newRule(ptype, values))
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), adapterTimeout)
+	defer cancel()
+	return a.db.WithTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM casbin_rule"); err != nil {
+			return err
+		}
+		for _, r := range rules {
+			if _, err := tx.ExecContext(ctx, tx.Rebind(insertRuleSQL), r.args()...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddPolicy 自动保存：Enforcer 添加规则时调用
+func (a *adapter) AddPolicy(_ string, ptype string, values []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), adapterTimeout)
+	defer cancel()
+	_, err := a.db.ExecContext(ctx, insertRuleSQL, newRule(ptype, values).args()...)
+	return err
+}
+
+// RemovePolicy 自动保存：Enforcer 删除规则时调用
+func (a *adapter) RemovePolicy(_ string, ptype string, values []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), adapterTimeout)
+	defer cancel()
+	_, err := a.db.ExecContext(ctx, "DELETE FROM casbin_rule WHERE ptype = ? AND v0 = ? AND v1 = ? AND v2 = ? AND v3 = ? AND v4 = ? AND v5 = ?",
+		newRule(ptype, values).args()...)
+	return err
+}
+
+// RemoveFilteredPolicy 自动保存：删除从第 fieldIndex 个字段开始与 fieldValues 匹配的规则，空值表示不限制
+func (a *adapter) RemoveFilteredPolicy(_ string, ptype string, fieldIndex int, fieldValues ...string) error {
+	conds := []string{"ptype = ?"}
+	args := []interface{}{ptype}
+	for i, v := range fieldValues {
+		idx := fieldIndex + i
+		if v == "" || idx > 5 {
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("v%d = ?", idx))
+		args = append(args, v)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), adapterTimeout)
+	defer cancel()
+	_, err := a.db.ExecContext(ctx, "DELETE FROM casbin_rule WHERE "+strings.Join(conds, " AND "), args...)
+	return err
+}
@@ -0,0 +1,162 @@
+package rbac
+
+import (
+	"errors"
+	"web_app/auth"
+	"web_app/dao/mysql"
+	"web_app/logger"
+	"web_app/response"
+	"web_app/routes"
+	"web_app/validation"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// policy 管理接口中的一条权限
+type policy struct {
+	Role       string `json:"role" binding:"required"`
+	Permission string `json:"permission" binding:"required"`
+}
+
+func init() {
+	routes.RegisterAPI("v1", "rbac", routes.RegistrarFunc(func(r gin.IRouter) error {
+		g := r.Group("/rbac", enabled, auth.Middleware(), RequirePermission(PermissionManage))
+		g.GET("/policies", listPoliciesHandler)
+		g.POST("/policies", grantHandler)
+		g.DELETE("/policies", revokeHandler)
+		g.GET("/users/:id/roles", userRolesHandler)
+		g.POST("/users/:id/roles", assignRoleHandler)
+		g.DELETE("/users/:id/roles/:role", unassignRoleHandler)
+		return nil
+	}))
+}
+
+// enabled 没有启用 rbac 时管理接口返回 404
+func enabled(c *gin.Context) {
+	if current.Load() == nil {
+		response.Error(c, response.CodeNotFound)
+		return
+	}
+	c.Next()
+}
+
+// listPoliciesHandler GET /api/v1/rbac/policies，所有角色的权限
+func listPoliciesHandler(c *gin.Context) {
+	r, err := load()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	rules := r.enforcer.GetPolicy()
+	policies := make([]policy, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) >= 2 {
+			policies = append(policies, policy{Role: rule[0], Permission: rule[1]})
+		}
+	}
+	response.Success(c, gin.H{"policies": policies})
+}
+
+// grantHandler POST /api/v1/rbac/policies {"role": "editor", "permission": "post:*"}
+func grantHandler(c *gin.Context) {
+	var req policy
+	if !validation.Bind(c, &req) {
+		return
+	}
+	added, err := Grant(c.Request.Context(), req.Role, req.Permission)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	logger.FromContext(c).Warn("rbac permission granted", zap.String("role", req.Role), zap.String("permission", req.Permission))
+	response.Success(c, gin.H{"changed": added})
+}
+
+// revokeHandler DELETE /api/v1/rbac/policies {"role": "editor", "permission": "post:*"}
+func revokeHandler(c *gin.Context) {
+	var req policy
+	if !validation.Bind(c, &req) {
+		return
+	}
+	if req.Role == AdminRole && req.Permission == "*" {
+		response.ErrorWithMsg(c, response.CodeInvalidParam, "cannot revoke permissions of the admin role")
+		return
+	}
+	removed, err := Revoke(c.Request.Context(), req.Role, req.Permission)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	logger.FromContext(c).Warn("rbac permission revoked", zap.String("role", req.Role), zap.String("permission", req.Permission))
+	response.Success(c, gin.H{"changed": removed})
+}
+
+// userRolesHandler GET /api/v1/rbac/users/:id/roles，用户的角色和（包括通过角色得到的）所有权限
+func userRolesHandler(c *gin.Context) {
+	r, err := load()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	userID := c.Param("id")
+	roles, err := r.enforcer.GetRolesForUser(userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	rules, err := r.enforcer.GetImplicitPermissionsForUser(userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	perms := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) >= 2 {
+			perms = append(perms, rule[1])
+		}
+	}
+	response.Success(c, gin.H{"roles": roles, "permissions": perms})
+}
+
+// assignRoleHandler POST /api/v1/rbac/users/:id/roles {"role": "editor"}
+func assignRoleHandler(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if !validation.Bind(c, &req) {
+		return
+	}
+	added, err := AssignRole(c.Request.Context(), c.Param("id"), req.Role)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	logger.FromContext(c).Warn("rbac role assigned", zap.String("target_user_id", c.Param("id")), zap.String("role", req.Role))
+	response.Success(c, gin.H{"changed": added})
+}
+
+// unassignRoleHandler DELETE /api/v1/rbac/users/:id/roles/:role
+func unassignRoleHandler(c *gin.Context) {
+	removed, err := UnassignRole(c.Request.Context(), c.Param("id"), c.Param("role"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	logger.FromContext(c).Warn("rbac role unassigned", zap.String("target_user_id", c.Param("id")), zap.String("role", c.Param("role")))
+	response.Success(c, gin.H{"changed": removed})
+}
+
+// respondError 数据库熔断、维护模式交给 middlewares.DBUnavailable 响应 503，其他错误响应 500
+func respondError(c *gin.Context, err error) {
+	if errors.Is(err, ErrDisabled) {
+		response.Error(c, response.CodeNotFound)
+		return
+	}
+	if errors.Is(err, mysql.ErrUnavailable) || errors.Is(err, mysql.ErrReadOnly) {
+		_ = c.Error(err)
+		return
+	}
+	logger.FromContext(c).Error("rbac operation failed", zap.Error(err))
+	response.ErrorWithMsg(c, response.CodeServerBusy, "rbac operation failed")
+}
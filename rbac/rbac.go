@@ -0,0 +1,227 @@
+// Package rbac 基于 Casbin 的角色权限控制：角色拥有权限（例如 post:delete、post:*），用户属于角色，
+// 规则保存在 MySQL 的 casbin_rule 表中并缓存在 Redis 中，通过管理接口修改后所有实例通过 Pub/Sub 重新加载
+//
+//	routes.RegisterAPI("v1", "post", routes.RegistrarFunc(func(r gin.IRouter) error {
+//		g := r.Group("/posts", auth.Middleware())
+//		g.DELETE("/:id", rbac.RequirePermission("post:delete"), deletePost)
+//		return nil
+//	}))
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"web_app/auth"
+	"web_app/dao/mysql"
+	"web_app/logger"
+	"web_app/pubsub"
+	"web_app/response"
+	"web_app/settings"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Config 权限控制配置，对应配置文件中的 rbac
+type Config struct {
+	// Enable 为 false 时 RequirePermission 拒绝所有请求，管理接口返回 404
+	Enable bool `mapstructure:"enable"`
+	// CacheTTL 规则在 Redis 中缓存的时间，0 表示不缓存，每次加载都读取数据库
+	CacheTTL time.Duration `mapstructure:"cache_ttl" validate:"min=0"`
+	// Admins 启动时加入 admin 角色（拥有所有权限）的用户 ID，用于初始化第一个管理员
+	Admins []string `mapstructure:"admins"`
+}
+
+// 配置文件中的 key
+const configKey = "rbac"
+
+const (
+	// AdminRole 拥有所有权限（*）的角色
+	AdminRole = "admin"
+	// PermissionManage 调用管理接口需要的权限
+	PermissionManage = "rbac:manage"
+	// reloadChannel 规则修改之后通知其他实例重新加载的频道
+	reloadChannel = "rbac:reload"
+)
+
+// CodeForbidden 没有权限时响应中的错误码
+var CodeForbidden = response.NewCode("forbidden", http.StatusForbidden, "permission denied")
+
+// modelText 请求为（用户或角色，权限），权限支持 keyMatch 的通配，例如 post:* 匹配 post:delete，* 匹配所有权限
+const modelText = `
+[request_definition]
+r = sub, perm
+
+[policy_definition]
+p = sub, perm
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch(r.perm, p.perm)
+`
+
+// ErrDisabled 没有启用 rbac
+var ErrDisabled = errors.New("rbac is not enabled")
+
+// rbac 启用时的 Enforcer 和 adapter
+type rbac struct {
+	enforcer *casbin.SyncedEnforcer
+	adapter  *adapter
+}
+
+var current atomic.Pointer[rbac]
+
+func init() {
+	settings.Register(configKey, Config{CacheTTL: time.Hour})
+}
+
+// Init 读取 rbac 配置，启用时加载规则并订阅其他实例的修改通知，需要在 mysql.Init、redis.Init 之后、pubsub.Start 之前调用；
+// 表结构见 dao/mysql/migrations/<driver>/00003_create_casbin_rule.sql
+func Init() (err error) {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil || !cfg.Enable {
+		return
+	}
+	db := mysql.Default()
+	if db == nil {
+		return fmt.Errorf("rbac requires mysql to be initialized: %w", mysql.ErrNotInitialized)
+	}
+	m, err := model.NewModelFromString(modelText)
+	if err != nil {
+		return
+	}
+	a := &adapter{db: db, cacheTTL: cfg.CacheTTL}
+	e, err := casbin.NewSyncedEnforcer(m, a)
+	if err != nil {
+		return fmt.Errorf("init casbin enforcer: %w", err)
+	}
+	r := &rbac{enforcer: e, adapter: a}
+	if err = r.bootstrap(cfg.Admins); err != nil {
+		return
+	}
+	current.Store(r)
+	pubsub.Handle(reloadChannel, func(ctx context.Context, msg *pubsub.Message) error {
+		return a.reload(e)
+	})
+	return nil
+}
+
+// bootstrap 确保 admin 角色拥有所有权限，并把 admins 中的用户加入 admin 角色
+func (r *rbac) bootstrap(admins []string) error {
+	changed, err := r.enforcer.AddPolicy(AdminRole, "*")
+	if err != nil {
+		return err
+	}
+	for _, userID := range admins {
+		added, err := r.enforcer.AddRoleForUser(userID, AdminRole)
+		if err != nil {
+			return err
+		}
+		changed = changed || added
+	}
+	if changed {
+		return r.changed(context.Background())
+	}
+	return nil
+}
+
+// changed 规则修改（已经写入数据库）之后删除 Redis 中的缓存并通知其他实例重新加载
+func (r *rbac) changed(ctx context.Context) error {
+	if err := r.adapter.invalidate(ctx); err != nil {
+		return fmt.Errorf("invalidate policy cache: %w", err)
+	}
+	if err := pubsub.Publish(ctx, reloadChannel, ""); err != nil {
+		return fmt.Errorf("notify policy reload: %w", err)
+	}
+	return nil
+}
+
+func load() (*rbac, error) {
+	r := current.Load()
+	if r == nil {
+		return nil, ErrDisabled
+	}
+	return r, nil
+}
+
+// Allowed 用户 userID（直接或者通过角色）是否拥有权限 perm
+func Allowed(userID, perm string) (bool, error) {
+	r, err := load()
+	if err != nil {
+		return false, err
+	}
+	return r.enforcer.Enforce(userID, perm)
+}
+
+// RequirePermission 当前用户拥有权限 perm 时才继续处理，需要放在 auth.Middleware 之后；
+// 没有登录时返回 401 和 {"code": "unauthorized"}，没有权限时返回 403 和 {"code": "forbidden"}
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := auth.UserID(c)
+		if userID == "" {
+			response.ErrorWithMsg(c, auth.CodeUnauthorized, "login required")
+			return
+		}
+		ok, err := Allowed(userID, perm)
+		if err != nil && !errors.Is(err, ErrDisabled) {
+			logger.FromContext(c).Error("check permission failed", zap.String("permission", perm), zap.Error(err))
+		}
+		if !ok {
+			response.ErrorWithMsg(c, CodeForbidden, "permission denied: "+perm)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Grant 给角色 role 加上权限 perm，返回 false 表示已经有这个权限
+func Grant(ctx context.Context, role, perm string) (bool, error) {
+	return modify(ctx, func(e *casbin.SyncedEnforcer) (bool, error) {
+		return e.AddPolicy(role, perm)
+	})
+}
+
+// Revoke 去掉角色 role 的权限 perm，返回 false 表示原本没有这个权限
+func Revoke(ctx context.Context, role, perm string) (bool, error) {
+	return modify(ctx, func(e *casbin.SyncedEnforcer) (bool, error) {
+		return e.RemovePolicy(role, perm)
+	})
+}
+
+// AssignRole 把用户加入角色，返回 false 表示已经在这个角色中
+func AssignRole(ctx context.Context, userID, role string) (bool, error) {
+	return modify(ctx, func(e *casbin.SyncedEnforcer) (bool, error) {
+		return e.AddRoleForUser(userID, role)
+	})
+}
+
+// UnassignRole 把用户移出角色，返回 false 表示原本不在这个角色中
+func UnassignRole(ctx context.Context, userID, role string) (bool, error) {
+	return modify(ctx, func(e *casbin.SyncedEnforcer) (bool, error) {
+		return e.DeleteRoleForUser(userID, role)
+	})
+}
+
+// modify 执行修改（同时写入数据库），有变化时通知其他实例
+func modify(ctx context.Context, fn func(e *casbin.SyncedEnforcer) (bool, error)) (bool, error) {
+	r, err := load()
+	if err != nil {
+		return false, err
+	}
+	ok, err := fn(r.enforcer)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, r.changed(ctx)
+}
@@ -0,0 +1,151 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Code 业务错误码，即响应中的 code，通过 NewCode 注册对应的 HTTP 状态码和默认的提示；
+// Code 实现了 error，handler 可以直接 c.Error(CodeInvalidParam)
+type Code string
+
+// codeInfo 错误码对应的 HTTP 状态码和默认的提示
+type codeInfo struct {
+	status int
+	msg    string
+}
+
+// errorCode RegisterError 注册的错误和错误码
+type errorCode struct {
+	target error
+	code   Code
+}
+
+var (
+	mu         sync.RWMutex
+	codes      = make(map[Code]codeInfo)
+	errorCodes []errorCode
+)
+
+// 内置的错误码
+var (
+	CodeSuccess      = NewCode("success", http.StatusOK, "success")
+	CodeInvalidParam = NewCode("invalid_param", http.StatusBadRequest, "invalid parameter")
+	CodeNotFound     = NewCode("not_found", http.StatusNotFound, "not found")
+	CodeServerBusy   = NewCode("server_busy", http.StatusInternalServerError, "server busy")
+	// CodeTimeout 请求超过 middlewares.Timeout 的超时时间
+	CodeTimeout = NewCode("timeout", http.StatusGatewayTimeout, "request timeout")
+)
+
+func init() {
+	// 超时之后数据库、Redis 等返回的错误
+	RegisterError(context.DeadlineExceeded, CodeTimeout)
+}
+
+// NewCode 注册错误码，一般在模块的包级变量中调用，code 重复时 panic
+//
+//	var CodeUserExist = response.NewCode("user_exist", http.StatusConflict, "username already exists")
+func NewCode(code string, status int, msg string) Code {
+	mu.Lock()
+	defer mu.Unlock()
+	c := Code(code)
+	if _, ok := codes[c]; ok {
+		panic(fmt.Sprintf("response: duplicate code %q", code))
+	}
+	codes[c] = codeInfo{status: status, msg: msg}
+	return c
+}
+
+// RegisterError 把 logic 等层返回的错误映射为错误码：handler c.Error(err) 之后，errors.Is(err, target) 时响应 code，
+// 使 logic 不需要依赖本包；按注册的顺序匹配，在模块的 init 中调用
+func RegisterError(target error, code Code) {
+	mu.Lock()
+	defer mu.Unlock()
+	errorCodes = append(errorCodes, errorCode{target: target, code: code})
+}
+
+func (c Code) info() (codeInfo, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	info, ok := codes[c]
+	return info, ok
+}
+
+// Status 错误码对应的 HTTP 状态码，没有注册时为 500
+func (c Code) Status() int {
+	if info, ok := c.info(); ok {
+		return info.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Msg 错误码默认的提示，没有注册时为错误码本身
+func (c Code) Msg() string {
+	if info, ok := c.info(); ok {
+		return info.msg
+	}
+	return string(c)
+}
+
+func (c Code) Error() string {
+	return c.Msg()
+}
+
+// WithMsg 使用 msg 代替默认的提示
+func (c Code) WithMsg(msg string) *CodeError {
+	return &CodeError{Code: c, Msg: msg}
+}
+
+// Wrap 响应错误码和默认的提示，err 只记录在日志中，不返回给客户端
+func (c Code) Wrap(err error) *CodeError {
+	return &CodeError{Code: c, Err: err}
+}
+
+// CodeError 带有错误码的错误，Msg 为空时使用错误码默认的提示
+type CodeError struct {
+	Code Code
+	Msg  string
+	Err  error
+}
+
+func (e *CodeError) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Err.Error()
+	}
+	return string(e.Code) + ": " + e.msg()
+}
+
+func (e *CodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CodeError) msg() string {
+	if e.Msg != "" {
+		return e.Msg
+	}
+	return e.Code.Msg()
+}
+
+// resolve err 对应的错误码和提示：*CodeError、Code、RegisterError 注册的错误，其他错误为 CodeServerBusy
+func resolve(err error) (Code, string) {
+	var e *CodeError
+	if errors.As(err, &e) {
+		return e.Code, e.msg()
+	}
+	var c Code
+	if errors.As(err, &c) {
+		return c, c.Msg()
+	}
+	mu.RLock()
+	ecs := errorCodes
+	mu.RUnlock()
+	for _, ec := range ecs {
+		if errors.Is(err, ec.target) {
+			return ec.code, ec.code.Msg()
+		}
+	}
+	return CodeServerBusy, CodeServerBusy.Msg()
+}
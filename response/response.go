@@ -0,0 +1,65 @@
+// Package response 统一的响应格式 {"code": "...", "msg": "...", "data": ...} 和业务错误码：
+// 成功时调用 Success，失败时调用 Error，或者 c.Error(err) 之后直接返回，由 Middleware 按错误码响应
+//
+//	var CodeUserExist = response.NewCode("user_exist", http.StatusConflict, "username already exists")
+//
+//	func init() {
+//		response.RegisterError(logic.ErrUserExist, CodeUserExist)
+//	}
+//
+//	func SignUpHandler(c *gin.Context) {
+//		var p models.ParamSignUp
+//		if !validation.Bind(c, &p) {
+//			return
+//		}
+//		u, err := logic.SignUp(c.Request.Context(), &p)
+//		if err != nil {
+//			_ = c.Error(err)
+//			return
+//		}
+//		response.Success(c, u)
+//	}
+package response
+
+import "github.com/gin-gonic/gin"
+
+// Body 响应的内容，成功时 Code 为 CodeSuccess
+type Body struct {
+	Code Code        `json:"code"`
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Success 响应 200 和 data
+func Success(c *gin.Context, data interface{}) {
+	c.JSON(CodeSuccess.Status(), Body{Code: CodeSuccess, Msg: CodeSuccess.Msg(), Data: data})
+}
+
+// Error 按错误码的 HTTP 状态码响应，msg 为错误码默认的提示，并终止后续的处理函数
+func Error(c *gin.Context, code Code) {
+	ErrorWithMsg(c, code, code.Msg())
+}
+
+// ErrorWithMsg 按错误码的 HTTP 状态码响应，使用 msg 代替默认的提示，例如参数校验失败的原因
+func ErrorWithMsg(c *gin.Context, code Code, msg string) {
+	c.AbortWithStatusJSON(code.Status(), Body{Code: code, Msg: msg})
+}
+
+// ErrorWithData 同 ErrorWithMsg，data 为错误的详情，例如参数校验失败的每个字段，见 validation.Bind
+func ErrorWithData(c *gin.Context, code Code, msg string, data interface{}) {
+	c.AbortWithStatusJSON(code.Status(), Body{Code: code, Msg: msg, Data: data})
+}
+
+// Middleware handler 通过 c.Error(err) 返回错误并且没有写入响应时，按最后一个错误对应的错误码（见 RegisterError）响应，
+// 没有对应的错误码时响应 500 和 server_busy，错误详情只记录在访问日志中；需要放在 middlewares.DBUnavailable 之前，
+// 数据库熔断、维护模式的错误由 DBUnavailable 响应
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Written() || len(c.Errors) == 0 {
+			return
+		}
+		code, msg := resolve(c.Errors.Last().Err)
+		ErrorWithMsg(c, code, msg)
+	}
+}
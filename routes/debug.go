@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"net/http"
+	"web_app/dao/mysql"
+	"web_app/logger"
+	"web_app/response"
+	"web_app/settings"
+	"web_app/validation"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// debugConfigHandler 返回当前生效的配置及每个配置项的来源，敏感信息已脱敏
+// 生产环境（app.mode 为 release）下不开放
+func debugConfigHandler(c *gin.Context) {
+	cfg := settings.Current()
+	if cfg == nil || cfg.App.Mode == gin.ReleaseMode {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	response.Success(c, gin.H{
+		"config_file": cfg.ConfigFile(),
+		"entries":     settings.Dump(),
+	})
+}
+
+// logLevelHandler 查看（GET）和修改（PUT）日志级别，?logger=access 对应访问日志
+// 排查线上问题时可以临时调到 debug，修改只在当前实例生效，重启后恢复为配置中的级别
+// 请求需要带有 app.debug_token，见 debugAuth
+func logLevelHandler(c *gin.Context) {
+	name := c.Query("logger")
+	h := logger.LevelHandler(name)
+	if h == nil {
+		response.ErrorWithMsg(c, response.CodeInvalidParam, "unknown logger "+name)
+		return
+	}
+	h.ServeHTTP(c.Writer, c.Request)
+	if c.Request.Method == http.MethodPut && c.Writer.Status() == http.StatusOK {
+		logger.FromContext(c).Warn("log level changed by api", zap.String("logger", name), zap.String("ip", c.ClientIP()))
+	}
+}
+
+// readOnlyHandler 查看（GET）和切换（PUT {"read_only": true}）数据库的维护模式，修改只在当前实例生效，
+// 配置中的 mysql.read_only 变化时会覆盖这里的修改；请求需要带有 app.debug_token，见 debugAuth
+func readOnlyHandler(c *gin.Context) {
+	if c.Request.Method == http.MethodPut {
+		var req struct {
+			ReadOnly *bool `json:"read_only" binding:"required"`
+		}
+		if !validation.Bind(c, &req) {
+			return
+		}
+		if err := mysql.SetReadOnly(*req.ReadOnly); err != nil {
+			response.ErrorWithMsg(c, response.CodeServerBusy, err.Error())
+			return
+		}
+		logger.FromContext(c).Warn("mysql read-only mode changed by api", zap.Bool("read_only", *req.ReadOnly), zap.String("ip", c.ClientIP()))
+	}
+	response.Success(c, gin.H{"read_only": mysql.ReadOnly()})
+}
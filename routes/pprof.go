@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+	"web_app/logger"
+	"web_app/response"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// recentGCPauses /debug/runtime 返回的最近几次 GC 的停顿时间
+const recentGCPauses = 10
+
+// pprofAuth app.enable_pprof 为 true 且请求带有 app.debug_token 时才允许访问 /debug/pprof、/debug/runtime，没有开启时返回 404
+func pprofAuth(c *gin.Context) {
+	cfg := settings.Current()
+	if cfg == nil || !cfg.App.EnablePprof {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	debugAuth(c)
+}
+
+// debugAuth 请求带有 app.debug_token 时才允许访问 /debug 下的运维接口，没有设置 debug_token 时返回 404，token 错误时返回 401；
+// token 通过 Authorization: Bearer <token> 或者 ?token=<token> 传入，go tool pprof 不能设置请求头时使用后者
+func debugAuth(c *gin.Context) {
+	cfg := settings.Current()
+	if cfg == nil || cfg.App.DebugToken == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		token = c.Query("token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.App.DebugToken)) != 1 {
+		logger.FromContext(c).Warn("debug endpoint access denied", zap.String("path", c.Request.URL.Path), zap.String("ip", c.ClientIP()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Next()
+}
+
+// pprofHandler net/http/pprof 的各个 profile，例如 /debug/pprof/heap、/debug/pprof/profile?seconds=30
+func pprofHandler(c *gin.Context) {
+	switch name := strings.TrimPrefix(c.Param("name"), "/"); name {
+	case "":
+		pprof.Index(c.Writer, c.Request)
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// runtimeHandler 返回 goroutine 数量、堆内存和 GC 的统计，ReadMemStats 会短暂地暂停所有 goroutine，不要高频调用
+func runtimeHandler(c *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	n := int(m.NumGC)
+	if n > recentGCPauses {
+		n = recentGCPauses
+	}
+	// PauseNs 是长度为 256 的环形缓冲区，最近一次 GC 在 (NumGC+255)%256
+	pauses := make([]string, n)
+	for i := range pauses {
+		pauses[i] = time.Duration(m.PauseNs[(int(m.NumGC)-i+255)%len(m.PauseNs)]).String()
+	}
+	var lastGC string
+	if m.LastGC > 0 {
+		lastGC = time.Unix(0, int64(m.LastGC)).Format(time.RFC3339Nano)
+	}
+	response.Success(c, gin.H{
+		"go_version": runtime.Version(),
+		"goroutines": runtime.NumGoroutine(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"num_cpu":    runtime.NumCPU(),
+		"heap": gin.H{
+			"alloc_bytes":    m.HeapAlloc,
+			"inuse_bytes":    m.HeapInuse,
+			"idle_bytes":     m.HeapIdle,
+			"released_bytes": m.HeapReleased,
+			"objects":        m.HeapObjects,
+			"sys_bytes":      m.Sys,
+		},
+		"gc": gin.H{
+			"num_gc":        m.NumGC,
+			"num_forced_gc": m.NumForcedGC,
+			"pause_total":   time.Duration(m.PauseTotalNs).String(),
+			"recent_pauses": pauses,
+			"last_gc":       lastGC,
+			"next_gc_bytes": m.NextGC,
+			"cpu_fraction":  m.GCCPUFraction,
+		},
+	})
+}
@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteRegistrar 功能模块注册自己的路由和中间件，在模块的 init 中通过 Register 注册，Setup 时调用，
+// 新增模块不需要修改 Setup
+//
+//	func init() {
+//		routes.Register("post", routes.RegistrarFunc(func(r gin.IRouter) error {
+//			g := r.Group("/api/v1/posts", auth.Middleware())
+//			g.GET("/:id", getPost)
+//			return nil
+//		}))
+//	}
+type RouteRegistrar interface {
+	// RegisterRoutes 在 r 上注册路由，模块自己的中间件通过 r.Group(path, ...) 只作用于模块的路由；返回错误时启动失败
+	RegisterRoutes(r gin.IRouter) error
+}
+
+// RegistrarFunc 把函数转换为 RouteRegistrar
+type RegistrarFunc func(r gin.IRouter) error
+
+// RegisterRoutes 调用 f(r)
+func (f RegistrarFunc) RegisterRoutes(r gin.IRouter) error {
+	return f(r)
+}
+
+var (
+	registrarsMu sync.Mutex
+	registrars   = make(map[string]RouteRegistrar)
+)
+
+// Register 注册名为 name 的模块的路由，Setup 按名称的顺序调用，名称重复时 panic
+func Register(name string, r RouteRegistrar) {
+	registrarsMu.Lock()
+	defer registrarsMu.Unlock()
+	if _, ok := registrars[name]; ok {
+		panic(fmt.Sprintf("routes: duplicate registrar %q", name))
+	}
+	registrars[name] = r
+}
+
+// registerModules 按名称的顺序调用所有注册的 RouteRegistrar
+func registerModules(r gin.IRouter) error {
+	registrarsMu.Lock()
+	names := make([]string, 0, len(registrars))
+	for name := range registrars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]RouteRegistrar, len(names))
+	for i, name := range names {
+		list[i] = registrars[name]
+	}
+	registrarsMu.Unlock()
+	for i, reg := range list {
+		if err := reg.RegisterRoutes(r); err != nil {
+			return fmt.Errorf("register routes of %s: %w", names[i], err)
+		}
+	}
+	return nil
+}
@@ -1,18 +1,71 @@
 package routes
 
 import (
+	"fmt"
 	"net/http"
+	"web_app/audit"
+	"web_app/featureflag"
+	"web_app/health"
 	"web_app/logger"
+	"web_app/middlewares"
+	"web_app/response"
+	"web_app/sessions"
+	"web_app/settings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func Setup() *gin.Engine {
+// Setup 按配置创建 gin.Engine：app.mode 为 release、test 时使用 gin 对应的模式，其他（例如 dev）为 debug 模式；
+// 注册公共的中间件和内置的路由之后，再创建各 API 版本的路由组，调用各模块通过 RegisterAPI、Register 注册的路由
+func Setup(cfg *settings.Config) (*gin.Engine, error) {
+	gin.SetMode(ginMode(cfg.App.Mode))
 	r := gin.New()
-	r.Use(logger.GinLogger(), logger.GinRecovery(true))
+	// 默认信任所有代理时客户端可以伪造 X-Forwarded-For，绕过按 IP 的限流、伪造访问日志和审计记录中的 IP
+	trusted := cfg.App.TrustedProxies
+	if len(trusted) == 0 {
+		trusted = nil
+	}
+	if err := r.SetTrustedProxies(trusted); err != nil {
+		return nil, fmt.Errorf("invalid app.trusted_proxies: %w", err)
+	}
+	r.Use(middlewares.RequestID(), middlewares.Metrics(), middlewares.TraceContext(), logger.GinLogger(), middlewares.CORS(), audit.Middleware(), logger.GinRecovery(true), logger.BodyLogger(), middlewares.InFlight(), middlewares.Timeout(), response.Middleware(), middlewares.DBUnavailable(), featureflag.Middleware(nil), sessions.Middleware())
 
 	r.GET("/", func(context *gin.Context) {
 		context.String(http.StatusOK, "OK")
 	})
-	return r
+
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/liveness", health.LivenessHandler)
+	r.GET("/readiness", health.ReadinessHandler)
+	r.GET("/healthz", health.LivenessHandler)
+	r.GET("/readyz", health.ReadinessHandler)
+	r.GET("/debug/config", debugConfigHandler)
+	ops := r.Group("/debug", debugAuth)
+	ops.GET("/loglevel", logLevelHandler)
+	ops.PUT("/loglevel", logLevelHandler)
+	ops.GET("/readonly", readOnlyHandler)
+	ops.PUT("/readonly", readOnlyHandler)
+	debug := r.Group("/debug", pprofAuth)
+	debug.GET("/pprof/*name", pprofHandler)
+	debug.POST("/pprof/symbol", pprofHandler)
+	debug.GET("/runtime", runtimeHandler)
+
+	if err := registerAPIs(r); err != nil {
+		return nil, err
+	}
+	if err := registerModules(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ginMode app.mode 对应的 gin 模式
+func ginMode(mode string) string {
+	switch mode {
+	case gin.ReleaseMode, gin.TestMode:
+		return mode
+	default:
+		return gin.DebugMode
+	}
 }
@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"fmt"
+	"sort"
+	"web_app/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiVersion 一个 API 版本的公共中间件和各模块在这个版本中的路由
+type apiVersion struct {
+	// declared 通过 APIVersion 声明过，只有 RegisterAPI 时 Setup 返回错误
+	declared    bool
+	middlewares []gin.HandlerFunc
+	registrars  map[string]RouteRegistrar
+}
+
+var versions = make(map[string]*apiVersion)
+
+func init() {
+	APIVersion("v1")
+}
+
+// APIVersion 声明 API 版本 version，Setup 时创建 /api/<version> 路由组，mw 为这个版本所有接口公共的中间件；
+// 可以多次调用，中间件按调用的顺序执行。v1 已经声明，例如新增 v2 并废弃整个 v1：
+//
+//	routes.APIVersion("v2", authV2())
+//	routes.APIVersion("v1", middlewares.Deprecated(middlewares.Deprecation{Sunset: sunset, Link: "https://example.com/docs/v2"}))
+func APIVersion(version string, mw ...gin.HandlerFunc) {
+	registrarsMu.Lock()
+	defer registrarsMu.Unlock()
+	v := lookupVersion(version)
+	v.declared = true
+	v.middlewares = append(v.middlewares, mw...)
+}
+
+// RegisterAPI 注册模块 name 在 API 版本 version 中的路由，r 为已经带有版本公共中间件的 /api/<version> 路由组，
+// 路由的路径不包括 /api/<version>；同一个模块的不同版本分别注册，新版本的不兼容修改不影响旧版本。
+// 同一个版本中名称重复时 panic，version 没有通过 APIVersion 声明时 Setup 返回错误
+//
+//	routes.RegisterAPI("v2", "post", routes.RegistrarFunc(func(r gin.IRouter) error {
+//		r.GET("/posts/:id", getPostV2)
+//		return nil
+//	}))
+func RegisterAPI(version, name string, r RouteRegistrar) {
+	registrarsMu.Lock()
+	defer registrarsMu.Unlock()
+	v := lookupVersion(version)
+	if _, ok := v.registrars[name]; ok {
+		panic(fmt.Sprintf("routes: duplicate registrar %q for api %s", name, version))
+	}
+	v.registrars[name] = r
+}
+
+// lookupVersion 返回 version，不存在时创建，调用前需要持有 registrarsMu
+func lookupVersion(version string) *apiVersion {
+	v, ok := versions[version]
+	if !ok {
+		// 其他包 init 的顺序不确定，RegisterAPI 可能在 APIVersion 之前调用
+		v = &apiVersion{registrars: make(map[string]RouteRegistrar)}
+		versions[version] = v
+	}
+	return v
+}
+
+// registerAPIs 按版本的顺序创建 /api/<version> 路由组，并按名称的顺序调用各模块注册的 RouteRegistrar
+func registerAPIs(r gin.IRouter) error {
+	registrarsMu.Lock()
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	registrarsMu.Unlock()
+	sort.Strings(names)
+	for _, version := range names {
+		registrarsMu.Lock()
+		v := versions[version]
+		declared, mw := v.declared, v.middlewares
+		modules := make([]string, 0, len(v.registrars))
+		for name := range v.registrars {
+			modules = append(modules, name)
+		}
+		sort.Strings(modules)
+		list := make([]RouteRegistrar, len(modules))
+		for i, name := range modules {
+			list[i] = v.registrars[name]
+		}
+		registrarsMu.Unlock()
+		if !declared {
+			return fmt.Errorf("api version %s is not declared, call routes.APIVersion(%q) first", version, version)
+		}
+		version := version
+		g := r.Group("/api/"+version, func(c *gin.Context) {
+			c.Set(middlewares.APIVersionKey, version)
+			c.Next()
+		})
+		g.Use(mw...)
+		for i, reg := range list {
+			if err := reg.RegisterRoutes(g); err != nil {
+				return fmt.Errorf("register routes of %s for api %s: %w", modules[i], version, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+// Package sessions 保存在 Redis 中的服务端会话，浏览器的 cookie 中只有随机的会话 ID，需要传统会话而不是 JWT 的应用使用
+//
+//	func login(c *gin.Context) {
+//		s := sessions.Get(c)
+//		s.Renew() // 登录后更换会话 ID，防止会话固定攻击
+//		_ = s.Set("user_id", user.ID)
+//	}
+//	func profile(c *gin.Context) {
+//		var userID int64
+//		if ok, _ := sessions.Get(c).Get("user_id", &userID); !ok {
+//			c.AbortWithStatus(http.StatusUnauthorized)
+//			return
+//		}
+//	}
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"web_app/dao/redis"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Config 会话配置，对应配置文件中的 sessions
+type Config struct {
+	// Enable 为 false 时 Middleware 不做任何事，Get 返回 nil
+	Enable bool `mapstructure:"enable"`
+	// Prefix 会话在 Redis 中的 key 的前缀（在 redis.key_prefix 之后）
+	Prefix     string `mapstructure:"prefix"`
+	CookieName string `mapstructure:"cookie_name" validate:"required"`
+	Path       string `mapstructure:"path"`
+	Domain     string `mapstructure:"domain"`
+	// Secure 只通过 HTTPS 发送 cookie，本地使用 HTTP 开发时关闭
+	Secure bool `mapstructure:"secure"`
+	// HTTPOnly 禁止 JavaScript 读取 cookie
+	HTTPOnly bool   `mapstructure:"http_only"`
+	SameSite string `mapstructure:"same_site" validate:"oneof=lax strict none"`
+	// IdleTimeout 超过该时间没有请求时会话过期，每次请求都会重新计时
+	IdleTimeout time.Duration `mapstructure:"idle_timeout" validate:"min=1s"`
+	// AbsoluteTimeout 会话创建之后最长的有效期，不受请求的影响，0 表示不限制
+	AbsoluteTimeout time.Duration `mapstructure:"absolute_timeout" validate:"min=0"`
+}
+
+// 配置文件中的 key
+const configKey = "sessions"
+
+// ctxKey gin.Context 中保存会话的 key
+const ctxKey = "web_app/sessions"
+
+var defaults = Config{
+	Prefix:          "session:",
+	CookieName:      "session_id",
+	Path:            "/",
+	Secure:          true,
+	HTTPOnly:        true,
+	SameSite:        "lax",
+	IdleTimeout:     30 * time.Minute,
+	AbsoluteTimeout: 24 * time.Hour,
+}
+
+var current atomic.Pointer[Config]
+
+func init() {
+	settings.Register(configKey, defaults)
+}
+
+// Init 读取会话配置，并在配置热加载时更新
+func Init() (err error) {
+	if err = load(); err != nil {
+		return
+	}
+	settings.OnChange(func(settings.Config) {
+		if err := load(); err != nil {
+			logger.Named("sessions").Error("reload sessions config failed", zap.Error(err))
+		}
+	})
+	return
+}
+
+func load() error {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil {
+		return err
+	}
+	current.Store(cfg)
+	return nil
+}
+
+// record 保存在 Redis 中的会话内容
+type record struct {
+	Values    map[string]json.RawMessage `json:"values"`
+	CreatedAt int64                      `json:"created_at"`
+}
+
+// Session 一个请求的会话，只在处理请求的 goroutine 中使用
+type Session struct {
+	c   *gin.Context
+	cfg *Config
+	id  string
+	rec record
+	// loaded 从 Redis 中读取到了会话
+	loaded bool
+	dirty  bool
+	// oldID Renew、Destroy 之前的 ID，保存时删除
+	oldID string
+}
+
+// Get 返回请求的会话，没有启用会话或者没有使用 Middleware 时返回 nil
+func Get(c *gin.Context) *Session {
+	if v, ok := c.Get(ctxKey); ok {
+		return v.(*Session)
+	}
+	return nil
+}
+
+// Middleware 从 cookie 中读取会话 ID 并从 Redis 中加载会话，请求结束后保存修改并刷新过期时间；
+// 没有写入过值的新会话不保存，也不下发 cookie
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := current.Load()
+		if cfg == nil || !cfg.Enable {
+			c.Next()
+			return
+		}
+		s := &Session{c: c, cfg: cfg, rec: record{Values: make(map[string]json.RawMessage)}}
+		if id, err := c.Cookie(cfg.CookieName); err == nil && id != "" {
+			s.load(c.Request.Context(), id)
+		}
+		if s.loaded {
+			// 滑动过期：每次请求都刷新 cookie 的有效期
+			s.setCookie()
+		}
+		c.Set(ctxKey, s)
+		c.Next()
+		s.save()
+	}
+}
+
+// load 读取会话，不存在或者超过 absolute_timeout 时作为新会话
+func (s *Session) load(ctx context.Context, id string) {
+	client := redis.Client()
+	if client == nil {
+		return
+	}
+	b, err := client.Get(ctx, s.key(id)).Bytes()
+	if err != nil {
+		if !errors.Is(err, goredis.Nil) {
+			logger.FromContext(ctx).Warn("load session failed", zap.Error(err))
+		}
+		return
+	}
+	var rec record
+	if err = json.Unmarshal(b, &rec); err != nil {
+		logger.FromContext(ctx).Warn("decode session failed", zap.Error(err))
+		return
+	}
+	if s.expired(rec.CreatedAt) {
+		s.oldID = id
+		return
+	}
+	if rec.Values == nil {
+		rec.Values = make(map[string]json.RawMessage)
+	}
+	s.id, s.rec, s.loaded = id, rec, true
+}
+
+// ID 会话 ID，新会话写入值之前为空
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew 是否为本次请求新建的会话
+func (s *Session) IsNew() bool {
+	return !s.loaded
+}
+
+// Get 把 key 的值反序列化到 v 中，key 不存在时返回 false
+func (s *Session) Get(key string, v interface{}) (ok bool, err error) {
+	raw, ok := s.rec.Values[key]
+	if !ok {
+		return
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Set 把 v 序列化为 JSON 保存到会话中，请求结束时写入 Redis
+func (s *Session) Set(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.ensureID()
+	s.rec.Values[key] = b
+	s.dirty = true
+	return nil
+}
+
+// Delete 删除会话中的 key
+func (s *Session) Delete(key string) {
+	if _, ok := s.rec.Values[key]; ok {
+		delete(s.rec.Values, key)
+		s.dirty = true
+	}
+}
+
+// Renew 更换会话 ID 并保留其中的值，登录、提升权限之后调用，防止会话固定攻击；absolute_timeout 重新计时
+func (s *Session) Renew() {
+	if s.id != "" && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = ""
+	s.rec.CreatedAt = 0
+	s.ensureID()
+	s.dirty = true
+}
+
+// Destroy 删除会话并清除 cookie，退出登录时调用；之后再 Set 时创建新的会话
+func (s *Session) Destroy() {
+	if s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id, s.loaded, s.dirty = "", false, false
+	s.rec = record{Values: make(map[string]json.RawMessage)}
+	http.SetCookie(s.c.Writer, s.cookie("", -1))
+}
+
+// ensureID 新会话第一次写入时生成 ID 并下发 cookie，cookie 必须在处理函数写入响应之前设置
+func (s *Session) ensureID() {
+	if s.id != "" {
+		return
+	}
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	s.id = hex.EncodeToString(b)
+	s.rec.CreatedAt = time.Now().Unix()
+	s.setCookie()
+}
+
+// save 请求结束后把修改写入 Redis，没有修改时只刷新过期时间
+func (s *Session) save() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client := redis.Client()
+	if client == nil {
+		return
+	}
+	var errs []error
+	if s.oldID != "" {
+		errs = append(errs, client.Del(ctx, s.key(s.oldID)).Err())
+	}
+	switch {
+	case s.dirty:
+		b, err := json.Marshal(&s.rec)
+		if err == nil {
+			err = client.Set(ctx, s.key(s.id), b, s.ttl()).Err()
+		}
+		errs = append(errs, err)
+	case s.loaded:
+		errs = append(errs, client.Expire(ctx, s.key(s.id), s.ttl()).Err())
+	}
+	if err := errors.Join(errs...); err != nil {
+		logger.FromContext(s.c.Request.Context()).Error("save session failed", zap.Error(err))
+	}
+}
+
+// ttl 会话剩余的有效期，idle_timeout 和 absolute_timeout 中较小的一个
+func (s *Session) ttl() time.Duration {
+	ttl := s.cfg.IdleTimeout
+	if s.cfg.AbsoluteTimeout > 0 {
+		if left := time.Until(time.Unix(s.rec.CreatedAt, 0).Add(s.cfg.AbsoluteTimeout)); left < ttl {
+			ttl = left
+		}
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return ttl
+}
+
+func (s *Session) expired(createdAt int64) bool {
+	return s.cfg.AbsoluteTimeout > 0 && time.Since(time.Unix(createdAt, 0)) >= s.cfg.AbsoluteTimeout
+}
+
+func (s *Session) setCookie() {
+	http.SetCookie(s.c.Writer, s.cookie(s.id, int(s.ttl().Seconds())))
+}
+
+func (s *Session) cookie(value string, maxAge int) *http.Cookie {
+	sameSite := map[string]http.SameSite{"lax": http.SameSiteLaxMode, "strict": http.SameSiteStrictMode, "none": http.SameSiteNoneMode}
+	return &http.Cookie{
+		Name:     s.cfg.CookieName,
+		Value:    value,
+		Path:     s.cfg.Path,
+		Domain:   s.cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.cfg.Secure,
+		HttpOnly: s.cfg.HTTPOnly,
+		SameSite: sameSite[s.cfg.SameSite],
+	}
+}
+
+func (s *Session) key(id string) string {
+	return redis.Key(s.cfg.Prefix + id)
+}
@@ -0,0 +1,19 @@
+package settings
+
+import "time"
+
+// AlertConfig 错误告警，webhook 为空表示不启用
+// level 及以上级别且匹配过滤条件的日志会发送到 Slack、钉钉或飞书机器人
+type AlertConfig struct {
+	Provider string `mapstructure:"provider" validate:"omitempty,oneof=slack dingtalk feishu"` // 默认 slack
+	Webhook  string `mapstructure:"webhook" validate:"omitempty,url"`
+	Secret   string `mapstructure:"secret"`                                                         // 钉钉、飞书机器人开启签名校验时的密钥
+	Level    string `mapstructure:"level" validate:"omitempty,oneof=warn error dpanic panic fatal"` // 默认 error
+	// Include 日志内容匹配其中任意一个正则表达式时才告警，为空表示全部告警
+	Include []string `mapstructure:"include" validate:"dive,regexp"`
+	// Exclude 日志内容匹配其中任意一个正则表达式时不告警
+	Exclude []string `mapstructure:"exclude" validate:"dive,regexp"`
+	// Throttle 相同的日志（内容和调用位置相同）在这段时间内只告警一次，默认 5m
+	Throttle time.Duration `mapstructure:"throttle" validate:"min=0"`
+	Timeout  time.Duration `mapstructure:"timeout" validate:"min=0"` // 默认 5s
+}
@@ -0,0 +1,24 @@
+package settings
+
+import "time"
+
+// LogArchiveConfig 把轮转后的日志文件压缩并上传到对象存储（S3、阿里云 OSS、MinIO 等兼容 S3 协议的服务），bucket 为空表示不启用
+// 应用日志、访问日志和审计日志轮转出来的文件都会上传，修改后需要重启服务
+type LogArchiveConfig struct {
+	Endpoint  string `mapstructure:"endpoint" validate:"required_with=Bucket"` // 例如 s3.amazonaws.com、oss-cn-hangzhou.aliyuncs.com、127.0.0.1:9000
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+	// Prefix 对象名的前缀，对象名为 prefix/主机名/文件名，默认为 app.name
+	Prefix string `mapstructure:"prefix"`
+	// Compress 上传前使用 gzip 压缩
+	Compress bool `mapstructure:"compress"`
+	// KeepLocal 上传成功后保留本地文件，由各自的 max_backups、max_age 清理，默认上传后删除
+	KeepLocal bool `mapstructure:"keep_local"`
+	// Interval 检查轮转文件的间隔，默认 1m
+	Interval time.Duration `mapstructure:"interval" validate:"min=0"`
+	// RetentionDays 对象存储中的日志保留的天数，0 表示不清理（也可以使用 bucket 的生命周期规则）
+	RetentionDays int `mapstructure:"retention_days" validate:"min=0"`
+}
@@ -0,0 +1,30 @@
+package settings
+
+// AuditConfig 审计日志，记录谁（用户 ID）在什么时间、从哪里（IP）做了什么操作（方法、路由、资源 ID）
+// 审计日志写入单独轮转的文件，table 不为空时同时写入 MySQL，修改后需要重启服务
+type AuditConfig struct {
+	Enable     bool   `mapstructure:"enable"`
+	Filename   string `mapstructure:"filename" validate:"required_if=Enable true"`
+	MaxSize    int    `mapstructure:"max_size" validate:"min=0"`
+	MaxAge     int    `mapstructure:"max_age" validate:"min=0"`
+	MaxBackups int    `mapstructure:"max_backups" validate:"min=0"`
+	Rotation   string `mapstructure:"rotation" validate:"omitempty,oneof=size daily hourly"`
+	// Table 不为空时审计记录同时写入 MySQL 的这张表
+	Table string `mapstructure:"table"`
+	// Methods 需要审计的请求方法，默认为 POST、PUT、PATCH、DELETE
+	Methods []string `mapstructure:"methods" validate:"dive,oneof=GET HEAD POST PUT PATCH DELETE OPTIONS"`
+	// SkipPaths 不审计的路由，例如登录接口
+	SkipPaths []string `mapstructure:"skip_paths"`
+	// ResourceParams 依次从这些路由参数中取资源 ID，默认为 id
+	ResourceParams []string `mapstructure:"resource_params"`
+	// Mutations 数据变更记录，与 enable 相互独立
+	Mutations AuditMutationsConfig `mapstructure:"mutations"`
+}
+
+// AuditMutationsConfig 数据变更记录：通过 mysql.Repository 的每次写入（表、主键、操作人、写入前后的数据）异步写入 MySQL
+type AuditMutationsConfig struct {
+	Enable bool   `mapstructure:"enable"`
+	Table  string `mapstructure:"table" validate:"required_if=Enable true"`
+	// Tables 需要记录的表，为空时记录所有表
+	Tables []string `mapstructure:"tables"`
+}
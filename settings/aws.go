@@ -0,0 +1,65 @@
+package settings
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// AWSSecretsConfig AWS Secrets Manager 配置
+// 配置中形如 aws-sm:webapp/prod#mysql_password 的值会从 Secrets Manager 中读取，# 后面为 JSON 中的字段名
+// 凭证使用 SDK 默认的查找顺序（环境变量、共享配置文件、IAM 角色等）
+type AWSSecretsConfig struct {
+	Region   string `mapstructure:"region"`
+	Profile  string `mapstructure:"profile"`
+	Endpoint string `mapstructure:"endpoint"` // 可选，例如本地调试时使用 localstack
+}
+
+func init() {
+	registerResolver("aws-sm", newAWSResolver)
+}
+
+type awsResolver struct {
+	client *secretsmanager.Client
+}
+
+func newAWSResolver(cfg *Config) (SecretResolver, error) {
+	ac := cfg.Secrets.AWS
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var opts []func(*config.LoadOptions) error
+	if ac.Region != "" {
+		opts = append(opts, config.WithRegion(ac.Region))
+	}
+	if ac.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(ac.Profile))
+	}
+	conf, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	client := secretsmanager.NewFromConfig(conf, func(o *secretsmanager.Options) {
+		if ac.Endpoint != "" {
+			o.EndpointResolver = secretsmanager.EndpointResolverFromURL(ac.Endpoint)
+		}
+	})
+	return &awsResolver{client: client}, nil
+}
+
+func (r *awsResolver) Resolve(ref string) (string, error) {
+	name, field := splitRef(ref)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := r.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	value := aws.ToString(out.SecretString)
+	if out.SecretString == nil {
+		value = string(out.SecretBinary)
+	}
+	return jsonField(value, field)
+}
@@ -0,0 +1,26 @@
+package settings
+
+import (
+	"bytes"
+	_ "embed"
+
+	"github.com/spf13/viper"
+)
+
+// defaultConfig 内嵌的默认配置，没有配置文件时也能直接启动
+//
+//go:embed default.yaml
+var defaultConfig []byte
+
+// setupDefaults 把内嵌的默认配置设置为 viper 的默认值，优先级低于配置文件、环境变量和命令行参数
+func setupDefaults() (err error) {
+	dv := viper.New()
+	dv.SetConfigType("yaml")
+	if err = dv.ReadConfig(bytes.NewReader(defaultConfig)); err != nil {
+		return
+	}
+	for _, key := range dv.AllKeys() {
+		viper.SetDefault(key, dv.Get(key))
+	}
+	return
+}
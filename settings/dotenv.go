@@ -0,0 +1,36 @@
+package settings
+
+import (
+	"errors"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// DotenvFile 本地开发时使用的 .env 文件，在工作目录中查找
+var DotenvFile = ".env"
+
+// dotenvVars 从 .env 文件加载到环境变量中的变量名
+var dotenvVars = make(map[string]bool)
+
+// loadDotenv 把 .env 文件中的变量加载到进程的环境变量中，文件不存在时忽略
+// 已经存在的环境变量不会被覆盖，所以优先级为 环境变量 > .env > 配置文件 > 默认值
+func loadDotenv() error {
+	vars, err := godotenv.Read(DotenvFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for k, v := range vars {
+		if _, ok := os.LookupEnv(k); ok {
+			continue
+		}
+		if err = os.Setenv(k, v); err != nil {
+			return err
+		}
+		dotenvVars[k] = true
+	}
+	return nil
+}
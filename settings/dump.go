@@ -0,0 +1,120 @@
+package settings
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// 配置项的来源，优先级从高到低
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceDotenv  = "dotenv"
+	SourceRemote  = "remote"
+	SourceOverlay = "overlay"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+// Entry 一个生效的配置项
+type Entry struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// current 当前生效的配置，配置热加载之后会被替换
+var current atomic.Pointer[Config]
+
+// Current 返回当前生效的配置，Init 之前调用返回 nil
+func Current() *Config {
+	return current.Load()
+}
+
+// Dump 返回当前生效的所有配置项及其来源，敏感信息已脱敏
+func Dump() []Entry {
+	cfg := Current()
+	if cfg == nil {
+		return nil
+	}
+	var entries []Entry
+	_ = walkFields(reflect.ValueOf(cfg).Elem(), "", func(key string, v reflect.Value) error {
+		var value interface{} = v.Interface()
+		if isSensitive(key) && !v.IsZero() {
+			value = "******"
+		} else if s, ok := value.(fmt.Stringer); ok {
+			value = s.String() // 例如 time.Duration 显示为 30s
+		}
+		entries = append(entries, Entry{Key: key, Value: value, Source: sourceOf(key)})
+		return nil
+	})
+	return entries
+}
+
+// ConfigFile 返回实际读取的配置文件路径，使用内嵌默认配置时为空
+func (c *Config) ConfigFile() string {
+	return viper.ConfigFileUsed()
+}
+
+// Print 以 key = value (source) 的格式输出当前生效的配置
+func Print(w io.Writer) {
+	for _, e := range Dump() {
+		fmt.Fprintf(w, "%s = %v (%s)\n", e.Key, e.Value, e.Source)
+	}
+}
+
+// isSensitive 根据 key 判断是否需要脱敏
+func isSensitive(key string) bool {
+	name := key[strings.LastIndex(key, ".")+1:]
+	for _, word := range []string{"password", "token", "secret", "dsn"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return name == "key" || strings.HasSuffix(name, "_key")
+}
+
+// sourceOf 按优先级推断配置项的值来自哪里
+func sourceOf(key string) string {
+	if key == "app.env" {
+		if f := pflag.Lookup("env"); f != nil && f.Changed {
+			return SourceFlag
+		}
+		if os.Getenv("APP_ENV") != "" {
+			return envSource("APP_ENV")
+		}
+	}
+	if name := envName(key); os.Getenv(name) != "" {
+		return envSource(name)
+	}
+	switch {
+	case remoteKeys[key]:
+		return SourceRemote
+	case overlayKeys[key]:
+		return SourceOverlay
+	case viper.InConfig(key):
+		return SourceFile
+	default:
+		return SourceDefault
+	}
+}
+
+// envSource 区分环境变量是进程本身的还是从 .env 文件加载的
+func envSource(name string) string {
+	if dotenvVars[name] {
+		return SourceDotenv
+	}
+	return SourceEnv
+}
+
+// envName 返回配置项对应的环境变量名
+func envName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
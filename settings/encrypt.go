@@ -0,0 +1,103 @@
+package settings
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// EncryptionConfig 加密配置值的密钥来源
+// 配置中形如 ENC(base64密文) 的值会在加载时用 AES-256-GCM 解密，密文可以用 cmd/encrypt-config 生成
+type EncryptionConfig struct {
+	// KeyEnv 保存密钥的环境变量名，密钥为 base64 编码的 32 字节
+	KeyEnv string `mapstructure:"key_env"`
+	// Key 也可以直接引用其他密钥后端中的密钥，例如 vault:secret/data/webapp#config_key
+	Key string `mapstructure:"key"`
+}
+
+// DefaultKeyEnv 未配置 key_env 时读取密钥的环境变量
+const DefaultKeyEnv = "WEBAPP_CONFIG_KEY"
+
+func init() {
+	registerResolver("enc", newEncResolver)
+}
+
+type encResolver struct {
+	aead cipher.AEAD
+}
+
+func newEncResolver(cfg *Config) (SecretResolver, error) {
+	ec := cfg.Secrets.Encryption
+	encoded := ec.Key
+	if encoded != "" {
+		// 密钥本身引用了其他密钥后端
+		var err error
+		if encoded, err = resolveValue(cfg, encoded); err != nil {
+			return nil, err
+		}
+	} else {
+		name := ec.KeyEnv
+		if name == "" {
+			name = DefaultKeyEnv
+		}
+		if encoded = os.Getenv(name); encoded == "" {
+			return nil, fmt.Errorf("encryption key not found in env %s", name)
+		}
+	}
+	aead, err := newAEAD(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return &encResolver{aead: aead}, nil
+}
+
+func (r *encResolver) Resolve(ref string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	size := r.aead.NonceSize()
+	if len(data) < size {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+	plain, err := r.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt value failed: %w", err)
+	}
+	return string(plain), nil
+}
+
+// Encrypt 用 base64 编码的密钥加密 plaintext，返回可以直接写进配置文件的 ENC(...) 字符串
+func Encrypt(plaintext, key string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	// 密文格式为 nonce + ciphertext
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return "ENC(" + base64.StdEncoding.EncodeToString(sealed) + ")", nil
+}
+
+func newAEAD(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("invalid encryption key: want 32 bytes, got %d", len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
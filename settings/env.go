@@ -0,0 +1,52 @@
+package settings
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix 环境变量前缀，需在 Init 之前修改才会生效
+// 例如 mysql.password 对应的环境变量为 WEBAPP_MYSQL_PASSWORD
+var EnvPrefix = "WEBAPP"
+
+// setupEnv 开启环境变量覆盖配置文件中的值
+func setupEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	// 配置项中的 . 替换为 _，例如 mysql.max_open_conns -> WEBAPP_MYSQL_MAX_OPEN_CONNS
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	// AutomaticEnv 只对 viper 已知的 key 生效，Unmarshal 时配置文件里没写的 key 不会去读环境变量，
+	// 所以这里把 Config 中所有的 key 都显式绑定一遍
+	bindEnvs(reflect.TypeOf(Config{}), "")
+	// Register 注册的配置段同样在设置前缀之后绑定，否则绑定的是没有前缀的环境变量
+	sectionsMu.Lock()
+	for key, t := range sections {
+		bindEnvs(t, key)
+	}
+	envReady = true
+	sectionsMu.Unlock()
+	// 运行环境还可以通过更通用的 APP_ENV 指定
+	_ = viper.BindEnv("app.env", EnvPrefix+"_APP_ENV", "APP_ENV")
+}
+
+// bindEnvs 递归遍历结构体的 mapstructure tag，为每个叶子节点绑定环境变量
+func bindEnvs(t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		if field.Type.Kind() == reflect.Struct {
+			bindEnvs(field.Type, key)
+			continue
+		}
+		_ = viper.BindEnv(key)
+	}
+}
@@ -0,0 +1,31 @@
+package settings
+
+import (
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// 命令行参数，例如 ./web_app --config /etc/webapp/prod.yaml --env prod
+var (
+	configFile = pflag.StringP("config", "c", "", "配置文件路径，不指定时在工作目录、./conf 和可执行文件所在目录中查找 config.yaml")
+	_          = pflag.StringP("env", "e", "", "运行环境，例如 dev/test/prod，会覆盖配置文件中的 app.env")
+	printCfg   = pflag.Bool("print-config", false, "打印最终生效的配置（密码等敏感信息已脱敏）及每个配置项的来源后退出")
+)
+
+// PrintConfigRequested 命令行中是否指定了 --print-config
+func PrintConfigRequested() bool {
+	return *printCfg
+}
+
+// Args 命令行参数之后的子命令，例如 ./web_app migrate status 返回 [migrate status]
+func Args() []string {
+	return pflag.Args()
+}
+
+// setupFlags 解析命令行参数并绑定到 viper，命令行参数的优先级最高
+func setupFlags() (err error) {
+	if !pflag.Parsed() {
+		pflag.Parse()
+	}
+	return viper.BindPFlag("app.env", pflag.Lookup("env"))
+}
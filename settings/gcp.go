@@ -0,0 +1,64 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+)
+
+// GCPSecretsConfig GCP Secret Manager 配置
+// 配置中的值可以写成 gcp-sm:projects/my-project/secrets/mysql-password/versions/latest，
+// 也可以省略 project 和版本写成 gcp-sm:mysql-password，# 后面为 JSON 中的字段名
+type GCPSecretsConfig struct {
+	Project         string `mapstructure:"project"`
+	CredentialsFile string `mapstructure:"credentials_file"` // 为空时使用 Application Default Credentials
+}
+
+func init() {
+	registerResolver("gcp-sm", newGCPResolver)
+}
+
+type gcpResolver struct {
+	client  *secretmanager.Client
+	project string
+}
+
+func newGCPResolver(cfg *Config) (SecretResolver, error) {
+	gc := cfg.Secrets.GCP
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var opts []option.ClientOption
+	if gc.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(gc.CredentialsFile))
+	}
+	client, err := secretmanager.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &gcpResolver{client: client, project: gc.Project}, nil
+}
+
+func (r *gcpResolver) Resolve(ref string) (string, error) {
+	name, field := splitRef(ref)
+	if !strings.HasPrefix(name, "projects/") {
+		if r.project == "" {
+			return "", fmt.Errorf("secrets.gcp.project is required for short secret name %q", name)
+		}
+		name = fmt.Sprintf("projects/%s/secrets/%s", r.project, name)
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := r.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return "", err
+	}
+	return jsonField(string(resp.GetPayload().GetData()), field)
+}
@@ -0,0 +1,66 @@
+package settings
+
+import "time"
+
+// LogSinksConfig 把日志额外发送到日志平台，多个副本时不再需要到各台机器上看日志文件
+// 每种 sink 的 endpoint（kafka 为 brokers）为空表示不启用，应用日志和访问日志都会发送
+type LogSinksConfig struct {
+	Loki          LokiSinkConfig          `mapstructure:"loki"`
+	Elasticsearch ElasticsearchSinkConfig `mapstructure:"elasticsearch"`
+	Kafka         KafkaSinkConfig         `mapstructure:"kafka"`
+	OTLP          OTLPSinkConfig          `mapstructure:"otlp"`
+}
+
+// SinkBatchConfig 日志批量发送的参数，日志先写入内存中的缓冲队列，由后台 goroutine 批量发送
+type SinkBatchConfig struct {
+	Size          int           `mapstructure:"size" validate:"min=0"`           // 每批最多发送的日志条数，默认 500
+	FlushInterval time.Duration `mapstructure:"flush_interval" validate:"min=0"` // 不满一批时最长等待的时间，默认 1s
+	BufferSize    int           `mapstructure:"buffer_size" validate:"min=0"`    // 缓冲队列的长度，默认 10000
+	// Overflow 缓冲队列满时的处理方式：drop 丢弃新的日志（默认），block 阻塞写日志的 goroutine 直到队列有空位
+	Overflow string        `mapstructure:"overflow" validate:"omitempty,oneof=drop block"`
+	Timeout  time.Duration `mapstructure:"timeout" validate:"min=0"` // 单次发送的超时时间，默认 5s
+}
+
+// LokiSinkConfig Grafana Loki，日志通过 /loki/api/v1/push 接口写入
+type LokiSinkConfig struct {
+	// Level 发送到该 sink 的最低日志级别，为空时与 log.level 相同
+	Level    string            `mapstructure:"level" validate:"omitempty,oneof=debug info warn error dpanic panic fatal"`
+	Batch    SinkBatchConfig   `mapstructure:"batch"`
+	Endpoint string            `mapstructure:"endpoint" validate:"omitempty,url"` // 例如 http://loki:3100
+	TenantID string            `mapstructure:"tenant_id"`                         // 多租户时的 X-Scope-OrgID
+	Username string            `mapstructure:"username"`
+	Password string            `mapstructure:"password"`
+	Labels   map[string]string `mapstructure:"labels"` // 日志流的标签，例如 {app: web_app, env: prod}
+}
+
+// ElasticsearchSinkConfig Elasticsearch，日志通过 _bulk 接口写入
+type ElasticsearchSinkConfig struct {
+	// Level 发送到该 sink 的最低日志级别，为空时与 log.level 相同
+	Level    string          `mapstructure:"level" validate:"omitempty,oneof=debug info warn error dpanic panic fatal"`
+	Batch    SinkBatchConfig `mapstructure:"batch"`
+	Endpoint string          `mapstructure:"endpoint" validate:"omitempty,url"` // 例如 http://es:9200
+	Index    string          `mapstructure:"index" validate:"required_with=Endpoint"`
+	Username string          `mapstructure:"username"`
+	Password string          `mapstructure:"password"`
+}
+
+// KafkaSinkConfig Kafka，每条日志作为一条消息写入 topic
+type KafkaSinkConfig struct {
+	// Level 发送到该 sink 的最低日志级别，为空时与 log.level 相同
+	Level   string          `mapstructure:"level" validate:"omitempty,oneof=debug info warn error dpanic panic fatal"`
+	Batch   SinkBatchConfig `mapstructure:"batch"`
+	Brokers []string        `mapstructure:"brokers"` // 例如 [kafka-0:9092, kafka-1:9092]
+	Topic   string          `mapstructure:"topic" validate:"required_with=Brokers"`
+}
+
+// OTLPSinkConfig OpenTelemetry Collector，日志通过 OTLP/HTTP（JSON）的 /v1/logs 接口写入
+// 日志中的 trace_id、span_id 字段会作为 LogRecord 的 TraceId、SpanId，与链路追踪关联
+type OTLPSinkConfig struct {
+	// Level 发送到该 sink 的最低日志级别，为空时与 log.level 相同
+	Level    string            `mapstructure:"level" validate:"omitempty,oneof=debug info warn error dpanic panic fatal"`
+	Batch    SinkBatchConfig   `mapstructure:"batch"`
+	Endpoint string            `mapstructure:"endpoint" validate:"omitempty,url"` // 例如 http://otel-collector:4318
+	Headers  map[string]string `mapstructure:"headers"`                           // 额外的请求头，例如认证信息
+	// Resource 资源属性，service.name、service.version、deployment.environment 默认取 app.name、git 版本号和 app.env
+	Resource AttributeMap `mapstructure:"resource"`
+}
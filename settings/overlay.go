@@ -0,0 +1,57 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// overlayFile 返回当前运行环境对应的覆盖配置文件路径，例如 config.yaml -> config.prod.yaml
+// 运行环境的优先级为 --env > APP_ENV/WEBAPP_APP_ENV > 配置文件中的 app.env
+func overlayFile() string {
+	env := viper.GetString("app.env")
+	base := viper.ConfigFileUsed()
+	if env == "" || base == "" {
+		return ""
+	}
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + env + ext
+}
+
+// overlayKeys 运行环境配置文件中出现的配置项
+var overlayKeys map[string]bool
+
+// mergeOverlay 把运行环境对应的配置文件深度合并到基础配置之上，文件不存在时忽略
+func mergeOverlay() (err error) {
+	overlayKeys = nil
+	name := overlayFile()
+	if name == "" {
+		return
+	}
+	if _, err = os.Stat(name); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	ov := viper.New()
+	ov.SetConfigFile(name)
+	if err = ov.ReadInConfig(); err != nil {
+		return fmt.Errorf("read config %s failed: %w", name, err)
+	}
+	// MergeConfigMap 会按 key 逐层合并 map，只覆盖 overlay 中出现的配置项
+	if err = viper.MergeConfigMap(ov.AllSettings()); err != nil {
+		return fmt.Errorf("merge config %s failed: %w", name, err)
+	}
+	overlayKeys = keySet(ov.AllKeys())
+	return
+}
+
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
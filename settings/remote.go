@@ -0,0 +1,90 @@
+package settings
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/spf13/viper"
+	_ "github.com/spf13/viper/remote" // 匿名导入 注册 etcd/consul 等远程配置中心的实现
+)
+
+// RemoteConfig 远程配置中心，provider 为空表示不启用
+// 所有实例共享同一份配置，读取失败时使用本地配置文件兜底
+type RemoteConfig struct {
+	Provider        string        `mapstructure:"provider" validate:"omitempty,oneof=etcd etcd3 consul firestore"`
+	Endpoint        string        `mapstructure:"endpoint" validate:"required_with=Provider"`     // 例如 http://127.0.0.1:2379
+	Path            string        `mapstructure:"path" validate:"required_with=Provider"`         // 例如 /config/web_app.yaml
+	Type            string        `mapstructure:"type" validate:"omitempty,oneof=yaml json toml"` // 远程配置内容的格式，默认 yaml
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" validate:"min=0"`
+}
+
+var (
+	remoteViper    *viper.Viper
+	remoteSettings map[string]interface{} // 最近一次从远程配置中心成功拉取到的配置
+	remoteKeys     map[string]bool
+)
+
+// setupRemote 从远程配置中心拉取配置合并到本地配置之上，并定期重新拉取
+func setupRemote() (err error) {
+	var rc RemoteConfig
+	if err = viper.UnmarshalKey("remote", &rc); err != nil {
+		return
+	}
+	if rc.Provider == "" {
+		return
+	}
+	if rc.Type == "" {
+		rc.Type = "yaml"
+	}
+	remoteViper = viper.New()
+	if err = remoteViper.AddRemoteProvider(rc.Provider, rc.Endpoint, rc.Path); err != nil {
+		return
+	}
+	remoteViper.SetConfigType(rc.Type)
+	if err := remoteViper.ReadRemoteConfig(); err != nil {
+		// 远程配置中心不可用时不影响启动，继续使用本地配置，后续定时拉取成功后再生效
+		fmt.Printf("read remote config from %s %s failed, fallback to local config, error: %v\n", rc.Provider, rc.Endpoint, err)
+	} else {
+		remoteSettings = remoteViper.AllSettings()
+		remoteKeys = keySet(remoteViper.AllKeys())
+		if err := mergeRemote(); err != nil {
+			return err
+		}
+	}
+	if rc.RefreshInterval > 0 {
+		go watchRemote(rc.RefreshInterval)
+	}
+	return
+}
+
+// mergeRemote 把最近一次拉取到的远程配置合并到当前配置之上
+func mergeRemote() error {
+	if remoteSettings == nil {
+		return nil
+	}
+	return viper.MergeConfigMap(remoteSettings)
+}
+
+// watchRemote 定期重新拉取远程配置，有变化时重新加载并通知
+func watchRemote(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// WatchRemoteConfig 只会重新拉取一次远程配置，并不会阻塞监听
+		if err := remoteViper.WatchRemoteConfig(); err != nil {
+			fmt.Printf("watch remote config failed, error: %v\n", err)
+			continue
+		}
+		latest := remoteViper.AllSettings()
+		if reflect.DeepEqual(latest, remoteSettings) {
+			continue
+		}
+		loadMu.Lock()
+		remoteSettings = latest
+		remoteKeys = keySet(remoteViper.AllKeys())
+		loadMu.Unlock()
+		// 重新读取本地配置，这样远程删除的配置项也能恢复为本地的值
+		reload("remote " + viper.GetString("remote.provider"))
+	}
+}
@@ -0,0 +1,204 @@
+package settings
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// durationPattern time.Duration 在配置文件中的写法，例如 5s、1m30s
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// Schema 生成完整配置（包括通过 Register 注册的配置段）的 JSON Schema，用于 CI 校验配置文件和编辑器补全
+// descriptions 为字段说明，key 形如 settings.MySQLConfig.Host，一般由 cmd/config-schema 从源码注释中提取
+func Schema(descriptions map[string]string) map[string]interface{} {
+	dv := viper.New()
+	dv.SetConfigType("yaml")
+	_ = dv.ReadConfig(bytes.NewReader(defaultConfig))
+	g := &schemaGenerator{descriptions: descriptions, defaults: dv, visiting: make(map[reflect.Type]string)}
+
+	root := g.object(reflect.TypeOf(Config{}), "")
+	props := root["properties"].(map[string]interface{})
+	sectionsMu.RLock()
+	keys := make([]string, 0, len(sections))
+	for key := range sections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		props[key] = g.object(sections[key], key)
+	}
+	sectionsMu.RUnlock()
+
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "web_app config"
+	return root
+}
+
+type schemaGenerator struct {
+	descriptions map[string]string
+	defaults     *viper.Viper
+	// visiting 正在生成的结构体及其 schema 的位置，递归的类型（例如 mysql.databases）引用已有的 schema
+	visiting map[reflect.Type]string
+}
+
+// object 生成结构体的 schema，prefix 为结构体在配置文件中的 key
+func (g *schemaGenerator) object(t reflect.Type, prefix string) map[string]interface{} {
+	if ref, ok := g.visiting[t]; ok {
+		return map[string]interface{}{"$ref": ref}
+	}
+	g.visiting[t] = "#/properties/" + strings.ReplaceAll(prefix, ".", "/properties/")
+	defer delete(g.visiting, t)
+	props := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.SplitN(field.Tag.Get("mapstructure"), ",", 2)[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		rules, itemRules := splitRules(field.Tag.Get("validate"))
+		s := g.schema(field.Type, key, itemRules)
+		applyRules(s, rules)
+		if rules["required"] != nil {
+			required = append(required, tag)
+		}
+		if desc := g.descriptions[typeName(t)+"."+field.Name]; desc != "" {
+			s["description"] = desc
+		}
+		if s["type"] != "object" {
+			if v := g.defaultValue(key); v != nil {
+				s["default"] = v
+			}
+		}
+		props[tag] = s
+	}
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// schema 生成任意类型的 schema，itemRules 为 dive 之后作用在元素上的校验规则
+func (g *schemaGenerator) schema(t reflect.Type, key string, itemRules map[string][]string) map[string]interface{} {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]interface{}{"type": "string", "pattern": durationPattern}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem(), key, itemRules)
+	case reflect.Struct:
+		return g.object(t, key)
+	case reflect.Slice, reflect.Array:
+		items := g.schema(t.Elem(), key, nil)
+		applyRules(items, itemRules)
+		return map[string]interface{}{"type": "array", "items": items}
+	case reflect.Map:
+		value := g.schema(t.Elem(), key, nil)
+		applyRules(value, itemRules)
+		return map[string]interface{}{"type": "object", "additionalProperties": value}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+// defaultValue 内嵌默认配置和 Register 注册的默认值
+func (g *schemaGenerator) defaultValue(key string) interface{} {
+	v := g.defaults.Get(key)
+	if v == nil {
+		v = viper.Get(key)
+	}
+	// Register 注册的默认值是 time.Duration，与配置文件中一样写为 10s 这种字符串
+	if d, ok := v.(time.Duration); ok {
+		return d.String()
+	}
+	return v
+}
+
+// splitRules 解析 validate tag，dive 之前的规则作用在字段上，之后的规则作用在元素上
+func splitRules(tag string) (rules, itemRules map[string][]string) {
+	rules = make(map[string][]string)
+	cur := rules
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "" {
+			continue
+		}
+		if rule == "dive" {
+			itemRules = make(map[string][]string)
+			cur = itemRules
+			continue
+		}
+		name, param, _ := strings.Cut(rule, "=")
+		cur[name] = strings.Fields(param)
+	}
+	return
+}
+
+// applyRules 把校验规则转换为对应的 JSON Schema 关键字
+func applyRules(s map[string]interface{}, rules map[string][]string) {
+	for name, params := range rules {
+		switch name {
+		case "oneof":
+			if _, ok := rules["omitempty"]; ok {
+				// omitempty 允许不配置，即空字符串
+				params = append([]string{""}, params...)
+			}
+			s["enum"] = params
+		case "url":
+			s["format"] = "uri"
+		case "min", "gte", "max", "lte":
+			if len(params) != 1 {
+				continue
+			}
+			n, err := strconv.ParseFloat(params[0], 64)
+			if err != nil {
+				continue
+			}
+			lower := name == "min" || name == "gte"
+			switch s["type"] {
+			case "integer", "number":
+				s[pick(lower, "minimum", "maximum")] = n
+			case "string":
+				if _, ok := s["pattern"]; !ok {
+					s[pick(lower, "minLength", "maxLength")] = n
+				}
+			case "array":
+				s[pick(lower, "minItems", "maxItems")] = n
+			}
+		}
+	}
+}
+
+func pick(cond bool, a, b string) string {
+	if cond {
+		return a
+	}
+	return b
+}
+
+// typeName 形如 settings.MySQLConfig
+func typeName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "." + t.Name()
+}
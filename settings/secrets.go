@@ -0,0 +1,150 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretsConfig 各密钥后端的配置
+type SecretsConfig struct {
+	Encryption EncryptionConfig    `mapstructure:"encryption"`
+	Vault      VaultConfig         `mapstructure:"vault"`
+	AWS        AWSSecretsConfig    `mapstructure:"aws"`
+	GCP        GCPSecretsConfig    `mapstructure:"gcp"`
+	Aliyun     AliyunSecretsConfig `mapstructure:"aliyun"`
+}
+
+// SecretResolver 把配置中的密钥引用解析为真实的值
+// 配置中形如 scheme:ref 的字符串会交给对应 scheme 的 SecretResolver 处理
+// 例如 vault:secret/data/webapp#mysql_password 中 scheme 为 vault，ref 为 secret/data/webapp#mysql_password
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// 初始化 SecretResolver，参数为当前的配置（不包含已解析的密钥）
+type resolverFactory func(cfg *Config) (SecretResolver, error)
+
+var (
+	resolversMu sync.Mutex
+	factories   = make(map[string]resolverFactory)
+	resolvers   = make(map[string]SecretResolver) // 已经初始化过的 SecretResolver，按 scheme 缓存
+)
+
+// registerResolver 注册一种密钥后端，在各后端文件的 init 中调用
+func registerResolver(scheme string, factory resolverFactory) {
+	factories[scheme] = factory
+}
+
+// resolveSecrets 遍历配置中所有的字符串字段，把密钥引用替换为真实的值
+func resolveSecrets(cfg *Config) error {
+	return resolveStruct(cfg, reflect.ValueOf(cfg).Elem(), "")
+}
+
+// resolveStruct 解析任意配置结构体中的密钥引用，初始化密钥后端时使用 cfg 中的配置
+func resolveStruct(cfg *Config, s reflect.Value, prefix string) error {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	return walkFields(s, prefix, func(key string, v reflect.Value) error {
+		if v.Kind() != reflect.String {
+			return nil
+		}
+		secret, err := resolveValue(cfg, v.String())
+		if err != nil {
+			return fmt.Errorf("resolve %s failed: %w", key, err)
+		}
+		v.SetString(secret)
+		return nil
+	})
+}
+
+// resolveValue 解析单个配置值，不是密钥引用时原样返回，调用方需持有 resolversMu
+func resolveValue(cfg *Config, s string) (string, error) {
+	scheme, ref, ok := strings.Cut(s, ":")
+	// ENC(...) 是加密配置值的写法
+	if strings.HasPrefix(s, "ENC(") && strings.HasSuffix(s, ")") {
+		scheme, ref, ok = "enc", s[len("ENC("):len(s)-1], true
+	}
+	if !ok {
+		return s, nil
+	}
+	factory, ok := factories[scheme]
+	if !ok {
+		return s, nil
+	}
+	r, ok := resolvers[scheme]
+	if !ok {
+		var err error
+		if r, err = factory(cfg); err != nil {
+			return "", fmt.Errorf("init %s secret resolver failed: %w", scheme, err)
+		}
+		resolvers[scheme] = r
+	}
+	return r.Resolve(ref)
+}
+
+// splitRef 把 name#field 形式的引用拆分为密钥名和 JSON 字段名，没有 # 时 field 为空
+func splitRef(ref string) (name, field string) {
+	name, field, _ = strings.Cut(ref, "#")
+	return
+}
+
+// jsonField 云厂商的密钥通常以 JSON 保存多个值，field 不为空时取出其中的一个字段
+func jsonField(value, field string) (string, error) {
+	if field == "" {
+		return value, nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found in secret", field)
+	}
+	return fmt.Sprint(v), nil
+}
+
+// walkFields 递归遍历结构体中的叶子字段，key 为配置文件中的 key
+func walkFields(v reflect.Value, prefix string, fn func(key string, v reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.SplitN(t.Field(i).Tag.Get("mapstructure"), ",", 2)[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Duration(0)) {
+			if err := walkFields(field, key, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		// 值为结构体的 map（例如 mysql.databases）逐个遍历，有修改时写回 map
+		if field.Kind() == reflect.Map && field.Type().Elem().Kind() == reflect.Struct && field.Len() > 0 {
+			iter := field.MapRange()
+			for iter.Next() {
+				elem := reflect.New(field.Type().Elem()).Elem()
+				elem.Set(iter.Value())
+				if err := walkFields(elem, key+"."+fmt.Sprint(iter.Key().Interface()), fn); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(elem.Interface(), iter.Value().Interface()) {
+					field.SetMapIndex(iter.Key(), elem)
+				}
+			}
+			continue
+		}
+		if err := fn(key, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package settings
+
+// SeedConfig 种子数据，./web_app seed 时使用，见 db/seeds
+type SeedConfig struct {
+	// Dir SQL 种子文件所在的目录，相对于工作目录
+	Dir string `mapstructure:"dir" validate:"required"`
+	// Envs 允许写入种子数据的 app.env，不在其中时拒绝执行，避免误写入生产环境
+	Envs []string `mapstructure:"envs"`
+}
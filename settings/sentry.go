@@ -0,0 +1,12 @@
+package settings
+
+// SentryConfig Sentry 错误上报，dsn 为空表示不启用
+// 启用后 panic 和 level 及以上级别的日志会上报到 Sentry
+type SentryConfig struct {
+	DSN         string  `mapstructure:"dsn" validate:"omitempty,url"`
+	Environment string  `mapstructure:"environment"`                                                    // 为空时使用 app.env，app.env 也为空时使用 app.mode
+	Release     string  `mapstructure:"release"`                                                        // 为空时使用构建信息中的 git 版本号
+	Level       string  `mapstructure:"level" validate:"omitempty,oneof=warn error dpanic panic fatal"` // 默认 error
+	SampleRate  float64 `mapstructure:"sample_rate" validate:"min=0,max=1"`                             // 事件的采样率，0 表示全部上报
+	Debug       bool    `mapstructure:"debug"`
+}
@@ -1,34 +1,461 @@
 package settings
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
 
-	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
-func Init() (err error) {
+// Config 整个应用的配置，与 config.yaml 的结构一一对应
+type Config struct {
+	App   AppConfig   `mapstructure:"app"`
+	Log   LogConfig   `mapstructure:"log"`
+	MySQL MySQLConfig `mapstructure:"mysql"`
+	Redis RedisConfig `mapstructure:"redis"`
+
+	Remote  RemoteConfig  `mapstructure:"remote"`
+	Secrets SecretsConfig `mapstructure:"secrets"`
+	Reload  ReloadConfig  `mapstructure:"reload"`
+	Sentry  SentryConfig  `mapstructure:"sentry"`
+	Tracing TracingConfig `mapstructure:"tracing"`
+	Audit   AuditConfig   `mapstructure:"audit"`
+	Seed    SeedConfig    `mapstructure:"seed"`
+}
+
+// AppConfig 应用自身的配置
+type AppConfig struct {
+	Name string `mapstructure:"name" validate:"required"`
+	Mode string `mapstructure:"mode" validate:"required"`
+	Env  string `mapstructure:"env"`
+	// Port 监听的端口，为 0 时由系统分配一个空闲端口
+	Port int `mapstructure:"port" validate:"min=0,max=65535"`
+	// PortFallback 端口被占用时改为监听系统分配的空闲端口
+	PortFallback bool `mapstructure:"port_fallback"`
+	// AddrFile 不为空时把实际监听的地址写入这个文件
+	AddrFile string `mapstructure:"addr_file"`
+	// TrustedProxies 信任的反向代理的 IP 或 CIDR，只有来自这些地址的请求才使用 X-Forwarded-For 中的客户端 IP，
+	// 为空时不信任任何代理，c.ClientIP() 为连接的对端地址；修改后需要重启
+	TrustedProxies []string `mapstructure:"trusted_proxies" validate:"dive,ip|cidr"`
+
+	// StrictConfig 严格模式，配置文件中出现未知的配置项时启动失败
+	StrictConfig bool `mapstructure:"strict_config"`
+
+	// Locale 请求参数校验的错误信息在请求没有 Accept-Language 或者不支持时使用的语言
+	Locale string `mapstructure:"locale" validate:"oneof=zh en"`
+
+	// StartTime 生成 ID 的起始时间，上线后不能修改；MachineID 生成 ID 的机器 ID，同时运行的每个实例必须不同，见 pkg/snowflake
+	StartTime string `mapstructure:"start_time" validate:"required,datetime=2006-01-02"`
+	MachineID int64  `mapstructure:"machine_id" validate:"min=0,max=1023"`
+
+	// EnablePprof 开放 /debug/pprof 和 /debug/runtime，请求需要带上 DebugToken，支持热加载
+	EnablePprof bool   `mapstructure:"enable_pprof"`
+	DebugToken  string `mapstructure:"debug_token" validate:"required_if=EnablePprof true"`
+
+	// ShutdownDelay 收到关机信号之后 readiness 返回 503，等待这段时间让负载均衡摘除实例之后再关闭 HTTP 服务
+	ShutdownDelay time.Duration `mapstructure:"shutdown_delay" validate:"min=0"`
+	// ShutdownTimeout 优雅关机时等待处理中的请求完成的最长时间
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" validate:"gt=0"`
+	// ForceExitTimeout 收到关机信号之后超过这个时间仍未退出则强制退出，0 表示不强制退出，不为 0 时必须大于 ShutdownDelay
+	ForceExitTimeout time.Duration `mapstructure:"force_exit_timeout" validate:"min=0"`
+	// ShutdownSignals 触发优雅关机的信号，reload.sighup 为 true 时不能包含 SIGHUP
+	ShutdownSignals []string `mapstructure:"shutdown_signals" validate:"dive,oneof=SIGINT SIGTERM SIGQUIT SIGHUP"`
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level      string `mapstructure:"level" validate:"required,oneof=debug info warn error dpanic panic fatal"`
+	Filename   string `mapstructure:"filename" validate:"required"`
+	MaxSize    int    `mapstructure:"max_size" validate:"min=0"`
+	MaxAge     int    `mapstructure:"max_age" validate:"min=0"`
+	MaxBackups int    `mapstructure:"max_backups" validate:"min=0"`
+	// Rotation 日志文件的轮转方式：size 按大小（max_size）轮转；daily/hourly 按天/小时写入带日期的文件，例如 web_app-2023-06-20.log
+	Rotation string `mapstructure:"rotation" validate:"omitempty,oneof=size daily hourly"`
+	// StacktraceLevel 该级别及以上的日志带上堆栈，默认 release 模式下为 error，其他模式下为 warn
+	StacktraceLevel string `mapstructure:"stacktrace_level" validate:"omitempty,oneof=debug info warn error dpanic panic fatal"`
+	// DisableCaller 不记录日志的调用位置
+	DisableCaller bool `mapstructure:"disable_caller"`
+	// Buffer 写日志文件的缓冲，应用日志和访问日志文件都会使用
+	Buffer LogBufferConfig `mapstructure:"buffer"`
+	// Access 访问日志（GinLogger 输出的请求记录）单独的配置
+	Access AccessLogConfig `mapstructure:"access"`
+	// Redact 日志脱敏规则
+	Redact RedactConfig `mapstructure:"redact"`
+	// Body 记录部分路由的请求体和响应体
+	Body BodyLogConfig `mapstructure:"body"`
+	// Sampling 应用日志采样
+	Sampling SamplingConfig `mapstructure:"sampling"`
+	// Sinks 日志平台
+	Sinks LogSinksConfig `mapstructure:"sinks"`
+	// Alert 错误告警
+	Alert AlertConfig `mapstructure:"alert"`
+	// Archive 轮转后的日志文件上传到对象存储
+	Archive LogArchiveConfig `mapstructure:"archive"`
+	// Crash panic 的崩溃报告
+	Crash CrashReportConfig `mapstructure:"crash"`
+	// Levels 各模块独立的日志级别，key 为 logger.Named 的名称，例如 {dao.mysql: warn, routes: debug}
+	// 没有配置的模块按名称的前缀查找，例如 dao.mysql.tx 使用 dao.mysql 的级别，都没有时使用 level
+	Levels LevelMap `mapstructure:"levels" validate:"dive,oneof=debug info warn error dpanic panic fatal"`
+}
+
+// LevelMap 模块名到日志级别的映射
+// 模块名中的 . 会被 viper 当作层级分隔符，反序列化时把嵌套的 map 展开为 dao.mysql 这样的 key
+type LevelMap map[string]string
+
+// AttributeMap 属性名到值的映射，例如 OpenTelemetry 的 service.namespace，展开方式与 LevelMap 相同
+type AttributeMap map[string]string
+
+// SamplingConfig 日志采样，每个 tick 内相同级别、相同内容的日志只记录前 initial 条，之后每 thereafter 条记录一条
+// initial 为 0 表示不采样，修改后需要重启才能生效
+type SamplingConfig struct {
+	Initial    int           `mapstructure:"initial" validate:"min=0"`
+	Thereafter int           `mapstructure:"thereafter" validate:"min=0"`
+	Tick       time.Duration `mapstructure:"tick" validate:"min=0"` // 默认 1s
+}
+
+// RedactConfig 日志脱敏配置，对日志字段、访问日志的 query 和 panic 时打印的请求同时生效
+type RedactConfig struct {
+	// Fields 字段名、query 参数名、请求头名包含其中任意一个（不区分大小写）时，值会被替换为 ******
+	Fields []string `mapstructure:"fields"`
+	// Patterns 日志内容中匹配这些正则表达式的部分会被替换为 ******，例如手机号
+	Patterns []string `mapstructure:"patterns" validate:"dive,regexp"`
+}
+
+// LogBufferConfig 日志先写入内存缓冲区，缓冲区满或者每隔 flush_interval 写入一次文件，减少同步写磁盘对请求耗时的影响
+// 进程退出前会写入缓冲区中剩余的日志，被 kill -9 时最多丢失 flush_interval 内的日志
+type LogBufferConfig struct {
+	SizeKB        int           `mapstructure:"size_kb" validate:"min=0"`        // 缓冲区大小，0 表示不缓冲
+	FlushInterval time.Duration `mapstructure:"flush_interval" validate:"min=0"` // 默认 30s
+}
+
+// CrashReportConfig GinRecovery 捕获到 panic 时写入的崩溃报告，filename 为空表示不写
+// 每个 panic 都有一个事件 ID（incident_id），会记录在日志和崩溃报告中，并在 500 响应中返回给调用方
+type CrashReportConfig struct {
+	Filename   string `mapstructure:"filename"`
+	MaxSize    int    `mapstructure:"max_size" validate:"min=0"`
+	MaxAge     int    `mapstructure:"max_age" validate:"min=0"`
+	MaxBackups int    `mapstructure:"max_backups" validate:"min=0"`
+	// GoroutineDump 崩溃报告中包含所有 goroutine 的堆栈，goroutine 很多时报告会比较大
+	GoroutineDump bool `mapstructure:"goroutine_dump"`
+}
+
+// BodyLogConfig 请求体和响应体日志，用于调试 webhook 等接口，routes 为空表示不记录
+type BodyLogConfig struct {
+	Routes       []string `mapstructure:"routes"`                  // 注册路由时的路径，例如 /api/v1/webhook/:source
+	MaxKB        int      `mapstructure:"max_kb" validate:"min=0"` // 请求体和响应体各自最多记录的大小，默认 4KB
+	ContentTypes []string `mapstructure:"content_types"`           // 记录内容的 Content-Type 前缀，默认为 JSON、表单、XML 和文本
+}
+
+// AccessLogConfig 访问日志配置，filename 为空时访问日志写入应用日志文件
+type AccessLogConfig struct {
+	Level      string `mapstructure:"level" validate:"omitempty,oneof=debug info warn error dpanic panic fatal"` // 默认 info
+	Filename   string `mapstructure:"filename"`
+	MaxSize    int    `mapstructure:"max_size" validate:"min=0"`
+	MaxAge     int    `mapstructure:"max_age" validate:"min=0"`
+	MaxBackups int    `mapstructure:"max_backups" validate:"min=0"`
+	Rotation   string `mapstructure:"rotation" validate:"omitempty,oneof=size daily hourly"`
+	// Sampling 按路由采样访问日志，例如健康检查、高频的读接口，状态码 >= 400 的请求总是记录
+	Sampling []RouteSampling `mapstructure:"sampling" validate:"dive"`
+	// SkipPaths 不记录访问日志的路由，例如 /readiness、/metrics，状态码 >= 400 的请求仍然会记录
+	SkipPaths []string `mapstructure:"skip_paths"`
+	// SlowThreshold 耗时超过该值的请求以 WARN 级别记录并带上 slow=true，0 表示不判断
+	SlowThreshold time.Duration `mapstructure:"slow_threshold" validate:"min=0"`
+}
+
+// RouteSampling 单个路由的访问日志采样率
+type RouteSampling struct {
+	Path string  `mapstructure:"path" validate:"required"`    // 注册路由时的路径，例如 /api/v1/post/:id
+	Rate float64 `mapstructure:"rate" validate:"min=0,max=1"` // 记录的比例，0 表示不记录
+}
+
+// MySQLConfig MySQL 连接配置
+type MySQLConfig struct {
+	// Driver 数据库驱动，mysql、postgres 或 sqlite，默认 mysql；sqlite 时 dbname 为数据库文件的路径，不需要 host、port、user
+	Driver string `mapstructure:"driver" validate:"omitempty,oneof=mysql postgres sqlite"`
+	// Backend mysql.NewStore 创建的 Store 的实现，sqlx（默认）或 gorm，gorm 不支持 sqlite，修改后需要重启服务
+	Backend string `mapstructure:"backend" validate:"omitempty,oneof=sqlx gorm"`
+	// DSN 不为空时直接使用，不再由 host、port、tls、params 等拼接
+	DSN          string `mapstructure:"dsn"`
+	Host         string `mapstructure:"host" validate:"required_unless=Driver sqlite"`
+	Port         int    `mapstructure:"port" validate:"required_unless=Driver sqlite,max=65535"`
+	User         string `mapstructure:"user" validate:"required_unless=Driver sqlite"`
+	Password     string `mapstructure:"password"`
+	DBName       string `mapstructure:"dbname" validate:"required"`
+	MaxOpenConns int    `mapstructure:"max_open_conns" validate:"min=0"`
+	MaxIdleConns int    `mapstructure:"max_idle_conns" validate:"min=0"`
+	// ConnMaxLifetime 连接的最长存活时间，应小于 MySQL 的 wait_timeout，0 表示不限制
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime" validate:"min=0"`
+	// ConnMaxIdleTime 连接的最长空闲时间，0 表示不限制
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time" validate:"min=0"`
+	// QueryTimeout 每条语句的超时时间，请求的 ctx 先结束时语句随之取消，应小于 app.shutdown_timeout，0 表示不限制
+	QueryTimeout time.Duration `mapstructure:"query_timeout" validate:"min=0"`
+	// SlowThreshold 耗时超过该值的语句以 WARN 级别记录慢查询日志，并计入 mysql_slow_queries_total，0 表示不记录
+	SlowThreshold time.Duration `mapstructure:"slow_threshold" validate:"min=0"`
+	// SlowLogArgs 慢查询日志中是否记录参数，长字符串会被截断，二进制只记录长度
+	SlowLogArgs bool `mapstructure:"slow_log_args"`
+	// BatchSize 批量写入（InsertBatch、Upsert）时每条语句最多的行数，默认 1000
+	BatchSize int `mapstructure:"batch_size" validate:"min=0"`
+	// MaxAllowedPacket 批量写入时每条语句的参数最多的字节数，应不大于 MySQL 的 max_allowed_packet，默认 4MB
+	MaxAllowedPacket int `mapstructure:"max_allowed_packet" validate:"min=0"`
+	// StmtCacheSize 缓存的预处理语句数（主库和副本合计），相同的 SQL 只预处理一次；0 表示不缓存（默认），
+	// 开启后所有语句都先预处理，只适合 SQL 固定、执行频繁的场景；通过 PgBouncer 等事务级连接池的代理连接，或者 params 中开启了 interpolateParams 时不要开启
+	StmtCacheSize int `mapstructure:"stmt_cache_size" validate:"min=0"`
+	// TLS 连接加密，云数据库一般要求开启，副本使用相同的配置
+	TLS DBTLSConfig `mapstructure:"tls"`
+	// Loc 解析 DATETIME、TIMESTAMP 使用的时区（MySQL），例如 Local、Asia/Shanghai，默认 UTC
+	Loc string `mapstructure:"loc" validate:"omitempty,timezone"`
+	// Timeout 建立连接的超时，ReadTimeout、WriteTimeout 读写的超时（MySQL），0 表示不限制
+	Timeout      time.Duration `mapstructure:"timeout" validate:"min=0"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout" validate:"min=0"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout" validate:"min=0"`
+	// Params 其他 DSN 参数，格式为 URL 的 query，例如 interpolateParams=true&maxAllowedPacket=0，同名时覆盖默认的 charset、parseTime 等参数
+	// 使用字符串而不是 map，因为 viper 会把 map 的 key 转为小写，而驱动的参数名区分大小写
+	Params string `mapstructure:"params"`
+	// Retry 启动时连接失败的重试，容器环境中 MySQL 可能比应用晚就绪
+	Retry RetryConfig `mapstructure:"retry"`
+	// Breaker 熔断器，数据库不可用时快速失败，而不是让请求堆积在连接池上等待
+	Breaker BreakerConfig `mapstructure:"breaker"`
+	// ReadOnly 维护模式，写入返回 503、错误码 db_read_only，查询正常执行，迁移、主从切换时使用，也可以通过 PUT /debug/readonly 临时切换
+	ReadOnly bool `mapstructure:"read_only"`
+	// Replicas 只读副本，查询轮询发送到健康的副本，写入和事务使用上面配置的主库，修改后需要重启服务
+	Replicas []MySQLReplicaConfig `mapstructure:"replicas" validate:"dive"`
+	// HealthCheckInterval 检查副本是否可用的间隔，默认 5s
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval" validate:"min=0"`
+	// Databases 命名的连接池，通过 mysql.Get(name) 获取，没有配置的字段与 mysql 中的相同（replicas、databases 除外）
+	// 例如只配置 dbname 即可连接同一实例上的另一个库
+	Databases map[string]MySQLConfig `mapstructure:"databases" validate:"dive"`
+	// Shards 水平分片，键为逻辑表名，通过 mysql.Router(name) 获取路由，修改后需要重启服务
+	Shards map[string]ShardConfig `mapstructure:"shards" validate:"dive"`
+	// AutoMigrate 启动时在主库上执行未执行的数据库迁移；迁移没有加锁，多实例部署时建议在发布流程中执行一次 ./web_app migrate up
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+}
+
+// MySQLReplicaConfig 只读副本的地址，user、password 为空时与主库相同，连接池的大小与主库相同
+type MySQLReplicaConfig struct {
+	Host     string `mapstructure:"host" validate:"required"`
+	Port     int    `mapstructure:"port" validate:"required,min=1,max=65535"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+}
+
+// RetryConfig 连接失败时按指数退避重试，每次的等待时间在 [backoff/2, backoff] 之间随机，避免多个实例同时重试
+type RetryConfig struct {
+	MaxAttempts    int           `mapstructure:"max_attempts" validate:"min=0"`    // 最多尝试的次数（包括第一次），0 或 1 表示不重试
+	InitialBackoff time.Duration `mapstructure:"initial_backoff" validate:"min=0"` // 第一次重试前的等待时间，默认 1s
+	MaxBackoff     time.Duration `mapstructure:"max_backoff" validate:"min=0"`     // 等待时间的上限，默认 30s
+}
+
+// DBTLSConfig 数据库（MySQL、PostgreSQL、Redis）连接的 TLS 配置，PostgreSQL 时对应 sslmode=verify-full（insecure_skip_verify 时为 require）、sslrootcert 等参数
+type DBTLSConfig struct {
+	Enable   bool   `mapstructure:"enable"`
+	CAFile   string `mapstructure:"ca_file" validate:"omitempty,file"` // 为空时使用系统的根证书
+	CertFile string `mapstructure:"cert_file" validate:"required_with=KeyFile,omitempty,file"`
+	KeyFile  string `mapstructure:"key_file" validate:"required_with=CertFile,omitempty,file"`
+	// ServerName 校验证书时使用的主机名，默认为 host，通过 IP 或者代理连接时需要指定
+	ServerName string `mapstructure:"server_name"`
+	// InsecureSkipVerify 不校验服务端证书，只用于开发环境
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+// BreakerConfig 熔断器：统计周期内的请求数达到 min_requests，并且连接失败、超时等错误的比例达到 failure_ratio 时熔断（打开），
+// 打开期间语句直接返回错误，open_timeout 后进入半开状态，放行 half_open_requests 个请求，全部成功时恢复（关闭），否则重新打开
+type BreakerConfig struct {
+	Enable           bool          `mapstructure:"enable"`
+	FailureRatio     float64       `mapstructure:"failure_ratio" validate:"min=0,max=1"` // 默认 0.5
+	MinRequests      uint32        `mapstructure:"min_requests"`                         // 默认 20
+	Interval         time.Duration `mapstructure:"interval" validate:"min=0"`            // 关闭状态下清空统计的周期，0 表示不清空
+	OpenTimeout      time.Duration `mapstructure:"open_timeout" validate:"min=0"`        // 默认 10s
+	HalfOpenRequests uint32        `mapstructure:"half_open_requests"`                   // 默认 1
+}
+
+// RedisConfig Redis 连接配置
+type RedisConfig struct {
+	// Mode 部署方式：single（默认）单机，cluster Redis Cluster，sentinel 哨兵
+	Mode string `mapstructure:"mode" validate:"omitempty,oneof=single cluster sentinel"`
+	// Addrs cluster 时为集群节点（部分即可），sentinel 时为哨兵的地址，为空时使用 host:port
+	Addrs []string `mapstructure:"addrs" validate:"dive,hostname_port"`
+	// MasterName sentinel 时主节点的名称，SentinelPassword 哨兵的密码（与 password 不同时配置）
+	MasterName       string `mapstructure:"master_name" validate:"required_if=Mode sentinel"`
+	SentinelPassword string `mapstructure:"sentinel_password"`
+	Host             string `mapstructure:"host" validate:"required_without=Addrs"`
+	Port             int    `mapstructure:"port" validate:"required_without=Addrs,omitempty,min=1,max=65535"`
+	// Username Redis 6 的 ACL 用户名，为空时使用 default 用户，只需要 password
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// TLS 连接加密，ElastiCache、Tair 等云服务开启传输加密时需要，cluster 的所有节点和 sentinel 的哨兵使用相同的配置
+	TLS DBTLSConfig `mapstructure:"tls"`
+	// DB cluster 时只能为 0
+	DB       int `mapstructure:"db" validate:"min=0,max=15"`
+	PoolSize int `mapstructure:"pool_size" validate:"min=0"`
+	// MinIdleConns 保持的最少空闲连接数，避免流量突增时集中建立连接
+	MinIdleConns int `mapstructure:"min_idle_conns" validate:"min=0"`
+	// DialTimeout 建立连接的超时，默认 5s；ReadTimeout、WriteTimeout 读写的超时，默认 3s，-1 表示不限制
+	DialTimeout  time.Duration `mapstructure:"dial_timeout" validate:"min=0"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout" validate:"min=-1"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout" validate:"min=-1"`
+	// MaxRetries 网络错误时命令的最多重试次数，默认 3，-1 表示不重试
+	MaxRetries int `mapstructure:"max_retries" validate:"min=-1"`
+	// MinRetryBackoff、MaxRetryBackoff 重试的等待时间按指数增长的下限和上限，默认 8ms 和 512ms
+	MinRetryBackoff time.Duration `mapstructure:"min_retry_backoff" validate:"min=0"`
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff" validate:"min=0"`
+	// KeyPrefix redis.Key 及 Get、Set、锁、限流、缓存等 key 的前缀，{app}、{env} 替换为 app.name、app.env，
+	// 多个环境共用一个 Redis 时 key 不会冲突
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+// Init 读取配置文件并反序列化到 Config 中返回
+func Init() (cfg *Config, err error) {
+	if err = setupFlags(); err != nil {
+		fmt.Printf("setup flags failed, error: %v\n", err)
+		return
+	}
+	// 在读取环境变量之前加载 .env 文件
+	if err = loadDotenv(); err != nil {
+		fmt.Printf("load %s failed, error: %v\n", DotenvFile, err)
+		return
+	}
 	// 设置默认值
 	viper.SetDefault("fileDir", "./")
+	if err = setupDefaults(); err != nil {
+		fmt.Printf("setup defaults failed, error: %v\n", err)
+		return
+	}
 	// 读取配置文件
-	viper.SetConfigFile("./config.yaml") // 指定配置文件路径
-	viper.SetConfigName("config")        // 配置文件名称(无扩展名)
-	viper.SetConfigType("yaml")          // SetConfigType设置远端源返回的配置类型，例如:“json”。
-	viper.AddConfigPath(".")             // 还可以在工作目录中查找配置
+	// 配置文件的格式由扩展名决定，支持 yaml/yml/json/toml
+	if *configFile != "" {
+		viper.SetConfigFile(*configFile) // 通过 --config 指定了配置文件路径
+		if filepath.Ext(*configFile) == "" {
+			viper.SetConfigType("yaml") // 没有扩展名时按 yaml 解析
+		}
+	} else {
+		viper.SetConfigName("config") // 配置文件名称(无扩展名)，会依次查找 config.json、config.toml、config.yaml 等
+		viper.AddConfigPath(".")      // 在工作目录中查找配置
+		viper.AddConfigPath("./conf") // 还可以在工作目录的 conf 目录下查找配置
+		if exe, err := os.Executable(); err == nil {
+			viper.AddConfigPath(filepath.Dir(exe)) // 最后在可执行文件所在目录中查找
+		}
+	}
+	// 环境变量的优先级高于配置文件
+	setupEnv()
 
 	err = viper.ReadInConfig() // 查找并读取配置文件
-	if err != nil {            // 处理读取配置文件的错误
+	var notFound viper.ConfigFileNotFoundError
+	if errors.As(err, &notFound) {
+		// 没有找到配置文件时使用内嵌的默认配置启动，通过 --config 指定的文件不存在时仍然报错
+		fmt.Println("config file not found, using embedded defaults")
+		err = nil
+	}
+	if err != nil { // 处理读取配置文件的错误
 		fmt.Printf("viper.ReadInConfig failed, error: %v\n", err)
 		return
 	}
+	// 合并运行环境对应的配置文件，例如 config.prod.yaml
+	if err = mergeOverlay(); err != nil {
+		fmt.Printf("mergeOverlay failed, error: %v\n", err)
+		return
+	}
+	// 合并远程配置中心的配置
+	if err = setupRemote(); err != nil {
+		fmt.Printf("setupRemote failed, error: %v\n", err)
+		return
+	}
 
-	// 实时监控配置文件的变化 WatchConfig 开始监视配置文件的更改。
-	viper.WatchConfig()
-	// OnConfigChange设置配置文件更改时调用的事件处理程序。
-	// 当配置文件变化之后调用的一个回调函数
-	viper.OnConfigChange(func(e fsnotify.Event) {
-		fmt.Println("Config file changed:", e.Name)
-	})
+	if cfg, err = unmarshal(); err != nil {
+		return nil, err
+	}
+	current.Store(cfg)
 
+	startWatch(&cfg.Reload)
 	return
 }
+
+// unmarshal 把读取到的配置信息反序列化到 Config 中，解析密钥引用之后进行校验
+func unmarshal() (*Config, error) {
+	cfg := new(Config)
+	if err := viper.Unmarshal(cfg, viper.DecodeHook(decodeHook())); err != nil {
+		return nil, fmt.Errorf("viper.Unmarshal failed: %w", err)
+	}
+	if err := inheritDatabases(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.App.StrictConfig {
+		if err := checkUnknownKeys(); err != nil {
+			return nil, err
+		}
+	}
+	if err := resolveSecrets(cfg); err != nil {
+		return nil, err
+	}
+	// 启动时就校验配置，避免写错的 key 变成零值之后在运行中才暴露问题
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// inheritDatabases mysql.databases 中的每个连接池以 mysql 的配置为基础，再覆盖上自己配置的字段
+func inheritDatabases(cfg *Config) error {
+	for name := range cfg.MySQL.Databases {
+		base := cfg.MySQL
+		base.Databases = nil
+		base.Replicas = nil
+		base.Shards = nil
+		if err := viper.UnmarshalKey("mysql.databases."+name, &base, viper.DecodeHook(decodeHook())); err != nil {
+			return fmt.Errorf("unmarshal mysql.databases.%s failed: %w", name, err)
+		}
+		cfg.MySQL.Databases[name] = base
+	}
+	return nil
+}
+
+// decodeHook 反序列化配置时的类型转换，在 viper 默认的基础上增加 LevelMap、AttributeMap 的展开
+func decodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		flattenLevelMapHook,
+	)
+}
+
+func flattenLevelMapHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(LevelMap{}) && to != reflect.TypeOf(AttributeMap{}) {
+		return data, nil
+	}
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	out := make(map[string]interface{})
+	var flatten func(prefix string, m map[string]interface{})
+	flatten = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			if sub, ok := v.(map[string]interface{}); ok {
+				flatten(k, sub)
+				continue
+			}
+			out[k] = v
+		}
+	}
+	flatten("", m)
+	return out, nil
+}
+
+// loadMu 保证配置文件监听和远程配置拉取两个 goroutine 不会同时重新加载配置
+var loadMu sync.Mutex
+
+// applyLayers 在基础配置文件之上依次合并运行环境配置和远程配置
+func applyLayers() (err error) {
+	if err = mergeOverlay(); err != nil {
+		return
+	}
+	return mergeRemote()
+}
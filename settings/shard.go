@@ -0,0 +1,20 @@
+package settings
+
+// ShardConfig 一张逻辑表的水平分片规则，键为逻辑表名，见 mysql.Router
+//
+// hash：按分片键的哈希把记录分到 len(databases)*tables 个分片中，分片 i 在 databases[i/tables] 上，表名为 <表名>_<i>；
+// tables 为 0 或 1 时只分库，表名不变。date：按时间分表，表名为 <表名>_<period 对应的日期>，例如 posts_202401，
+// 多个库时 since[i] 为 databases[i] 开始存放的日期
+type ShardConfig struct {
+	Strategy string `mapstructure:"strategy" validate:"required,oneof=hash date"`
+	// Databases 分片所在的连接池，为 mysql.databases 中的名称，default 表示默认连接池；上线后不能修改顺序和数量，扩容需要迁移数据
+	Databases []string `mapstructure:"databases" validate:"required,min=1"`
+	// Tables hash 时每个库的分表数
+	Tables int `mapstructure:"tables" validate:"min=0"`
+	// Period date 时每张表的时间范围，默认 month
+	Period string `mapstructure:"period" validate:"omitempty,oneof=day month year"`
+	// Since date 且有多个库时每个库开始存放的日期（格式为 2006-01-02），与 databases 一一对应并按时间递增
+	Since []string `mapstructure:"since" validate:"dive,datetime=2006-01-02"`
+	// Loc date 时划分日期使用的时区，例如 Asia/Shanghai，默认 UTC
+	Loc string `mapstructure:"loc" validate:"omitempty,timezone"`
+}
@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// checkUnknownKeys 严格模式下检查配置文件（包括运行环境配置和远程配置）中是否有未知的配置项
+// 未知的配置项通常是拼写错误，例如 max_open_cons，非严格模式下会被静默忽略
+func checkUnknownKeys() error {
+	known := knownKeys()
+	var unknown []string
+	for _, key := range viper.AllKeys() {
+		if !viper.InConfig(key) || isKnown(known, key) {
+			continue
+		}
+		if guess := closest(known, key); guess != "" {
+			key = fmt.Sprintf("%s (did you mean %s?)", key, guess)
+		}
+		unknown = append(unknown, key)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown config keys: %s", strings.Join(unknown, ", "))
+}
+
+// knownKeys Config 以及通过 Register 注册的配置段中所有的 key
+func knownKeys() map[string]bool {
+	known := make(map[string]bool)
+	collect := func(t reflect.Type, prefix string) {
+		_ = walkFields(reflect.New(t).Elem(), prefix, func(key string, _ reflect.Value) error {
+			known[key] = true
+			return nil
+		})
+	}
+	collect(reflect.TypeOf(Config{}), "")
+	sectionsMu.RLock()
+	for key, t := range sections {
+		collect(t, key)
+	}
+	sectionsMu.RUnlock()
+	return known
+}
+
+// isKnown map 类型的配置项下可以有任意的子 key，例如 log.levels.dao.mysql
+func isKnown(known map[string]bool, key string) bool {
+	for k := key; ; {
+		if known[k] {
+			return true
+		}
+		i := strings.LastIndex(k, ".")
+		if i < 0 {
+			return false
+		}
+		k = k[:i]
+	}
+}
+
+// closest 返回与 key 编辑距离最近的已知 key，距离太远时返回空
+func closest(known map[string]bool, key string) (guess string) {
+	best := len(key)/3 + 1
+	for k := range known {
+		if d := distance(k, key); d < best || (d == best && k < guess) {
+			best, guess = d, k
+		}
+	}
+	return
+}
+
+// distance 两个字符串的编辑距离
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
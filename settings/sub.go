@@ -0,0 +1,91 @@
+package settings
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+var (
+	sectionsMu sync.RWMutex
+	sections   = make(map[string]reflect.Type) // 通过 Register 注册的配置段
+	envReady   bool                            // setupEnv 已经设置了环境变量前缀
+)
+
+// Register 注册一个模块自己的配置段，例如 kafka、s3 等不在 Config 中的模块
+// defaults 中的非零值作为默认值，配置段中的所有 key 同样可以通过环境变量覆盖
+// 一般在模块的 init 函数中调用
+//
+//	type KafkaConfig struct {
+//		Brokers []string `mapstructure:"brokers" validate:"required"`
+//		Topic   string   `mapstructure:"topic" validate:"required"`
+//	}
+//	settings.Register("kafka", KafkaConfig{Topic: "events"})
+func Register[T any](key string, defaults T) {
+	v := reflect.ValueOf(defaults)
+	if v.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("settings: Register %s with non-struct type %T", key, defaults))
+	}
+	sectionsMu.Lock()
+	sections[key] = v.Type()
+	ready := envReady
+	sectionsMu.Unlock()
+
+	_ = walkFields(v, key, func(k string, fv reflect.Value) error {
+		if !fv.IsZero() {
+			viper.SetDefault(k, fv.Interface())
+		}
+		return nil
+	})
+	// BindEnv 在绑定时就拼接了前缀，init 中注册的配置段由 setupEnv 在设置前缀之后绑定
+	if ready {
+		bindEnvs(v.Type(), key)
+	}
+}
+
+// Sub 读取 key 对应的配置段到 T 中，解析其中的密钥引用并校验
+//
+//	cfg, err := settings.Sub[settings.MySQLConfig]("mysql")
+func Sub[T any](key string) (*T, error) {
+	t := new(T)
+	// UnmarshalKey 不会合并环境变量覆盖的子 key，所以从 AllSettings 中取出配置段再反序列化
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       decodeHook(),
+		WeaklyTypedInput: true,
+		Result:           t,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = decoder.Decode(section(viper.AllSettings(), key)); err != nil {
+		return nil, fmt.Errorf("unmarshal config %s failed: %w", key, err)
+	}
+	cfg := Current()
+	if cfg == nil {
+		cfg = new(Config)
+	}
+	if err := resolveStruct(cfg, reflect.ValueOf(t).Elem(), key); err != nil {
+		return nil, err
+	}
+	if err := validateStruct(t, key); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// section 按 a.b.c 的路径从嵌套的 map 中取出配置段
+func section(m map[string]interface{}, key string) interface{} {
+	var cur interface{} = m
+	for _, part := range strings.Split(key, ".") {
+		node, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = node[part]
+	}
+	return cur
+}
@@ -0,0 +1,11 @@
+package settings
+
+// TracingConfig OpenTelemetry 链路追踪，endpoint 为空表示不启用
+// 启用后每个 HTTP 请求生成一个 server span，请求中执行的 SQL 是它的子 span，通过 OTLP/HTTP 发送到 Collector
+type TracingConfig struct {
+	Endpoint    string       `mapstructure:"endpoint" validate:"omitempty,url"` // Collector 的地址，例如 http://127.0.0.1:4318
+	Headers     AttributeMap `mapstructure:"headers"`                           // 请求头，例如认证信息
+	SampleRatio float64      `mapstructure:"sample_ratio" validate:"min=0,max=1"`
+	// Resource 附加的资源属性，service.name、service.version、deployment.environment 会自动设置
+	Resource AttributeMap `mapstructure:"resource"`
+}
@@ -0,0 +1,104 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// 错误信息中使用配置文件里的 key，而不是结构体字段名
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("mapstructure"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	// regexp 要求字符串是合法的正则表达式
+	_ = v.RegisterValidation("regexp", func(fl validator.FieldLevel) bool {
+		_, err := regexp.Compile(fl.Field().String())
+		return err == nil
+	})
+	return v
+}
+
+// Validate 检查配置项是否缺失或超出范围，所有不合法的配置项会汇总到一个错误中返回
+func (c *Config) Validate() error {
+	if err := validateStruct(c, ""); err != nil {
+		return err
+	}
+	// 强制退出的计时从收到关机信号开始，shutdown_delay 不小于它时还没开始关闭 HTTP 服务就强制退出了
+	if c.App.ForceExitTimeout > 0 && c.App.ShutdownDelay >= c.App.ForceExitTimeout {
+		return fmt.Errorf("invalid config: app.shutdown_delay must be less than app.force_exit_timeout, got %s >= %s", c.App.ShutdownDelay, c.App.ForceExitTimeout)
+	}
+	// SIGHUP 用于重新加载配置时不能同时作为关机信号，否则收到 SIGHUP 时既重新加载又关机
+	if c.Reload.SIGHUP {
+		for _, sig := range c.App.ShutdownSignals {
+			if sig == "SIGHUP" {
+				return errors.New("invalid config: app.shutdown_signals cannot contain SIGHUP when reload.sighup is true")
+			}
+		}
+	}
+	return nil
+}
+
+// validateStruct 校验任意配置结构体，prefix 为该结构体在配置文件中的 key
+func validateStruct(s interface{}, prefix string) error {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, fe := range errs {
+		msgs = append(msgs, describe(fe, prefix))
+	}
+	return fmt.Errorf("invalid config: %s", strings.Join(msgs, "; "))
+}
+
+// describe 把单个校验错误转换为易读的描述，例如 mysql.host is required
+func describe(fe validator.FieldError, prefix string) string {
+	// Namespace 形如 Config.mysql.host，去掉最外层的结构体名
+	key := fe.Namespace()
+	if i := strings.Index(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", key)
+	case "required_with":
+		return fmt.Sprintf("%s is required when %s is set", key, fe.Param())
+	case "required_without":
+		return fmt.Sprintf("%s is required when %s is not set", key, fe.Param())
+	case "required_if":
+		return fmt.Sprintf("%s is required when %s", key, strings.Replace(fe.Param(), " ", " is ", 1))
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s], got %q", key, fe.Param(), fmt.Sprint(fe.Value()))
+	case "min", "gte":
+		return fmt.Sprintf("%s must be >= %s, got %v", key, fe.Param(), fe.Value())
+	case "gt":
+		return fmt.Sprintf("%s must be > %s, got %v", key, fe.Param(), fe.Value())
+	case "max", "lte":
+		return fmt.Sprintf("%s must be <= %s, got %v", key, fe.Param(), fe.Value())
+	case "ltfield":
+		return fmt.Sprintf("%s must be less than %s, got %v", key, fe.Param(), fe.Value())
+	case "regexp":
+		return fmt.Sprintf("%s must be a valid regular expression, got %q", key, fmt.Sprint(fe.Value()))
+	default:
+		return fmt.Sprintf("%s failed on the %q rule, got %v", key, fe.Tag(), fe.Value())
+	}
+}
@@ -0,0 +1,147 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/api/auth/approle"
+)
+
+// VaultConfig HashiCorp Vault 配置，address 为空表示不启用
+// 启用后配置中形如 vault:secret/data/webapp#mysql_password 的值会在启动时从 Vault 中读取
+type VaultConfig struct {
+	Address    string `mapstructure:"address" validate:"omitempty,url"`
+	Namespace  string `mapstructure:"namespace"`
+	AuthMethod string `mapstructure:"auth_method" validate:"omitempty,oneof=token approle"` // 默认 token
+	Token      string `mapstructure:"token"`
+	RoleID     string `mapstructure:"role_id"`
+	SecretID   string `mapstructure:"secret_id"`
+}
+
+func init() {
+	registerResolver("vault", newVaultResolver)
+}
+
+type vaultResolver struct {
+	client *vault.Client
+}
+
+func newVaultResolver(cfg *Config) (SecretResolver, error) {
+	vc := cfg.Secrets.Vault
+	if vc.Address == "" {
+		return nil, errors.New("secrets.vault.address is not configured")
+	}
+	conf := vault.DefaultConfig()
+	conf.Address = vc.Address
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	if vc.Namespace != "" {
+		client.SetNamespace(vc.Namespace)
+	}
+
+	r := &vaultResolver{client: client}
+	login := r.loginFunc(&vc)
+	secret, err := login(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("vault login failed: %w", err)
+	}
+	// 后台自动续期 token，token 达到最大有效期无法再续期时重新登录
+	go r.renew(secret, login)
+	return r, nil
+}
+
+// loginFunc 根据认证方式返回登录函数，返回值为包含 token 租约信息的 Secret
+func (r *vaultResolver) loginFunc(vc *VaultConfig) func(ctx context.Context) (*vault.Secret, error) {
+	if vc.AuthMethod == "approle" {
+		return func(ctx context.Context) (*vault.Secret, error) {
+			auth, err := approle.NewAppRoleAuth(vc.RoleID, &approle.SecretID{FromString: vc.SecretID})
+			if err != nil {
+				return nil, err
+			}
+			return r.client.Auth().Login(ctx, auth)
+		}
+	}
+	return func(ctx context.Context) (*vault.Secret, error) {
+		r.client.SetToken(vc.Token)
+		// 查询 token 自身的有效期，转换为登录返回的格式用于续期
+		self, err := r.client.Auth().Token().LookupSelfWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		renewable, _ := self.TokenIsRenewable()
+		ttl, _ := self.TokenTTL()
+		return &vault.Secret{Auth: &vault.SecretAuth{
+			ClientToken:   vc.Token,
+			Renewable:     renewable,
+			LeaseDuration: int(ttl.Seconds()),
+		}}, nil
+	}
+}
+
+// renew 持续续期 token
+func (r *vaultResolver) renew(secret *vault.Secret, login func(ctx context.Context) (*vault.Secret, error)) {
+	for {
+		if renewable, _ := secret.TokenIsRenewable(); !renewable {
+			return
+		}
+		watcher, err := r.client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{Secret: secret})
+		if err != nil {
+			fmt.Printf("vault token watcher failed, error: %v\n", err)
+			return
+		}
+		go watcher.Start()
+		for done := false; !done; {
+			select {
+			case err := <-watcher.DoneCh():
+				if err != nil {
+					fmt.Printf("vault token renew failed, error: %v\n", err)
+				}
+				done = true
+			case <-watcher.RenewCh():
+			}
+		}
+		watcher.Stop()
+		if secret, err = login(context.Background()); err != nil {
+			fmt.Printf("vault re-login failed, error: %v\n", err)
+			return
+		}
+	}
+}
+
+// Resolve ref 形如 secret/data/webapp#mysql_password
+func (r *vaultResolver) Resolve(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid vault reference %q, want path#key", ref)
+	}
+	data, err := r.read(path)
+	if err != nil {
+		return "", err
+	}
+	v, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in vault path %q", key, path)
+	}
+	return fmt.Sprint(v), nil
+}
+
+func (r *vaultResolver) read(path string) (map[string]interface{}, error) {
+	secret, err := r.client.Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("vault path %q not found", path)
+	}
+	data := secret.Data
+	// KV v2 引擎的数据在 data 字段中
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		data = inner
+	}
+	return data, nil
+}
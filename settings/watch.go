@@ -0,0 +1,146 @@
+package settings
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// ReloadConfig 配置文件热加载方式
+type ReloadConfig struct {
+	// Mode fsnotify 监听文件系统事件；poll 定期比较文件内容，适用于 Kubernetes ConfigMap 这种通过替换软链接更新的场景；off 不监听
+	Mode     string        `mapstructure:"mode" validate:"omitempty,oneof=fsnotify poll off"`
+	Interval time.Duration `mapstructure:"interval" validate:"min=0"` // poll 模式下检查的间隔，默认 10s
+	// SIGHUP 收到 SIGHUP 信号时重新加载配置
+	SIGHUP bool `mapstructure:"sighup"`
+}
+
+// startWatch 按配置的方式监听配置文件的变化
+func startWatch(rc *ReloadConfig) {
+	if rc.SIGHUP {
+		go watchSignal()
+	}
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+	switch rc.Mode {
+	case "off":
+	case "poll":
+		interval := rc.Interval
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		go poll(interval, fingerprint())
+	default:
+		// 实时监控配置文件的变化 WatchConfig 开始监视配置文件的更改。
+		viper.WatchConfig()
+		// OnConfigChange设置配置文件更改时调用的事件处理程序。
+		// 当配置文件变化之后调用的一个回调函数
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			// WatchConfig 只会重新读取基础配置文件，需要再合并一次其他来源的配置
+			loadMu.Lock()
+			err := applyLayers()
+			loadMu.Unlock()
+			if err != nil {
+				fmt.Printf("reload config failed, error: %v\n", err)
+				return
+			}
+			notifyChange("file " + e.Name)
+		})
+	}
+}
+
+// reload 重新读取本地配置文件并合并其他来源的配置，然后通知订阅者
+func reload(source string) {
+	loadMu.Lock()
+	var err error
+	if viper.ConfigFileUsed() != "" {
+		err = viper.ReadInConfig()
+	}
+	if err == nil {
+		err = applyLayers()
+	}
+	loadMu.Unlock()
+	if err != nil {
+		fmt.Printf("reload config failed, error: %v\n", err)
+		return
+	}
+	notifyChange(source)
+}
+
+// poll 定期比较配置文件的内容，内容变化时重新加载
+// 读取文件时会跟随软链接，所以 ConfigMap 更新时替换 ..data 软链接也能感知到
+func poll(interval time.Duration, last [sha256.Size]byte) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if sum := fingerprint(); sum != last {
+			last = sum
+			reload("poll " + viper.ConfigFileUsed())
+		}
+	}
+}
+
+// fingerprint 基础配置文件与运行环境配置文件内容的摘要
+func fingerprint() [sha256.Size]byte {
+	h := sha256.New()
+	for _, name := range []string{viper.ConfigFileUsed(), overlayFile()} {
+		if name == "" {
+			continue
+		}
+		data, _ := os.ReadFile(name)
+		h.Write([]byte(name))
+		h.Write(data)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// watchSignal 收到 SIGHUP 时重新加载配置
+func watchSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		reload("signal SIGHUP")
+	}
+}
+
+var (
+	handlersMu sync.RWMutex
+	handlers   []func(Config)
+)
+
+// OnChange 注册配置变化之后的回调函数，每次配置重新加载并校验通过之后按注册顺序调用
+// 回调中拿到的是完整的新配置，各模块自行比较需要关心的字段
+func OnChange(fn func(Config)) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers = append(handlers, fn)
+}
+
+// notifyChange 配置重新加载之后调用，把新配置分发给所有订阅者
+func notifyChange(source string) {
+	fmt.Println("Config changed:", source)
+	// 不合法的配置不下发，继续使用之前的配置
+	cfg, err := unmarshal()
+	if err != nil {
+		fmt.Printf("ignore config change from %s, error: %v\n", source, err)
+		return
+	}
+	current.Store(cfg)
+	handlersMu.RLock()
+	fns := make([]func(Config), len(handlers))
+	copy(fns, handlers)
+	handlersMu.RUnlock()
+	for _, fn := range fns {
+		fn(*cfg)
+	}
+}
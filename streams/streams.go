@@ -0,0 +1,420 @@
+// Package streams 基于 Redis Streams 消费组的后台任务：Add 写入消息，各模块在 init 中通过 Handle 注册处理函数，main 中 Start 启动消费
+//
+//	func init() {
+//		streams.Handle("email:send", func(ctx context.Context, msg *streams.Message) error {
+//			var req SendEmailRequest
+//			if err := msg.Decode(&req); err != nil {
+//				return err
+//			}
+//			return sendEmail(ctx, &req)
+//		})
+//	}
+//	id, err := streams.Add(ctx, "email:send", &SendEmailRequest{To: "a@example.com"})
+//
+// 所有实例属于同一个消费组（streams.group），每条消息只由其中一个实例处理；处理成功后 XACK，
+// 失败或者实例崩溃时消息留在待确认列表中，超过 claim_idle 后由任意实例接管重试，
+// 投递超过 max_deliveries 次后移入死信流 <stream>:dead。处理函数应是幂等的，同一条消息可能被处理多次
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web_app/dao/redis"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Config 消费配置，对应配置文件中的 streams，Start 时读取
+type Config struct {
+	// Group 消费组的名称，同一个服务的所有实例相同
+	Group string `mapstructure:"group" validate:"required"`
+	// Consumer 消费者的名称，同一个消费组中每个实例不同，默认为主机名
+	Consumer string `mapstructure:"consumer"`
+	// Concurrency 每个流同时执行的处理函数数量
+	Concurrency int `mapstructure:"concurrency" validate:"min=1"`
+	// Batch 每次读取、接管的最多消息数
+	Batch int `mapstructure:"batch" validate:"min=1"`
+	// Block 没有新消息时 XREADGROUP 阻塞等待的时间，也是关机时最长的等待时间
+	Block time.Duration `mapstructure:"block" validate:"min=1ms"`
+	// HandlerTimeout 每条消息的处理超时，必须小于 claim_idle，否则处理中的消息会被其他实例接管
+	HandlerTimeout time.Duration `mapstructure:"handler_timeout" validate:"min=1ms,ltfield=ClaimIdle"`
+	// ClaimIdle 消息超过该时间没有确认时（处理失败、实例崩溃）由其他实例接管重试
+	ClaimIdle time.Duration `mapstructure:"claim_idle" validate:"min=1ms"`
+	// ClaimInterval 检查待确认列表的间隔
+	ClaimInterval time.Duration `mapstructure:"claim_interval" validate:"min=1ms"`
+	// MaxDeliveries 最多投递的次数（包括第一次），超过后移入死信流
+	MaxDeliveries int `mapstructure:"max_deliveries" validate:"min=1"`
+	// DeadLetterSuffix 死信流的后缀，死信流为 <stream><suffix>
+	DeadLetterSuffix string `mapstructure:"dead_letter_suffix" validate:"required"`
+	// MaxLen Add 时流保留的最大长度（近似），0 表示不限制
+	MaxLen int64 `mapstructure:"max_len" validate:"min=0"`
+}
+
+// 配置文件中的 key
+const configKey = "streams"
+
+// dataField 消息中保存内容的字段
+const dataField = "data"
+
+var defaults = Config{
+	Group:            "web_app",
+	Concurrency:      8,
+	Batch:            10,
+	Block:            2 * time.Second,
+	HandlerTimeout:   30 * time.Second,
+	ClaimIdle:        time.Minute,
+	ClaimInterval:    30 * time.Second,
+	MaxDeliveries:    5,
+	DeadLetterSuffix: ":dead",
+	MaxLen:           100000,
+}
+
+// Message 读取到的消息
+type Message struct {
+	Stream string
+	ID     string
+	Values map[string]interface{}
+	// Deliveries 第几次投递，第一次为 1
+	Deliveries int
+}
+
+// Decode 把 Add 写入的内容反序列化到 v 中
+func (m *Message) Decode(v interface{}) error {
+	s, _ := m.Values[dataField].(string)
+	return json.Unmarshal([]byte(s), v)
+}
+
+// Handler 消息的处理函数，返回 nil 时确认消息，返回错误或 panic 时消息在 claim_idle 之后重试
+type Handler func(ctx context.Context, msg *Message) error
+
+// messages 处理的消息数，result 为 ok、error、panic 或 dead（移入死信流）
+var messages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "streams_messages_total",
+	Help: "Number of Redis Streams messages handled by stream and result.",
+}, []string{"stream", "result"})
+
+var (
+	mu       sync.Mutex
+	handlers = make(map[string]Handler)
+	svc      *service
+	current  atomic.Pointer[Config]
+)
+
+func init() {
+	settings.Register(configKey, defaults)
+}
+
+// Handle 注册流 stream 的处理函数，在 Start 之前（一般在 init 中）调用，重复注册或者 Start 之后注册时 panic
+func Handle(stream string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	if svc != nil {
+		panic(fmt.Sprintf("streams: Handle %q after Start", stream))
+	}
+	if _, ok := handlers[stream]; ok {
+		panic(fmt.Sprintf("streams: duplicate handler for %q", stream))
+	}
+	handlers[stream] = h
+}
+
+// Add 使用默认的 Redis 客户端向 stream（自动加上 redis.key_prefix）写入一条消息，v 序列化为 JSON，返回消息的 ID；流的长度近似地保留 streams.max_len
+func Add(ctx context.Context, stream string, v interface{}) (id string, err error) {
+	client := redis.Client()
+	if client == nil {
+		return "", redis.ErrNotInitialized
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	return client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: redis.Key(stream),
+		MaxLen: config().MaxLen,
+		Approx: true,
+		Values: []interface{}{dataField, b},
+	}).Result()
+}
+
+func config() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	return &defaults
+}
+
+// service 后台的消费 goroutine
+type service struct {
+	cfg    Config
+	cancel context.CancelFunc
+	loops  sync.WaitGroup
+	// running 正在执行的处理函数
+	running sync.WaitGroup
+	log     *zap.Logger
+}
+
+// worker 一个流的消费者
+type worker struct {
+	s      *service
+	stream string
+	// key 加上 redis.key_prefix 之后的 key
+	key string
+	h   Handler
+	sem chan struct{}
+}
+
+// Start 读取 streams 配置，为每个注册的流创建消费组（流不存在时一起创建）并在后台消费；没有注册处理函数时不消费
+func Start() error {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil {
+		return err
+	}
+	if cfg.Consumer == "" {
+		if cfg.Consumer, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	current.Store(cfg)
+	mu.Lock()
+	defer mu.Unlock()
+	if svc != nil {
+		return errors.New("streams already started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &service{cfg: *cfg, cancel: cancel, log: logger.Named("streams")}
+	for stream, h := range handlers {
+		w := &worker{s: s, stream: stream, key: redis.Key(stream), h: h, sem: make(chan struct{}, cfg.Concurrency)}
+		if err = w.createGroup(ctx); err != nil {
+			cancel()
+			return fmt.Errorf("create consumer group for stream %s: %w", stream, err)
+		}
+		s.loops.Add(2)
+		go w.readLoop(ctx)
+		go w.claimLoop(ctx)
+	}
+	svc = s
+	return nil
+}
+
+// Shutdown 停止读取新消息并等待正在执行的处理函数返回，ctx 结束时不再等待并返回 ctx 的错误；
+// 没有处理完的消息留在待确认列表中，由其他实例接管
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	s := svc
+	mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	s.cancel()
+	finished := make(chan struct{})
+	go func() {
+		// 阻塞中的 XREADGROUP 最多在 streams.block 之后返回
+		s.loops.Wait()
+		s.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// createGroup 从流的开头创建消费组，已经存在时忽略
+func (w *worker) createGroup(ctx context.Context) error {
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	err := client.XGroupCreateMkStream(ctx, w.key, w.s.cfg.Group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// readLoop 读取新消息，出错时等待 1s 后重试，流或者消费组被删除时重新创建
+func (w *worker) readLoop(ctx context.Context) {
+	defer w.s.loops.Done()
+	cfg := &w.s.cfg
+	for ctx.Err() == nil {
+		client := redis.Client()
+		if client == nil {
+			sleep(ctx, time.Second)
+			continue
+		}
+		res, err := client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    cfg.Group,
+			Consumer: cfg.Consumer,
+			Streams:  []string{w.key, ">"},
+			Count:    int64(cfg.Batch),
+			Block:    cfg.Block,
+		}).Result()
+		if errors.Is(err, goredis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.s.log.Warn("read stream failed", zap.String("stream", w.stream), zap.Error(err))
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				_ = w.createGroup(ctx)
+			}
+			sleep(ctx, time.Second)
+			continue
+		}
+		for _, xs := range res {
+			for _, m := range xs.Messages {
+				if !w.dispatch(ctx, m, 1) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// claimLoop 定期接管超过 claim_idle 没有确认的消息：投递次数达到 max_deliveries 的移入死信流，其他的重新处理
+func (w *worker) claimLoop(ctx context.Context) {
+	defer w.s.loops.Done()
+	ticker := time.NewTicker(w.s.cfg.ClaimInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := w.claim(ctx); err != nil && ctx.Err() == nil {
+			w.s.log.Warn("claim pending messages failed", zap.String("stream", w.stream), zap.Error(err))
+		}
+	}
+}
+
+func (w *worker) claim(ctx context.Context) error {
+	cfg := &w.s.cfg
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	pending, err := client.XPendingExt(ctx, &goredis.XPendingExtArgs{
+		Stream: w.key,
+		Group:  cfg.Group,
+		Idle:   cfg.ClaimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  int64(cfg.Batch),
+	}).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil
+	}
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	ids := make([]string, len(pending))
+	deliveries := make(map[string]int, len(pending))
+	for i, p := range pending {
+		ids[i] = p.ID
+		deliveries[p.ID] = int(p.RetryCount)
+	}
+	// XCLAIM 同样检查空闲时间，多个实例同时接管时只有一个成功
+	msgs, err := client.XClaim(ctx, &goredis.XClaimArgs{
+		Stream:   w.key,
+		Group:    cfg.Group,
+		Consumer: cfg.Consumer,
+		MinIdle:  cfg.ClaimIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		n := deliveries[m.ID]
+		if n >= cfg.MaxDeliveries {
+			if err = w.deadLetter(ctx, m, n); err != nil {
+				return err
+			}
+			continue
+		}
+		if !w.dispatch(ctx, m, n+1) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// deadLetter 把消息写入死信流并确认，死信中带有原来的流、ID 和投递次数
+func (w *worker) deadLetter(ctx context.Context, m goredis.XMessage, deliveries int) error {
+	values := make([]interface{}, 0, 2*len(m.Values)+6)
+	for k, v := range m.Values {
+		values = append(values, k, v)
+	}
+	values = append(values, "source_stream", w.stream, "source_id", m.ID, "deliveries", deliveries)
+	client := redis.Client()
+	if err := client.XAdd(ctx, &goredis.XAddArgs{Stream: w.key + w.s.cfg.DeadLetterSuffix, Values: values}).Err(); err != nil {
+		return err
+	}
+	messages.WithLabelValues(w.stream, "dead").Inc()
+	w.s.log.Error("stream message moved to dead letter", zap.String("stream", w.stream), zap.String("id", m.ID), zap.Int("deliveries", deliveries))
+	return client.XAck(ctx, w.key, w.s.cfg.Group, m.ID).Err()
+}
+
+// dispatch 在新的 goroutine 中处理消息，同时执行的数量达到 concurrency 时等待，ctx 结束时返回 false
+func (w *worker) dispatch(ctx context.Context, m goredis.XMessage, deliveries int) bool {
+	select {
+	case w.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	w.s.running.Add(1)
+	go func() {
+		defer func() {
+			<-w.sem
+			w.s.running.Done()
+		}()
+		w.handle(&Message{Stream: w.stream, ID: m.ID, Values: m.Values, Deliveries: deliveries})
+	}()
+	return true
+}
+
+// handle 调用处理函数，成功时确认消息；使用独立的 ctx，Shutdown 时正在执行的处理函数不会被取消
+func (w *worker) handle(msg *Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.s.cfg.HandlerTimeout)
+	defer cancel()
+	log := w.s.log.With(zap.String("stream", msg.Stream), zap.String("id", msg.ID), zap.Int("deliveries", msg.Deliveries))
+	defer func() {
+		if p := recover(); p != nil {
+			messages.WithLabelValues(msg.Stream, "panic").Inc()
+			log.Error("[Recovery from panic]", zap.Any("error", p), zap.String("stack", string(debug.Stack())))
+		}
+	}()
+	if err := w.h(ctx, msg); err != nil {
+		messages.WithLabelValues(msg.Stream, "error").Inc()
+		log.Error("handle stream message failed", zap.Error(err))
+		return
+	}
+	messages.WithLabelValues(msg.Stream, "ok").Inc()
+	if err := redis.Client().XAck(ctx, w.key, w.s.cfg.Group, msg.ID).Err(); err != nil {
+		log.Warn("ack stream message failed", zap.Error(err))
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,9 @@
+-- 从就绪队列取出一个任务放入处理中的有序集合（分数为可见性超时的时间），返回任务和第几次执行
+local member = redis.call("LPOP", KEYS[1])
+if not member then
+	return false
+end
+redis.call("ZADD", KEYS[2], tonumber(ARGV[1]), member)
+local id = cjson.decode(member)["id"]
+local attempt = redis.call("HINCRBY", KEYS[3], id, 1)
+return {member, attempt}
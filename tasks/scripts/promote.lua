@@ -0,0 +1,13 @@
+-- 把到期的延迟任务和超过可见性超时仍未确认的任务移到就绪队列，返回移动的数量
+local now = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local moved = 0
+for _, key in ipairs({KEYS[1], KEYS[3]}) do
+	local due = redis.call("ZRANGEBYSCORE", key, "-inf", now, "LIMIT", 0, limit)
+	for _, member in ipairs(due) do
+		redis.call("ZREM", key, member)
+		redis.call("RPUSH", KEYS[2], member)
+	end
+	moved = moved + #due
+end
+return moved
@@ -0,0 +1,369 @@
+// Package tasks 基于 Redis 有序集合的延迟任务：Enqueue 指定执行的时间，各模块在 init 中通过 Handle 注册任务类型的处理函数，main 中 Start 启动执行
+//
+//	func init() {
+//		tasks.Handle("reminder:send", func(ctx context.Context, t *tasks.Task) error {
+//			var r Reminder
+//			if err := t.Decode(&r); err != nil {
+//				return err
+//			}
+//			return sendReminder(ctx, &r)
+//		})
+//	}
+//	task, err := tasks.NewTask("reminder:send", &Reminder{UserID: 1})
+//	err = tasks.Enqueue(ctx, task, time.Now().Add(24*time.Hour))
+//
+// 任务保存在 {tasks}:delayed 中，分数为执行的时间；每个实例每 poll_interval 把到期的任务移到就绪队列 {tasks}:ready，
+// 取出时放入 {tasks}:processing，处理成功后删除。处理失败、超时或实例崩溃（超过 visibility_timeout 没有确认）时重新执行，
+// 执行 max_attempts 次仍失败时移入 {tasks}:dead。同一个任务可能执行多次，处理函数应是幂等的
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+	"web_app/dao/redis"
+	"web_app/logger"
+	"web_app/settings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Config 延迟任务配置，对应配置文件中的 tasks，Start 时读取
+type Config struct {
+	// Concurrency 同时执行的任务数量
+	Concurrency int `mapstructure:"concurrency" validate:"min=1"`
+	// PollInterval 检查到期任务的间隔，也是就绪队列为空时等待的时间，任务实际执行的时间最多晚这么久
+	PollInterval time.Duration `mapstructure:"poll_interval" validate:"min=1ms"`
+	// Batch 每次最多移动的到期任务数
+	Batch int `mapstructure:"batch" validate:"min=1"`
+	// HandlerTimeout 每个任务的处理超时，必须小于 visibility_timeout，否则处理中的任务会被重新执行
+	HandlerTimeout time.Duration `mapstructure:"handler_timeout" validate:"min=1ms,ltfield=VisibilityTimeout"`
+	// VisibilityTimeout 任务取出后超过该时间没有确认（实例崩溃）时重新执行
+	VisibilityTimeout time.Duration `mapstructure:"visibility_timeout" validate:"min=1ms"`
+	// MaxAttempts 最多执行的次数（包括第一次），超过后移入 {tasks}:dead
+	MaxAttempts int `mapstructure:"max_attempts" validate:"min=1"`
+	// RetryBackoff、MaxRetryBackoff 失败后等待多久重试，按 RetryBackoff*2^(n-1) 增长，不超过 MaxRetryBackoff
+	RetryBackoff    time.Duration `mapstructure:"retry_backoff" validate:"min=0"`
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff" validate:"min=0"`
+}
+
+// 配置文件中的 key
+const configKey = "tasks"
+
+// 任务使用的 key（不包括 redis.key_prefix），hash tag 保证 cluster 中在同一个 slot，Lua 脚本和事务可以同时操作
+const (
+	delayedKey    = "{tasks}:delayed"
+	readyKey      = "{tasks}:ready"
+	processingKey = "{tasks}:processing"
+	attemptsKey   = "{tasks}:attempts"
+	deadKey       = "{tasks}:dead"
+)
+
+var defaults = Config{
+	Concurrency:       8,
+	PollInterval:      time.Second,
+	Batch:             100,
+	HandlerTimeout:    time.Minute,
+	VisibilityTimeout: 5 * time.Minute,
+	MaxAttempts:       5,
+	RetryBackoff:      10 * time.Second,
+	MaxRetryBackoff:   time.Hour,
+}
+
+var (
+	//go:embed scripts/promote.lua
+	promoteLua    string
+	promoteScript = redis.RegisterScript("tasks_promote", promoteLua)
+	//go:embed scripts/pop.lua
+	popLua    string
+	popScript = redis.RegisterScript("tasks_pop", popLua)
+)
+
+// Task 延迟执行的任务
+type Task struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempt 第几次执行，第一次为 1，只在处理函数中有值
+	Attempt int `json:"-"`
+}
+
+// NewTask 创建类型为 typ 的任务，payload 序列化为 JSON，处理函数中通过 Decode 解析
+func NewTask(typ string, payload interface{}) (t *Task, err error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	return &Task{Type: typ, Payload: b}, nil
+}
+
+// Decode 把任务的内容反序列化到 v 中
+func (t *Task) Decode(v interface{}) error {
+	return json.Unmarshal(t.Payload, v)
+}
+
+// Handler 任务的处理函数，返回 nil 时任务完成，返回错误或 panic 时按 retry_backoff 重试
+type Handler func(ctx context.Context, t *Task) error
+
+// executions 执行的任务数，result 为 ok、error、panic 或 dead（超过 max_attempts 移入 {tasks}:dead）
+var executions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tasks_executions_total",
+	Help: "Number of delayed task executions by type and result.",
+}, []string{"type", "result"})
+
+var (
+	mu       sync.Mutex
+	handlers = make(map[string]Handler)
+	svc      *service
+)
+
+func init() {
+	settings.Register(configKey, defaults)
+}
+
+// Handle 注册任务类型 typ 的处理函数，在 Start 之前（一般在 init 中）调用，重复注册或者 Start 之后注册时 panic；
+// 所有实例都应注册相同的任务类型，没有处理函数的任务按失败重试
+func Handle(typ string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	if svc != nil {
+		panic(fmt.Sprintf("tasks: Handle %q after Start", typ))
+	}
+	if _, ok := handlers[typ]; ok {
+		panic(fmt.Sprintf("tasks: duplicate handler for %q", typ))
+	}
+	handlers[typ] = h
+}
+
+// Enqueue 使用默认的 Redis 客户端添加任务，在 runAt 之后执行，runAt 已经过去时尽快执行；t.ID 为空时生成随机的 ID
+func Enqueue(ctx context.Context, t *Task, runAt time.Time) error {
+	client := redis.Client()
+	if client == nil {
+		return redis.ErrNotInitialized
+	}
+	if t.ID == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		t.ID = hex.EncodeToString(b)
+	}
+	member, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return client.ZAdd(ctx, redis.Key(delayedKey), goredis.Z{Score: float64(runAt.UnixMilli()), Member: member}).Err()
+}
+
+// EnqueueIn 添加任务，在 delay 之后执行，见 Enqueue
+func EnqueueIn(ctx context.Context, t *Task, delay time.Duration) error {
+	return Enqueue(ctx, t, time.Now().Add(delay))
+}
+
+// service 后台的执行 goroutine
+type service struct {
+	cfg    Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	log    *zap.Logger
+}
+
+// Start 读取 tasks 配置，在后台检查到期的任务并以 concurrency 个 goroutine 执行；没有注册处理函数时不执行
+func Start() error {
+	cfg, err := settings.Sub[Config](configKey)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if svc != nil {
+		return errors.New("tasks already started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	svc = &service{cfg: *cfg, cancel: cancel, log: logger.Named("tasks")}
+	if len(handlers) == 0 {
+		return nil
+	}
+	svc.wg.Add(1 + cfg.Concurrency)
+	go svc.poll(ctx)
+	for i := 0; i < cfg.Concurrency; i++ {
+		go svc.work(ctx)
+	}
+	return nil
+}
+
+// Shutdown 停止取出新的任务并等待正在执行的任务返回，ctx 结束时不再等待并返回 ctx 的错误；
+// 没有执行完的任务在 visibility_timeout 之后重新执行
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	s := svc
+	mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	s.cancel()
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poll 每 poll_interval 把到期的任务和可见性超时的任务移到就绪队列，一次移动了 batch 个时立即继续
+func (s *service) poll(ctx context.Context) {
+	defer s.wg.Done()
+	keys := []string{redis.Key(delayedKey), redis.Key(readyKey), redis.Key(processingKey)}
+	for ctx.Err() == nil {
+		n, err := promoteScript.Run(ctx, nil, keys, time.Now().UnixMilli(), s.cfg.Batch).Int()
+		if err != nil && ctx.Err() == nil {
+			s.log.Warn("promote due tasks failed", zap.Error(err))
+		}
+		if n < s.cfg.Batch {
+			sleep(ctx, s.cfg.PollInterval)
+		}
+	}
+}
+
+// work 循环取出就绪的任务并执行，队列为空时等待 poll_interval
+func (s *service) work(ctx context.Context) {
+	defer s.wg.Done()
+	keys := []string{redis.Key(readyKey), redis.Key(processingKey), redis.Key(attemptsKey)}
+	for ctx.Err() == nil {
+		deadline := time.Now().Add(s.cfg.VisibilityTimeout).UnixMilli()
+		res, err := popScript.Run(ctx, nil, keys, deadline).Slice()
+		if errors.Is(err, goredis.Nil) {
+			sleep(ctx, s.cfg.PollInterval)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log.Warn("pop task failed", zap.Error(err))
+				sleep(ctx, s.cfg.PollInterval)
+			}
+			continue
+		}
+		member, _ := res[0].(string)
+		attempt, _ := res[1].(int64)
+		s.execute(member, int(attempt))
+	}
+}
+
+// execute 执行一个任务并根据结果删除、重试或者移入死信队列，使用独立的 ctx，Shutdown 时不取消正在执行的任务
+func (s *service) execute(member string, attempt int) {
+	var t Task
+	if err := json.Unmarshal([]byte(member), &t); err != nil {
+		s.log.Error("decode task failed, moving to dead", zap.Error(err))
+		s.finish(member, t.ID, deadKey, 0)
+		return
+	}
+	t.Attempt = attempt
+	log := s.log.With(zap.String("type", t.Type), zap.String("id", t.ID), zap.Int("attempt", attempt))
+	if attempt > s.cfg.MaxAttempts {
+		// 执行中的实例崩溃导致次数超过上限，不再执行
+		s.moveToDead(log, member, &t)
+		return
+	}
+	err := s.run(&t)
+	if err == nil {
+		executions.WithLabelValues(t.Type, "ok").Inc()
+		s.finish(member, t.ID, "", 0)
+		return
+	}
+	log.Error("run task failed", zap.Error(err))
+	if attempt >= s.cfg.MaxAttempts {
+		s.moveToDead(log, member, &t)
+		return
+	}
+	s.finish(member, t.ID, delayedKey, s.backoff(attempt))
+}
+
+// run 调用处理函数，panic 时恢复并作为错误返回
+func (s *service) run(t *Task) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.HandlerTimeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			executions.WithLabelValues(t.Type, "panic").Inc()
+			s.log.Error("[Recovery from panic]", zap.String("type", t.Type), zap.String("id", t.ID),
+				zap.Any("error", p), zap.String("stack", string(debug.Stack())))
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	h := handlers[t.Type]
+	if h == nil {
+		executions.WithLabelValues(t.Type, "error").Inc()
+		return fmt.Errorf("no handler for task type %q", t.Type)
+	}
+	if err = h(ctx, t); err != nil {
+		executions.WithLabelValues(t.Type, "error").Inc()
+	}
+	return
+}
+
+func (s *service) moveToDead(log *zap.Logger, member string, t *Task) {
+	executions.WithLabelValues(t.Type, "dead").Inc()
+	log.Error("task moved to dead after max attempts", zap.Int("max_attempts", s.cfg.MaxAttempts))
+	s.finish(member, t.ID, deadKey, 0)
+}
+
+// finish 从 {tasks}:processing 中删除任务，to 为 delayedKey 时在 delay 之后重试，为 deadKey 时移入死信队列，为空时任务完成
+func (s *service) finish(member, id, to string, delay time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := redis.Client()
+	if client == nil {
+		return
+	}
+	_, err := client.TxPipelined(ctx, func(p goredis.Pipeliner) error {
+		p.ZRem(ctx, redis.Key(processingKey), member)
+		switch to {
+		case delayedKey:
+			p.ZAdd(ctx, redis.Key(delayedKey), goredis.Z{Score: float64(time.Now().Add(delay).UnixMilli()), Member: member})
+		case deadKey:
+			p.RPush(ctx, redis.Key(deadKey), member)
+			p.HDel(ctx, redis.Key(attemptsKey), id)
+		default:
+			p.HDel(ctx, redis.Key(attemptsKey), id)
+		}
+		return nil
+	})
+	if err != nil {
+		// 没有删除的任务在 visibility_timeout 之后重新执行
+		s.log.Warn("update task state failed", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// backoff 第 attempt 次失败之后等待的时间
+func (s *service) backoff(attempt int) time.Duration {
+	d := s.cfg.RetryBackoff
+	for i := 1; i < attempt && d < s.cfg.MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if s.cfg.MaxRetryBackoff > 0 && d > s.cfg.MaxRetryBackoff {
+		d = s.cfg.MaxRetryBackoff
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
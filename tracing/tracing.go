@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"sync/atomic"
+	"web_app/logger"
+	"web_app/settings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	provider *sdktrace.TracerProvider
+	enabled  atomic.Bool
+)
+
+// Init 按 tracing 配置初始化全局的 TracerProvider，tracing.endpoint 为空时不启用，otel.Tracer 返回的 tracer 不做任何事
+// 修改后需要重启服务
+func Init(cfg *settings.TracingConfig, app *settings.AppConfig) (err error) {
+	if cfg.Endpoint == "" {
+		return
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithHeaders(cfg.Headers)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.name", app.Name)}
+	if rev := logger.VCSRevision(); rev != "" {
+		attrs = append(attrs, attribute.String("service.version", rev))
+	}
+	if app.Env != "" {
+		attrs = append(attrs, attribute.String("deployment.environment", app.Env))
+	}
+	for k, v := range cfg.Resource {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+		// 有上游的 traceparent 时跟随上游的采样决定，否则按 sample_ratio 采样
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	enabled.Store(true)
+	return
+}
+
+// Enabled 是否启用了链路追踪
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Tracer 返回名为 name 的 tracer，没有启用时返回的 tracer 不做任何事
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Shutdown 发送缓冲区中的 span 并关闭 exporter，退出前调用
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
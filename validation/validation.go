@@ -0,0 +1,195 @@
+// Package validation 请求参数校验：在 gin 的 validator 上注册中文、英文的错误信息，字段名使用 json 标签，
+// Bind 绑定参数失败时按请求的 Accept-Language 翻译每个字段的错误，以统一的响应格式返回
+//
+//	var p models.ParamSignUp
+//	if !validation.Bind(c, &p) {
+//		return
+//	}
+//
+// 自定义的校验规则在模块的 init 中通过 RegisterValidation 注册，并给出各语言的错误信息，{0} 为字段名，{1} 为参数：
+//
+//	validation.RegisterValidation("username", usernameRule, map[string]string{
+//		"zh": "{0}只能包含字母、数字和下划线",
+//		"en": "{0} may only contain letters, digits and underscores",
+//	})
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"web_app/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	zhTranslations "github.com/go-playground/validator/v10/translations/zh"
+)
+
+// 支持的语言，app.locale 只能是其中之一
+const (
+	LocaleZh = "zh"
+	LocaleEn = "en"
+)
+
+// rule RegisterValidation 注册的校验规则
+type rule struct {
+	tag      string
+	fn       validator.Func
+	messages map[string]string
+}
+
+var (
+	mu            sync.Mutex
+	rules         []rule
+	messages      = make(map[string]map[string]string)
+	uni           *ut.UniversalTranslator
+	defaultLocale = LocaleZh
+)
+
+// RegisterValidation 注册自定义的校验规则 tag 和各语言的错误信息，在模块的 init 中调用
+func RegisterValidation(tag string, fn validator.Func, messages map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules = append(rules, rule{tag: tag, fn: fn, messages: messages})
+}
+
+// RegisterMessage 替换内置校验规则 tag 的错误信息，例如让 required 提示得更具体，在模块的 init 中调用
+func RegisterMessage(tag string, msgs map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+	messages[tag] = msgs
+}
+
+// Init 在 gin 的 validator 上注册翻译和自定义的校验规则，locale 为请求没有 Accept-Language 或者不支持时使用的语言
+func Init(locale string) (err error) {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("gin validator is not go-playground/validator")
+	}
+	// 错误中的字段名使用 json 标签，与请求中的一致
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	u := ut.New(en.New(), zh.New(), en.New())
+	zhTrans, _ := u.GetTranslator(LocaleZh)
+	enTrans, _ := u.GetTranslator(LocaleEn)
+	if err = zhTranslations.RegisterDefaultTranslations(v, zhTrans); err != nil {
+		return
+	}
+	if err = enTranslations.RegisterDefaultTranslations(v, enTrans); err != nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range rules {
+		if err = v.RegisterValidation(r.tag, r.fn); err != nil {
+			return fmt.Errorf("register validation %q: %w", r.tag, err)
+		}
+		if err = registerMessages(v, u, r.tag, r.messages); err != nil {
+			return
+		}
+	}
+	for tag, msgs := range messages {
+		if err = registerMessages(v, u, tag, msgs); err != nil {
+			return
+		}
+	}
+	if _, ok := u.GetTranslator(locale); !ok {
+		return fmt.Errorf("unsupported locale %q", locale)
+	}
+	uni, defaultLocale = u, locale
+	return nil
+}
+
+// registerMessages 注册 tag 在各语言中的错误信息，{0} 为字段名，{1} 为规则的参数
+func registerMessages(v *validator.Validate, u *ut.UniversalTranslator, tag string, msgs map[string]string) error {
+	for locale, msg := range msgs {
+		trans, ok := u.GetTranslator(locale)
+		if !ok {
+			return fmt.Errorf("validation %q: unsupported locale %q", tag, locale)
+		}
+		msg := msg
+		err := v.RegisterTranslation(tag, trans, func(t ut.Translator) error {
+			return t.Add(tag, msg, true)
+		}, func(t ut.Translator, fe validator.FieldError) string {
+			s, err := t.T(fe.Tag(), fe.Field(), fe.Param())
+			if err != nil {
+				return fe.Error()
+			}
+			return s
+		})
+		if err != nil {
+			return fmt.Errorf("validation %q: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// Translate 把校验错误翻译为字段（json 中的路径，例如 address.city）到错误信息的映射，
+// locales 为按优先级排列的语言，都不支持时使用 Init 的 locale；err 不是校验错误时返回 nil
+func Translate(err error, locales ...string) map[string]string {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) || uni == nil {
+		return nil
+	}
+	trans, ok := uni.FindTranslator(locales...)
+	if !ok {
+		trans, _ = uni.GetTranslator(defaultLocale)
+	}
+	fields := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		fields[fieldPath(fe)] = fe.Translate(trans)
+	}
+	return fields
+}
+
+// fieldPath Namespace 形如 ParamSignUp.re_password，去掉最外层的结构体名
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+// Bind 按 Content-Type 绑定请求参数（见 gin.Context.ShouldBind）并校验，失败时响应 400 和 invalid_param 并返回 false：
+// 校验失败时 data 为每个字段的错误信息，msg 为其中之一；请求体不是合法的 JSON 等其他错误时 msg 为错误本身
+func Bind(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBind(obj)
+	if err == nil {
+		return true
+	}
+	fields := Translate(err, acceptLanguages(c)...)
+	if len(fields) == 0 {
+		response.ErrorWithMsg(c, response.CodeInvalidParam, err.Error())
+		return false
+	}
+	var errs validator.ValidationErrors
+	errors.As(err, &errs)
+	response.ErrorWithData(c, response.CodeInvalidParam, fields[fieldPath(errs[0])], fields)
+	return false
+}
+
+// acceptLanguages Accept-Language 中的语言，例如 zh-CN,zh;q=0.9,en;q=0.8 为 zh、zh、en，按客户端给出的顺序
+func acceptLanguages(c *gin.Context) []string {
+	var locales []string
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		tag = strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if tag != "" && tag != "*" {
+			locales = append(locales, tag)
+		}
+	}
+	return locales
+}